@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"context"
+	"driver/domain"
+	"driver/domain/config"
+	"fmt"
+	"log"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const backfillTimeLayout = "2006-01-02 15:04:05"
+
+var (
+	backfillFromLt   uint64
+	backfillToLt     uint64
+	backfillFromTime string
+	backfillToTime   string
+	backfillToHash   string
+	backfillGaps     bool
+	backfillDryRun   bool
+)
+
+// backfillCmd represents the backfill command
+var backfillCmd = &cobra.Command{
+	Use:   "backfill",
+	Short: "Looks through a range of the treasury history again for missed requests",
+	Long: `Looks through a range of the treasury history again, and inserts the stake and unstake requests and the events
+missing from the database. Requests already stored are left as they are. The range is bounded by logical times or by times, e.g.
+'2024-01-02 15:04:05' in UTC, and at least a lower bound is needed. Instead of a range, '--gaps' back-fills the gaps
+found by the extraction, in the treasury history and in the driver wallet's, whose bounces and excesses are processed.
+Old transactions are only kept by archive liteservers, see 'archive_liteserver'.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ranges := make([]domain.BackfillRange, 0)
+		gaps := make([]domain.Gap, 0)
+		if !backfillGaps {
+			r, err := backfillRange()
+			if err != nil {
+				log.Fatalf("❌ %v\n", err.Error())
+			}
+			ranges = append(ranges, r)
+		}
+
+		backfillDependencyInject()
+		defer dbPool.Close()
+
+		var inboundGaps []domain.Gap
+		if backfillGaps {
+			var err error
+			gaps, err = memoInteractor.GetExtractionGaps()
+			if err != nil {
+				log.Fatalf("❌ %v\n", err.Error())
+			}
+			for _, gap := range gaps {
+				ranges = append(ranges, gapRange(gap))
+			}
+			inboundGaps, err = memoInteractor.GetInboundGaps()
+			if err != nil {
+				log.Fatalf("❌ %v\n", err.Error())
+			}
+			if len(ranges) == 0 && len(inboundGaps) == 0 {
+				fmt.Printf("No gap is found by the extraction.\n")
+				return
+			}
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		for i, r := range ranges {
+			result, err := backfillInteractor.Backfill(ctx, config.GetTreasuryAccountId(), r, backfillDryRun)
+			if result != nil {
+				printBackfillResult(result)
+			}
+			if err != nil {
+				log.Fatalf("❌ %v\n", err.Error())
+			}
+
+			if backfillGaps && !backfillDryRun {
+				err = memoInteractor.RemoveExtractionGap(gaps[i])
+				if err != nil {
+					log.Fatalf("❌ %v\n", err.Error())
+				}
+			}
+		}
+
+		// The bounces and excesses missed in the driver wallet transactions are processed too.
+		for _, gap := range inboundGaps {
+			result, err := backfillInteractor.BackfillInbound(ctx, gapRange(gap), backfillDryRun)
+			if result != nil {
+				printInboundBackfillResult(result)
+			}
+			if err != nil {
+				log.Fatalf("❌ %v\n", err.Error())
+			}
+
+			if !backfillDryRun {
+				err = memoInteractor.RemoveInboundGap(gap)
+				if err != nil {
+					log.Fatalf("❌ %v\n", err.Error())
+				}
+			}
+		}
+	},
+}
+
+// gapRange is the range to back-fill a gap found by the extraction, from the oldest transaction reached after it.
+func gapRange(gap domain.Gap) domain.BackfillRange {
+	return domain.BackfillRange{FromLt: gap.FromLt, ToLt: gap.ToLt, StartHash: gap.ToHash}
+}
+
+// backfillRange builds the range to back-fill from the flags.
+func backfillRange() (domain.BackfillRange, error) {
+	r := domain.BackfillRange{
+		FromLt:    backfillFromLt,
+		ToLt:      backfillToLt,
+		StartHash: backfillToHash,
+	}
+
+	var err error
+	if backfillFromTime != "" {
+		r.FromTime, err = time.ParseInLocation(backfillTimeLayout, backfillFromTime, time.UTC)
+		if err != nil {
+			return r, fmt.Errorf("invalid --from-time - %v", err.Error())
+		}
+	}
+	if backfillToTime != "" {
+		r.ToTime, err = time.ParseInLocation(backfillTimeLayout, backfillToTime, time.UTC)
+		if err != nil {
+			return r, fmt.Errorf("invalid --to-time - %v", err.Error())
+		}
+	}
+
+	if r.FromLt == 0 && r.FromTime.IsZero() {
+		return r, fmt.Errorf("a lower bound is needed, either --from-lt or --from-time")
+	}
+	if r.StartHash != "" && r.ToLt == 0 {
+		return r, fmt.Errorf("--to-hash needs --to-lt")
+	}
+	return r, nil
+}
+
+func printBackfillResult(result *domain.BackfillResult) {
+	verb := "Inserted"
+	if backfillDryRun {
+		verb = "Would insert"
+	}
+
+	for _, request := range result.StakeRequests {
+		fmt.Printf("%v stake - [ wallet: %v , hash: %v , time: %v ]\n", verb, request.Address, request.Hash, request.Info.Time.UTC().Format(backfillTimeLayout))
+	}
+	for _, request := range result.UnstakeRequests {
+		fmt.Printf("%v unstake - [ wallet: %v , hash: %v , time: %v ]\n", verb, request.Address, request.Hash, request.Info.Time.UTC().Format(backfillTimeLayout))
+	}
+	for _, request := range result.FailedRequests {
+		fmt.Printf("%v failed %v - [ sender: %v , hash: %v , time: %v ]\n", verb, request.Kind, failedSenderOf(request), request.Hash, request.ExecutedAt.UTC().Format(backfillTimeLayout))
+	}
+	fmt.Printf("✅ %v transaction(s) looked through, %v stake(s), %v unstake(s) and %v failure(s) missing, %v event(s) indexed\n",
+		result.Transactions, len(result.StakeRequests), len(result.UnstakeRequests), len(result.FailedRequests), result.Events)
+}
+
+func printInboundBackfillResult(result *domain.InboundBackfillResult) {
+	if backfillDryRun {
+		fmt.Printf("✅ %v driver wallet transaction(s) looked through, %v bounce(s) and excess(es) to process\n", result.Transactions, result.Returned)
+		return
+	}
+	fmt.Printf("✅ %v driver wallet transaction(s) looked through, %v bounce(s) and %v excess(es) processed\n",
+		result.Transactions, result.Bounces, result.Excesses)
+}
+
+func init() {
+	rootCmd.AddCommand(backfillCmd)
+
+	backfillCmd.Flags().Uint64Var(&backfillFromLt, "from-lt", 0, "the logical time of the oldest transaction to look through")
+	backfillCmd.Flags().Uint64Var(&backfillToLt, "to-lt", 0, "the logical time of the latest transaction to look through")
+	backfillCmd.Flags().StringVar(&backfillFromTime, "from-time", "", "the time of the oldest transaction to look through, in UTC")
+	backfillCmd.Flags().StringVar(&backfillToTime, "to-time", "", "the time of the latest transaction to look through, in UTC")
+	backfillCmd.Flags().StringVar(&backfillToHash, "to-hash", "", "the hash of the transaction at --to-lt, to start from it instead of the latest one")
+	backfillCmd.Flags().BoolVar(&backfillGaps, "gaps", false, "back-fill the gaps found by the extraction, of the treasury and the driver wallet")
+	backfillCmd.Flags().BoolVar(&backfillDryRun, "dry-run", false, "only report the missing requests, without inserting them")
+}
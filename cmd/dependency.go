@@ -2,9 +2,9 @@ package cmd
 
 import (
 	"database/sql"
-	"driver/domain"
 	"driver/domain/config"
 	"driver/infrastructure/dbhandler"
+	txemulator "driver/infrastructure/emulator"
 	"driver/interface/repository"
 	"driver/usecase"
 	"fmt"
@@ -17,17 +17,44 @@ import (
 	"github.com/tonkeeper/tongo/wallet"
 )
 
-func defaultDependencyInject() {
+func openDatabase() {
 	var err error
 	dbURI := config.GetDbUri()
-	dbPool, err = sql.Open("postgres", dbURI)
+	switch config.GetDbDriver() {
+	case config.SQLiteDriver:
+		dbPool, err = dbhandler.OpenSQLite(dbURI)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+	default:
+		dbPool, err = sql.Open("postgres", dbURI)
+		if err != nil {
+			log.Fatal(err)
+		}
+		dbPool.SetMaxOpenConns(20)
+		dbPool.SetMaxIdleConns(5)
+		dbPool.SetConnMaxIdleTime(1 * time.Minute)
+		dbPool.SetConnMaxLifetime(4 * time.Hour)
+	}
+}
+
+func newMigrator() *dbhandler.Migrator {
+	migrator, err := dbhandler.NewMigrator(dbPool, config.GetDbDriver())
 	if err != nil {
-		log.Fatal(err)
+		log.Fatalf("Unable to load migrations - %v\n", err.Error())
+	}
+	return migrator
+}
+
+func defaultDependencyInject() {
+	var err error
+	openDatabase()
+
+	err = newMigrator().Check()
+	if err != nil {
+		log.Fatalf("⛔️ Unable to use the database - %v\n", err.Error())
 	}
-	dbPool.SetMaxOpenConns(20)
-	dbPool.SetMaxIdleConns(5)
-	dbPool.SetConnMaxIdleTime(1 * time.Minute)
-	dbPool.SetConnMaxLifetime(4 * time.Hour)
 
 	dbHandler := dbhandler.DBHandler{DB: dbPool}
 
@@ -76,39 +103,211 @@ func defaultDependencyInject() {
 		log.Fatal("Unable to create tongo client: ", err)
 	}
 
-	driverWallet, err = wallet.New(config.GetDriverWalletPrivateKey(), wallet.V4R2, 0, nil, tongoClient)
+	chainClient = tongoClient
+
+	walletVersion := wallet.V4R2
+	if config.IsHighloadWallet() {
+		walletVersion = wallet.HighLoadV2R2
+	}
+
+	driverWallet, err = wallet.New(config.GetDriverWalletPrivateKey(), walletVersion, 0, nil, chainClient)
+	if err != nil {
+		log.Fatalf("Unable to connect to driver wallet - %v\n", err.Error())
+		return
+	}
+
+	var messengerWallet usecase.DriverWallet
+	if config.IsHighloadWallet() {
+		messengerWallet, err = usecase.NewHighloadWallet(chainClient, config.GetDriverWalletPrivateKey())
+	} else {
+		messengerWallet, err = usecase.NewSeqnoWallet(chainClient, config.GetDriverWalletPrivateKey())
+	}
 	if err != nil {
 		log.Fatalf("Unable to connect to driver wallet - %v\n", err.Error())
 		return
 	}
 
-	stakeRepository := repository.NewStakeRepository(dbHandler)
-	unstakeRepository := repository.NewUnstakeRepository(dbHandler)
-	memoRepository := repository.NewMemoRepository(dbHandler)
+	var emulator usecase.Emulator
+	if config.IsEmulationEnabled() {
+		emulator, err = txemulator.NewEmulator(tongoClient)
+		if err != nil {
+			log.Fatalf("Unable to create the emulator - %v\n", err.Error())
+			return
+		}
+	}
+
+	var stakeRepository usecase.StakeRepository
+	var unstakeRepository usecase.UnstakeRepository
+	var memoRepository usecase.MemoRepository
+	var outboxRepository usecase.OutboxRepository
+	var queryIdRepository usecase.QueryIdRepository
+	var spendRepository usecase.SpendRepository
+	var eventRepository usecase.EventRepository
+	var failureRepository usecase.FailureRepository
+	switch config.GetDbDriver() {
+	case config.SQLiteDriver:
+		stakeRepository = repository.NewSQLiteStakeRepository(dbHandler)
+		unstakeRepository = repository.NewSQLiteUnstakeRepository(dbHandler)
+		memoRepository = repository.NewSQLiteMemoRepository(dbHandler)
+		outboxRepository = repository.NewSQLiteOutboxRepository(dbHandler)
+		queryIdRepository = repository.NewSQLiteQueryIdRepository(dbHandler)
+		spendRepository = repository.NewSQLiteSpendRepository(dbHandler)
+		eventRepository = repository.NewSQLiteEventRepository(dbHandler)
+		failureRepository = repository.NewSQLiteFailureRepository(dbHandler)
+	default:
+		stakeRepository = repository.NewStakeRepository(dbHandler)
+		unstakeRepository = repository.NewUnstakeRepository(dbHandler)
+		memoRepository = repository.NewMemoRepository(dbHandler)
+		outboxRepository = repository.NewOutboxRepository(dbHandler)
+		queryIdRepository = repository.NewQueryIdRepository(dbHandler)
+		spendRepository = repository.NewSpendRepository(dbHandler)
+		eventRepository = repository.NewEventRepository(dbHandler)
+		failureRepository = repository.NewFailureRepository(dbHandler)
+	}
 
 	memoInteractor = usecase.NewMemoInteractor(memoRepository)
-	contractInteractor = usecase.NewContractInteractor(tongoClient)
-	stakeInteractor = usecase.NewStakeInteractor(tongoClient, memoInteractor, contractInteractor, stakeRepository, &driverWallet)
-	unstakeInteractor = usecase.NewUnstakeInteractor(tongoClient, memoInteractor, contractInteractor, unstakeRepository, &driverWallet)
-	extractInteractor = usecase.NewExtractInteractor(tongoClient, memoInteractor, contractInteractor, stakeInteractor, unstakeInteractor, &driverWallet)
-	verifyInteractor = usecase.NewVerifyInteractor(tongoClient, contractInteractor, stakeRepository, unstakeRepository)
+	contractInteractor = usecase.NewContractInteractor(chainClient)
+	feeInteractor = usecase.NewFeeInteractor(chainClient)
+	stakeInteractor = usecase.NewStakeInteractor(chainClient, memoInteractor, contractInteractor, feeInteractor, stakeRepository, queryIdRepository, &driverWallet)
+	unstakeInteractor = usecase.NewUnstakeInteractor(chainClient, memoInteractor, contractInteractor, feeInteractor, unstakeRepository, queryIdRepository, &driverWallet)
+	eventInteractor = usecase.NewEventInteractor(eventRepository)
+	failureInteractor = usecase.NewFailureInteractor(failureRepository)
 
-	messengerCh := make(chan domain.MessagePack, 10)
-	stakeCh := stakeInteractor.InitializeChannel(messengerCh)
-	unstakeCh := unstakeInteractor.InitializeChannel(messengerCh)
+	decoderRegistry = usecase.NewDecoderRegistry()
+	decoders := append([]usecase.Decoder{stakeInteractor.Decoder(), unstakeInteractor.Decoder()}, failureInteractor.Decoders()...)
+	for _, decoder := range decoders {
+		err = decoderRegistry.Register(decoder)
+		if err != nil {
+			log.Fatalf("⛔️ Unable to register the %v decoder - %v\n", decoder.Name, err.Error())
+		}
+	}
+
+	finalityInteractor = usecase.NewFinalityInteractor(tongoClient)
+	extractInteractor = usecase.NewExtractInteractor(chainClient, memoInteractor, contractInteractor, stakeInteractor, unstakeInteractor, eventInteractor, failureInteractor, decoderRegistry, finalityInteractor, &driverWallet)
+	streamInteractor = usecase.NewStreamInteractor(tongoClient, memoInteractor, extractInteractor, finalityInteractor)
+	verifyInteractor = usecase.NewVerifyInteractor(chainClient, contractInteractor, stakeRepository, unstakeRepository)
+
+	outboxInteractor = usecase.NewOutboxInteractor(outboxRepository)
+	stakeCh := stakeInteractor.InitializeChannel(outboxInteractor)
+	unstakeCh := unstakeInteractor.InitializeChannel(outboxInteractor)
+
+	spendInteractor = usecase.NewSpendInteractor(spendRepository)
+	balanceInteractor = usecase.NewBalanceInteractor(chainClient, messengerWallet)
+	messengerInteractor = usecase.NewMessengerInteractor(chainClient, messengerWallet, outboxInteractor, emulator, spendInteractor, balanceInteractor, stakeCh, unstakeCh)
+	inboundInteractor = usecase.NewInboundInteractor(chainClient, memoInteractor, outboxInteractor, feeInteractor, stakeRepository, unstakeRepository, messengerWallet)
+}
+
+// backfillDependencyInject prepares what the backfill command needs, which is what the driver needs along with a
+// client of an archive liteserver.
+func backfillDependencyInject() {
+	defaultDependencyInject()
+
+	archiveClient := chainClient
+	host, key := config.GetArchiveLiteserver()
+	if host != "" {
+		client, err := liteapi.NewClient(liteapi.WithLiteServers([]tconfig.LiteServer{{Host: host, Key: key}}))
+		if err != nil {
+			log.Fatal("Unable to create archive liteserver client: ", err)
+		}
+		archiveClient = client
+	} else {
+		log.Printf("❗️ No archive liteserver is configured, the history may not be kept by the default liteservers.\n")
+	}
+
+	backfillInteractor = usecase.NewBackfillInteractor(archiveClient, stakeInteractor, unstakeInteractor, eventInteractor, failureInteractor, decoderRegistry, finalityInteractor, inboundInteractor)
+}
+
+// spendDependencyInject prepares what the spend commands need, i.e. only the database.
+func spendDependencyInject() {
+	openDatabase()
+
+	err := newMigrator().Check()
+	if err != nil {
+		log.Fatalf("⛔️ Unable to use the database - %v\n", err.Error())
+	}
+
+	dbHandler := dbhandler.DBHandler{DB: dbPool}
+
+	var spendRepository usecase.SpendRepository
+	switch config.GetDbDriver() {
+	case config.SQLiteDriver:
+		spendRepository = repository.NewSQLiteSpendRepository(dbHandler)
+	default:
+		spendRepository = repository.NewSpendRepository(dbHandler)
+	}
+
+	spendInteractor = usecase.NewSpendInteractor(spendRepository)
+}
+
+// requestsDependencyInject prepares what the requests command needs, i.e. only the database.
+func requestsDependencyInject() {
+	openDatabase()
+
+	err := newMigrator().Check()
+	if err != nil {
+		log.Fatalf("⛔️ Unable to use the database - %v\n", err.Error())
+	}
+
+	dbHandler := dbhandler.DBHandler{DB: dbPool}
+
+	var stakeRepository usecase.StakeRepository
+	var unstakeRepository usecase.UnstakeRepository
+	switch config.GetDbDriver() {
+	case config.SQLiteDriver:
+		stakeRepository = repository.NewSQLiteStakeRepository(dbHandler)
+		unstakeRepository = repository.NewSQLiteUnstakeRepository(dbHandler)
+	default:
+		stakeRepository = repository.NewStakeRepository(dbHandler)
+		unstakeRepository = repository.NewUnstakeRepository(dbHandler)
+	}
+
+	requestInteractor = usecase.NewRequestInteractor(stakeRepository, unstakeRepository)
+}
+
+// failedDependencyInject prepares what the failed command needs, i.e. only the database.
+func failedDependencyInject() {
+	openDatabase()
+
+	err := newMigrator().Check()
+	if err != nil {
+		log.Fatalf("⛔️ Unable to use the database - %v\n", err.Error())
+	}
+
+	dbHandler := dbhandler.DBHandler{DB: dbPool}
+
+	var failureRepository usecase.FailureRepository
+	switch config.GetDbDriver() {
+	case config.SQLiteDriver:
+		failureRepository = repository.NewSQLiteFailureRepository(dbHandler)
+	default:
+		failureRepository = repository.NewFailureRepository(dbHandler)
+	}
 
-	messengerInteractor = usecase.NewMessengerInteractor(tongoClient, &driverWallet, messengerCh, stakeCh, unstakeCh)
+	failureInteractor = usecase.NewFailureInteractor(failureRepository)
 }
 
 var dbPool *sql.DB
 var tongoClient *liteapi.Client
+var chainClient usecase.ChainClient
 
 var memoInteractor *usecase.MemoInteractor
 var contractInteractor *usecase.ContractInteractor
+var feeInteractor *usecase.FeeInteractor
 var stakeInteractor *usecase.StakeInteractor
 var unstakeInteractor *usecase.UnstakeInteractor
+var eventInteractor *usecase.EventInteractor
+var failureInteractor *usecase.FailureInteractor
+var decoderRegistry *usecase.DecoderRegistry
+var finalityInteractor *usecase.FinalityInteractor
 var extractInteractor *usecase.ExtractInteractor
+var streamInteractor *usecase.StreamInteractor
 var verifyInteractor *usecase.VerifyInteractor
 
+var outboxInteractor *usecase.OutboxInteractor
 var messengerInteractor *usecase.MessengerInteractor
+var inboundInteractor *usecase.InboundInteractor
+var balanceInteractor *usecase.BalanceInteractor
+var spendInteractor *usecase.SpendInteractor
+var backfillInteractor *usecase.BackfillInteractor
+var requestInteractor *usecase.RequestInteractor
 var driverWallet wallet.Wallet
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"driver/domain"
+	"driver/domain/config"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tonkeeper/tongo"
+)
+
+var (
+	failedSince  time.Duration
+	failedSender string
+	failedLimit  int
+)
+
+// failedCmd represents the failed command
+var failedCmd = &cobra.Command{
+	Use:   "failed",
+	Short: "Lists the deposits and unstakes the treasury failed to process",
+	Long: `Lists the deposits and unstakes the treasury failed to process, the latest first, along with the exit code of
+the treasury transaction and whether the coins were bounced back. The failures of a user are listed by '--sender', which is
+the user's wallet for the deposits and the j-wallet for the unstakes.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		sender := ""
+		if failedSender != "" {
+			accountId, err := tongo.ParseAccountID(failedSender)
+			if err != nil {
+				log.Fatalf("❌ invalid --sender - %v\n", err.Error())
+			}
+			sender = accountId.ToHuman(true, config.IsTestNet())
+		}
+
+		failedDependencyInject()
+		defer dbPool.Close()
+
+		requests, err := failureInteractor.List(time.Now().Add(-failedSince), sender, failedLimit)
+		if err != nil {
+			log.Fatalf("❌ %v\n", err.Error())
+		}
+
+		for _, request := range requests {
+			fmt.Printf("%v %-7v - [ sender: %v , value: %v , exit code: %v , bounced: %v , hash: %v ]\n",
+				request.ExecutedAt.UTC().Format(backfillTimeLayout), request.Kind, failedSenderOf(*request), request.Value, request.ExitCode, request.Bounced, request.Hash)
+		}
+		if len(requests) == 0 {
+			fmt.Printf("No failed request is found.\n")
+		}
+	},
+}
+
+// failedSenderOf returns the sender of the failed request, or '-' if its in-message has no source.
+func failedSenderOf(request domain.FailedRequest) string {
+	if request.Sender == nil {
+		return "-"
+	}
+	return *request.Sender
+}
+
+func init() {
+	rootCmd.AddCommand(failedCmd)
+
+	failedCmd.Flags().DurationVar(&failedSince, "since", 24*time.Hour, "how far back to list the failures, e.g. 72h")
+	failedCmd.Flags().StringVar(&failedSender, "sender", "", "list the failures of the address, whenever they were")
+	failedCmd.Flags().IntVar(&failedLimit, "limit", 100, "the most failures to list")
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/spf13/cobra"
+)
+
+var migrateSteps int
+
+// migrateCmd represents the migrate command
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Manages the database schema",
+	Long:  `Manages the database schema using the migrations embedded in the driver. Use 'up', 'down', or 'status'.`,
+}
+
+var migrateUpCmd = &cobra.Command{
+	Use:   "up",
+	Short: "Applies all pending migrations",
+	Run: func(cmd *cobra.Command, args []string) {
+		openDatabase()
+		defer dbPool.Close()
+
+		applied, err := newMigrator().Up()
+		for _, m := range applied {
+			fmt.Printf("✅ Applied %04d_%v\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("❌ %v\n", err.Error())
+		}
+		if len(applied) == 0 {
+			fmt.Printf("Schema is up to date.\n")
+		}
+	},
+}
+
+var migrateDownCmd = &cobra.Command{
+	Use:   "down",
+	Short: "Reverts the latest applied migrations",
+	Run: func(cmd *cobra.Command, args []string) {
+		openDatabase()
+		defer dbPool.Close()
+
+		reverted, err := newMigrator().Down(migrateSteps)
+		for _, m := range reverted {
+			fmt.Printf("✅ Reverted %04d_%v\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("❌ %v\n", err.Error())
+		}
+		if len(reverted) == 0 {
+			fmt.Printf("No migration is applied.\n")
+		}
+	},
+}
+
+var migrateStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Lists the migrations and whether they are applied",
+	Run: func(cmd *cobra.Command, args []string) {
+		openDatabase()
+		defer dbPool.Close()
+
+		statuses, err := newMigrator().Status()
+		if err != nil {
+			log.Fatalf("❌ %v\n", err.Error())
+		}
+
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-30v %v\n", status.Version, status.Name, appliedAt)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(migrateCmd)
+	migrateCmd.AddCommand(migrateUpCmd)
+	migrateCmd.AddCommand(migrateDownCmd)
+	migrateCmd.AddCommand(migrateStatusCmd)
+
+	migrateDownCmd.Flags().IntVar(&migrateSteps, "steps", 1, "number of migrations to revert")
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"driver/domain/config"
+	"fmt"
+	"log"
+
+	"github.com/spf13/cobra"
+	"github.com/tonkeeper/tongo"
+)
+
+var (
+	requestsOwner string
+)
+
+// requestsCmd represents the requests command
+var requestsCmd = &cobra.Command{
+	Use:   "requests",
+	Short: "Lists the stake and unstake requests of a user",
+	Long: `Lists the stake and unstake requests of a user, the oldest first, along with their states. The user is given by
+'--owner', which is the user's wallet rather than the j-wallet.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if requestsOwner == "" {
+			log.Fatalf("❌ the owner is needed, --owner\n")
+		}
+		accountId, err := tongo.ParseAccountID(requestsOwner)
+		if err != nil {
+			log.Fatalf("❌ invalid --owner - %v\n", err.Error())
+		}
+		owner := accountId.ToHuman(true, config.IsTestNet())
+
+		requestsDependencyInject()
+		defer dbPool.Close()
+
+		stakes, unstakes, err := requestInteractor.FindByOwner(owner)
+		if err != nil {
+			log.Fatalf("❌ %v\n", err.Error())
+		}
+
+		for _, request := range stakes {
+			fmt.Printf("%v stake   - [ wallet: %v , round: %v , state: %v , hash: %v ]\n",
+				request.Info.Time.UTC().Format(backfillTimeLayout), request.Address, request.RoundSince, request.State, request.Hash)
+		}
+		for _, request := range unstakes {
+			fmt.Printf("%v unstake - [ wallet: %v , tokens: %v , state: %v , hash: %v ]\n",
+				request.Info.Time.UTC().Format(backfillTimeLayout), request.Address, &request.Tokens, request.State, request.Hash)
+		}
+		if len(stakes) == 0 && len(unstakes) == 0 {
+			fmt.Printf("No request of the owner is found.\n")
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(requestsCmd)
+
+	requestsCmd.Flags().StringVar(&requestsOwner, "owner", "", "the wallet of the user whose requests are listed")
+}
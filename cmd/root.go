@@ -13,7 +13,6 @@ import (
 )
 
 var cfgFile string
-var quit chan bool
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
@@ -53,8 +52,6 @@ func init() {
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 
 	exporter.Init()
-
-	quit = make(chan bool)
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"driver/domain"
+	"driver/domain/config"
+	"fmt"
+	"log"
+
+	"github.com/spf13/cobra"
+	"github.com/tonkeeper/tongo/tlb"
+)
+
+// spendCmd represents the spend command
+var spendCmd = &cobra.Command{
+	Use:   "spend",
+	Short: "Manages the spend caps of the driver wallet",
+	Long: `Manages the spend caps of the driver wallet. Once a cap is hit, the driver wallet is locked, and no more messages
+are sent until the lock is lifted. Use 'status' or 'lift'.`,
+}
+
+var spendStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Shows what is spent against the caps, and whether the driver wallet is locked",
+	Run: func(cmd *cobra.Command, args []string) {
+		spendDependencyInject()
+		defer dbPool.Close()
+
+		caps := []struct {
+			period string
+			limit  tlb.Grams
+		}{
+			{domain.SpendPeriodHour, config.GetMaxSpendPerHour()},
+			{domain.SpendPeriodDay, config.GetMaxSpendPerDay()},
+		}
+		for _, c := range caps {
+			spent, err := spendInteractor.Spent(c.period)
+			if err != nil {
+				log.Fatalf("❌ %v\n", err.Error())
+			}
+			limit := "no cap"
+			if c.limit > 0 {
+				limit = fmt.Sprintf("%v", c.limit)
+			}
+			fmt.Printf("%-5v spent: %v, cap: %v\n", c.period, spent, limit)
+		}
+
+		lock, err := spendInteractor.FindLatestLock()
+		if err != nil {
+			log.Fatalf("❌ %v\n", err.Error())
+		}
+		switch {
+		case lock == nil:
+			fmt.Printf("Driver wallet was never locked.\n")
+		case lock.LiftedAt == nil:
+			fmt.Printf("⛔️ Driver wallet is locked since %v for hitting the %v cap [spent: %v, cap: %v]\n",
+				lock.LockedAt.Format("2006-01-02 15:04:05"), lock.Period, lock.Spent, lock.Cap)
+		default:
+			fmt.Printf("Driver wallet is not locked, the latest lock was lifted at %v.\n", lock.LiftedAt.Format("2006-01-02 15:04:05"))
+		}
+	},
+}
+
+var spendLiftCmd = &cobra.Command{
+	Use:   "lift",
+	Short: "Lifts the lock of the driver wallet, so messages are sent again",
+	Long: `Lifts the lock of the driver wallet, so messages are sent again. Only what is spent after the lift counts
+against the caps. A running driver picks the lift up within a minute.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		spendDependencyInject()
+		defer dbPool.Close()
+
+		lifted, err := spendInteractor.Lift()
+		if err != nil {
+			log.Fatalf("❌ %v\n", err.Error())
+		}
+		for _, lock := range lifted {
+			fmt.Printf("✅ Lifted the lock of %v for hitting the %v cap [spent: %v, cap: %v]\n",
+				lock.LockedAt.Format("2006-01-02 15:04:05"), lock.Period, lock.Spent, lock.Cap)
+		}
+		if len(lifted) == 0 {
+			fmt.Printf("Driver wallet is not locked.\n")
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(spendCmd)
+	spendCmd.AddCommand(spendStatusCmd)
+	spendCmd.AddCommand(spendLiftCmd)
+}
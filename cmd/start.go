@@ -4,11 +4,12 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
-	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
@@ -23,7 +24,7 @@ import (
 var startCmd = &cobra.Command{
 	Use:   "start",
 	Short: "Starts driver's tasks",
-	Long:  `Starts driver's tasks. To stop it, run 'stop' command.`,
+	Long:  `Starts driver's tasks. To stop it gracefully, send SIGINT or SIGTERM.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		defaultDependencyInject()
 
@@ -32,68 +33,161 @@ var startCmd = &cobra.Command{
 			"Network:             %s\n"+
 			"Treasury wallet:     %v\n"+
 			"Driver Interval:     %v\n"+
+			"Extraction Mode:     %v\n"+
 			"Extractoin Interval: %v\n"+
 			"Stake Interval:      %v\n"+
 			"Unstake Interval:    %v\n"+
 			"Verify Interval:     %v\n"+
+			"Balance Interval:    %v\n"+
+			"Minimum Reserve:     %v\n"+
+			"Spend Cap per Hour:  %v\n"+
+			"Spend Cap per Day:   %v\n"+
 			"----------------------------------\n",
 			config.GetNetwork(),
 			config.GetTreasuryAddress(),
 			driverWallet.GetAddress().ToHuman(true, config.IsTestNet()),
+			config.GetExtractMode(),
 			config.GetExtractInterval(),
 			config.GetStakeInterval(),
 			config.GetUnstakeInterval(),
-			config.GetVerifyInterval())
-
-		config.GetTreasuryAddress()
-
-		extractTiker := schedule(extract, config.GetExtractInterval(), quit)
-		stakeTicker := schedule(stake, config.GetStakeInterval(), quit)
-		unstakeTicker := schedule(unstake, config.GetUnstakeInterval(), quit)
-		verifyTicker := schedule(verify, config.GetVerifyInterval(), quit)
+			config.GetVerifyInterval(),
+			config.GetBalanceInterval(),
+			config.GetMinReserve(),
+			config.GetMaxSpendPerHour(),
+			config.GetMaxSpendPerDay())
+
+		// ctx is cancelled on SIGINT or SIGTERM, which stops scheduling new tasks. Transfers already sent
+		// by the messenger are still waited on until sendCtx is cancelled at the shutdown deadline.
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		sendCtx, cancelSend := context.WithCancel(context.Background())
+		defer cancelSend()
+
+		// The balance is checked before anything is queued, so a wallet low on funds is not used at all.
+		balance(ctx)
+
+		var tasks sync.WaitGroup
+		schedule(ctx, &tasks, balance, config.GetBalanceInterval())
+		if config.IsStreamExtraction() {
+			follow(ctx, &tasks, stream, config.GetExtractInterval())
+		} else {
+			schedule(ctx, &tasks, extract, config.GetExtractInterval())
+		}
+		schedule(ctx, &tasks, stake, config.GetStakeInterval())
+		schedule(ctx, &tasks, unstake, config.GetUnstakeInterval())
+		schedule(ctx, &tasks, verify, config.GetVerifyInterval())
+		schedule(ctx, &tasks, inbound, config.GetExtractInterval())
 
-		go messengerInteractor.ListenOnChannel()
+		go messengerInteractor.ListenOnOutbox(sendCtx)
 
 		// Handle prometheus metrics
 		http.Handle("/metrics", promhttp.Handler())
 		go http.ListenAndServe(":2990", nil)
 
-		signal.Ignore()
-		stop := make(chan os.Signal, 1)
-		signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
-		s := <-stop
-		log.Printf("Got signal '%v', stopping", s)
+		<-ctx.Done()
+		log.Printf("Got stop signal, stopping [timeout: %v]", config.GetShutdownTimeout())
+
+		done := make(chan struct{})
+		go func() {
+			// Once the tasks are returned, nothing else is queued, so the outbox can be closed. Pending messages
+			// are left in the outbox for the next run. The listeners are done when the responses of all sent
+			// transfers are persisted.
+			tasks.Wait()
+			outboxInteractor.Close()
+			<-stakeInteractor.Done()
+			<-unstakeInteractor.Done()
+			close(done)
+		}()
+
+		deadline := time.AfterFunc(config.GetShutdownTimeout(), cancelSend)
+		defer deadline.Stop()
+
+		select {
+		case <-done:
+			log.Printf("Stopped gracefully")
+		case <-time.After(config.GetShutdownTimeout() + shutdownGrace):
+			log.Printf("🔴 stopping - timed out waiting for the running tasks")
+		}
 
-		extractTiker.Stop()
-		stakeTicker.Stop()
-		unstakeTicker.Stop()
-		verifyTicker.Stop()
+		dbPool.Close()
 	},
 }
 
-func schedule(task func(), interval time.Duration, done chan bool) *time.Ticker {
-	ticker := time.NewTicker(interval)
+// shutdownGrace is the extra time given after the shutdown deadline, for persisting the results of
+// the transfers which were being waited on.
+const shutdownGrace = 5 * time.Second
+
+// schedule runs the task periodically until the context is cancelled. A running task is not interrupted,
+// but it receives the context so it can return early.
+func schedule(ctx context.Context, tasks *sync.WaitGroup, task func(ctx context.Context), interval time.Duration) {
+	tasks.Add(1)
 	go func() {
+		defer tasks.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
 		for {
 			select {
 
 			case <-ticker.C:
 				ticker.Stop()
-				task()
+				task(ctx)
 				ticker.Reset(interval)
 
-			case <-done:
+			case <-ctx.Done():
 				return
 			}
 		}
 	}()
-	return ticker
 }
 
-func extract() {
+// follow runs the task over and over until the context is cancelled. A task which fails is run again after the
+// interval.
+func follow(ctx context.Context, tasks *sync.WaitGroup, task func(ctx context.Context) error, interval time.Duration) {
+	tasks.Add(1)
+	go func() {
+		defer tasks.Done()
+
+		for ctx.Err() == nil {
+			err := task(ctx)
+			if err == nil {
+				continue
+			}
+
+			select {
+			case <-time.After(interval):
+			case <-ctx.Done():
+			}
+		}
+	}()
+}
+
+func stream(ctx context.Context) error {
 	accountId := config.GetTreasuryAccountId()
 
-	extractResult, err := extractInteractor.Extract(accountId)
+	extractResult, err := streamInteractor.Next(ctx, accountId)
+	if err != nil {
+		if ctx.Err() == nil {
+			fmt.Printf("❌ No request is extracted: %v\n", err.Error())
+		}
+		return err
+	}
+
+	err = extractInteractor.Store(extractResult)
+	if err != nil {
+		fmt.Printf("❌ No request is stored: %v\n", err.Error())
+		return err
+	}
+
+	printOutWallets(extractResult)
+	return nil
+}
+
+func extract(ctx context.Context) {
+	accountId := config.GetTreasuryAccountId()
+
+	extractResult, err := extractInteractor.Extract(ctx, accountId)
 	if err != nil {
 		fmt.Printf("❌ No request is extracted: %v\n", err.Error())
 		return
@@ -108,44 +202,74 @@ func extract() {
 	printOutWallets(extractResult)
 }
 
-func stake() {
+func balance(ctx context.Context) {
+	balanceInteractor.Check(ctx)
+}
+
+func stake(ctx context.Context) {
+	// Requests are left untouched while the driver wallet is low on funds, so their retries are not consumed.
+	if balanceInteractor.IsLow() {
+		fmt.Printf("❌ Stake is paused, the driver wallet balance is below the reserve\n")
+		return
+	}
+
 	requests, err := stakeInteractor.LoadTriable()
 	if err != nil {
 		fmt.Printf("❌ Failed to load Stake requests - %v\n", err.Error())
 		return
 	}
 
-	stakeInteractor.SendStakeMessageToJettonWallets(requests)
+	stakeInteractor.SendStakeMessageToJettonWallets(ctx, requests)
 }
 
-func unstake() {
+func unstake(ctx context.Context) {
+	if balanceInteractor.IsLow() {
+		fmt.Printf("❌ Unstake is paused, the driver wallet balance is below the reserve\n")
+		return
+	}
+
 	requests, err := unstakeInteractor.LoadTriable()
 	if err != nil {
 		fmt.Printf("❌ Failed to send Withdraw message - %v\n", err.Error())
 		return
 	}
 
-	unstakeInteractor.SendWithdrawMessageToJettonWallets(requests)
+	unstakeInteractor.SendWithdrawMessageToJettonWallets(ctx, requests)
 }
 
-func verify() {
+func verify(ctx context.Context) {
 	stakeRequests, unstakeRequests, err := verifyInteractor.LoadVerifiable()
 	if err != nil {
 		fmt.Printf("❌ Failed to find verifiable reqcords - %v\n", err.Error())
 		return
 	}
 
-	err = verifyInteractor.VerifyStakeRequests(stakeRequests)
+	err = verifyInteractor.VerifyStakeRequests(ctx, stakeRequests)
 	if err != nil {
 		fmt.Printf("❌ Failed to verify stakes - %v\n", err.Error())
 	}
 
-	err = verifyInteractor.VerifyUnstakeRequests(unstakeRequests)
+	err = verifyInteractor.VerifyUnstakeRequests(ctx, unstakeRequests)
 	if err != nil {
 		fmt.Printf("❌ Failed to verify unstakes - %v\n", err.Error())
 	}
 }
 
+func inbound(ctx context.Context) {
+	bounces, excesses, err := inboundInteractor.Extract(ctx)
+	if err != nil {
+		fmt.Printf("❌ Failed to extract inbound messages - %v\n", err.Error())
+		return
+	}
+
+	if bounces > 0 {
+		fmt.Printf("❌ %v request(s) bounced\n", bounces)
+	}
+	if excesses > 0 {
+		fmt.Printf("%v excess(es) returned\n", excesses)
+	}
+}
+
 func printOutWallets(extractResult *domain.ExtractionResult) {
 
 	if len(extractResult.StakeRequests)+len(extractResult.UnstakeRequests) > 0 {
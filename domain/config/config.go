@@ -11,6 +11,7 @@ import (
 
 	"github.com/spf13/viper"
 	"github.com/tonkeeper/tongo"
+	"github.com/tonkeeper/tongo/tlb"
 	"github.com/tonkeeper/tongo/ton"
 	"github.com/tonkeeper/tongo/wallet"
 )
@@ -18,44 +19,104 @@ import (
 const (
 	MainNetwork = "mainnet"
 	TestNetwork = "testnet"
+
+	PostgresDriver = "postgres"
+	SQLiteDriver   = "sqlite"
+
+	DefaultShutdownTimeout = 30 * time.Second
+
+	DefaultFinalityDepth = 3
+
+	DefaultFeeMargin        = 20
+	DefaultMinAttachedValue = 50000000
+	DefaultMaxAttachedValue = 1000000000
+
+	DefaultMinReserve      = 1000000000
+	DefaultBalanceInterval = 1 * time.Minute
+
+	DefaultMaxSpendPerHour = 0
+	DefaultMaxSpendPerDay  = 0
+
+	WalletV4R2         = "v4r2"
+	WalletHighloadV2R2 = "highload_v2r2"
+
+	ExtractModePoll   = "poll"
+	ExtractModeStream = "stream"
 )
 
 var (
 	ErrorInvalidNetwork = fmt.Errorf("network must be equal to 'mainnet' or 'testnet' only")
 
-	ErrorNoMnemonic          = fmt.Errorf("no mnemonic is defined")
-	ErrorMnemonicConflict    = fmt.Errorf("only one of mnemonic or mnemonic_url must be defined")
-	ErrorReadingMnemonicFile = fmt.Errorf("error in reading mnemonic file")
+	ErrorNoMnemonic           = fmt.Errorf("no mnemonic is defined")
+	ErrorMnemonicConflict     = fmt.Errorf("only one of mnemonic or mnemonic_url must be defined")
+	ErrorReadingMnemonicFile  = fmt.Errorf("error in reading mnemonic file")
+	ErrorInvalidWalletVersion = fmt.Errorf("wallet_version must be equal to 'v4r2' or 'highload_v2r2' only")
 
+	ErrorInvalidExtractMode     = fmt.Errorf("extract_mode must be equal to 'poll' or 'stream' only")
 	ErrorInvalidExtractInterval = fmt.Errorf("invalid time interval for extract process")
+	ErrorInvalidFinalityDepth   = fmt.Errorf("finality_depth must not be negative")
 	ErrorInvalidStakeInterval   = fmt.Errorf("invalid time interval for stake process")
 	ErrorInvalidUnstakeInterval = fmt.Errorf("invalid time interval for unstake process")
 	ErrorInvalidVerifyInterval  = fmt.Errorf("invalid time interval for verify process")
+	ErrorInvalidShutdownTimeout = fmt.Errorf("invalid shutdown timeout")
+
+	ErrorInvalidFeeMargin        = fmt.Errorf("fee_margin must not be negative")
+	ErrorInvalidMinAttachedValue = fmt.Errorf("min_attached_value must be positive and not more than max_attached_value")
+	ErrorInvalidMaxAttachedValue = fmt.Errorf("max_attached_value must be positive")
+
+	ErrorInvalidMinReserve      = fmt.Errorf("min_reserve must not be negative")
+	ErrorInvalidBalanceInterval = fmt.Errorf("invalid time interval for balance check")
+
+	ErrorInvalidMaxSpendPerHour = fmt.Errorf("max_spend_per_hour must not be negative")
+	ErrorInvalidMaxSpendPerDay  = fmt.Errorf("max_spend_per_day must not be negative")
+
+	ErrorArchiveLiteserverKey = fmt.Errorf("archive_liteserver and archive_liteserver_key must be defined together")
 
 	ErrorInvalidTreausryAddress = fmt.Errorf("invalid treasury address")
 )
 
 var (
 	TrailingSlashRE = regexp.MustCompile("/+$")
+	SQLiteSchemeRE  = regexp.MustCompile("^sqlite:(//)?")
 )
 
 var (
-	dbUri   string
-	network string
+	dbUri    string
+	dbDriver string
+	network  string
 
 	mnemonic               string
 	mnemonic_url           string
 	driverWalletPrivateKey ed25519.PrivateKey
+	walletVersion          string
 
 	treasuryAddress   string
 	treasuryAccountId tongo.AccountID
 
+	extractMode     string
+	finalityDepth   uint32
 	extractInterval time.Duration
 	stakeInterval   time.Duration
 	unstakeInterval time.Duration
 	verifyInterval  time.Duration
+	shutdownTimeout time.Duration
 
 	maxRetry int
+
+	feeMargin        int
+	minAttachedValue tlb.Grams
+	maxAttachedValue tlb.Grams
+
+	emulateMessages bool
+
+	minReserve      tlb.Grams
+	balanceInterval time.Duration
+
+	maxSpendPerHour tlb.Grams
+	maxSpendPerDay  tlb.Grams
+
+	archiveLiteserver    string
+	archiveLiteserverKey string
 )
 
 func ReadConfig(filePath string) {
@@ -80,6 +141,12 @@ func initializeVariables() error {
 
 	// Database stuff
 	dbUri = TrailingSlashRE.ReplaceAllString(viper.GetString("service_db_uri"), "")
+	dbDriver = PostgresDriver
+	if SQLiteSchemeRE.MatchString(dbUri) {
+		// An sqlite uri points to the database file, e.g. 'sqlite://./driver.db'
+		dbDriver = SQLiteDriver
+		dbUri = SQLiteSchemeRE.ReplaceAllString(dbUri, "")
+	}
 
 	// Network stuff
 	network = strings.TrimSpace(strings.ToLower(viper.GetString("network")))
@@ -118,6 +185,35 @@ func initializeVariables() error {
 		return err
 	}
 
+	walletVersion = strings.TrimSpace(strings.ToLower(viper.GetString("wallet_version")))
+	if walletVersion == "" {
+		walletVersion = WalletV4R2
+	}
+	if walletVersion != WalletV4R2 && walletVersion != WalletHighloadV2R2 {
+		return ErrorInvalidWalletVersion
+	}
+
+	//---------------------------------------------------------------
+	// extract mode
+	extractMode = strings.TrimSpace(strings.ToLower(viper.GetString("extract_mode")))
+	if extractMode == "" {
+		extractMode = ExtractModePoll
+	}
+	if extractMode != ExtractModePoll && extractMode != ExtractModeStream {
+		return ErrorInvalidExtractMode
+	}
+
+	//---------------------------------------------------------------
+	// finality depth
+	finalityDepth = DefaultFinalityDepth
+	if viper.IsSet("finality_depth") {
+		value := viper.GetInt("finality_depth")
+		if value < 0 {
+			return ErrorInvalidFinalityDepth
+		}
+		finalityDepth = uint32(value)
+	}
+
 	//---------------------------------------------------------------
 	// extract interval
 	strValue := viper.GetString("extract_interval")
@@ -150,8 +246,100 @@ func initializeVariables() error {
 		return ErrorInvalidVerifyInterval
 	}
 
+	//---------------------------------------------------------------
+	// shutdown timeout
+	shutdownTimeout = DefaultShutdownTimeout
+	strValue = viper.GetString("shutdown_timeout")
+	if strValue != "" {
+		shutdownTimeout, err = time.ParseDuration(strValue)
+		if err != nil {
+			return ErrorInvalidShutdownTimeout
+		}
+	}
+
 	maxRetry = viper.GetInt("max_retry")
 
+	//---------------------------------------------------------------
+	// attached value of the messages
+	feeMargin = DefaultFeeMargin
+	if viper.IsSet("fee_margin") {
+		feeMargin = viper.GetInt("fee_margin")
+		if feeMargin < 0 {
+			return ErrorInvalidFeeMargin
+		}
+	}
+
+	maxAttachedValue = DefaultMaxAttachedValue
+	if viper.IsSet("max_attached_value") {
+		value := viper.GetInt64("max_attached_value")
+		if value <= 0 {
+			return ErrorInvalidMaxAttachedValue
+		}
+		maxAttachedValue = tlb.Grams(value)
+	}
+
+	minAttachedValue = DefaultMinAttachedValue
+	if viper.IsSet("min_attached_value") {
+		value := viper.GetInt64("min_attached_value")
+		if value <= 0 {
+			return ErrorInvalidMinAttachedValue
+		}
+		minAttachedValue = tlb.Grams(value)
+	}
+	if minAttachedValue > maxAttachedValue {
+		return ErrorInvalidMinAttachedValue
+	}
+
+	emulateMessages = viper.GetBool("emulate_messages")
+
+	//---------------------------------------------------------------
+	// driver wallet balance
+	minReserve = DefaultMinReserve
+	if viper.IsSet("min_reserve") {
+		value := viper.GetInt64("min_reserve")
+		if value < 0 {
+			return ErrorInvalidMinReserve
+		}
+		minReserve = tlb.Grams(value)
+	}
+
+	balanceInterval = DefaultBalanceInterval
+	strValue = viper.GetString("balance_interval")
+	if strValue != "" {
+		balanceInterval, err = time.ParseDuration(strValue)
+		if err != nil || balanceInterval <= 0 {
+			return ErrorInvalidBalanceInterval
+		}
+	}
+
+	//---------------------------------------------------------------
+	// spend caps
+	maxSpendPerHour = DefaultMaxSpendPerHour
+	if viper.IsSet("max_spend_per_hour") {
+		value := viper.GetInt64("max_spend_per_hour")
+		if value < 0 {
+			return ErrorInvalidMaxSpendPerHour
+		}
+		maxSpendPerHour = tlb.Grams(value)
+	}
+
+	maxSpendPerDay = DefaultMaxSpendPerDay
+	if viper.IsSet("max_spend_per_day") {
+		value := viper.GetInt64("max_spend_per_day")
+		if value < 0 {
+			return ErrorInvalidMaxSpendPerDay
+		}
+		maxSpendPerDay = tlb.Grams(value)
+	}
+
+	//---------------------------------------------------------------
+	// archive liteserver
+	archiveLiteserver = viper.GetString("archive_liteserver")
+	archiveLiteserverKey = viper.GetString("archive_liteserver_key")
+	if (archiveLiteserver == "") != (archiveLiteserverKey == "") {
+		return ErrorArchiveLiteserverKey
+	}
+
 	return nil
 }
 
@@ -178,6 +366,10 @@ func GetDbUri() string {
 	return dbUri
 }
 
+func GetDbDriver() string {
+	return dbDriver
+}
+
 func GetTreasuryAddress() string {
 	return treasuryAddress
 }
@@ -190,6 +382,16 @@ func GetNetwork() string {
 	return network
 }
 
+func GetExtractMode() string {
+	return extractMode
+}
+
+// GetFinalityDepth returns how many masterchain blocks a block must be behind the latest one, before the
+// transactions it commits to are extracted.
+func GetFinalityDepth() uint32 {
+	return finalityDepth
+}
+
 func GetExtractInterval() time.Duration {
 	return extractInterval
 }
@@ -206,17 +408,80 @@ func GetVerifyInterval() time.Duration {
 	return verifyInterval
 }
 
+func GetShutdownTimeout() time.Duration {
+	return shutdownTimeout
+}
+
 func GetMaxRetry() int {
 	return maxRetry
 }
 
+// GetFeeMargin returns the percentage added to the estimated fees of a message.
+func GetFeeMargin() int {
+	return feeMargin
+}
+
+// GetMinAttachedValue returns the least coins attached to a message, whatever the estimated fees are.
+func GetMinAttachedValue() tlb.Grams {
+	return minAttachedValue
+}
+
+// GetMaxAttachedValue returns the most coins attached to a message, whatever the estimated fees are.
+func GetMaxAttachedValue() tlb.Grams {
+	return maxAttachedValue
+}
+
+// GetMinReserve returns the balance of the driver wallet below which no more messages are queued.
+func GetMinReserve() tlb.Grams {
+	return minReserve
+}
+
+func GetBalanceInterval() time.Duration {
+	return balanceInterval
+}
+
+// GetMaxSpendPerHour returns the most nanotons the driver wallet may send out in an hour, or 0 if there is no cap.
+func GetMaxSpendPerHour() tlb.Grams {
+	return maxSpendPerHour
+}
+
+// GetMaxSpendPerDay returns the most nanotons the driver wallet may send out in a day, or 0 if there is no cap.
+func GetMaxSpendPerDay() tlb.Grams {
+	return maxSpendPerDay
+}
+
+// GetArchiveLiteserver returns the address and the public key of the liteserver keeping the whole history, used to
+// back-fill the treasury transactions. They are empty if no archive liteserver is configured.
+func GetArchiveLiteserver() (string, string) {
+	return archiveLiteserver, archiveLiteserverKey
+}
+
 func GetDriverWalletPrivateKey() ed25519.PrivateKey {
 	return driverWalletPrivateKey
 }
 
+func GetWalletVersion() string {
+	return walletVersion
+}
+
 // -------------------------------------------------------------------
 // Evaluating values
 
+func IsHighloadWallet() bool {
+	return walletVersion == WalletHighloadV2R2
+}
+
+// IsStreamExtraction tells whether the requests are extracted by following the blocks, instead of polling the
+// latest transactions of the treasury.
+func IsStreamExtraction() bool {
+	return extractMode == ExtractModeStream
+}
+
+// IsEmulationEnabled tells whether the driver messages are emulated before being sent.
+func IsEmulationEnabled() bool {
+	return emulateMessages
+}
+
 func IsTestNet() bool {
 	return strings.Compare(network, TestNetwork) == 0
 }
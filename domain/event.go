@@ -0,0 +1,40 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/tonkeeper/tongo/tlb"
+)
+
+// Event is a treasury transaction, whatever it is about, decoded and kept for auditing deposits, unstakes, loans
+// and failures. Source is nil if the in-message has no source, e.g. an external message.
+type Event struct {
+	Hash        string         `json:"hash"`
+	Lt          uint64         `json:"lt"`
+	ExecutedAt  time.Time      `json:"executed_at"`
+	Opcode      uint32         `json:"opcode"`
+	Source      *string        `json:"source"`
+	Value       tlb.Grams      `json:"value"`
+	Success     bool           `json:"success"`
+	Fees        EventFees      `json:"fees"`
+	OutMessages []EventMessage `json:"out_messages"`
+	CreatedAt   time.Time      `json:"created_at"`
+}
+
+// EventFees are the fees of a transaction, as HTransaction.Fees returns them.
+type EventFees struct {
+	Total   tlb.Grams `json:"total"`
+	Process tlb.Grams `json:"process"`
+	Storage tlb.Grams `json:"storage"`
+	InMsg   tlb.Grams `json:"in_msg"`
+	OutMsgs tlb.Grams `json:"out_msgs"`
+}
+
+// EventMessage is an out-message of a transaction. QueryId is nil if the body has no query id after the opcode.
+type EventMessage struct {
+	Opcode      uint32    `json:"opcode"`
+	QueryId     *uint64   `json:"query_id,omitempty"`
+	Destination string    `json:"destination"`
+	Value       tlb.Grams `json:"value"`
+	FwdFee      tlb.Grams `json:"fwd_fee"`
+}
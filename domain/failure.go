@@ -0,0 +1,27 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/tonkeeper/tongo/tlb"
+)
+
+const (
+	FailedRequestKindDeposit = "deposit"
+	FailedRequestKindUnstake = "unstake"
+)
+
+// FailedRequest is a deposit or an unstake the treasury failed to process, kept so a user asking about their coins can
+// be answered. Sender is nil if the in-message has no source. Bounced tells whether the coins were sent back.
+type FailedRequest struct {
+	Hash         string    `json:"hash"`
+	Lt           uint64    `json:"lt"`
+	ExecutedAt   time.Time `json:"executed_at"`
+	Kind         string    `json:"kind"`
+	Sender       *string   `json:"sender"`
+	Value        tlb.Grams `json:"value"`
+	ExitCode     int32     `json:"exit_code"`
+	Bounced      bool      `json:"bounced"`
+	FinalMcSeqno *uint32   `json:"final_mc_seqno"` // see ExtractionResult.FinalMcSeqno
+	CreatedAt    time.Time `json:"created_at"`
+}
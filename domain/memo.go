@@ -1,6 +1,11 @@
 package domain
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/tonkeeper/tongo"
+)
 
 type Memorable interface {
 	ToJson() string
@@ -12,8 +17,57 @@ type Memo struct {
 	Memo string `json:"memo"`
 }
 
+// ExtractionMemo keeps where looking through the transactions of an account stopped, and the gaps found in them.
+// Memos written before the logical time was kept have only the hash. The blocks are kept only when they are
+// followed, and memos written before the shard block id was kept have no shard block.
 type ExtractionMemo struct {
-	LatestProcessedHash string `json:"latest_processed_hash"`
+	LatestProcessedHash    string      `json:"latest_processed_hash"`
+	LatestProcessedLt      uint64      `json:"latest_processed_lt,omitempty"`
+	LatestMasterchainSeqno uint32      `json:"latest_masterchain_seqno,omitempty"`
+	LatestShardBlock       *ShardBlock `json:"latest_shard_block,omitempty"`
+	Gaps                   []Gap       `json:"gaps,omitempty"`
+}
+
+// ShardBlock identifies a block of a shard by its workchain, shard, seqno and hashes, as the masterchain refers to
+// it. The hashes are in hex.
+type ShardBlock struct {
+	Workchain int32  `json:"workchain"`
+	Shard     uint64 `json:"shard"`
+	Seqno     uint32 `json:"seqno"`
+	RootHash  string `json:"root_hash"`
+	FileHash  string `json:"file_hash"`
+}
+
+// Cursor identifies the latest processed transaction of an account by its logical time and hash. A zero cursor
+// means no transaction is processed yet.
+type Cursor struct {
+	Lt   uint64
+	Hash string
+}
+
+// BlockCursor identifies the latest processed masterchain block, and the latest processed block of the shard the
+// account is in. A zero cursor means no block is processed yet, and a zero shard block that it's not known.
+type BlockCursor struct {
+	MasterchainSeqno uint32
+	ShardBlock       tongo.BlockIDExt
+}
+
+// FinalBlock is the latest masterchain block deep enough to be final, along with the block of the account's shard it
+// commits to. The transactions of the account before EndLt are committed by it, or by an older masterchain block.
+type FinalBlock struct {
+	MasterchainSeqno uint32
+	ShardBlock       tongo.BlockIDExt
+	EndLt            uint64
+}
+
+// Gap is a part of the history of an account which could not be looked through, as the liteserver didn't return
+// it. The transactions after FromLt and before ToLt are missed. ToHash is the hash of the transaction at ToLt, the
+// oldest one reached, so the history before it can be paged through again.
+type Gap struct {
+	FromLt     uint64    `json:"from_lt"`
+	ToLt       uint64    `json:"to_lt"`
+	ToHash     string    `json:"to_hash"`
+	DetectedAt time.Time `json:"detected_at"`
 }
 
 func (obj *ExtractionMemo) ToJson() string {
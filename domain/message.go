@@ -12,6 +12,12 @@ const (
 	OpcodeWithdraw  = uint32(0x469bd91e)
 )
 
+// The coins attached to the messages when the network fees cannot be estimated.
+const (
+	DefaultStakeCoinAmount = tlb.Grams(150000000)
+	DefaultWithdrawAmount  = tlb.Grams(300000000)
+)
+
 type MessagePack struct {
 	Reference string
 	Message   Messagable
@@ -22,6 +28,7 @@ type MessagePack struct {
 
 type Messagable interface {
 	MakeMessage() *wallet.Message
+	QueryId() uint64
 }
 
 type TlbSaveCoinMessage struct {
@@ -55,11 +62,13 @@ type TlbWithdrawMessage struct {
 
 type StakeCoinMessage struct {
 	AccountId tongo.AccountID
+	Amount    tlb.Grams
 	TlbMsg    TlbStakeCoinMessage
 }
 
 type WithdrawMessage struct {
 	AccountId tongo.AccountID
+	Amount    tlb.Grams
 	TlbMsg    TlbWithdrawMessage
 }
 
@@ -69,7 +78,7 @@ func (msg StakeCoinMessage) MakeMessage() *wallet.Message {
 	tlb.Marshal(cell, msg.TlbMsg)
 
 	wmsg := wallet.Message{
-		Amount:  150000000,     //  tlb.Grams
+		Amount:  msg.Amount,    //  tlb.Grams
 		Address: msg.AccountId, //  tongo.AccountID
 		Body:    cell,          //  *boc.Cell
 		Code:    nil,           //  *boc.Cell
@@ -87,7 +96,7 @@ func (msg WithdrawMessage) MakeMessage() *wallet.Message {
 	tlb.Marshal(cell, msg.TlbMsg)
 
 	wmsg := wallet.Message{
-		Amount:  300000000,     //  tlb.Grams
+		Amount:  msg.Amount,    //  tlb.Grams
 		Address: msg.AccountId, //  tongo.AccountID
 		Body:    cell,          //  *boc.Cell
 		Code:    nil,           //  *boc.Cell
@@ -98,3 +107,11 @@ func (msg WithdrawMessage) MakeMessage() *wallet.Message {
 
 	return &wmsg
 }
+
+func (msg StakeCoinMessage) QueryId() uint64 {
+	return uint64(msg.TlbMsg.QuieryId)
+}
+
+func (msg WithdrawMessage) QueryId() uint64 {
+	return uint64(msg.TlbMsg.QuieryId)
+}
@@ -16,6 +16,41 @@ func NewHMessage(msg *tlb.Message) *HMessage {
 	}
 }
 
+// Hash returns the hash of the message cell.
+func (m *HMessage) Hash() tongo.Bits256 {
+	hash := m.msg.Hash()
+	if hash == (tlb.Bits256{}) {
+		// The message is not decoded from a cell, so build it.
+		cell := boc.NewCell()
+		if err := tlb.Marshal(cell, *m.msg); err == nil {
+			hash, _ = cell.Hash256()
+		}
+	}
+	return tongo.Bits256(hash)
+}
+
+// Raw returns the message itself.
+func (m *HMessage) Raw() tlb.Message {
+	return *m.msg
+}
+
+func (m *HMessage) IsExternalIn() bool {
+	return m.msg.Info.SumType == "ExtInMsgInfo"
+}
+
+// IsBounced reports whether the message is a bounce of a message which its destination rejected.
+func (m *HMessage) IsBounced() bool {
+	return m.msg.Info.IntMsgInfo != nil && m.msg.Info.IntMsgInfo.Bounced
+}
+
+func (m *HMessage) CreatedLt() uint64 {
+	var lt uint64
+	if m.msg.Info.IntMsgInfo != nil {
+		lt = m.msg.Info.IntMsgInfo.CreatedLt
+	}
+	return lt
+}
+
 func (m *HMessage) Opcode() uint32 {
 	body, _ := m.msg.Body.Value.MarshalJSON()
 	cell := boc.NewCell()
@@ -24,6 +59,28 @@ func (m *HMessage) Opcode() uint32 {
 	return uint32(opcode)
 }
 
+// Comment returns the text of the message if its body is a comment, i.e. the opcode 0 followed by the text in the
+// same cell.
+func (m *HMessage) Comment() (string, bool) {
+	cell := m.GetBody()
+	if cell.BitsAvailableForRead() < 32 {
+		return "", false
+	}
+	opcode, err := cell.ReadUint(32)
+	if err != nil || opcode != 0 {
+		return "", false
+	}
+	size := cell.BitsAvailableForRead()
+	if size%8 != 0 || cell.RefsAvailableForRead() > 0 {
+		return "", false
+	}
+	text, err := cell.ReadBytes(size / 8)
+	if err != nil {
+		return "", false
+	}
+	return string(text), true
+}
+
 func (m *HMessage) GetBody() *boc.Cell {
 	body, _ := m.msg.Body.Value.MarshalJSON()
 	cell := boc.NewCell()
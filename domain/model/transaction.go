@@ -116,6 +116,25 @@ func (t *HTransaction) IsSucceeded() bool {
 	return t.trans.Description.TransOrd.Action.Value.Value.Success
 }
 
+func (t *HTransaction) IsComputeSucceeded() bool {
+	computePh := t.trans.Description.TransOrd.ComputePh
+	return computePh.SumType == "TrPhaseComputeVm" && computePh.TrPhaseComputeVm.Success
+}
+
+// ExitCode returns the exit code of the compute phase, or the result code of the action phase if the compute
+// phase succeeded. Exit codes 0 and 1 mean success.
+func (t *HTransaction) ExitCode() int32 {
+	computePh := t.trans.Description.TransOrd.ComputePh
+	if computePh.SumType == "TrPhaseComputeVm" && computePh.TrPhaseComputeVm.Vm.ExitCode > 1 {
+		return computePh.TrPhaseComputeVm.Vm.ExitCode
+	}
+	action := t.trans.Description.TransOrd.Action
+	if action.Exists {
+		return action.Value.Value.ResultCode
+	}
+	return 0
+}
+
 func (t *HTransaction) GetInMessagesByOpcode(opcode uint32) *HMessage {
 	msg := t.InMessage()
 	op := msg.Opcode()
@@ -0,0 +1,36 @@
+package domain
+
+import (
+	"time"
+)
+
+const (
+	OutboxStatePending  = "pending"
+	OutboxStateSending  = "sending"
+	OutboxStateSent     = "sent"
+	OutboxStateFailed   = "failed"
+	OutboxStateBounced  = "bounced"
+	OutboxStateRejected = "rejected"
+
+	OutboxKindStake   = "stake"
+	OutboxKindUnstake = "unstake"
+)
+
+// OutboxMessage is an internal message waiting to be sent by the driver wallet, or already sent by it.
+// Once it's picked by a transfer, the transfer's id, hash, and expiry are kept along with it, so the transfer
+// can be looked up again if the driver stops before it's confirmed.
+type OutboxMessage struct {
+	Id           int64      `json:"id"`
+	Reference    string     `json:"reference"`
+	Kind         string     `json:"kind"`
+	Destination  string     `json:"destination"`
+	QueryId      uint64     `json:"query_id"`
+	Message      string     `json:"message"` // base64 encoded BOC of the internal message
+	Mode         uint8      `json:"mode"`
+	State        string     `json:"state"`
+	TransferId   *uint64    `json:"transfer_id"`
+	TransferHash *string    `json:"transfer_hash"`
+	ValidUntil   *time.Time `json:"valid_until"`
+	CreatedAt    time.Time  `json:"created_at"`
+	SentAt       *time.Time `json:"sent_at"`
+}
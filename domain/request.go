@@ -1,7 +1,10 @@
 package domain
 
 import (
+	"fmt"
 	"math/big"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/tonkeeper/tongo/tlb"
@@ -14,20 +17,66 @@ const (
 	RequestStateVerified  = "verified"
 	RequestStateRetriable = "retriable"
 	RequestStateSkipped   = "skipped"
+	RequestStateBounced   = "bounced"
+	RequestStateRejected  = "rejected"
 	RequestStateError     = "error"
 )
 
+var (
+	ErrorInvalidReference = fmt.Errorf("invalid stake request reference")
+)
+
 type StakeRequest struct {
-	Address    string           `json:"address"`
-	RoundSince uint32           `json:"round_since"`
-	Hash       string           `json:"hash"`
-	State      string           `json:"state"`
-	RetryCount int              `json:"retry_count"`
-	Info       StakeRelatedInfo `json:"info"`
-	CreatedAt  time.Time        `json:"created_at"`
-	RetriedAt  *time.Time       `json:"retried_at"`
-	SentAt     *time.Time       `json:"sent_at"`
-	VerifiedAt *time.Time       `json:"verified_at"`
+	Address      string           `json:"address"`
+	RoundSince   uint32           `json:"round_since"`
+	Hash         string           `json:"hash"`
+	MsgIndex     int              `json:"msg_index"`
+	FinalMcSeqno *uint32          `json:"final_mc_seqno"` // see ExtractionResult.FinalMcSeqno
+	Owner        *string          `json:"owner"`
+	State        string           `json:"state"`
+	RetryCount   int              `json:"retry_count"`
+	Info         StakeRelatedInfo `json:"info"`
+	CreatedAt    time.Time        `json:"created_at"`
+	RetriedAt    *time.Time       `json:"retried_at"`
+	SentAt       *time.Time       `json:"sent_at"`
+	VerifiedAt   *time.Time       `json:"verified_at"`
+	MessageHash  *string          `json:"message_hash"`
+	ExitCode     *int32           `json:"exit_code"`
+	Cost         *tlb.Grams       `json:"cost"`
+	Excess       *tlb.Grams       `json:"excess"`
+}
+
+// NetCost is what sending the message of the request cost the driver wallet, after the excess is returned.
+func (r *StakeRequest) NetCost() *big.Int {
+	return netCost(r.Cost, r.Excess)
+}
+
+// Reference identifies the request in the outbox and the excesses.
+func (r *StakeRequest) Reference() string {
+	return StakeReference(r.Hash, r.MsgIndex)
+}
+
+// StakeReference makes the reference of the stake request of a save_coin out-message, which is the hash of its
+// transaction, followed by the index of the message among the save_coin ones if it's not the first one. So the
+// references of the requests found before a transaction could have several of them are still the same.
+func StakeReference(hash string, msgIndex int) string {
+	if msgIndex == 0 {
+		return hash
+	}
+	return fmt.Sprintf("%v:%v", hash, msgIndex)
+}
+
+// ParseStakeReference returns the transaction hash and the save_coin message index of a stake request reference.
+func ParseStakeReference(reference string) (string, int, error) {
+	hash, index, found := strings.Cut(reference, ":")
+	if !found {
+		return reference, 0, nil
+	}
+	msgIndex, err := strconv.Atoi(index)
+	if err != nil || msgIndex <= 0 {
+		return "", 0, ErrorInvalidReference
+	}
+	return hash, msgIndex, nil
 }
 
 type StakeRelatedInfo struct {
@@ -37,16 +86,27 @@ type StakeRelatedInfo struct {
 }
 
 type UnstakeRequest struct {
-	Address    string             `json:"address"`
-	Tokens     big.Int            `json:"tokens"`
-	Hash       string             `json:"hash"`
-	State      string             `json:"state"`
-	RetryCount int                `json:"retry_count"`
-	Info       UnstakeRelatedInfo `json:"info"`
-	CreatedAt  time.Time          `json:"created_at"`
-	RetriedAt  *time.Time         `json:"retried_at"`
-	SentAt     *time.Time         `json:"sent_at"`
-	VerifiedAt *time.Time         `json:"verified_at"`
+	Address      string             `json:"address"`
+	Tokens       big.Int            `json:"tokens"`
+	Hash         string             `json:"hash"`
+	FinalMcSeqno *uint32            `json:"final_mc_seqno"` // see ExtractionResult.FinalMcSeqno
+	Owner        *string            `json:"owner"`
+	State        string             `json:"state"`
+	RetryCount   int                `json:"retry_count"`
+	Info         UnstakeRelatedInfo `json:"info"`
+	CreatedAt    time.Time          `json:"created_at"`
+	RetriedAt    *time.Time         `json:"retried_at"`
+	SentAt       *time.Time         `json:"sent_at"`
+	VerifiedAt   *time.Time         `json:"verified_at"`
+	MessageHash  *string            `json:"message_hash"`
+	ExitCode     *int32             `json:"exit_code"`
+	Cost         *tlb.Grams         `json:"cost"`
+	Excess       *tlb.Grams         `json:"excess"`
+}
+
+// NetCost is what sending the message of the request cost the driver wallet, after the excess is returned.
+func (r *UnstakeRequest) NetCost() *big.Int {
+	return netCost(r.Cost, r.Excess)
 }
 
 type UnstakeRelatedInfo struct {
@@ -55,7 +115,55 @@ type UnstakeRelatedInfo struct {
 	Hash  string    `json:"hash"`
 }
 
+func netCost(cost *tlb.Grams, excess *tlb.Grams) *big.Int {
+	result := big.NewInt(0)
+	if cost != nil {
+		result.SetUint64(uint64(*cost))
+	}
+	if excess != nil {
+		result.Sub(result, new(big.Int).SetUint64(uint64(*excess)))
+	}
+	return result
+}
+
+// ExtractionResult keeps what is found in the treasury transactions committed by a final masterchain block.
 type ExtractionResult struct {
+	// FinalMcSeqno is the seqno of a masterchain block the transactions are final as of, i.e. which commits to them
+	// or to a later block of their shard. In the stream mode, it's the masterchain block which commits to them first,
+	// but the polling extraction and the back-fill look through several blocks at once, so it's the final masterchain
+	// block at the time, which may be a few blocks after the one committing to them.
+	FinalMcSeqno    uint32
 	StakeRequests   []StakeRequest
 	UnstakeRequests []UnstakeRequest
+	FailedRequests  []FailedRequest
+	Events          []Event
+}
+
+// BackfillRange bounds the treasury transactions to back-fill, both ends included. Zero bounds are open. If StartHash
+// is given, the transactions are paged back from the one at ToLt with that hash, instead of from the latest one.
+type BackfillRange struct {
+	FromLt    uint64
+	ToLt      uint64
+	FromTime  time.Time
+	ToTime    time.Time
+	StartHash string
+}
+
+// BackfillResult tells how many transactions are looked through by a back-fill, the requests and the failed requests
+// found in them which were missing from the database, and how many events are indexed.
+type BackfillResult struct {
+	Transactions    int
+	StakeRequests   []StakeRequest
+	UnstakeRequests []UnstakeRequest
+	FailedRequests  []FailedRequest
+	Events          int
+}
+
+// InboundBackfillResult tells how many driver wallet transactions are looked through by a back-fill, and how many
+// bounces and excesses are processed in them, or how many there are to process on a dry run.
+type InboundBackfillResult struct {
+	Transactions int
+	Bounces      int
+	Excesses     int
+	Returned     int
 }
@@ -0,0 +1,23 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/tonkeeper/tongo/tlb"
+)
+
+const (
+	SpendPeriodHour = "hour"
+	SpendPeriodDay  = "day"
+)
+
+// SpendLock is recorded when the driver wallet hits a spend cap. No transfer is sent while a lock is active, i.e.
+// until an operator lifts it.
+type SpendLock struct {
+	Id       int64      `json:"id"`
+	Period   string     `json:"period"`
+	Spent    tlb.Grams  `json:"spent"`
+	Cap      tlb.Grams  `json:"cap"`
+	LockedAt time.Time  `json:"locked_at"`
+	LiftedAt *time.Time `json:"lifted_at"`
+}
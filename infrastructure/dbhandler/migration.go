@@ -0,0 +1,299 @@
+package dbhandler
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+var (
+	ErrorUnknownDialect     = fmt.Errorf("no migrations for this database driver")
+	ErrorInvalidMigration   = fmt.Errorf("invalid migration file name")
+	ErrorSchemaOutOfDate    = fmt.Errorf("database schema is out of date, run 'migrate up' first")
+	ErrorSchemaNewer        = fmt.Errorf("database schema is newer than this driver")
+	ErrorIrreversibleChange = fmt.Errorf("migration has no down script")
+)
+
+const (
+	createMigrationsTable = `
+	create table if not exists schema_migrations
+	(
+		version     bigint      not null,
+		name        text        not null,
+		applied_at  timestamp   not null,
+
+		primary key (version)
+	)
+`
+	selectAppliedMigrations = `select version, applied_at from schema_migrations order by version`
+)
+
+// Migration is a versioned change of the database schema. Migrations are kept as embedded files named
+// like 'migrations/<driver>/0001_initial.up.sql' and the matching '.down.sql'.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus reports whether a migration is applied on the database, and when.
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrator applies the embedded migrations of a database driver, keeping track of them in the
+// schema_migrations table.
+type Migrator struct {
+	db         *sql.DB
+	driver     string
+	migrations []Migration
+}
+
+func NewMigrator(db *sql.DB, driver string) (*Migrator, error) {
+	migrations, err := loadMigrations(driver)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		db:         db,
+		driver:     driver,
+		migrations: migrations,
+	}, nil
+}
+
+func loadMigrations(driver string) ([]Migration, error) {
+	dir := path.Join("migrations", driver)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, ErrorUnknownDialect
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		fileName := entry.Name()
+
+		var direction string
+		switch {
+		case strings.HasSuffix(fileName, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(fileName, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("%w: %v", ErrorInvalidMigration, fileName)
+		}
+
+		base := strings.TrimSuffix(fileName, "."+direction+".sql")
+		versionPart, name, found := strings.Cut(base, "_")
+		if !found {
+			return nil, fmt.Errorf("%w: %v", ErrorInvalidMigration, fileName)
+		}
+		version, err := strconv.ParseInt(versionPart, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrorInvalidMigration, fileName)
+		}
+
+		content, err := migrationFiles.ReadFile(path.Join(dir, fileName))
+		if err != nil {
+			return nil, err
+		}
+
+		m, exist := byVersion[version]
+		if !exist {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	result := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("%w: version %v has no up script", ErrorInvalidMigration, m.Version)
+		}
+		result = append(result, *m)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Version < result[j].Version
+	})
+
+	return result, nil
+}
+
+// LatestVersion returns the version of the newest embedded migration.
+func (migrator *Migrator) LatestVersion() int64 {
+	if len(migrator.migrations) == 0 {
+		return 0
+	}
+	return migrator.migrations[len(migrator.migrations)-1].Version
+}
+
+// Status lists all embedded migrations along with the time they were applied, if they are.
+func (migrator *Migrator) Status() ([]MigrationStatus, error) {
+	applied, err := migrator.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]MigrationStatus, 0, len(migrator.migrations))
+	for _, m := range migrator.migrations {
+		status := MigrationStatus{Migration: m}
+		if appliedAt, exist := applied[m.Version]; exist {
+			status.AppliedAt = &appliedAt
+		}
+		result = append(result, status)
+	}
+
+	return result, nil
+}
+
+// Check returns an error if there are pending migrations, or if the database has migrations applied which
+// this driver doesn't know about.
+func (migrator *Migrator) Check() error {
+	applied, err := migrator.applied()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrator.migrations {
+		if _, exist := applied[m.Version]; !exist {
+			return ErrorSchemaOutOfDate
+		}
+	}
+
+	for version := range applied {
+		if version > migrator.LatestVersion() {
+			return ErrorSchemaNewer
+		}
+	}
+
+	return nil
+}
+
+// Up applies all pending migrations in order, each one in its own transaction, and returns the applied ones.
+func (migrator *Migrator) Up() ([]Migration, error) {
+	applied, err := migrator.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Migration, 0)
+	for _, m := range migrator.migrations {
+		if _, exist := applied[m.Version]; exist {
+			continue
+		}
+
+		err = migrator.run(m.Up, migrator.insertVersionQuery(), m.Version, m.Name, time.Now())
+		if err != nil {
+			return result, fmt.Errorf("migration %04d_%v failed: %w", m.Version, m.Name, err)
+		}
+		result = append(result, m)
+	}
+
+	return result, nil
+}
+
+// Down reverts up to the given number of the latest applied migrations, and returns the reverted ones.
+func (migrator *Migrator) Down(steps int) ([]Migration, error) {
+	applied, err := migrator.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Migration, 0)
+	for i := len(migrator.migrations) - 1; i >= 0 && len(result) < steps; i-- {
+		m := migrator.migrations[i]
+		if _, exist := applied[m.Version]; !exist {
+			continue
+		}
+		if m.Down == "" {
+			return result, fmt.Errorf("%w: %04d_%v", ErrorIrreversibleChange, m.Version, m.Name)
+		}
+
+		err = migrator.run(m.Down, migrator.deleteVersionQuery(), m.Version)
+		if err != nil {
+			return result, fmt.Errorf("reverting migration %04d_%v failed: %w", m.Version, m.Name, err)
+		}
+		result = append(result, m)
+	}
+
+	return result, nil
+}
+
+// run executes a migration script and records it in the same transaction, so a failed migration leaves
+// nothing behind.
+func (migrator *Migrator) run(script string, query string, args ...interface{}) error {
+	tx, err := migrator.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(script)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (migrator *Migrator) applied() (map[int64]time.Time, error) {
+	_, err := migrator.db.Exec(createMigrationsTable)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := migrator.db.Query(selectAppliedMigrations)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		err = rows.Scan(&version, &appliedAt)
+		if err != nil {
+			return nil, err
+		}
+		result[version] = appliedAt
+	}
+
+	return result, rows.Err()
+}
+
+func (migrator *Migrator) insertVersionQuery() string {
+	if migrator.driver == "sqlite" {
+		return `insert into schema_migrations (version, name, applied_at) values (?1, ?2, ?3)`
+	}
+	return `insert into schema_migrations (version, name, applied_at) values ($1, $2, $3)`
+}
+
+func (migrator *Migrator) deleteVersionQuery() string {
+	if migrator.driver == "sqlite" {
+		return `delete from schema_migrations where version = ?1`
+	}
+	return `delete from schema_migrations where version = $1`
+}
@@ -0,0 +1,222 @@
+package dbhandler
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	db, err := OpenSQLite(filepath.Join(t.TempDir(), "driver.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	var count int
+	err := db.QueryRow(`select count(*) from sqlite_master where type = 'table' and name = ?1`, name).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return count > 0
+}
+
+func versions(migrations []Migration) []int64 {
+	result := make([]int64, 0, len(migrations))
+	for _, m := range migrations {
+		result = append(result, m.Version)
+	}
+	return result
+}
+
+func TestLoadMigrations(t *testing.T) {
+	for _, driver := range []string{"postgres", "sqlite"} {
+		t.Run(driver, func(t *testing.T) {
+			migrations, err := loadMigrations(driver)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(migrations) == 0 || migrations[0].Version != 1 {
+				t.Fatalf("loaded versions %v, want them from 1", versions(migrations))
+			}
+			for i := 1; i < len(migrations); i++ {
+				if migrations[i].Version <= migrations[i-1].Version {
+					t.Fatalf("loaded versions %v, want them in order", versions(migrations))
+				}
+				if migrations[i].Down == "" {
+					t.Fatalf("migration %04d_%v has no down script", migrations[i].Version, migrations[i].Name)
+				}
+			}
+		})
+	}
+
+	_, err := loadMigrations("mysql")
+	if !errors.Is(err, ErrorUnknownDialect) {
+		t.Fatalf("loading an unknown dialect returned %v, want ErrorUnknownDialect", err)
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	tests := []struct {
+		name       string
+		migrations []Migration
+		run        func(t *testing.T, migrator *Migrator)
+	}{
+		{
+			name: "applies in order",
+			migrations: []Migration{
+				{Version: 1, Name: "first", Up: `create table a (id integer)`},
+				{Version: 2, Name: "second", Up: `alter table a add column name text`, Down: `alter table a drop column name`},
+				{Version: 5, Name: "third", Up: `create index a_name_idx on a (name)`, Down: `drop index a_name_idx`},
+			},
+			run: func(t *testing.T, migrator *Migrator) {
+				applied, err := migrator.Up()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := versions(applied); len(got) != 3 || got[0] != 1 || got[1] != 2 || got[2] != 5 {
+					t.Fatalf("applied versions %v, want 1, 2 and 5", got)
+				}
+				applied, err = migrator.Up()
+				if err != nil || len(applied) != 0 {
+					t.Fatalf("applied %v again, want none", versions(applied))
+				}
+				if err = migrator.Check(); err != nil {
+					t.Fatalf("checking an up to date schema returned %v", err)
+				}
+			},
+		},
+		{
+			name: "rolls back a failed migration",
+			migrations: []Migration{
+				{Version: 1, Name: "first", Up: `create table a (id integer)`},
+				{Version: 2, Name: "broken", Up: `create table b (id integer); insert into missing values (1);`, Down: `drop table b`},
+			},
+			run: func(t *testing.T, migrator *Migrator) {
+				applied, err := migrator.Up()
+				if err == nil {
+					t.Fatal("applied a broken migration")
+				}
+				if got := versions(applied); len(got) != 1 || got[0] != 1 {
+					t.Fatalf("applied versions %v, want only 1", got)
+				}
+				if tableExists(t, migrator.db, "b") {
+					t.Fatal("the failed migration left its table behind")
+				}
+				if err = migrator.Check(); !errors.Is(err, ErrorSchemaOutOfDate) {
+					t.Fatalf("checking returned %v, want ErrorSchemaOutOfDate", err)
+				}
+			},
+		},
+		{
+			name: "schema out of date",
+			migrations: []Migration{
+				{Version: 1, Name: "first", Up: `create table a (id integer)`},
+			},
+			run: func(t *testing.T, migrator *Migrator) {
+				if err := migrator.Check(); !errors.Is(err, ErrorSchemaOutOfDate) {
+					t.Fatalf("checking an empty database returned %v, want ErrorSchemaOutOfDate", err)
+				}
+			},
+		},
+		{
+			name: "schema newer",
+			migrations: []Migration{
+				{Version: 1, Name: "first", Up: `create table a (id integer)`},
+			},
+			run: func(t *testing.T, migrator *Migrator) {
+				_, err := migrator.Up()
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, err = migrator.db.Exec(migrator.insertVersionQuery(), 2, "unknown", "2024-01-02 15:04:05")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err = migrator.Check(); !errors.Is(err, ErrorSchemaNewer) {
+					t.Fatalf("checking returned %v, want ErrorSchemaNewer", err)
+				}
+			},
+		},
+		{
+			name: "down stops at an irreversible migration",
+			migrations: []Migration{
+				{Version: 1, Name: "first", Up: `create table a (id integer)`},
+				{Version: 2, Name: "second", Up: `create table b (id integer)`, Down: `drop table b`},
+			},
+			run: func(t *testing.T, migrator *Migrator) {
+				_, err := migrator.Up()
+				if err != nil {
+					t.Fatal(err)
+				}
+				reverted, err := migrator.Down(2)
+				if !errors.Is(err, ErrorIrreversibleChange) {
+					t.Fatalf("reverting returned %v, want ErrorIrreversibleChange", err)
+				}
+				if got := versions(reverted); len(got) != 1 || got[0] != 2 {
+					t.Fatalf("reverted versions %v, want only 2", got)
+				}
+				if tableExists(t, migrator.db, "b") || !tableExists(t, migrator.db, "a") {
+					t.Fatal("want only the table of the first migration left")
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			migrator := &Migrator{db: openTestDB(t), driver: "sqlite", migrations: test.migrations}
+			test.run(t, migrator)
+		})
+	}
+}
+
+// TestSQLiteMigrations runs the embedded SQLite migrations all the way up and back down to 0001, which has no down
+// script, and up again.
+func TestSQLiteMigrations(t *testing.T) {
+	db := openTestDB(t)
+	migrator, err := NewMigrator(db, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := migrator.Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != len(migrator.migrations) {
+		t.Fatalf("applied %v migrations, want all %v", len(applied), len(migrator.migrations))
+	}
+	if err = migrator.Check(); err != nil {
+		t.Fatal(err)
+	}
+
+	reverted, err := migrator.Down(len(migrator.migrations))
+	if !errors.Is(err, ErrorIrreversibleChange) {
+		t.Fatalf("reverting all returned %v, want ErrorIrreversibleChange at 0001", err)
+	}
+	if len(reverted) != len(migrator.migrations)-1 {
+		t.Fatalf("reverted %v migrations, want all but 0001", len(reverted))
+	}
+	status, err := migrator.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range status {
+		if (s.AppliedAt != nil) != (s.Version == 1) {
+			t.Fatalf("migration %04d_%v applied at %v, want only 0001 applied", s.Version, s.Name, s.AppliedAt)
+		}
+	}
+
+	applied, err = migrator.Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != len(migrator.migrations)-1 {
+		t.Fatalf("applied %v migrations again, want all but 0001", len(applied))
+	}
+}
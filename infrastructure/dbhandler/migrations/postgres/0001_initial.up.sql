@@ -1,8 +1,4 @@
-begin;
-
-CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
-
-create table stakes
+create table if not exists stakes
 (
     address       text        not null,
     round_since   bigint      not null,
@@ -18,7 +14,7 @@ create table stakes
     primary key (hash)
 );
 
-create table unstakes
+create table if not exists unstakes
 (
     address       text        not null,
     tokens        numeric(40) not null,
@@ -30,11 +26,11 @@ create table unstakes
     retried_at    timestamptz,
     sent_at       timestamptz,
     verified_at   timestamptz,
-    
+
     primary key (hash)
 );
 
-create table memos
+create table if not exists memos
 (
     key     text    not null,
     memo    jsonb   not null,
@@ -0,0 +1,20 @@
+create table if not exists outbox
+(
+    id            bigserial   not null,
+    reference     text        not null,
+    kind          text        not null,
+    destination   text        not null,
+    query_id      bigint      not null,
+    message       text        not null,
+    mode          smallint    not null,
+    state         text        not null,
+    transfer_id   bigint,
+    valid_until   timestamptz,
+    created_at    timestamptz not null,
+    sent_at       timestamptz,
+
+    primary key (id)
+);
+
+create index if not exists outbox_state_idx on outbox (state, id);
+create index if not exists outbox_reference_idx on outbox (reference);
@@ -0,0 +1,4 @@
+alter table unstakes drop column if exists message_hash;
+alter table stakes drop column if exists message_hash;
+
+alter table outbox drop column if exists transfer_hash;
@@ -0,0 +1,4 @@
+alter table outbox add column if not exists transfer_hash text;
+
+alter table stakes add column if not exists message_hash text;
+alter table unstakes add column if not exists message_hash text;
@@ -0,0 +1,4 @@
+alter table stakes add column if not exists exit_code integer;
+alter table unstakes add column if not exists exit_code integer;
+
+create index if not exists outbox_destination_idx on outbox (destination, query_id);
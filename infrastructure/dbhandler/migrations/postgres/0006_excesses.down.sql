@@ -0,0 +1,6 @@
+alter table unstakes drop column if exists excess;
+alter table unstakes drop column if exists cost;
+alter table stakes drop column if exists excess;
+alter table stakes drop column if exists cost;
+
+drop table if exists excesses;
@@ -0,0 +1,16 @@
+create table if not exists excesses
+(
+    hash          text        not null,
+    reference     text        not null,
+    value         bigint      not null,
+    created_at    timestamptz not null,
+
+    primary key (hash)
+);
+
+create index if not exists excesses_reference_idx on excesses (reference);
+
+alter table stakes add column if not exists cost bigint;
+alter table stakes add column if not exists excess bigint;
+alter table unstakes add column if not exists cost bigint;
+alter table unstakes add column if not exists excess bigint;
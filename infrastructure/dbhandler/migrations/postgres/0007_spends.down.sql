@@ -0,0 +1,2 @@
+drop table if exists spend_locks;
+drop table if exists spends;
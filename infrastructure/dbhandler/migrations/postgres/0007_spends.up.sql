@@ -0,0 +1,23 @@
+create table if not exists spends
+(
+    id            bigserial   not null,
+    transfer_id   bigint      not null,
+    amount        bigint      not null,
+    created_at    timestamptz not null,
+
+    primary key (id)
+);
+
+create index if not exists spends_created_at_idx on spends (created_at);
+
+create table if not exists spend_locks
+(
+    id            bigserial   not null,
+    period        text        not null,
+    spent         bigint      not null,
+    cap           bigint      not null,
+    locked_at     timestamptz not null,
+    lifted_at     timestamptz,
+
+    primary key (id)
+);
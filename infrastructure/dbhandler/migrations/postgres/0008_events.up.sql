@@ -0,0 +1,22 @@
+create table if not exists events
+(
+    hash          text        not null,
+    lt            bigint      not null,
+    executed_at   timestamptz not null,
+    opcode        bigint      not null,
+    source        text,
+    value         bigint      not null,
+    success       boolean     not null,
+    total_fee     bigint      not null,
+    process_fee   bigint      not null,
+    storage_fee   bigint      not null,
+    in_msg_fee    bigint      not null,
+    out_msgs_fee  bigint      not null,
+    out_messages  jsonb       not null,
+    created_at    timestamptz not null,
+
+    primary key (hash)
+);
+
+create index if not exists events_lt_idx on events (lt);
+create index if not exists events_opcode_idx on events (opcode);
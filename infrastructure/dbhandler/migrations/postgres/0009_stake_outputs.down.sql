@@ -0,0 +1,6 @@
+delete from stakes where msg_index <> 0;
+
+alter table stakes drop constraint if exists stakes_pkey;
+alter table stakes add primary key (hash);
+
+alter table stakes drop column if exists msg_index;
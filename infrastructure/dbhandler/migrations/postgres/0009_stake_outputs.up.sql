@@ -0,0 +1,4 @@
+alter table stakes add column if not exists msg_index integer not null default 0;
+
+alter table stakes drop constraint if exists stakes_pkey;
+alter table stakes add primary key (hash, msg_index);
@@ -0,0 +1,2 @@
+alter table unstakes drop column if exists final_mc_seqno;
+alter table stakes drop column if exists final_mc_seqno;
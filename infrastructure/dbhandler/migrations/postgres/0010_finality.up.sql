@@ -0,0 +1,3 @@
+-- The seqno is of a masterchain block the request is final by, which is not always the block committing it.
+alter table stakes add column if not exists final_mc_seqno bigint;
+alter table unstakes add column if not exists final_mc_seqno bigint;
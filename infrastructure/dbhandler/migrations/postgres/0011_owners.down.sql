@@ -0,0 +1,5 @@
+drop index if exists unstakes_owner_idx;
+drop index if exists stakes_owner_idx;
+
+alter table unstakes drop column if exists owner;
+alter table stakes drop column if exists owner;
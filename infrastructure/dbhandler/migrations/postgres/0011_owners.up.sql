@@ -0,0 +1,5 @@
+alter table stakes add column if not exists owner text;
+alter table unstakes add column if not exists owner text;
+
+create index if not exists stakes_owner_idx on stakes (owner);
+create index if not exists unstakes_owner_idx on unstakes (owner);
@@ -0,0 +1,39 @@
+create table if not exists stakes
+(
+    address       text        not null,
+    round_since   bigint      not null,
+    hash          text        not null,
+    state         text        not null,
+    retry_count   integer     not null,
+    info          text        not null,
+    created_at    timestamp   not null,
+    retried_at    timestamp,
+    sent_at       timestamp,
+    verified_at   timestamp,
+
+    primary key (hash)
+);
+
+create table if not exists unstakes
+(
+    address       text        not null,
+    tokens        text        not null,
+    hash          text        not null,
+    state         text        not null,
+    retry_count   integer     not null,
+    info          text        not null,
+    created_at    timestamp   not null,
+    retried_at    timestamp,
+    sent_at       timestamp,
+    verified_at   timestamp,
+
+    primary key (hash)
+);
+
+create table if not exists memos
+(
+    key     text    not null,
+    memo    text    not null,
+
+    primary key (key)
+);
@@ -0,0 +1,18 @@
+create table if not exists outbox
+(
+    id            integer     primary key autoincrement,
+    reference     text        not null,
+    kind          text        not null,
+    destination   text        not null,
+    query_id      bigint      not null,
+    message       text        not null,
+    mode          integer     not null,
+    state         text        not null,
+    transfer_id   bigint,
+    valid_until   timestamp,
+    created_at    timestamp   not null,
+    sent_at       timestamp
+);
+
+create index if not exists outbox_state_idx on outbox (state, id);
+create index if not exists outbox_reference_idx on outbox (reference);
@@ -0,0 +1,4 @@
+alter table unstakes drop column message_hash;
+alter table stakes drop column message_hash;
+
+alter table outbox drop column transfer_hash;
@@ -0,0 +1,4 @@
+alter table outbox add column transfer_hash text;
+
+alter table stakes add column message_hash text;
+alter table unstakes add column message_hash text;
@@ -0,0 +1,4 @@
+drop index if exists outbox_destination_idx;
+
+alter table unstakes drop column exit_code;
+alter table stakes drop column exit_code;
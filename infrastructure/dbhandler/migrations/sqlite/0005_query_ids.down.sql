@@ -0,0 +1,3 @@
+drop index if exists outbox_query_id_idx;
+
+drop table if exists counters;
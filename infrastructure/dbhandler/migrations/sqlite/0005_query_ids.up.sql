@@ -0,0 +1,12 @@
+create table if not exists counters
+(
+    name          text        not null,
+    value         bigint      not null,
+
+    primary key (name)
+);
+
+insert into counters (name, value) values ('query_id', 0) on conflict (name) do nothing;
+
+-- Excesses and bounces are matched with the outbox message which carried their query id.
+create index if not exists outbox_query_id_idx on outbox (query_id);
@@ -0,0 +1,6 @@
+alter table unstakes drop column excess;
+alter table unstakes drop column cost;
+alter table stakes drop column excess;
+alter table stakes drop column cost;
+
+drop table if exists excesses;
@@ -0,0 +1,19 @@
+create table if not exists spends
+(
+    id            integer     primary key autoincrement,
+    transfer_id   bigint      not null,
+    amount        bigint      not null,
+    created_at    timestamp   not null
+);
+
+create index if not exists spends_created_at_idx on spends (created_at);
+
+create table if not exists spend_locks
+(
+    id            integer     primary key autoincrement,
+    period        text        not null,
+    spent         bigint      not null,
+    cap           bigint      not null,
+    locked_at     timestamp   not null,
+    lifted_at     timestamp
+);
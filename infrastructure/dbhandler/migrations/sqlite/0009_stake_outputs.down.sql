@@ -0,0 +1,32 @@
+create table stakes_old
+(
+    address       text        not null,
+    round_since   bigint      not null,
+    hash          text        not null,
+    state         text        not null,
+    retry_count   integer     not null,
+    info          text        not null,
+    created_at    timestamp   not null,
+    retried_at    timestamp,
+    sent_at       timestamp,
+    verified_at   timestamp,
+    message_hash  text,
+    exit_code     integer,
+    cost          bigint,
+    excess        bigint,
+
+    primary key (hash)
+);
+
+insert into stakes_old (
+        address, round_since, hash, state, retry_count, info, created_at, retried_at, sent_at, verified_at,
+        message_hash, exit_code, cost, excess
+    )
+    select
+        address, round_since, hash, state, retry_count, info, created_at, retried_at, sent_at, verified_at,
+        message_hash, exit_code, cost, excess
+    from stakes
+    where msg_index = 0;
+
+drop table stakes;
+alter table stakes_old rename to stakes;
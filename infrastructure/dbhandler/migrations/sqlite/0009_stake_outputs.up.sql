@@ -0,0 +1,33 @@
+-- SQLite can't change the primary key of a table, so the table is built again.
+create table stakes_new
+(
+    address       text        not null,
+    round_since   bigint      not null,
+    hash          text        not null,
+    msg_index     integer     not null default 0,
+    state         text        not null,
+    retry_count   integer     not null,
+    info          text        not null,
+    created_at    timestamp   not null,
+    retried_at    timestamp,
+    sent_at       timestamp,
+    verified_at   timestamp,
+    message_hash  text,
+    exit_code     integer,
+    cost          bigint,
+    excess        bigint,
+
+    primary key (hash, msg_index)
+);
+
+insert into stakes_new (
+        address, round_since, hash, msg_index, state, retry_count, info, created_at, retried_at, sent_at, verified_at,
+        message_hash, exit_code, cost, excess
+    )
+    select
+        address, round_since, hash, 0, state, retry_count, info, created_at, retried_at, sent_at, verified_at,
+        message_hash, exit_code, cost, excess
+    from stakes;
+
+drop table stakes;
+alter table stakes_new rename to stakes;
@@ -0,0 +1,2 @@
+alter table unstakes drop column final_mc_seqno;
+alter table stakes drop column final_mc_seqno;
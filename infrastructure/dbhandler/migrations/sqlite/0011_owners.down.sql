@@ -0,0 +1,5 @@
+drop index if exists unstakes_owner_idx;
+drop index if exists stakes_owner_idx;
+
+alter table unstakes drop column owner;
+alter table stakes drop column owner;
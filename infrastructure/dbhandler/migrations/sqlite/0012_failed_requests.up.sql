@@ -0,0 +1,18 @@
+create table if not exists failed_requests
+(
+    hash           text        not null,
+    lt             bigint      not null,
+    executed_at    timestamp   not null,
+    kind           text        not null,
+    sender         text,
+    value          bigint      not null,
+    exit_code      integer     not null,
+    bounced        boolean     not null,
+    final_mc_seqno bigint,
+    created_at     timestamp   not null,
+
+    primary key (hash)
+);
+
+create index if not exists failed_requests_lt_idx on failed_requests (lt);
+create index if not exists failed_requests_sender_idx on failed_requests (sender);
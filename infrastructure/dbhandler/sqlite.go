@@ -0,0 +1,23 @@
+package dbhandler
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "modernc.org/sqlite"
+)
+
+// OpenSQLite opens the SQLite database file at the given path. The file is created if it doesn't exist;
+// its tables are created by the migrations.
+func OpenSQLite(path string) (*sql.DB, error) {
+	dsn := fmt.Sprintf("file:%v?_pragma=busy_timeout(5000)&_txlock=immediate&_time_format=sqlite", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows a single writer only, so sharing one connection avoids busy errors.
+	db.SetMaxOpenConns(1)
+
+	return db, nil
+}
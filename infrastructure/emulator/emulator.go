@@ -0,0 +1,152 @@
+//go:build emulator
+
+package emulator
+
+import (
+	"context"
+	"driver/usecase"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tonkeeper/tongo/boc"
+	"github.com/tonkeeper/tongo/liteapi"
+	"github.com/tonkeeper/tongo/tlb"
+	"github.com/tonkeeper/tongo/ton"
+	"github.com/tonkeeper/tongo/txemulator"
+)
+
+// configTTL is how long the blockchain config is used for emulating before reading it again.
+const configTTL = 10 * time.Minute
+
+var (
+	ErrorNoDestination = fmt.Errorf("message has no destination to emulate it against")
+	ErrorNoEmulation   = fmt.Errorf("emulator returned no transaction")
+)
+
+// Client is what the emulator needs from the lite client, to get the states of the accounts, the libraries
+// their code refers to, and the blockchain config.
+type Client interface {
+	GetAccountState(ctx context.Context, accountID ton.AccountID) (tlb.ShardAccount, error)
+	GetLibraries(ctx context.Context, libraryList []ton.Bits256) (map[ton.Bits256]*boc.Cell, error)
+	GetConfigAll(ctx context.Context, mode liteapi.ConfigMode) (tlb.ConfigParams, error)
+}
+
+// Emulator runs messages against the current states of their destinations, using the TVM emulator of tongo.
+type Emulator struct {
+	client Client
+
+	mutex    sync.Mutex
+	emulator *txemulator.Emulator
+	loadedAt time.Time
+}
+
+func NewEmulator(client Client) (*Emulator, error) {
+	return &Emulator{client: client}, nil
+}
+
+// Emulate runs the message against the current state of its destination, and returns the transaction.
+func (e *Emulator) Emulate(ctx context.Context, msg tlb.Message) (tlb.Transaction, error) {
+	var address tlb.MsgAddress
+	switch msg.Info.SumType {
+	case "IntMsgInfo":
+		address = msg.Info.IntMsgInfo.Dest
+	case "ExtInMsgInfo":
+		address = msg.Info.ExtInMsgInfo.Dest
+	}
+	accountId, err := ton.AccountIDFromTlb(address)
+	if err != nil {
+		return tlb.Transaction{}, err
+	}
+	if accountId == nil {
+		return tlb.Transaction{}, ErrorNoDestination
+	}
+
+	state, err := e.client.GetAccountState(ctx, *accountId)
+	if err != nil {
+		return tlb.Transaction{}, err
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	emulator, err := e.getEmulator(ctx)
+	if err != nil {
+		return tlb.Transaction{}, err
+	}
+	err = e.setLibraries(ctx, emulator, state)
+	if err != nil {
+		return tlb.Transaction{}, err
+	}
+	err = emulator.SetUnixtime(uint32(time.Now().Unix()))
+	if err != nil {
+		return tlb.Transaction{}, err
+	}
+
+	result, err := emulator.Emulate(state, msg)
+	if err != nil {
+		return tlb.Transaction{}, err
+	}
+	if result.Error != nil {
+		return tlb.Transaction{}, fmt.Errorf("%w [exit code: %v] - %v", usecase.ErrorNotAccepted, result.Error.ExitCode, result.Error.Text)
+	}
+	if result.Emulation == nil {
+		return tlb.Transaction{}, ErrorNoEmulation
+	}
+	return result.Emulation.Transaction, nil
+}
+
+// getEmulator returns an emulator with the current blockchain config, and creates it again if the config is
+// read too long ago.
+func (e *Emulator) getEmulator(ctx context.Context) (*txemulator.Emulator, error) {
+	if e.emulator != nil && time.Since(e.loadedAt) < configTTL {
+		return e.emulator, nil
+	}
+
+	params, err := e.client.GetConfigAll(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	config := boc.NewCell()
+	err = tlb.Marshal(config, params.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	emulator, err := txemulator.NewEmulator(config, txemulator.LogTruncated)
+	if err != nil {
+		return nil, err
+	}
+	e.emulator = emulator
+	e.loadedAt = time.Now()
+	return emulator, nil
+}
+
+// setLibraries hands over the public libraries the code of the account refers to.
+func (e *Emulator) setLibraries(ctx context.Context, emulator *txemulator.Emulator, state tlb.ShardAccount) error {
+	if state.Account.Status() != tlb.AccountActive {
+		return nil
+	}
+	code := state.Account.Account.Storage.State.AccountActive.StateInit.Code
+	if !code.Exists {
+		return nil
+	}
+
+	hashes, err := txemulator.FindLibraries(&code.Value.Value)
+	if err != nil || len(hashes) == 0 {
+		return err
+	}
+	libraries, err := e.client.GetLibraries(ctx, hashes)
+	if err != nil || len(libraries) == 0 {
+		return err
+	}
+	encoded, err := txemulator.LibrariesToBase64(libraries)
+	if err != nil {
+		return err
+	}
+	libs, err := boc.DeserializeSinglRootBase64(encoded)
+	if err != nil {
+		return err
+	}
+	return emulator.SetLibs(libs)
+}
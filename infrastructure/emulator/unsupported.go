@@ -0,0 +1,35 @@
+//go:build !emulator
+
+package emulator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tonkeeper/tongo/boc"
+	"github.com/tonkeeper/tongo/liteapi"
+	"github.com/tonkeeper/tongo/tlb"
+	"github.com/tonkeeper/tongo/ton"
+)
+
+var (
+	ErrorNotSupported = fmt.Errorf("the driver is built without the emulator, build it with '-tags emulator'")
+)
+
+// Client is what the emulator needs from the lite client.
+type Client interface {
+	GetAccountState(ctx context.Context, accountID ton.AccountID) (tlb.ShardAccount, error)
+	GetLibraries(ctx context.Context, libraryList []ton.Bits256) (map[ton.Bits256]*boc.Cell, error)
+	GetConfigAll(ctx context.Context, mode liteapi.ConfigMode) (tlb.ConfigParams, error)
+}
+
+// Emulator is not available, as the TVM emulator of tongo needs its native library to be linked.
+type Emulator struct{}
+
+func NewEmulator(client Client) (*Emulator, error) {
+	return nil, ErrorNotSupported
+}
+
+func (e *Emulator) Emulate(ctx context.Context, msg tlb.Message) (tlb.Transaction, error) {
+	return tlb.Transaction{}, ErrorNotSupported
+}
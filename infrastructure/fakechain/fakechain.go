@@ -0,0 +1,666 @@
+package fakechain
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"math/bits"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tonkeeper/tongo"
+	"github.com/tonkeeper/tongo/boc"
+	"github.com/tonkeeper/tongo/liteapi"
+	"github.com/tonkeeper/tongo/liteclient"
+	"github.com/tonkeeper/tongo/tl"
+	"github.com/tonkeeper/tongo/tlb"
+)
+
+var (
+	ErrorMethodNotFound      = fmt.Errorf("get method is not scripted")
+	ErrorTransactionNotFound = fmt.Errorf("transaction not found")
+	ErrorInvalidPayload      = fmt.Errorf("invalid external message payload")
+	ErrorBlockNotFound       = fmt.Errorf("block not found")
+	ErrorWaitTimeout         = fmt.Errorf("timeout")
+
+	// ErrorHistoryPruned is what a pruned account answers a request for the transactions before the oldest one kept,
+	// the way a liteserver answers a request for the history it doesn't keep.
+	ErrorHistoryPruned = liteclient.LiteServerErrorC{Code: 651, Message: "transaction history is not kept"}
+)
+
+// FullShard is the shard of the masterchain, and of the basechain unless it's split into LeftShard and RightShard.
+const (
+	FullShard  = uint64(0x8000000000000000)
+	LeftShard  = uint64(0x4000000000000000)
+	RightShard = uint64(0xc000000000000000)
+)
+
+// MethodHandler answers a get-method call. It receives the call parameters and returns the exit code
+// and the result stack, just like a liteserver does.
+type MethodHandler func(params tlb.VmStack) (uint32, tlb.VmStack, error)
+
+// SendHandler is called for every payload passed to SendMessage, after the destination's seqno is
+// increased. Returning an error makes SendMessage fail with the same error.
+type SendHandler func(dest tongo.AccountID, msg tlb.Message) error
+
+type methodKey struct {
+	account tongo.AccountID
+	method  string
+}
+
+type blockTransaction struct {
+	account tongo.AccountID
+	lt      uint64
+}
+
+// shardBlock is a basechain block, along with the blocks it's made after, which are two after a merge.
+type shardBlock struct {
+	id           tongo.BlockIDExt
+	prev         []int
+	afterSplit   bool
+	afterMerge   bool
+	endLt        uint64
+	transactions []blockTransaction
+}
+
+// FakeChain is an in-memory chain client. Nothing is computed; tests script the answers by registering
+// get-method handlers, account states and transactions, and inspect the payloads sent through it.
+type FakeChain struct {
+	mutex sync.Mutex
+
+	methods      map[methodKey]MethodHandler
+	states       map[tongo.AccountID]tlb.ShardAccount
+	transactions map[tongo.AccountID][]tongo.Transaction
+	pruned       map[tongo.AccountID]bool
+	seqnos       map[tongo.AccountID]uint32
+	failures     map[string]error
+	config       tlb.ConfigParams
+
+	sent   [][]byte
+	onSend SendHandler
+
+	// The transactions added since the latest shard blocks, the shard blocks in the order they are sealed, the
+	// latest block of each shard, and the shard blocks each masterchain block commits to. The blocks are referred to
+	// by their index in shardBlocks, and masterchain blocks are indexed by their seqno - 1. The next shard blocks
+	// are made after a split or a merge if one is asked for.
+	pending      []blockTransaction
+	shardBlocks  []shardBlock
+	shardTops    []int
+	masterBlocks [][]int
+	split, merge bool
+}
+
+func NewFakeChain() *FakeChain {
+	return &FakeChain{
+		methods:      make(map[methodKey]MethodHandler),
+		states:       make(map[tongo.AccountID]tlb.ShardAccount),
+		transactions: make(map[tongo.AccountID][]tongo.Transaction),
+		pruned:       make(map[tongo.AccountID]bool),
+		seqnos:       make(map[tongo.AccountID]uint32),
+		failures:     make(map[string]error),
+	}
+}
+
+//-------------------------------------------------------------------
+// Scripting
+
+// SetMethod registers the handler answering calls to the get-method of the account.
+func (chain *FakeChain) SetMethod(accountId tongo.AccountID, method string, handler MethodHandler) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	chain.methods[methodKey{account: accountId, method: method}] = handler
+}
+
+// SetMethodResult registers a fixed result stack for the get-method of the account.
+func (chain *FakeChain) SetMethodResult(accountId tongo.AccountID, method string, stack tlb.VmStack) {
+	chain.SetMethod(accountId, method, func(tlb.VmStack) (uint32, tlb.VmStack, error) {
+		return 0, stack, nil
+	})
+}
+
+func (chain *FakeChain) SetAccountState(accountId tongo.AccountID, state tlb.ShardAccount) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	chain.states[accountId] = state
+}
+
+func (chain *FakeChain) SetSeqno(accountId tongo.AccountID, seqno uint32) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	chain.seqnos[accountId] = seqno
+}
+
+// AddTransactions appends transactions to the history of the account. The history is always kept sorted
+// by logical time, newest first, as a liteserver returns it.
+func (chain *FakeChain) AddTransactions(accountId tongo.AccountID, trans ...tongo.Transaction) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+
+	list := append(chain.transactions[accountId], trans...)
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Lt > list[j].Lt
+	})
+	chain.transactions[accountId] = list
+
+	for _, t := range trans {
+		chain.pending = append(chain.pending, blockTransaction{account: accountId, lt: t.Lt})
+	}
+}
+
+// SealShardBlock puts the transactions added since the latest shard blocks into a new basechain block of each
+// shard, and returns the ids of the new blocks. No masterchain block commits to them until SealMasterchainBlock is
+// called.
+func (chain *FakeChain) SealShardBlock() []tongo.BlockIDExt {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	return chain.sealShardBlock()
+}
+
+// SplitShard makes the next shard blocks the first ones of LeftShard and RightShard, both made after the latest
+// block of FullShard.
+func (chain *FakeChain) SplitShard() {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	chain.split, chain.merge = true, false
+}
+
+// MergeShards makes the next shard block the one of FullShard made after the latest blocks of LeftShard and
+// RightShard.
+func (chain *FakeChain) MergeShards() {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	chain.split, chain.merge = false, true
+}
+
+// SealMasterchainBlock makes a new masterchain block committing to the latest block of each shard, and returns its
+// seqno. The transactions added since the latest shard blocks, or a split or merge asked for, are sealed into new
+// ones first.
+func (chain *FakeChain) SealMasterchainBlock() uint32 {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+
+	if len(chain.pending) > 0 || len(chain.shardTops) == 0 || chain.split || chain.merge {
+		chain.sealShardBlock()
+	}
+	tops := make([]int, len(chain.shardTops))
+	copy(tops, chain.shardTops)
+	chain.masterBlocks = append(chain.masterBlocks, tops)
+	return uint32(len(chain.masterBlocks))
+}
+
+func (chain *FakeChain) sealShardBlock() []tongo.BlockIDExt {
+	type next struct {
+		shard      uint64
+		prev       []int
+		afterSplit bool
+		afterMerge bool
+	}
+
+	blocks := make([]next, 0, 2)
+	switch {
+	case len(chain.shardTops) == 0:
+		blocks = append(blocks, next{shard: FullShard})
+	case chain.split && len(chain.shardTops) == 1:
+		top := chain.shardTops[0]
+		blocks = append(blocks, next{shard: LeftShard, prev: []int{top}, afterSplit: true})
+		blocks = append(blocks, next{shard: RightShard, prev: []int{top}, afterSplit: true})
+	case chain.merge && len(chain.shardTops) == 2:
+		blocks = append(blocks, next{shard: FullShard, prev: chain.shardTops, afterMerge: true})
+	default:
+		for _, top := range chain.shardTops {
+			blocks = append(blocks, next{shard: chain.shardBlocks[top].id.Shard, prev: []int{top}})
+		}
+	}
+	chain.split, chain.merge = false, false
+
+	tops := make([]int, 0, len(blocks))
+	ids := make([]tongo.BlockIDExt, 0, len(blocks))
+	for _, b := range blocks {
+		block := shardBlock{prev: b.prev, afterSplit: b.afterSplit, afterMerge: b.afterMerge, endLt: 1}
+		seqno := uint32(0)
+		for _, prev := range b.prev {
+			if chain.shardBlocks[prev].id.Seqno > seqno {
+				seqno = chain.shardBlocks[prev].id.Seqno
+			}
+			if chain.shardBlocks[prev].endLt > block.endLt {
+				block.endLt = chain.shardBlocks[prev].endLt
+			}
+		}
+		block.id = blockId(0, b.shard, seqno+1)
+
+		shard, _ := tongo.ParseShardID(int64(b.shard))
+		for _, bt := range chain.pending {
+			if !shard.MatchAccountID(bt.account) {
+				continue
+			}
+			block.transactions = append(block.transactions, bt)
+			if bt.lt >= block.endLt {
+				block.endLt = bt.lt + 1
+			}
+		}
+		sort.SliceStable(block.transactions, func(i, j int) bool {
+			c := bytes.Compare(block.transactions[i].account.Address[:], block.transactions[j].account.Address[:])
+			return c < 0 || (c == 0 && block.transactions[i].lt < block.transactions[j].lt)
+		})
+
+		chain.shardBlocks = append(chain.shardBlocks, block)
+		tops = append(tops, len(chain.shardBlocks)-1)
+		ids = append(ids, block.id)
+	}
+	chain.shardTops = tops
+	chain.pending = nil
+	return ids
+}
+
+// PruneTransactions drops all but the latest transactions of the account, as a liteserver which doesn't keep the
+// old history does. Paging back from the oldest transaction kept fails with ErrorHistoryPruned.
+func (chain *FakeChain) PruneTransactions(accountId tongo.AccountID, keep int) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	if len(chain.transactions[accountId]) > keep {
+		chain.transactions[accountId] = chain.transactions[accountId][:keep]
+		chain.pruned[accountId] = true
+	}
+}
+
+// SetConfigParams sets the blockchain configuration, which GetConfigParams answers a subset of.
+func (chain *FakeChain) SetConfigParams(params tlb.ConfigParams) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	chain.config = params
+}
+
+// SetFailure makes the named client method (e.g. "GetSeqno") fail with the given error until it is
+// cleared by passing a nil error.
+func (chain *FakeChain) SetFailure(name string, err error) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	if err == nil {
+		delete(chain.failures, name)
+		return
+	}
+	chain.failures[name] = err
+}
+
+// OnSend registers a handler which is called for every sent message.
+func (chain *FakeChain) OnSend(handler SendHandler) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	chain.onSend = handler
+}
+
+// SentMessages returns a copy of all payloads passed to SendMessage so far.
+func (chain *FakeChain) SentMessages() [][]byte {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	result := make([][]byte, len(chain.sent))
+	copy(result, chain.sent)
+	return result
+}
+
+//-------------------------------------------------------------------
+// Chain client
+
+func (chain *FakeChain) RunSmcMethod(ctx context.Context, accountId tongo.AccountID, method string, params tlb.VmStack) (uint32, tlb.VmStack, error) {
+	chain.mutex.Lock()
+	err := chain.failures["RunSmcMethod"]
+	handler, exist := chain.methods[methodKey{account: accountId, method: method}]
+	chain.mutex.Unlock()
+
+	if err != nil {
+		return 0, tlb.VmStack{}, err
+	}
+	if !exist {
+		return 0, tlb.VmStack{}, ErrorMethodNotFound
+	}
+	return handler(params)
+}
+
+func (chain *FakeChain) GetAccountState(ctx context.Context, accountId tongo.AccountID) (tlb.ShardAccount, error) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+
+	if err := chain.failures["GetAccountState"]; err != nil {
+		return tlb.ShardAccount{}, err
+	}
+
+	state, exist := chain.states[accountId]
+	if !exist {
+		return tlb.ShardAccount{Account: tlb.Account{SumType: "AccountNone"}}, nil
+	}
+
+	// Keep the last transaction fields consistent with the scripted history.
+	if list := chain.transactions[accountId]; len(list) > 0 {
+		state.LastTransLt = list[0].Lt
+		state.LastTransHash = tlb.Bits256(list[0].Hash())
+	}
+	return state, nil
+}
+
+func (chain *FakeChain) GetLastTransactions(ctx context.Context, accountId tongo.AccountID, limit int) ([]tongo.Transaction, error) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+
+	if err := chain.failures["GetLastTransactions"]; err != nil {
+		return nil, err
+	}
+
+	list := chain.transactions[accountId]
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	result := make([]tongo.Transaction, len(list))
+	copy(result, list)
+	return result, nil
+}
+
+// GetTransactions returns up to count transactions of the account, starting from (and including) the
+// transaction identified by lt and hash, going back in time.
+func (chain *FakeChain) GetTransactions(ctx context.Context, count uint32, accountId tongo.AccountID, lt uint64, hash tongo.Bits256) ([]tongo.Transaction, error) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+
+	if err := chain.failures["GetTransactions"]; err != nil {
+		return nil, err
+	}
+
+	list := chain.transactions[accountId]
+	for i, t := range list {
+		if t.Lt == lt && tongo.Bits256(t.Hash()) == hash {
+			if chain.pruned[accountId] && i == len(list)-1 {
+				return nil, ErrorHistoryPruned
+			}
+			end := i + int(count)
+			if end > len(list) {
+				end = len(list)
+			}
+			result := make([]tongo.Transaction, end-i)
+			copy(result, list[i:end])
+			return result, nil
+		}
+	}
+
+	return nil, ErrorTransactionNotFound
+}
+
+func (chain *FakeChain) GetSeqno(ctx context.Context, accountId tongo.AccountID) (uint32, error) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+
+	if err := chain.failures["GetSeqno"]; err != nil {
+		return 0, err
+	}
+	return chain.seqnos[accountId], nil
+}
+
+// GetConfigParams returns the requested parameters of the configuration set by SetConfigParams. The
+// parameters which are not set are missing from the result, as a liteserver does.
+func (chain *FakeChain) GetConfigParams(ctx context.Context, mode liteapi.ConfigMode, paramList []uint32) (tlb.ConfigParams, error) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+
+	if err := chain.failures["GetConfigParams"]; err != nil {
+		return tlb.ConfigParams{}, err
+	}
+	return chain.config.CloneKeepingSubsetOfKeys(paramList), nil
+}
+
+// SendMessage records the payload, decodes the external message to find its destination and increases
+// the destination's seqno, as if the message were accepted by a wallet contract.
+func (chain *FakeChain) SendMessage(ctx context.Context, payload []byte) (uint32, error) {
+	chain.mutex.Lock()
+	if err := chain.failures["SendMessage"]; err != nil {
+		chain.mutex.Unlock()
+		return 0, err
+	}
+	chain.sent = append(chain.sent, payload)
+	chain.mutex.Unlock()
+
+	msg, dest, err := DecodeExternalMessage(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	chain.mutex.Lock()
+	chain.seqnos[dest]++
+	handler := chain.onSend
+	chain.mutex.Unlock()
+
+	if handler != nil {
+		if err := handler(dest, msg); err != nil {
+			return 0, err
+		}
+	}
+
+	return 1, nil
+}
+
+//-------------------------------------------------------------------
+// Block client
+
+func (chain *FakeChain) GetMasterchainInfo(ctx context.Context) (liteclient.LiteServerMasterchainInfoC, error) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+
+	if err := chain.failures["GetMasterchainInfo"]; err != nil {
+		return liteclient.LiteServerMasterchainInfoC{}, err
+	}
+	last := blockId(-1, FullShard, uint32(len(chain.masterBlocks)))
+	return liteclient.LiteServerMasterchainInfoC{Last: liteclient.BlockIDExt(last)}, nil
+}
+
+// WaitMasterchainSeqno waits until the masterchain block with the seqno is sealed.
+func (chain *FakeChain) WaitMasterchainSeqno(ctx context.Context, seqno uint32, timeout time.Duration) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	deadline := time.After(timeout)
+
+	for {
+		chain.mutex.Lock()
+		reached := uint32(len(chain.masterBlocks)) >= seqno
+		chain.mutex.Unlock()
+		if reached {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline:
+			return ErrorWaitTimeout
+		case <-ticker.C:
+		}
+	}
+}
+
+// LookupBlock finds a block by its shard and seqno, whatever the mode is. The info of a basechain block tells its
+// shard and the blocks it's made after, and its end logical time is after the logical times of its transactions and
+// the ones before it.
+func (chain *FakeChain) LookupBlock(ctx context.Context, blockID tongo.BlockID, mode uint32, lt *uint64, utime *uint32) (tongo.BlockIDExt, tlb.BlockInfo, error) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+
+	if err := chain.failures["LookupBlock"]; err != nil {
+		return tongo.BlockIDExt{}, tlb.BlockInfo{}, err
+	}
+
+	var info tlb.BlockInfo
+	info.SeqNo = blockID.Seqno
+	if blockID.Workchain == -1 {
+		if blockID.Seqno == 0 || int(blockID.Seqno) > len(chain.masterBlocks) {
+			return tongo.BlockIDExt{}, tlb.BlockInfo{}, ErrorBlockNotFound
+		}
+		return blockId(-1, FullShard, blockID.Seqno), info, nil
+	}
+
+	index, err := chain.findShardBlock(blockID)
+	if err != nil {
+		return tongo.BlockIDExt{}, tlb.BlockInfo{}, err
+	}
+	block := chain.shardBlocks[index]
+
+	info.NotMaster = true
+	info.AfterSplit = block.afterSplit
+	info.AfterMerge = block.afterMerge
+	info.EndLt = block.endLt
+	tag := block.id.Shard & -block.id.Shard
+	info.Shard = tlb.ShardIdent{WorkchainID: block.id.Workchain, ShardPfxBits: tlb.Uint6(63 - bits.TrailingZeros64(tag)), ShardPrefix: block.id.Shard &^ tag}
+	refs := make([]tlb.ExtBlkRef, 0, len(block.prev))
+	for _, prev := range block.prev {
+		id := chain.shardBlocks[prev].id
+		refs = append(refs, tlb.ExtBlkRef{EndLt: chain.shardBlocks[prev].endLt, SeqNo: id.Seqno, RootHash: tlb.Bits256(id.RootHash), FileHash: tlb.Bits256(id.FileHash)})
+	}
+	switch len(refs) {
+	case 1:
+		info.PrevRef.SumType = "PrevBlkInfo"
+		info.PrevRef.PrevBlkInfo = &struct{ Prev tlb.ExtBlkRef }{Prev: refs[0]}
+	case 2:
+		info.PrevRef.SumType = "PrevBlksInfo"
+		info.PrevRef.PrevBlksInfo = &struct {
+			Prev1 tlb.ExtBlkRef
+			Prev2 tlb.ExtBlkRef
+		}{Prev1: refs[0], Prev2: refs[1]}
+	}
+	return block.id, info, nil
+}
+
+// GetAllShardsInfo returns the latest basechain block of each shard the masterchain block commits to.
+func (chain *FakeChain) GetAllShardsInfo(ctx context.Context, blockID tongo.BlockIDExt) ([]tongo.BlockIDExt, error) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+
+	if err := chain.failures["GetAllShardsInfo"]; err != nil {
+		return nil, err
+	}
+	if blockID.Workchain != -1 || blockID.Seqno == 0 || int(blockID.Seqno) > len(chain.masterBlocks) {
+		return nil, ErrorBlockNotFound
+	}
+	shards := make([]tongo.BlockIDExt, 0, 2)
+	for _, top := range chain.masterBlocks[blockID.Seqno-1] {
+		shards = append(shards, chain.shardBlocks[top].id)
+	}
+	return shards, nil
+}
+
+// ListBlockTransactions lists the transactions of a basechain block ordered by account and logical time, as a
+// liteserver does. All of account, logical time and hash are returned, whatever the mode asks for.
+func (chain *FakeChain) ListBlockTransactions(ctx context.Context, blockID tongo.BlockIDExt, mode, count uint32, after *liteclient.LiteServerTransactionId3C) ([]liteclient.LiteServerTransactionIdC, bool, error) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+
+	if err := chain.failures["ListBlockTransactions"]; err != nil {
+		return nil, false, err
+	}
+	block, err := chain.shardBlock(blockID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	ids := make([]liteclient.LiteServerTransactionIdC, 0)
+	for _, bt := range block {
+		if mode&128 != 0 && after != nil {
+			c := bytes.Compare(bt.account.Address[:], after.Account[:])
+			if c < 0 || (c == 0 && bt.lt <= after.Lt) {
+				continue
+			}
+		}
+		if uint32(len(ids)) == count {
+			return ids, true, nil
+		}
+
+		account := tl.Int256(bt.account.Address)
+		lt := bt.lt
+		var hash tl.Int256
+		if t := chain.findTransaction(bt.account, bt.lt); t != nil {
+			hash = tl.Int256(t.Hash())
+		}
+		ids = append(ids, liteclient.LiteServerTransactionIdC{Mode: mode, Account: &account, Lt: &lt, Hash: &hash})
+	}
+	return ids, false, nil
+}
+
+func (chain *FakeChain) GetOneTransactionFromBlock(ctx context.Context, accountID tongo.AccountID, blockId tongo.BlockIDExt, lt uint64) (tongo.Transaction, error) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+
+	if err := chain.failures["GetOneTransactionFromBlock"]; err != nil {
+		return tongo.Transaction{}, err
+	}
+	block, err := chain.shardBlock(blockId)
+	if err != nil {
+		return tongo.Transaction{}, err
+	}
+
+	for _, bt := range block {
+		if bt.account == accountID && bt.lt == lt {
+			t := chain.findTransaction(accountID, lt)
+			if t == nil {
+				break
+			}
+			result := *t
+			result.BlockID = blockId
+			return result, nil
+		}
+	}
+	return tongo.Transaction{}, ErrorTransactionNotFound
+}
+
+func (chain *FakeChain) shardBlock(blockID tongo.BlockIDExt) ([]blockTransaction, error) {
+	index, err := chain.findShardBlock(blockID.BlockID)
+	if err != nil {
+		return nil, err
+	}
+	return chain.shardBlocks[index].transactions, nil
+}
+
+func (chain *FakeChain) findShardBlock(blockID tongo.BlockID) (int, error) {
+	for i, block := range chain.shardBlocks {
+		if block.id.BlockID == blockID {
+			return i, nil
+		}
+	}
+	return 0, ErrorBlockNotFound
+}
+
+func (chain *FakeChain) findTransaction(accountId tongo.AccountID, lt uint64) *tongo.Transaction {
+	for i, t := range chain.transactions[accountId] {
+		if t.Lt == lt {
+			return &chain.transactions[accountId][i]
+		}
+	}
+	return nil
+}
+
+// blockId makes the id of a block, with its hashes derived from its workchain, shard and seqno.
+func blockId(workchain int32, shard uint64, seqno uint32) tongo.BlockIDExt {
+	id := tongo.BlockID{Workchain: workchain, Shard: shard, Seqno: seqno}
+	return tongo.BlockIDExt{
+		BlockID:  id,
+		RootHash: tongo.Bits256(sha256.Sum256([]byte("root" + id.String()))),
+		FileHash: tongo.Bits256(sha256.Sum256([]byte("file" + id.String()))),
+	}
+}
+
+// DecodeExternalMessage parses a serialized external-in message and returns it along with its destination.
+func DecodeExternalMessage(payload []byte) (tlb.Message, tongo.AccountID, error) {
+	var msg tlb.Message
+
+	cells, err := boc.DeserializeBoc(payload)
+	if err != nil || len(cells) != 1 {
+		return msg, tongo.AccountID{}, ErrorInvalidPayload
+	}
+
+	err = tlb.Unmarshal(cells[0], &msg)
+	if err != nil || msg.Info.ExtInMsgInfo == nil {
+		return msg, tongo.AccountID{}, ErrorInvalidPayload
+	}
+
+	dest, err := tongo.AccountIDFromTlb(msg.Info.ExtInMsgInfo.Dest)
+	if err != nil || dest == nil {
+		return msg, tongo.AccountID{}, ErrorInvalidPayload
+	}
+
+	return msg, *dest, nil
+}
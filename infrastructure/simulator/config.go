@@ -0,0 +1,69 @@
+package simulator
+
+import (
+	"github.com/tonkeeper/tongo/boc"
+	"github.com/tonkeeper/tongo/tlb"
+)
+
+// The gas and forwarding prices of the simulated chain, the same as the mainnet ones at the time of writing.
+// Prices are in 1/65536 of a nanoton, as the config parameters keep them.
+const (
+	basechainGasPrice   = uint64(26214400)
+	masterchainGasPrice = uint64(655360000)
+)
+
+// gasPrices builds a gas_flat_pfx price set, as config parameters 20 and 21 keep it.
+func gasPrices(flatGasPrice uint64, gasPrice uint64) tlb.GasLimitsPrices {
+	other := tlb.GasLimitsPrices{SumType: "GasPricesExt"}
+	other.GasPricesExt.GasPrice = gasPrice
+	other.GasPricesExt.GasLimit = 1_000_000
+	other.GasPricesExt.SpecialGasLimit = 1_000_000
+	other.GasPricesExt.GasCredit = 10_000
+	other.GasPricesExt.BlockGasLimit = 10_000_000
+	other.GasPricesExt.FreezeDueLimit = 100_000_000
+	other.GasPricesExt.DeleteDueLimit = 1_000_000_000
+
+	prices := tlb.GasLimitsPrices{SumType: "GasFlatPfx"}
+	prices.GasFlatPfx.FlatGasLimit = 100
+	prices.GasFlatPfx.FlatGasPrice = flatGasPrice
+	prices.GasFlatPfx.Other = &other
+	return prices
+}
+
+// SetGasPrice changes the basechain gas price, in 1/65536 of a nanoton per gas unit.
+func (sim *Simulator) SetGasPrice(gasPrice uint64) {
+	sim.mutex.Lock()
+	defer sim.mutex.Unlock()
+	sim.gasPrice = gasPrice
+	sim.SetConfigParams(sim.configParams())
+}
+
+// configParams encodes the gas and forwarding prices of the masterchain and the basechain, i.e. the config
+// parameters 20, 21, 24 and 25.
+func (sim *Simulator) configParams() tlb.ConfigParams {
+	params := map[uint32]any{
+		20: tlb.ConfigParam20{GasLimitsPrices: gasPrices(1_000_000, masterchainGasPrice)},
+		21: tlb.ConfigParam21{GasLimitsPrices: gasPrices(40_000, sim.gasPrice)},
+		24: tlb.ConfigParam24{MsgForwardPrices: tlb.MsgForwardPrices{
+			LumpPrice: 10_000_000, BitPrice: 655360000, CellPrice: 65536000000,
+			IhrPriceFactor: 98304, FirstFrac: 21845, NextFrac: 21845,
+		}},
+		25: tlb.ConfigParam25{MsgForwardPrices: tlb.MsgForwardPrices{
+			LumpPrice: 400_000, BitPrice: 26214400, CellPrice: 2621440000,
+			IhrPriceFactor: 98304, FirstFrac: 21845, NextFrac: 21845,
+		}},
+	}
+
+	keys := make([]tlb.Uint32, 0, len(params))
+	values := make([]tlb.Ref[boc.Cell], 0, len(params))
+	for _, key := range []uint32{20, 21, 24, 25} {
+		cell := boc.NewCell()
+		if err := tlb.Marshal(cell, params[key]); err != nil {
+			panic(err)
+		}
+		keys = append(keys, tlb.Uint32(key))
+		values = append(values, tlb.Ref[boc.Cell]{Value: *cell})
+	}
+
+	return tlb.ConfigParams{Config: tlb.NewHashmap(keys, values)}
+}
@@ -0,0 +1,146 @@
+package simulator
+
+import (
+	"math/big"
+
+	"github.com/tonkeeper/tongo"
+	"github.com/tonkeeper/tongo/boc"
+	"github.com/tonkeeper/tongo/tlb"
+)
+
+// getTreasuryState answers get_treasury_state with the same 18 items stack the treasury returns. Only
+// the items the driver reads carry real values.
+func (sim *Simulator) getTreasuryState(tlb.VmStack) (uint32, tlb.VmStack, error) {
+	sim.mutex.Lock()
+	defer sim.mutex.Unlock()
+
+	rounds := make([]uint32, 0, len(sim.participations))
+	for round := range sim.participations {
+		rounds = append(rounds, round)
+	}
+
+	stack := tlb.VmStack{
+		intValue(&sim.totalCoins),
+		intValue(&sim.totalTokens),
+		intValue(&sim.totalStaking),
+		intValue(&sim.totalUnstaking),
+		intValue(big.NewInt(0)), // total validators stake
+		intValue(big.NewInt(0)),
+		intValue(big.NewInt(0)),
+		dictValue(rounds, nil),
+		{SumType: "VmStkTinyInt", VmStkTinyInt: 0}, // rounds imbalance
+		{SumType: "VmStkTinyInt", VmStkTinyInt: 0}, // stopped
+		cellValue(),                                // wallet code
+		cellValue(),                                // loan code
+		sliceValue(),                               // driver
+		sliceValue(),                               // halter
+		sliceValue(),                               // governor
+		{SumType: "VmStkNull"},                     // proposed governor
+		{SumType: "VmStkTinyInt", VmStkTinyInt: 0}, // reward share
+		cellValue(),                                // content
+	}
+
+	return 0, stack, nil
+}
+
+func (sim *Simulator) getMaxBurnableTokens(tlb.VmStack) (uint32, tlb.VmStack, error) {
+	sim.mutex.Lock()
+	defer sim.mutex.Unlock()
+
+	return 0, tlb.VmStack{intValue(&sim.maxBurnable)}, nil
+}
+
+func (sim *Simulator) getWalletState(walletId tongo.AccountID) (uint32, tlb.VmStack, error) {
+	sim.mutex.Lock()
+	defer sim.mutex.Unlock()
+
+	w := sim.wallets[walletId]
+
+	rounds := make([]uint32, 0, len(w.staking))
+	amounts := make([]*big.Int, 0, len(w.staking))
+	for round, amount := range w.staking {
+		rounds = append(rounds, round)
+		amounts = append(amounts, amount)
+	}
+
+	stack := tlb.VmStack{
+		intValue(&w.tokens),
+		dictValue(rounds, amounts),
+		intValue(&w.unstaking),
+	}
+
+	return 0, stack, nil
+}
+
+// highloadMessage is the body of a transfer of a highload wallet v2.
+type highloadMessage struct {
+	SubWalletId uint32
+	QueryId     uint64
+	Messages    tlb.HashmapE[tlb.Uint16, struct {
+		Mode    uint8
+		Message tlb.Ref[tlb.Message]
+	}]
+}
+
+// processed answers the processed? get-method of the highload driver wallet, which returns -1 for the processed
+// queries and 0 for the others.
+func (sim *Simulator) processed(params tlb.VmStack) (uint32, tlb.VmStack, error) {
+	sim.mutex.Lock()
+	defer sim.mutex.Unlock()
+
+	var queryId uint64
+	if len(params) == 1 {
+		queryId = getUint64(params[0])
+	}
+
+	var result int64
+	if sim.driverQueries[queryId] {
+		result = -1
+	}
+	return 0, tlb.VmStack{{SumType: "VmStkTinyInt", VmStkTinyInt: result}}, nil
+}
+
+func getUint64(value tlb.VmStackValue) uint64 {
+	if value.SumType == "VmStkTinyInt" {
+		return uint64(value.VmStkTinyInt)
+	}
+	i := big.Int(value.VmStkInt)
+	return i.Uint64()
+}
+
+func intValue(value *big.Int) tlb.VmStackValue {
+	if value.IsInt64() {
+		return tlb.VmStackValue{SumType: "VmStkTinyInt", VmStkTinyInt: value.Int64()}
+	}
+	return tlb.VmStackValue{SumType: "VmStkInt", VmStkInt: tlb.Int257(*value)}
+}
+
+// dictValue makes a uint32 keyed dictionary. Values are stored as coins if given, and left empty otherwise.
+func dictValue(keys []uint32, values []*big.Int) tlb.VmStackValue {
+	if len(keys) == 0 {
+		return tlb.VmStackValue{SumType: "VmStkNull"}
+	}
+
+	dictKeys := make([]tlb.Uint32, len(keys))
+	dictValues := make([]tlb.Any, len(keys))
+	for i, key := range keys {
+		dictKeys[i] = tlb.Uint32(key)
+		cell := boc.NewCell()
+		if values != nil {
+			tlb.Marshal(cell, tlb.Grams(values[i].Uint64()))
+		}
+		dictValues[i] = tlb.Any(*cell)
+	}
+
+	cell := boc.NewCell()
+	tlb.Marshal(cell, tlb.NewHashmap(dictKeys, dictValues))
+	return tlb.VmStackValue{SumType: "VmStkCell", VmStkCell: tlb.Ref[boc.Cell]{Value: *cell}}
+}
+
+func cellValue() tlb.VmStackValue {
+	return tlb.VmStackValue{SumType: "VmStkCell", VmStkCell: tlb.Ref[boc.Cell]{Value: *boc.NewCell()}}
+}
+
+func sliceValue() tlb.VmStackValue {
+	return tlb.VmStackValue{SumType: "VmStkSlice"}
+}
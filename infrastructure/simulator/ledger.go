@@ -0,0 +1,261 @@
+package simulator
+
+import (
+	"time"
+
+	"github.com/tonkeeper/tongo"
+	"github.com/tonkeeper/tongo/boc"
+	"github.com/tonkeeper/tongo/tlb"
+)
+
+// transactionCell mirrors tlb.Transaction without its unexported hash, which the encoder can't handle.
+type transactionCell struct {
+	Magic         tlb.Magic `tlb:"transaction$0111"`
+	AccountAddr   tlb.Bits256
+	Lt            uint64
+	PrevTransHash tlb.Bits256
+	PrevTransLt   uint64
+	Now           uint32
+	OutMsgCnt     tlb.Uint15
+	OrigStatus    tlb.AccountStatus
+	EndStatus     tlb.AccountStatus
+	Msgs          struct {
+		InMsg   tlb.Maybe[tlb.Ref[tlb.Message]]
+		OutMsgs tlb.HashmapE[tlb.Uint15, tlb.Ref[tlb.Message]]
+	} `tlb:"^"`
+	TotalFees   tlb.CurrencyCollection
+	StateUpdate tlb.HashUpdate       `tlb:"^"`
+	Description tlb.TransactionDescr `tlb:"^"`
+}
+
+type lastTrans struct {
+	lt   uint64
+	hash tlb.Bits256
+}
+
+// ledger builds messages and transactions the way a liteserver would return them, so their hashes and
+// logical times are consistent and they can be chained through PrevTransLt and PrevTransHash.
+type ledger struct {
+	lt   uint64
+	last map[tongo.AccountID]lastTrans
+}
+
+func newLedger() ledger {
+	return ledger{
+		lt:   1_000_000,
+		last: make(map[tongo.AccountID]lastTrans),
+	}
+}
+
+func (l *ledger) nextLt() uint64 {
+	l.lt += 1_000
+	return l.lt
+}
+
+func (l *ledger) internalMessage(src tongo.AccountID, dest tongo.AccountID, value tlb.Grams, body *boc.Cell, bounce bool) tlb.Message {
+	msg := tlb.Message{}
+	msg.Info.SumType = "IntMsgInfo"
+	msg.Info.IntMsgInfo = &struct {
+		IhrDisabled bool
+		Bounce      bool
+		Bounced     bool
+		Src         tlb.MsgAddress
+		Dest        tlb.MsgAddress
+		Value       tlb.CurrencyCollection
+		IhrFee      tlb.Grams
+		FwdFee      tlb.Grams
+		CreatedLt   uint64
+		CreatedAt   uint32
+	}{
+		IhrDisabled: true,
+		Bounce:      bounce,
+		Src:         src.ToMsgAddress(),
+		Dest:        dest.ToMsgAddress(),
+		Value:       tlb.CurrencyCollection{Grams: value},
+		CreatedLt:   l.nextLt(),
+		CreatedAt:   uint32(time.Now().Unix()),
+	}
+	msg.Body.IsRight = true
+	msg.Body.Value = tlb.Any(*body)
+
+	return rehash(msg)
+}
+
+// forward fills in the fields of an internal message the sender contract fills in when it's sent.
+func (l *ledger) forward(src tongo.AccountID, msg tlb.Message) tlb.Message {
+	if msg.Info.IntMsgInfo == nil {
+		return msg
+	}
+
+	info := *msg.Info.IntMsgInfo
+	info.Src = src.ToMsgAddress()
+	info.CreatedLt = l.nextLt()
+	info.CreatedAt = uint32(time.Now().Unix())
+	msg.Info.IntMsgInfo = &info
+
+	return rehash(msg)
+}
+
+// transaction makes a transaction of the account processing the in-message and emitting the out-messages.
+// A non-zero exit code fails the compute phase, and the transaction is aborted.
+func (l *ledger) transaction(accountId tongo.AccountID, inMsg tlb.Message, outMsgs []tlb.Message, exitCode int32) (tongo.Transaction, error) {
+	prev := l.last[accountId]
+	success := exitCode == 0
+
+	t := tlb.Transaction{
+		AccountAddr:   accountId.Address,
+		Lt:            l.nextLt(),
+		PrevTransHash: prev.hash,
+		PrevTransLt:   prev.lt,
+		Now:           uint32(time.Now().Unix()),
+		OutMsgCnt:     tlb.Uint15(len(outMsgs)),
+		OrigStatus:    tlb.AccountActive,
+		EndStatus:     tlb.AccountActive,
+	}
+
+	t.Msgs.InMsg.Exists = true
+	t.Msgs.InMsg.Value.Value = inMsg
+
+	// Out-messages are created by the transaction, so their logical times follow the transaction's.
+	created := make([]tlb.Message, len(outMsgs))
+	for i, msg := range outMsgs {
+		created[i] = msg
+		if msg.Info.IntMsgInfo != nil {
+			info := *msg.Info.IntMsgInfo
+			info.CreatedLt = t.Lt + uint64(i) + 1
+			created[i].Info.IntMsgInfo = &info
+			created[i] = rehash(created[i])
+		}
+	}
+
+	var err error
+	t.Msgs.OutMsgs, err = outMessages(created)
+	if err != nil {
+		return tongo.Transaction{}, err
+	}
+
+	t.TotalFees.Grams = 5_000_000
+
+	descr := &t.Description
+	descr.SumType = "TransOrd"
+	descr.TransOrd.StoragePh.Exists = true
+	descr.TransOrd.StoragePh.Value.StatusChange = tlb.AccStatusChangeUnchanged
+	descr.TransOrd.CreditPh.Exists = true
+	if inMsg.Info.IntMsgInfo != nil {
+		descr.TransOrd.CreditPh.Value.Credit = inMsg.Info.IntMsgInfo.Value
+	}
+	descr.TransOrd.ComputePh.SumType = "TrPhaseComputeVm"
+	descr.TransOrd.ComputePh.TrPhaseComputeVm.Success = success
+	descr.TransOrd.ComputePh.TrPhaseComputeVm.Vm.ExitCode = exitCode
+	descr.TransOrd.Action.Exists = success
+	descr.TransOrd.Action.Value.Value.Success = success
+	descr.TransOrd.Action.Value.Value.Valid = success
+	descr.TransOrd.Action.Value.Value.StatusChange = tlb.AccStatusChangeUnchanged
+	descr.TransOrd.Action.Value.Value.TotActions = uint16(len(outMsgs))
+	descr.TransOrd.Action.Value.Value.MsgsCreated = uint16(len(outMsgs))
+	descr.TransOrd.Aborted = !success
+
+	// Round-trip the transaction through its cell representation, so it carries a real hash.
+	cell := boc.NewCell()
+	err = tlb.Marshal(cell, transactionCell{
+		AccountAddr:   t.AccountAddr,
+		Lt:            t.Lt,
+		PrevTransHash: t.PrevTransHash,
+		PrevTransLt:   t.PrevTransLt,
+		Now:           t.Now,
+		OutMsgCnt:     t.OutMsgCnt,
+		OrigStatus:    t.OrigStatus,
+		EndStatus:     t.EndStatus,
+		Msgs:          t.Msgs,
+		TotalFees:     t.TotalFees,
+		StateUpdate:   t.StateUpdate,
+		Description:   t.Description,
+	})
+	if err != nil {
+		return tongo.Transaction{}, err
+	}
+
+	var result tongo.Transaction
+	err = tlb.Unmarshal(cell, &result.Transaction)
+	if err != nil {
+		return tongo.Transaction{}, err
+	}
+
+	l.last[accountId] = lastTrans{lt: result.Lt, hash: result.Hash()}
+	return result, nil
+}
+
+func outMessages(msgs []tlb.Message) (tlb.HashmapE[tlb.Uint15, tlb.Ref[tlb.Message]], error) {
+	var result tlb.HashmapE[tlb.Uint15, tlb.Ref[tlb.Message]]
+
+	keys := make([]tlb.Uint15, len(msgs))
+	values := make([]tlb.Ref[tlb.Message], len(msgs))
+	for i, msg := range msgs {
+		keys[i] = tlb.Uint15(i)
+		values[i] = tlb.Ref[tlb.Message]{Value: msg}
+	}
+
+	// HashmapE can't be filled directly, so it's decoded from its serialized form.
+	var temp tlb.Maybe[tlb.Ref[tlb.Hashmap[tlb.Uint15, tlb.Ref[tlb.Message]]]]
+	temp.Exists = len(msgs) > 0
+	temp.Value.Value = tlb.NewHashmap(keys, values)
+
+	cell := boc.NewCell()
+	err := tlb.Marshal(cell, temp)
+	if err != nil {
+		return result, err
+	}
+	err = tlb.Unmarshal(cell, &result)
+	return result, err
+}
+
+// bounce makes the message a bounced message, sent back from its destination to its source with the beginning of
+// its body, as the destination contract rejected it.
+func (l *ledger) bounce(msg tlb.Message, fee tlb.Grams) tlb.Message {
+	original := boc.Cell(msg.Body.Value)
+	original.ResetCounters()
+	body := boc.NewCell()
+	body.WriteUint(0xffffffff, 32)
+	size := original.BitsAvailableForRead()
+	if size > 256 {
+		size = 256
+	}
+	bits, _ := original.ReadBits(size)
+	body.WriteBitString(bits)
+
+	info := *msg.Info.IntMsgInfo
+	info.Src, info.Dest = info.Dest, info.Src
+	info.Bounce = false
+	info.Bounced = true
+	info.Value = tlb.CurrencyCollection{Grams: info.Value.Grams - fee}
+	info.CreatedAt = uint32(time.Now().Unix())
+	msg.Info.IntMsgInfo = &info
+	msg.Init.Exists = false
+	msg.Body.IsRight = true
+	msg.Body.Value = tlb.Any(*body)
+
+	return rehash(msg)
+}
+
+// rehash round-trips a message through its cell representation, so it carries a real hash.
+func rehash(msg tlb.Message) tlb.Message {
+	cell := boc.NewCell()
+	if tlb.Marshal(cell, msg) != nil {
+		return msg
+	}
+
+	var result tlb.Message
+	if tlb.Unmarshal(cell, &result) != nil {
+		return msg
+	}
+	return result
+}
+
+func activeAccount(accountId tongo.AccountID, balance tlb.Grams) tlb.ShardAccount {
+	account := tlb.Account{SumType: "Account"}
+	account.Account.Addr = accountId.ToMsgAddress()
+	account.Account.Storage.Balance.Grams = balance
+	account.Account.Storage.State.SumType = "AccountActive"
+
+	return tlb.ShardAccount{Account: account}
+}
@@ -0,0 +1,633 @@
+package simulator
+
+import (
+	"context"
+	"driver/domain"
+	"driver/domain/model"
+	"driver/infrastructure/fakechain"
+	"driver/usecase"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/tonkeeper/tongo"
+	"github.com/tonkeeper/tongo/boc"
+	"github.com/tonkeeper/tongo/tlb"
+	tgwallet "github.com/tonkeeper/tongo/wallet"
+)
+
+var (
+	ErrorUnknownWallet  = fmt.Errorf("unknown j-wallet")
+	ErrorQueryProcessed = fmt.Errorf("query is already processed")
+)
+
+// Exit codes of the simulated j-wallets when they reject a message. They are made up for the simulator.
+const (
+	ExitCodeNotStaking   = int32(70)
+	ExitCodeRoundOngoing = int32(71)
+	ExitCodeNotUnstaking = int32(72)
+	ExitCodeNotBurnable  = int32(73)
+)
+
+const (
+	// bounceFee is what a rejected message loses from its value before being bounced back.
+	bounceFee = tlb.Grams(10_000_000)
+
+	// excessFee is what processing an accepted message costs, and is not returned as its excess.
+	excessFee = tlb.Grams(50_000_000)
+)
+
+// jwallet keeps the state of a simulated j-wallet, as get_wallet_state reports it.
+type jwallet struct {
+	owner     tongo.AccountID
+	tokens    big.Int
+	staking   map[uint32]*big.Int
+	unstaking big.Int
+}
+
+// Simulator is an in-memory model of the Hipo treasury and its j-wallets. It is a chain client, so it can
+// be injected in place of the lite client, and it reacts to the stake_coins and withdraw_tokens messages
+// sent by the driver wallet the way the contracts do.
+type Simulator struct {
+	*fakechain.FakeChain
+
+	mutex sync.Mutex
+
+	treasuryId      tongo.AccountID
+	treasuryBalance tlb.Grams
+	driverId        tongo.AccountID
+	driverBalance   tlb.Grams
+	driverHighload  bool
+	driverQueries   map[uint64]bool
+	gasPrice        uint64
+	depositNotices  bool
+
+	wallets        map[tongo.AccountID]*jwallet
+	participations map[uint32]bool
+	round          uint32
+	maxBurnable    big.Int
+	totalCoins     big.Int
+	totalTokens    big.Int
+	totalStaking   big.Int
+	totalUnstaking big.Int
+
+	ledger ledger
+}
+
+func NewSimulator(treasuryId tongo.AccountID, driverId tongo.AccountID) *Simulator {
+	sim := &Simulator{
+		FakeChain:       fakechain.NewFakeChain(),
+		treasuryId:      treasuryId,
+		treasuryBalance: 1_000_000_000_000,
+		driverId:        driverId,
+		driverBalance:   100_000_000_000,
+		wallets:         make(map[tongo.AccountID]*jwallet),
+		participations:  make(map[uint32]bool),
+		driverQueries:   make(map[uint64]bool),
+		gasPrice:        basechainGasPrice,
+		ledger:          newLedger(),
+	}
+
+	sim.SetMethod(treasuryId, "get_treasury_state", sim.getTreasuryState)
+	sim.SetMethod(treasuryId, "get_max_burnable_tokens", sim.getMaxBurnableTokens)
+	sim.SetAccountState(treasuryId, activeAccount(treasuryId, sim.treasuryBalance))
+	sim.SetAccountState(driverId, activeAccount(driverId, sim.driverBalance))
+	sim.SetConfigParams(sim.configParams())
+	sim.OnSend(sim.receiveExternal)
+
+	return sim
+}
+
+// UseHighloadDriver makes the driver wallet a highload wallet v2, which accepts transfers by query id and
+// answers the processed? get-method.
+func (sim *Simulator) UseHighloadDriver() {
+	sim.mutex.Lock()
+	defer sim.mutex.Unlock()
+	sim.driverHighload = true
+	sim.SetMethod(sim.driverId, "processed?", sim.processed)
+}
+
+// SendDepositNotices makes the treasury send a plain transfer back to the sender of each deposit, ahead of the
+// save_coins messages, so a save_coins message is not the first out-message of its transaction.
+func (sim *Simulator) SendDepositNotices(enabled bool) {
+	sim.mutex.Lock()
+	defer sim.mutex.Unlock()
+	sim.depositNotices = enabled
+}
+
+// SetDriverBalance sets the balance of the driver wallet, e.g. to drain it below the reserve.
+func (sim *Simulator) SetDriverBalance(balance tlb.Grams) {
+	sim.mutex.Lock()
+	defer sim.mutex.Unlock()
+	sim.driverBalance = balance
+	sim.SetAccountState(sim.driverId, activeAccount(sim.driverId, sim.driverBalance))
+}
+
+//-------------------------------------------------------------------
+// Rounds
+
+// StartRound starts a validation round. Coins deposited from now on are staked for this round, and
+// j-wallets cannot receive stake_coins for it until the round is finished.
+func (sim *Simulator) StartRound(since uint32) {
+	sim.mutex.Lock()
+	defer sim.mutex.Unlock()
+	sim.round = since
+	sim.participations[since] = true
+}
+
+// FinishRound finishes a validation round, so stake_coins messages for it are accepted.
+func (sim *Simulator) FinishRound(since uint32) {
+	sim.mutex.Lock()
+	defer sim.mutex.Unlock()
+	delete(sim.participations, since)
+}
+
+// SetMaxBurnableTokens sets the budget the treasury has for paying withdraw_tokens messages.
+func (sim *Simulator) SetMaxBurnableTokens(tokens *big.Int) {
+	sim.mutex.Lock()
+	defer sim.mutex.Unlock()
+	sim.maxBurnable.Set(tokens)
+}
+
+//-------------------------------------------------------------------
+// User actions
+
+// Deposit simulates a user sending coins to the treasury. The treasury answers with a save_coins message
+// to the user's j-wallet, which keeps the coins as staking for the current round.
+func (sim *Simulator) Deposit(owner tongo.AccountID, walletId tongo.AccountID, amount tlb.Grams) (tongo.Transaction, error) {
+	return sim.MultiDeposit(owner, []WalletDeposit{{Owner: owner, WalletId: walletId, Amount: amount}})
+}
+
+// WalletDeposit is the part of a deposit kept by a j-wallet.
+type WalletDeposit struct {
+	Owner    tongo.AccountID
+	WalletId tongo.AccountID
+	Amount   tlb.Grams
+}
+
+// MultiDeposit simulates a deposit made for several j-wallets at once. The treasury answers with a save_coins
+// message to each of them in the same transaction.
+func (sim *Simulator) MultiDeposit(sender tongo.AccountID, deposits []WalletDeposit) (tongo.Transaction, error) {
+	sim.mutex.Lock()
+	defer sim.mutex.Unlock()
+
+	// Users deposit by sending coins with the comment 'd'.
+	inBody := boc.NewCell()
+	inBody.WriteUint(0, 32)
+	inBody.WriteBytes([]byte("d"))
+
+	total := tlb.Grams(0)
+	outMsgs := make([]tlb.Message, 0, len(deposits)+1)
+	if sim.depositNotices {
+		outMsgs = append(outMsgs, sim.ledger.internalMessage(sim.treasuryId, sender, 1, boc.NewCell(), false))
+	}
+	for _, deposit := range deposits {
+		outBody := boc.NewCell()
+		tlb.Marshal(outBody, domain.TlbSaveCoinMessage{
+			Opcode:       tlb.Uint32(usecase.OpcodeSaveCoin),
+			QuieryId:     0,
+			StakeAmount:  deposit.Amount,
+			RoundSince:   tlb.Uint32(sim.round),
+			ReturnExcess: deposit.Owner.ToMsgAddress(),
+		})
+		outMsgs = append(outMsgs, sim.ledger.internalMessage(sim.treasuryId, deposit.WalletId, 100_000_000, outBody, true))
+		total += deposit.Amount
+	}
+
+	inMsg := sim.ledger.internalMessage(sender, sim.treasuryId, total, inBody, true)
+	trans, err := sim.ledger.transaction(sim.treasuryId, inMsg, outMsgs, 0)
+	if err != nil {
+		return tongo.Transaction{}, err
+	}
+
+	for _, deposit := range deposits {
+		w := sim.ensureWallet(deposit.Owner, deposit.WalletId)
+		staking, exist := w.staking[sim.round]
+		if !exist {
+			staking = big.NewInt(0)
+			w.staking[sim.round] = staking
+		}
+		staking.Add(staking, big.NewInt(int64(deposit.Amount)))
+		sim.totalStaking.Add(&sim.totalStaking, big.NewInt(int64(deposit.Amount)))
+	}
+
+	sim.AddTransactions(sim.treasuryId, trans)
+	return trans, nil
+}
+
+// Unstake simulates a user asking the j-wallet to unstake some tokens. The j-wallet sends a reserve_tokens
+// message to the treasury and keeps the tokens as unstaking until a withdraw_tokens message arrives.
+func (sim *Simulator) Unstake(walletId tongo.AccountID, tokens *big.Int) (tongo.Transaction, error) {
+	sim.mutex.Lock()
+	defer sim.mutex.Unlock()
+
+	w, exist := sim.wallets[walletId]
+	if !exist {
+		return tongo.Transaction{}, ErrorUnknownWallet
+	}
+
+	body := boc.NewCell()
+	tlb.Marshal(body, domain.TlbReserveTokenMessage{
+		Opcode:       tlb.Uint32(usecase.OpcodeReserveToken),
+		QuieryId:     0,
+		Tokens:       tlb.Grams(tokens.Uint64()),
+		Owner:        w.owner.ToMsgAddress(),
+		ReturnExcess: w.owner.ToMsgAddress(),
+	})
+
+	inMsg := sim.ledger.internalMessage(walletId, sim.treasuryId, 100_000_000, body, true)
+	trans, err := sim.ledger.transaction(sim.treasuryId, inMsg, nil, 0)
+	if err != nil {
+		return tongo.Transaction{}, err
+	}
+
+	w.tokens.Sub(&w.tokens, tokens)
+	w.unstaking.Add(&w.unstaking, tokens)
+	sim.totalUnstaking.Add(&sim.totalUnstaking, tokens)
+
+	sim.AddTransactions(sim.treasuryId, trans)
+	return trans, nil
+}
+
+// FailedDeposit simulates a deposit the treasury fails to process with the exit code. The coins are bounced back to
+// the sender, and no j-wallet is credited.
+func (sim *Simulator) FailedDeposit(sender tongo.AccountID, amount tlb.Grams, exitCode int32) (tongo.Transaction, error) {
+	return sim.FailedTransfer(sender, amount, "d", exitCode)
+}
+
+// FailedTransfer simulates a transfer with the comment, or with an empty body if the comment is empty, which the
+// treasury fails to process with the exit code. The coins are bounced back to the sender.
+func (sim *Simulator) FailedTransfer(sender tongo.AccountID, amount tlb.Grams, comment string, exitCode int32) (tongo.Transaction, error) {
+	sim.mutex.Lock()
+	defer sim.mutex.Unlock()
+
+	inBody := boc.NewCell()
+	if comment != "" {
+		inBody.WriteUint(0, 32)
+		inBody.WriteBytes([]byte(comment))
+	}
+
+	inMsg := sim.ledger.internalMessage(sender, sim.treasuryId, amount, inBody, true)
+	return sim.fail(inMsg, exitCode)
+}
+
+// FailedUnstake simulates a reserve_tokens message the treasury fails to process with the exit code. The message is
+// bounced back to the j-wallet, so its tokens are left as they are.
+func (sim *Simulator) FailedUnstake(walletId tongo.AccountID, tokens *big.Int, exitCode int32) (tongo.Transaction, error) {
+	sim.mutex.Lock()
+	defer sim.mutex.Unlock()
+
+	w, exist := sim.wallets[walletId]
+	if !exist {
+		return tongo.Transaction{}, ErrorUnknownWallet
+	}
+
+	body := boc.NewCell()
+	tlb.Marshal(body, domain.TlbReserveTokenMessage{
+		Opcode:       tlb.Uint32(usecase.OpcodeReserveToken),
+		QuieryId:     0,
+		Tokens:       tlb.Grams(tokens.Uint64()),
+		Owner:        w.owner.ToMsgAddress(),
+		ReturnExcess: w.owner.ToMsgAddress(),
+	})
+
+	inMsg := sim.ledger.internalMessage(walletId, sim.treasuryId, 100_000_000, body, true)
+	return sim.fail(inMsg, exitCode)
+}
+
+// fail adds a treasury transaction failing to process the message, which bounces it.
+func (sim *Simulator) fail(inMsg tlb.Message, exitCode int32) (tongo.Transaction, error) {
+	trans, err := sim.ledger.transaction(sim.treasuryId, inMsg, []tlb.Message{sim.ledger.bounce(inMsg, bounceFee)}, exitCode)
+	if err != nil {
+		return tongo.Transaction{}, err
+	}
+
+	sim.AddTransactions(sim.treasuryId, trans)
+	return trans, nil
+}
+
+// WalletState returns the current state of a j-wallet, or nil if the simulator doesn't know it.
+func (sim *Simulator) WalletState(walletId tongo.AccountID) *model.WalletState {
+	sim.mutex.Lock()
+	defer sim.mutex.Unlock()
+
+	w, exist := sim.wallets[walletId]
+	if !exist {
+		return nil
+	}
+
+	result := &model.WalletState{}
+	result.Tokens.Set(&w.tokens)
+	result.Unstaking.Set(&w.unstaking)
+	result.Staking = make(map[uint32]tlb.Any)
+	for round := range w.staking {
+		result.Staking[round] = tlb.Any{}
+	}
+	return result
+}
+
+func (sim *Simulator) ensureWallet(owner tongo.AccountID, walletId tongo.AccountID) *jwallet {
+	w, exist := sim.wallets[walletId]
+	if exist {
+		return w
+	}
+
+	w = &jwallet{
+		owner:   owner,
+		staking: make(map[uint32]*big.Int),
+	}
+	sim.wallets[walletId] = w
+	sim.SetMethod(walletId, "get_wallet_state", func(tlb.VmStack) (uint32, tlb.VmStack, error) {
+		return sim.getWalletState(walletId)
+	})
+	return w
+}
+
+//-------------------------------------------------------------------
+// Driver messages
+
+// receiveExternal is called for every external message sent through the simulator. Messages of the
+// driver wallet are unpacked and their internal messages are delivered to the j-wallets.
+func (sim *Simulator) receiveExternal(dest tongo.AccountID, msg tlb.Message) error {
+	if dest != sim.driverId {
+		return nil
+	}
+
+	sim.mutex.Lock()
+	defer sim.mutex.Unlock()
+
+	rawMessages, err := sim.driverMessages(msg, true)
+	if err != nil {
+		return err
+	}
+
+	outMsgs := make([]tlb.Message, 0, len(rawMessages))
+	for _, intMsg := range rawMessages {
+		// Fill in the fields the wallet contract would fill in.
+		outMsg := sim.ledger.forward(sim.driverId, intMsg)
+		outMsgs = append(outMsgs, outMsg)
+		sim.driverBalance -= model.NewHMessage(&outMsg).Value()
+	}
+
+	trans, err := sim.ledger.transaction(sim.driverId, msg, outMsgs, 0)
+	if err != nil {
+		return err
+	}
+	sim.AddTransactions(sim.driverId, trans)
+
+	// Deliver the messages as the transaction created them.
+	for _, outMsg := range trans.Msgs.OutMsgs.Values() {
+		err = sim.deliver(outMsg.Value)
+		if err != nil {
+			return err
+		}
+	}
+	sim.SetAccountState(sim.driverId, activeAccount(sim.driverId, sim.driverBalance))
+
+	return nil
+}
+
+// driverMessages extracts the internal messages of an external message sent to the driver wallet. The query of a
+// highload transfer is marked as processed if accept is true.
+func (sim *Simulator) driverMessages(msg tlb.Message, accept bool) ([]tlb.Message, error) {
+	if !sim.driverHighload {
+		cell := boc.NewCell()
+		err := tlb.Marshal(cell, msg)
+		if err != nil {
+			return nil, err
+		}
+
+		rawMessages, err := tgwallet.ExtractRawMessages(tgwallet.V4R2, cell)
+		if err != nil {
+			return nil, err
+		}
+
+		result := make([]tlb.Message, len(rawMessages))
+		for i, raw := range rawMessages {
+			err = tlb.Unmarshal(raw.Message, &result[i])
+			if err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	}
+
+	var signed tgwallet.SignedMsgBody
+	bodyCell := boc.Cell(msg.Body.Value)
+	err := tlb.Unmarshal(&bodyCell, &signed)
+	if err != nil {
+		return nil, err
+	}
+
+	var body highloadMessage
+	payloadCell := boc.Cell(signed.Message)
+	err = tlb.Unmarshal(&payloadCell, &body)
+	if err != nil {
+		return nil, err
+	}
+
+	// A query is accepted only once, as the contract does.
+	if sim.driverQueries[body.QueryId] {
+		return nil, ErrorQueryProcessed
+	}
+	if accept {
+		sim.driverQueries[body.QueryId] = true
+	}
+
+	result := make([]tlb.Message, 0, len(body.Messages.Values()))
+	for _, raw := range body.Messages.Values() {
+		result = append(result, raw.Message.Value)
+	}
+	return result, nil
+}
+
+// deliver applies the effect of an internal message sent by the driver on the destination j-wallet. A message the
+// j-wallet rejects is bounced back to the driver wallet if it's bounceable.
+func (sim *Simulator) deliver(msg tlb.Message) error {
+	hmsg := model.NewHMessage(&msg)
+	dest := hmsg.Dest()
+	if dest == nil {
+		return nil
+	}
+
+	w, exist := sim.wallets[*dest]
+	if !exist {
+		return nil
+	}
+
+	exitCode := sim.apply(w, hmsg)
+	trans, err := sim.ledger.transaction(*dest, msg, sim.replies(*dest, msg, exitCode), exitCode)
+	if err != nil {
+		return err
+	}
+	sim.AddTransactions(*dest, trans)
+
+	// Bounces and excesses sent to the driver wallet are received by it.
+	for _, outMsg := range trans.Msgs.OutMsgs.Values() {
+		returned := model.NewHMessage(&outMsg.Value)
+		if returned.Dest() == nil || *returned.Dest() != sim.driverId {
+			continue
+		}
+		received, err := sim.ledger.transaction(sim.driverId, outMsg.Value, nil, 0)
+		if err != nil {
+			return err
+		}
+		sim.AddTransactions(sim.driverId, received)
+		sim.driverBalance += returned.Value()
+	}
+
+	return nil
+}
+
+// replies returns what a j-wallet sends back for a message it processed with the exit code: a bounce if it
+// rejected a bounceable message, or the excess if it accepted it.
+func (sim *Simulator) replies(walletId tongo.AccountID, msg tlb.Message, exitCode int32) []tlb.Message {
+	hmsg := model.NewHMessage(&msg)
+
+	outMsgs := []tlb.Message{}
+	if exitCode != 0 && msg.Info.IntMsgInfo.Bounce {
+		outMsgs = append(outMsgs, sim.ledger.bounce(msg, bounceFee))
+	}
+	if exitCode == 0 {
+		// The unused part of the attached coins is returned to the excess address.
+		queryId, returnExcess := excessOf(hmsg)
+		if returnExcess != nil && hmsg.Value() > excessFee {
+			body := boc.NewCell()
+			body.WriteUint(uint64(usecase.OpcodeExcesses), 32)
+			body.WriteUint(queryId, 64)
+			outMsgs = append(outMsgs, sim.ledger.internalMessage(walletId, *returnExcess, hmsg.Value()-excessFee, body, false))
+		}
+	}
+	return outMsgs
+}
+
+//-------------------------------------------------------------------
+// Emulation
+
+// Emulate runs a message to the driver wallet or a j-wallet, and returns the transaction processing it, without
+// changing anything. Transactions of other accounts cannot be emulated.
+func (sim *Simulator) Emulate(ctx context.Context, msg tlb.Message) (tlb.Transaction, error) {
+	sim.mutex.Lock()
+	defer sim.mutex.Unlock()
+
+	hmsg := model.NewHMessage(&msg)
+	dest := hmsg.Dest()
+	if dest == nil {
+		return tlb.Transaction{}, ErrorUnknownWallet
+	}
+
+	if *dest == sim.driverId && hmsg.IsExternalIn() {
+		rawMessages, err := sim.driverMessages(msg, false)
+		if errors.Is(err, ErrorQueryProcessed) {
+			return tlb.Transaction{}, fmt.Errorf("%w - %v", usecase.ErrorNotAccepted, err.Error())
+		}
+		if err != nil {
+			return tlb.Transaction{}, err
+		}
+
+		outMsgs := make([]tlb.Message, 0, len(rawMessages))
+		for _, intMsg := range rawMessages {
+			outMsgs = append(outMsgs, sim.ledger.forward(sim.driverId, intMsg))
+		}
+		trans, err := sim.ledger.transaction(sim.driverId, msg, outMsgs, 0)
+		return trans.Transaction, err
+	}
+
+	w, exist := sim.wallets[*dest]
+	if !exist || msg.Info.IntMsgInfo == nil {
+		return tlb.Transaction{}, ErrorUnknownWallet
+	}
+	exitCode := sim.check(w, hmsg)
+	trans, err := sim.ledger.transaction(*dest, msg, sim.replies(*dest, msg, exitCode), exitCode)
+	return trans.Transaction, err
+}
+
+// excessOf returns the query id and the excess address of a message sent by the driver. The excess address is nil
+// if there is none.
+func excessOf(hmsg *model.HMessage) (uint64, *tongo.AccountID) {
+	var queryId tlb.Uint64
+	var returnExcess tlb.MsgAddress
+	switch hmsg.Opcode() {
+	case domain.OpcodeStakeCoin:
+		tlbm := domain.TlbStakeCoinMessage{}
+		if tlb.Unmarshal(hmsg.GetBody(), &tlbm) != nil {
+			return 0, nil
+		}
+		queryId, returnExcess = tlbm.QuieryId, tlbm.ReturnExcess
+	case domain.OpcodeWithdraw:
+		tlbm := domain.TlbWithdrawMessage{}
+		if tlb.Unmarshal(hmsg.GetBody(), &tlbm) != nil {
+			return 0, nil
+		}
+		queryId, returnExcess = tlbm.QuieryId, tlbm.ReturnExcess
+	default:
+		return 0, nil
+	}
+
+	accountId, err := tongo.AccountIDFromTlb(returnExcess)
+	if err != nil {
+		return 0, nil
+	}
+	return uint64(queryId), accountId
+}
+
+// check returns the exit code of processing the message by the j-wallet, without changing anything.
+func (sim *Simulator) check(w *jwallet, hmsg *model.HMessage) int32 {
+	switch hmsg.Opcode() {
+	case domain.OpcodeStakeCoin:
+		tlbm := domain.TlbStakeCoinMessage{}
+		if tlb.Unmarshal(hmsg.GetBody(), &tlbm) != nil {
+			return ExitCodeNotStaking
+		}
+
+		roundSince := uint32(tlbm.RoundSince)
+		if _, exist := w.staking[roundSince]; !exist {
+			return ExitCodeNotStaking
+		}
+		if sim.participations[roundSince] {
+			return ExitCodeRoundOngoing
+		}
+
+	case domain.OpcodeWithdraw:
+		if w.unstaking.Sign() == 0 {
+			return ExitCodeNotUnstaking
+		}
+		if w.unstaking.Cmp(&sim.maxBurnable) > 0 {
+			return ExitCodeNotBurnable
+		}
+	}
+
+	return 0
+}
+
+// apply changes the j-wallet by the message, and returns the exit code of processing it.
+func (sim *Simulator) apply(w *jwallet, hmsg *model.HMessage) int32 {
+	exitCode := sim.check(w, hmsg)
+	if exitCode != 0 {
+		return exitCode
+	}
+
+	switch hmsg.Opcode() {
+	case domain.OpcodeStakeCoin:
+		tlbm := domain.TlbStakeCoinMessage{}
+		tlb.Unmarshal(hmsg.GetBody(), &tlbm)
+
+		roundSince := uint32(tlbm.RoundSince)
+		staking := w.staking[roundSince]
+		w.tokens.Add(&w.tokens, staking)
+		sim.totalTokens.Add(&sim.totalTokens, staking)
+		sim.totalCoins.Add(&sim.totalCoins, staking)
+		sim.totalStaking.Sub(&sim.totalStaking, staking)
+		delete(w.staking, roundSince)
+
+	case domain.OpcodeWithdraw:
+		sim.maxBurnable.Sub(&sim.maxBurnable, &w.unstaking)
+		sim.totalTokens.Sub(&sim.totalTokens, &w.unstaking)
+		sim.totalCoins.Sub(&sim.totalCoins, &w.unstaking)
+		sim.totalUnstaking.Sub(&sim.totalUnstaking, &w.unstaking)
+		w.unstaking.SetInt64(0)
+	}
+
+	return 0
+}
@@ -0,0 +1,159 @@
+package simulator_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"driver/domain"
+	"driver/domain/model"
+	"driver/infrastructure/simulator"
+	"driver/usecase"
+	"math/big"
+	"testing"
+
+	"github.com/tonkeeper/tongo"
+	"github.com/tonkeeper/tongo/tlb"
+	"github.com/tonkeeper/tongo/wallet"
+)
+
+func account(kind byte, idx int) tongo.AccountID {
+	var address tongo.Bits256
+	address[0] = kind
+	address[1] = byte(idx)
+	return *tongo.NewAccountId(0, address)
+}
+
+func newSimulator(t *testing.T) (*simulator.Simulator, wallet.Wallet) {
+	key := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	address, err := wallet.GenerateWalletAddress(key.Public().(ed25519.PublicKey), wallet.V4R2, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sim := simulator.NewSimulator(account(1, 0), address)
+	driverWallet, err := wallet.New(key, wallet.V4R2, 0, nil, sim)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sim, driverWallet
+}
+
+func walletState(t *testing.T, contract *usecase.ContractInteractor, walletId tongo.AccountID) *model.WalletState {
+	state, err := contract.GetWalletState(context.Background(), walletId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return state
+}
+
+func TestStakeCoins(t *testing.T) {
+	sim, driverWallet := newSimulator(t)
+	contract := usecase.NewContractInteractor(sim)
+	owner, walletId := account(2, 0), account(3, 0)
+	driverId := driverWallet.GetAddress()
+
+	sim.StartRound(100)
+	trans, err := sim.Deposit(owner, walletId, 5_000_000_000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trans.Msgs.OutMsgs.Values()) != 1 {
+		t.Fatalf("deposit sent %v messages, want a save_coins message", len(trans.Msgs.OutMsgs.Values()))
+	}
+	outMsg := trans.Msgs.OutMsgs.Values()[0].Value
+	if opcode := model.NewHMessage(&outMsg).Opcode(); opcode != usecase.OpcodeSaveCoin {
+		t.Fatalf("deposit sent opcode %x, want save_coins", opcode)
+	}
+	state := walletState(t, contract, walletId)
+	if _, exist := state.Staking[100]; !exist || state.Tokens.Sign() != 0 {
+		t.Fatalf("j-wallet has %v tokens and staking %v, want the coins staking for round 100", &state.Tokens, state.Staking)
+	}
+
+	stake := func() {
+		err := driverWallet.Send(context.Background(), domain.StakeCoinMessage{
+			AccountId: walletId,
+			TlbMsg: domain.TlbStakeCoinMessage{
+				Opcode:       tlb.Uint32(domain.OpcodeStakeCoin),
+				RoundSince:   100,
+				ReturnExcess: driverId.ToMsgAddress(),
+			},
+		}.MakeMessage())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The j-wallet ignores stake_coins while the round is ongoing.
+	stake()
+	state = walletState(t, contract, walletId)
+	if _, exist := state.Staking[100]; !exist || state.Tokens.Sign() != 0 {
+		t.Fatalf("j-wallet has %v tokens during the round, want none", &state.Tokens)
+	}
+
+	sim.FinishRound(100)
+	stake()
+	state = walletState(t, contract, walletId)
+	if len(state.Staking) != 0 || state.Tokens.Cmp(big.NewInt(5_000_000_000)) != 0 {
+		t.Fatalf("j-wallet has %v tokens and staking %v, want the coins staked", &state.Tokens, state.Staking)
+	}
+}
+
+func TestWithdrawTokens(t *testing.T) {
+	sim, driverWallet := newSimulator(t)
+	contract := usecase.NewContractInteractor(sim)
+	owner, walletId := account(2, 0), account(3, 0)
+	driverId := driverWallet.GetAddress()
+
+	sim.StartRound(100)
+	_, err := sim.Deposit(owner, walletId, 5_000_000_000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.FinishRound(100)
+	err = driverWallet.Send(context.Background(), domain.StakeCoinMessage{
+		AccountId: walletId,
+		TlbMsg: domain.TlbStakeCoinMessage{
+			Opcode:       tlb.Uint32(domain.OpcodeStakeCoin),
+			RoundSince:   100,
+			ReturnExcess: driverId.ToMsgAddress(),
+		},
+	}.MakeMessage())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = sim.Unstake(walletId, big.NewInt(2_000_000_000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := walletState(t, contract, walletId)
+	if state.Tokens.Cmp(big.NewInt(3_000_000_000)) != 0 || state.Unstaking.Cmp(big.NewInt(2_000_000_000)) != 0 {
+		t.Fatalf("j-wallet has %v tokens and %v unstaking, want 3 TON and 2 TON", &state.Tokens, &state.Unstaking)
+	}
+
+	withdraw := func() {
+		err := driverWallet.Send(context.Background(), domain.WithdrawMessage{
+			AccountId: walletId,
+			TlbMsg: domain.TlbWithdrawMessage{
+				Opcode:       tlb.Uint32(domain.OpcodeWithdraw),
+				ReturnExcess: driverId.ToMsgAddress(),
+			},
+		}.MakeMessage())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The treasury cannot burn the tokens until it has the budget for them.
+	withdraw()
+	state = walletState(t, contract, walletId)
+	if state.Unstaking.Sign() == 0 {
+		t.Fatal("j-wallet withdrew the tokens without a burnable budget")
+	}
+
+	sim.SetMaxBurnableTokens(big.NewInt(2_000_000_000))
+	withdraw()
+	state = walletState(t, contract, walletId)
+	if state.Unstaking.Sign() != 0 || state.Tokens.Cmp(big.NewInt(3_000_000_000)) != 0 {
+		t.Fatalf("j-wallet has %v tokens and %v unstaking, want the unstaking tokens withdrawn", &state.Tokens, &state.Unstaking)
+	}
+}
@@ -5,11 +5,14 @@ import (
 )
 
 const (
-	METRIC_ERROR_COUNT = "error_count"
+	METRIC_ERROR_COUNT           = "error_count"
+	METRIC_DRIVER_WALLET_BALANCE = "driver_wallet_balance"
+	METRIC_SPEND_LOCKED          = "spend_locked"
 )
 
 var (
 	counters map[string]prometheus.Counter
+	gauges   map[string]prometheus.Gauge
 )
 
 func Init() {
@@ -18,6 +21,7 @@ func Init() {
 
 	// Create metric spaces
 	counters = make(map[string]prometheus.Counter)
+	gauges = make(map[string]prometheus.Gauge)
 
 	// Register metrics
 	counter := prometheus.NewCounter(prometheus.CounterOpts{
@@ -28,12 +32,48 @@ func Init() {
 	})
 	prometheus.MustRegister(counter)
 	counters[METRIC_ERROR_COUNT] = counter
+
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "hipo",
+		Subsystem: "driver",
+		Name:      METRIC_DRIVER_WALLET_BALANCE,
+		Help:      "The balance of the driver wallet in TON",
+	})
+	prometheus.MustRegister(gauge)
+	gauges[METRIC_DRIVER_WALLET_BALANCE] = gauge
+
+	gauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "hipo",
+		Subsystem: "driver",
+		Name:      METRIC_SPEND_LOCKED,
+		Help:      "Whether the driver wallet is locked for hitting a spend cap, 1 if it is",
+	})
+	prometheus.MustRegister(gauge)
+	gauges[METRIC_SPEND_LOCKED] = gauge
 }
 
 func GetCounter(name string) prometheus.Counter {
 	return counters[name]
 }
 
+func GetGauge(name string) prometheus.Gauge {
+	return gauges[name]
+}
+
 func IncErrorCount() {
 	counters[METRIC_ERROR_COUNT].Inc()
 }
+
+// SetDriverWalletBalance sets the balance of the driver wallet, given in TON.
+func SetDriverWalletBalance(balance float64) {
+	gauges[METRIC_DRIVER_WALLET_BALANCE].Set(balance)
+}
+
+// SetSpendLocked tells whether the driver wallet is locked for hitting a spend cap.
+func SetSpendLocked(locked bool) {
+	value := 0.0
+	if locked {
+		value = 1
+	}
+	gauges[METRIC_SPEND_LOCKED].Set(value)
+}
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"driver/domain"
+	"encoding/json"
+
+	"github.com/behrang/sqlbatch"
+	"github.com/tonkeeper/tongo/tlb"
+)
+
+const (
+	sqlEventInsertIfNotExists = `
+	insert into events (
+			hash, lt, executed_at, opcode, source, value, success,
+			total_fee, process_fee, storage_fee, in_msg_fee, out_msgs_fee, out_messages, created_at
+		)
+		values (
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13::jsonb, now()
+		)
+	on conflict (hash) do nothing
+`
+
+	sqlEventFind = `
+	select
+		hash, lt, executed_at, opcode, source, value, success,
+		total_fee, process_fee, storage_fee, in_msg_fee, out_msgs_fee, out_messages, created_at
+	from events
+	where hash = $1
+`
+)
+
+// eventQueries keeps the SQL commands of a database dialect.
+type eventQueries struct {
+	insertIfNotExists string
+	find              string
+}
+
+var postgresEventQueries = eventQueries{
+	insertIfNotExists: sqlEventInsertIfNotExists,
+	find:              sqlEventFind,
+}
+
+// EventRepository keeps every treasury transaction, decoded, for auditing.
+type EventRepository struct {
+	batchHandler BatchHandler
+	queries      eventQueries
+}
+
+func NewEventRepository(db BatchHandler) *EventRepository {
+	return &EventRepository{batchHandler: db, queries: postgresEventQueries}
+}
+
+func readEvent(scan func(...interface{}) error) (interface{}, error) {
+	e := domain.Event{}
+	var lt, opcode, value, totalFee, processFee, storageFee, inMsgFee, outMsgsFee int64
+	var outMessagesJson []byte
+	err := scan(&e.Hash, &lt, &e.ExecutedAt, &opcode, &e.Source, &value, &e.Success,
+		&totalFee, &processFee, &storageFee, &inMsgFee, &outMsgsFee, &outMessagesJson, &e.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	e.Lt = uint64(lt)
+	e.Opcode = uint32(opcode)
+	e.Value = tlb.Grams(value)
+	e.Fees = domain.EventFees{
+		Total:   tlb.Grams(totalFee),
+		Process: tlb.Grams(processFee),
+		Storage: tlb.Grams(storageFee),
+		InMsg:   tlb.Grams(inMsgFee),
+		OutMsgs: tlb.Grams(outMsgsFee),
+	}
+	err = json.Unmarshal(outMessagesJson, &e.OutMessages)
+	return &e, err
+}
+
+// InsertAll keeps the events, and leaves the ones already kept as they are.
+func (repo *EventRepository) InsertAll(events []domain.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	commands := make([]sqlbatch.Command, 0, len(events))
+	for _, e := range events {
+		outMessagesJson, _ := json.Marshal(e.OutMessages)
+		commands = append(commands, sqlbatch.Command{
+			Query: repo.queries.insertIfNotExists,
+			Args: []interface{}{
+				e.Hash, int64(e.Lt), e.ExecutedAt, int64(e.Opcode), e.Source, int64(e.Value), e.Success,
+				int64(e.Fees.Total), int64(e.Fees.Process), int64(e.Fees.Storage), int64(e.Fees.InMsg), int64(e.Fees.OutMsgs),
+				outMessagesJson,
+			},
+		})
+	}
+
+	_, err := repo.batchHandler.Batch(&BatchOptionNormal, commands)
+	return err
+}
+
+func (repo *EventRepository) Find(hash string) (*domain.Event, error) {
+	results, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
+		{
+			Query:   repo.queries.find,
+			Args:    []interface{}{hash},
+			ReadOne: readEvent,
+		},
+	})
+	result, _ := results[0].(*domain.Event)
+	return result, err
+}
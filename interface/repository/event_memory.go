@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"driver/domain"
+	"sync"
+	"time"
+)
+
+// MemoryEventRepository keeps events in memory. It behaves like EventRepository and is meant for tests and
+// short-lived runs.
+type MemoryEventRepository struct {
+	mutex  sync.Mutex
+	events map[string]*domain.Event
+}
+
+func NewMemoryEventRepository() *MemoryEventRepository {
+	return &MemoryEventRepository{
+		events: make(map[string]*domain.Event),
+	}
+}
+
+func (repo *MemoryEventRepository) InsertAll(events []domain.Event) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	for _, e := range events {
+		if _, exist := repo.events[e.Hash]; exist {
+			continue
+		}
+		event := e
+		event.CreatedAt = time.Now()
+		repo.events[e.Hash] = &event
+	}
+	return nil
+}
+
+func (repo *MemoryEventRepository) Find(hash string) (*domain.Event, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	event, exist := repo.events[hash]
+	if !exist {
+		return nil, nil
+	}
+	e := *event
+	return &e, nil
+}
@@ -0,0 +1,31 @@
+package repository
+
+const (
+	sqliteEventInsertIfNotExists = `
+	insert into events (
+			hash, lt, executed_at, opcode, source, value, success,
+			total_fee, process_fee, storage_fee, in_msg_fee, out_msgs_fee, out_messages, created_at
+		)
+		values (
+			?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9, ?10, ?11, ?12, ?13, CURRENT_TIMESTAMP
+		)
+	on conflict (hash) do nothing
+`
+
+	sqliteEventFind = `
+	select
+		hash, lt, executed_at, opcode, source, value, success,
+		total_fee, process_fee, storage_fee, in_msg_fee, out_msgs_fee, out_messages, created_at
+	from events
+	where hash = ?1
+`
+)
+
+var sqliteEventQueries = eventQueries{
+	insertIfNotExists: sqliteEventInsertIfNotExists,
+	find:              sqliteEventFind,
+}
+
+func NewSQLiteEventRepository(db BatchHandler) *EventRepository {
+	return &EventRepository{batchHandler: db, queries: sqliteEventQueries}
+}
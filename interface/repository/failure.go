@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"driver/domain"
+	"time"
+
+	"github.com/behrang/sqlbatch"
+	"github.com/tonkeeper/tongo/tlb"
+)
+
+const (
+	sqlFailureInsertIfNotExists = `
+	insert into failed_requests (
+			hash, lt, executed_at, kind, sender, value, exit_code, bounced, final_mc_seqno, created_at
+		)
+		values (
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, now()
+		)
+	on conflict (hash) do nothing
+`
+
+	sqlFailureFind = `
+	select
+		hash, lt, executed_at, kind, sender, value, exit_code, bounced, final_mc_seqno, created_at
+	from failed_requests
+	where hash = $1
+`
+
+	sqlFailureFindAll = `
+	select
+		hash, lt, executed_at, kind, sender, value, exit_code, bounced, final_mc_seqno, created_at
+	from failed_requests
+	where executed_at >= $1
+	order by lt desc
+	limit $2
+`
+
+	sqlFailureFindBySender = `
+	select
+		hash, lt, executed_at, kind, sender, value, exit_code, bounced, final_mc_seqno, created_at
+	from failed_requests
+	where sender = $1
+	order by lt desc
+	limit $2
+`
+)
+
+// failureQueries keeps the SQL commands of a database dialect.
+type failureQueries struct {
+	insertIfNotExists string
+	find              string
+	findAll           string
+	findBySender      string
+}
+
+var postgresFailureQueries = failureQueries{
+	insertIfNotExists: sqlFailureInsertIfNotExists,
+	find:              sqlFailureFind,
+	findAll:           sqlFailureFindAll,
+	findBySender:      sqlFailureFindBySender,
+}
+
+// FailureRepository keeps the deposits and unstakes the treasury failed to process.
+type FailureRepository struct {
+	batchHandler BatchHandler
+	queries      failureQueries
+}
+
+func NewFailureRepository(db BatchHandler) *FailureRepository {
+	return &FailureRepository{batchHandler: db, queries: postgresFailureQueries}
+}
+
+func scanFailure(scan func(...interface{}) error) (*domain.FailedRequest, error) {
+	f := domain.FailedRequest{}
+	var lt, value int64
+	err := scan(&f.Hash, &lt, &f.ExecutedAt, &f.Kind, &f.Sender, &value, &f.ExitCode, &f.Bounced, &f.FinalMcSeqno, &f.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	f.Lt = uint64(lt)
+	f.Value = tlb.Grams(value)
+	return &f, nil
+}
+
+func readFailure(scan func(...interface{}) error) (interface{}, error) {
+	return scanFailure(scan)
+}
+
+func readAllFailures(memo interface{}, scan func(...interface{}) error) (interface{}, error) {
+	list := memo.([]*domain.FailedRequest)
+	f, err := scanFailure(scan)
+	if err != nil {
+		return list, err
+	}
+	return append(list, f), nil
+}
+
+// InsertAll keeps the failed requests, and leaves the ones already kept as they are.
+func (repo *FailureRepository) InsertAll(requests []domain.FailedRequest) error {
+	if len(requests) == 0 {
+		return nil
+	}
+
+	commands := make([]sqlbatch.Command, 0, len(requests))
+	for _, f := range requests {
+		commands = append(commands, sqlbatch.Command{
+			Query: repo.queries.insertIfNotExists,
+			Args: []interface{}{
+				f.Hash, int64(f.Lt), f.ExecutedAt, f.Kind, f.Sender, int64(f.Value), f.ExitCode, f.Bounced, f.FinalMcSeqno,
+			},
+		})
+	}
+
+	_, err := repo.batchHandler.Batch(&BatchOptionNormal, commands)
+	return err
+}
+
+func (repo *FailureRepository) Find(hash string) (*domain.FailedRequest, error) {
+	results, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
+		{
+			Query:   repo.queries.find,
+			Args:    []interface{}{hash},
+			ReadOne: readFailure,
+		},
+	})
+	result, _ := results[0].(*domain.FailedRequest)
+	return result, err
+}
+
+// FindAll returns the requests failed since the time, the latest first.
+func (repo *FailureRepository) FindAll(since time.Time, limit int) ([]*domain.FailedRequest, error) {
+	results, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
+		{
+			Query:   repo.queries.findAll,
+			Args:    []interface{}{since, limit},
+			Init:    make([]*domain.FailedRequest, 0),
+			ReadAll: readAllFailures,
+		},
+	})
+	result, _ := results[0].([]*domain.FailedRequest)
+	return result, err
+}
+
+// FindBySender returns the failed requests sent by the address, the latest first.
+func (repo *FailureRepository) FindBySender(sender string, limit int) ([]*domain.FailedRequest, error) {
+	results, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
+		{
+			Query:   repo.queries.findBySender,
+			Args:    []interface{}{sender, limit},
+			Init:    make([]*domain.FailedRequest, 0),
+			ReadAll: readAllFailures,
+		},
+	})
+	result, _ := results[0].([]*domain.FailedRequest)
+	return result, err
+}
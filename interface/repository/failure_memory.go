@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"driver/domain"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryFailureRepository keeps failed requests in memory. It behaves like FailureRepository and is meant for tests
+// and short-lived runs.
+type MemoryFailureRepository struct {
+	mutex    sync.Mutex
+	requests map[string]*domain.FailedRequest
+}
+
+func NewMemoryFailureRepository() *MemoryFailureRepository {
+	return &MemoryFailureRepository{
+		requests: make(map[string]*domain.FailedRequest),
+	}
+}
+
+func (repo *MemoryFailureRepository) InsertAll(requests []domain.FailedRequest) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	for _, f := range requests {
+		if _, exist := repo.requests[f.Hash]; exist {
+			continue
+		}
+		request := f
+		request.CreatedAt = time.Now()
+		repo.requests[f.Hash] = &request
+	}
+	return nil
+}
+
+func (repo *MemoryFailureRepository) Find(hash string) (*domain.FailedRequest, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	request, exist := repo.requests[hash]
+	if !exist {
+		return nil, nil
+	}
+	f := *request
+	return &f, nil
+}
+
+func (repo *MemoryFailureRepository) FindAll(since time.Time, limit int) ([]*domain.FailedRequest, error) {
+	return repo.findAll(func(f *domain.FailedRequest) bool {
+		return !f.ExecutedAt.Before(since)
+	}, limit), nil
+}
+
+func (repo *MemoryFailureRepository) FindBySender(sender string, limit int) ([]*domain.FailedRequest, error) {
+	return repo.findAll(func(f *domain.FailedRequest) bool {
+		return f.Sender != nil && *f.Sender == sender
+	}, limit), nil
+}
+
+func (repo *MemoryFailureRepository) findAll(match func(f *domain.FailedRequest) bool, limit int) []*domain.FailedRequest {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	list := make([]*domain.FailedRequest, 0)
+	for _, f := range repo.requests {
+		if match(f) {
+			request := *f
+			list = append(list, &request)
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Lt > list[j].Lt
+	})
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	return list
+}
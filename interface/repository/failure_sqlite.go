@@ -0,0 +1,50 @@
+package repository
+
+// Timestamps are compared through julianday, as they are kept as text in SQLite.
+const (
+	sqliteFailureInsertIfNotExists = `
+	insert into failed_requests (
+			hash, lt, executed_at, kind, sender, value, exit_code, bounced, final_mc_seqno, created_at
+		)
+		values (
+			?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9, CURRENT_TIMESTAMP
+		)
+	on conflict (hash) do nothing
+`
+
+	sqliteFailureFind = `
+	select
+		hash, lt, executed_at, kind, sender, value, exit_code, bounced, final_mc_seqno, created_at
+	from failed_requests
+	where hash = ?1
+`
+
+	sqliteFailureFindAll = `
+	select
+		hash, lt, executed_at, kind, sender, value, exit_code, bounced, final_mc_seqno, created_at
+	from failed_requests
+	where julianday(executed_at) >= julianday(?1)
+	order by lt desc
+	limit ?2
+`
+
+	sqliteFailureFindBySender = `
+	select
+		hash, lt, executed_at, kind, sender, value, exit_code, bounced, final_mc_seqno, created_at
+	from failed_requests
+	where sender = ?1
+	order by lt desc
+	limit ?2
+`
+)
+
+var sqliteFailureQueries = failureQueries{
+	insertIfNotExists: sqliteFailureInsertIfNotExists,
+	find:              sqliteFailureFind,
+	findAll:           sqliteFailureFindAll,
+	findBySender:      sqliteFailureFindBySender,
+}
+
+func NewSQLiteFailureRepository(db BatchHandler) *FailureRepository {
+	return &FailureRepository{batchHandler: db, queries: sqliteFailureQueries}
+}
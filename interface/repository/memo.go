@@ -27,12 +27,24 @@ const (
 `
 )
 
+// memoQueries keeps the SQL commands of a database dialect.
+type memoQueries struct {
+	upsert string
+	find   string
+}
+
+var postgresMemoQueries = memoQueries{
+	upsert: sqlMemoUpsert,
+	find:   sqlMemoFind,
+}
+
 type MemoRepository struct {
 	batchHandler BatchHandler
+	queries      memoQueries
 }
 
 func NewMemoRepository(db BatchHandler) *MemoRepository {
-	return &MemoRepository{batchHandler: db}
+	return &MemoRepository{batchHandler: db, queries: postgresMemoQueries}
 }
 
 func readMemo(scan func(...interface{}) error) (interface{}, error) {
@@ -68,14 +80,14 @@ func (repo *MemoRepository) Upsert(key string, memo domain.Memorable) (*domain.M
 	jstr := memo.ToJson()
 	results, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
 		{
-			Query: sqlMemoUpsert,
+			Query: repo.queries.upsert,
 			Args: []interface{}{
 				key, jstr,
 			},
 			Affect: 1,
 		},
 		{
-			Query:   sqlMemoFind,
+			Query:   repo.queries.find,
 			Args:    []interface{}{key},
 			ReadOne: readMemo,
 		},
@@ -88,7 +100,7 @@ func (repo *MemoRepository) Upsert(key string, memo domain.Memorable) (*domain.M
 func (repo *MemoRepository) Find(key string) (*domain.Memo, error) {
 	results, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
 		{
-			Query:   sqlMemoFind,
+			Query:   repo.queries.find,
 			Args:    []interface{}{key},
 			ReadOne: readMemo,
 		},
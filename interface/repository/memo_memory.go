@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"driver/domain"
+	"sync"
+)
+
+// MemoryMemoRepository keeps memos in memory. It behaves like MemoRepository and is meant for tests and
+// short-lived runs.
+type MemoryMemoRepository struct {
+	mutex sync.Mutex
+	memos map[string]string
+}
+
+func NewMemoryMemoRepository() *MemoryMemoRepository {
+	return &MemoryMemoRepository{memos: make(map[string]string)}
+}
+
+func (repo *MemoryMemoRepository) Upsert(key string, memo domain.Memorable) (*domain.Memo, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	repo.memos[key] = memo.ToJson()
+	return &domain.Memo{Key: key, Memo: repo.memos[key]}, nil
+}
+
+func (repo *MemoryMemoRepository) Find(key string) (*domain.Memo, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	jstr, exist := repo.memos[key]
+	if !exist {
+		return nil, nil
+	}
+	return &domain.Memo{Key: key, Memo: jstr}, nil
+}
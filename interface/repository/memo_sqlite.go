@@ -0,0 +1,31 @@
+package repository
+
+const (
+	sqliteMemoUpsert = `
+	insert into memos as c (
+			key, memo
+		)
+		values (
+			?1, ?2
+		)
+	on conflict (key) do
+		update set
+			memo = ?2
+`
+
+	sqliteMemoFind = `
+	select
+		key, memo
+	from memos
+	where key = ?1
+`
+)
+
+var sqliteMemoQueries = memoQueries{
+	upsert: sqliteMemoUpsert,
+	find:   sqliteMemoFind,
+}
+
+func NewSQLiteMemoRepository(db BatchHandler) *MemoRepository {
+	return &MemoRepository{batchHandler: db, queries: sqliteMemoQueries}
+}
@@ -0,0 +1,276 @@
+package repository
+
+import (
+	"database/sql"
+	"driver/domain"
+	"time"
+
+	"github.com/behrang/sqlbatch"
+)
+
+const (
+	sqlOutboxEnqueue = `
+	insert into outbox (
+			reference, kind, destination, query_id, message, mode, state, transfer_id, valid_until, created_at, sent_at
+		)
+		select
+			$1, $2, $3, $4, $5, $6, 'pending', null, null, now(), null
+		where not exists (
+			select 1 from outbox where reference = $1 and state in ('pending', 'sending')
+		)
+	returning id
+`
+
+	sqlOutboxFindActive = `
+	select
+		id, reference, kind, destination, query_id, message, mode, state, transfer_id, transfer_hash, valid_until, created_at, sent_at
+	from outbox
+	where reference = $1 and state in ('pending', 'sending')
+`
+
+	sqlOutboxFindAllPending = `
+	select
+		id, reference, kind, destination, query_id, message, mode, state, transfer_id, transfer_hash, valid_until, created_at, sent_at
+	from outbox
+	where state = 'pending'
+	order by id
+	limit $1
+`
+
+	sqlOutboxFindAllSending = `
+	select
+		id, reference, kind, destination, query_id, message, mode, state, transfer_id, transfer_hash, valid_until, created_at, sent_at
+	from outbox
+	where state = 'sending'
+	order by id
+`
+
+	sqlOutboxFindSent = `
+	select
+		id, reference, kind, destination, query_id, message, mode, state, transfer_id, transfer_hash, valid_until, created_at, sent_at
+	from outbox
+	where destination = $1 and query_id = $2 and state = 'sent'
+	order by id desc
+	limit 1
+`
+
+	sqlOutboxFindByQueryId = `
+	select
+		id, reference, kind, destination, query_id, message, mode, state, transfer_id, transfer_hash, valid_until, created_at, sent_at
+	from outbox
+	where query_id = $1
+	order by id desc
+	limit 1
+`
+
+	sqlOutboxSetSending = `
+	update outbox
+		set state = 'sending', transfer_id = $2, transfer_hash = $3, valid_until = $4
+	where id = $1 and state = 'pending'
+`
+
+	sqlOutboxSetSent = `
+	update outbox
+		set state = 'sent', sent_at = $2
+	where id = $1
+`
+
+	sqlOutboxSetState = `
+	update outbox
+		set state = $2, transfer_id = null, transfer_hash = null, valid_until = null
+	where id = $1
+`
+)
+
+// outboxQueries keeps the SQL commands of a database dialect.
+type outboxQueries struct {
+	enqueue        string
+	findActive     string
+	findAllPending string
+	findAllSending string
+	findSent       string
+	findByQueryId  string
+	setSending     string
+	setSent        string
+	setState       string
+}
+
+var postgresOutboxQueries = outboxQueries{
+	enqueue:        sqlOutboxEnqueue,
+	findActive:     sqlOutboxFindActive,
+	findAllPending: sqlOutboxFindAllPending,
+	findAllSending: sqlOutboxFindAllSending,
+	findSent:       sqlOutboxFindSent,
+	findByQueryId:  sqlOutboxFindByQueryId,
+	setSending:     sqlOutboxSetSending,
+	setSent:        sqlOutboxSetSent,
+	setState:       sqlOutboxSetState,
+}
+
+type OutboxRepository struct {
+	batchHandler BatchHandler
+	queries      outboxQueries
+}
+
+func NewOutboxRepository(db BatchHandler) *OutboxRepository {
+	return &OutboxRepository{batchHandler: db, queries: postgresOutboxQueries}
+}
+
+func readOutboxMessage(scan func(...interface{}) error) (interface{}, error) {
+	m := domain.OutboxMessage{}
+	// Query ids and transfer ids are unsigned, but they are kept in signed columns.
+	var queryId int64
+	var transferId sql.NullInt64
+	err := scan(
+		&m.Id, &m.Reference, &m.Kind, &m.Destination, &queryId, &m.Message, &m.Mode, &m.State, &transferId, &m.TransferHash, &m.ValidUntil, &m.CreatedAt, &m.SentAt,
+	)
+	m.QueryId = uint64(queryId)
+	if transferId.Valid {
+		id := uint64(transferId.Int64)
+		m.TransferId = &id
+	}
+	return &m, err
+}
+
+func readAllOutboxMessages(memo interface{}, scan func(...interface{}) error) (interface{}, error) {
+	m, err := readOutboxMessage(scan)
+
+	list := memo.([]*domain.OutboxMessage)
+	list = append(list, m.(*domain.OutboxMessage))
+	return list, err
+}
+
+func readId(scan func(...interface{}) error) (interface{}, error) {
+	var id int64
+	err := scan(&id)
+	return id, err
+}
+
+// Enqueue inserts the message as pending, unless another message with the same reference is pending or sending.
+// It returns false if the message is not inserted.
+func (repo *OutboxRepository) Enqueue(msg *domain.OutboxMessage) (bool, error) {
+	results, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
+		{
+			Query: repo.queries.enqueue,
+			Args: []interface{}{
+				msg.Reference, msg.Kind, msg.Destination, int64(msg.QueryId), msg.Message, msg.Mode,
+			},
+			ReadOne: readId,
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	id, inserted := results[0].(int64)
+	if inserted {
+		msg.Id = id
+		msg.State = domain.OutboxStatePending
+	}
+	return inserted, nil
+}
+
+func (repo *OutboxRepository) FindActive(reference string) (*domain.OutboxMessage, error) {
+	results, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
+		{
+			Query:   repo.queries.findActive,
+			Args:    []interface{}{reference},
+			ReadOne: readOutboxMessage,
+		},
+	})
+	result, _ := results[0].(*domain.OutboxMessage)
+	return result, err
+}
+
+func (repo *OutboxRepository) FindAllPending(limit int) ([]*domain.OutboxMessage, error) {
+	results, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
+		{
+			Query:   repo.queries.findAllPending,
+			Args:    []interface{}{limit},
+			Init:    make([]*domain.OutboxMessage, 0),
+			ReadAll: readAllOutboxMessages,
+		},
+	})
+	result, _ := results[0].([]*domain.OutboxMessage)
+	return result, err
+}
+
+func (repo *OutboxRepository) FindAllSending() ([]*domain.OutboxMessage, error) {
+	results, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
+		{
+			Query:   repo.queries.findAllSending,
+			Args:    []interface{}{},
+			Init:    make([]*domain.OutboxMessage, 0),
+			ReadAll: readAllOutboxMessages,
+		},
+	})
+	result, _ := results[0].([]*domain.OutboxMessage)
+	return result, err
+}
+
+// FindSent returns the latest message sent to the destination with the query id, or nil if there is none.
+func (repo *OutboxRepository) FindSent(destination string, queryId uint64) (*domain.OutboxMessage, error) {
+	results, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
+		{
+			Query:   repo.queries.findSent,
+			Args:    []interface{}{destination, int64(queryId)},
+			ReadOne: readOutboxMessage,
+		},
+	})
+	result, _ := results[0].(*domain.OutboxMessage)
+	return result, err
+}
+
+// FindByQueryId returns the latest message with the query id, in any state, or nil if there is none.
+func (repo *OutboxRepository) FindByQueryId(queryId uint64) (*domain.OutboxMessage, error) {
+	results, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
+		{
+			Query:   repo.queries.findByQueryId,
+			Args:    []interface{}{int64(queryId)},
+			ReadOne: readOutboxMessage,
+		},
+	})
+	result, _ := results[0].(*domain.OutboxMessage)
+	return result, err
+}
+
+// SetSending assigns the pending messages to a transfer, all or none.
+func (repo *OutboxRepository) SetSending(ids []int64, transferId uint64, transferHash string, validUntil time.Time) error {
+	commands := make([]sqlbatch.Command, 0, len(ids))
+	for _, id := range ids {
+		commands = append(commands, sqlbatch.Command{
+			Query:  repo.queries.setSending,
+			Args:   []interface{}{id, int64(transferId), transferHash, validUntil},
+			Affect: 1,
+		})
+	}
+	_, err := repo.batchHandler.Batch(&BatchOptionNormal, commands)
+	return err
+}
+
+func (repo *OutboxRepository) SetSent(ids []int64, timestamp time.Time) error {
+	commands := make([]sqlbatch.Command, 0, len(ids))
+	for _, id := range ids {
+		commands = append(commands, sqlbatch.Command{
+			Query:  repo.queries.setSent,
+			Args:   []interface{}{id, timestamp},
+			Affect: 1,
+		})
+	}
+	_, err := repo.batchHandler.Batch(&BatchOptionNormal, commands)
+	return err
+}
+
+// SetState moves the messages to the given state, detaching them from their transfer.
+func (repo *OutboxRepository) SetState(ids []int64, state string) error {
+	commands := make([]sqlbatch.Command, 0, len(ids))
+	for _, id := range ids {
+		commands = append(commands, sqlbatch.Command{
+			Query:  repo.queries.setState,
+			Args:   []interface{}{id, state},
+			Affect: 1,
+		})
+	}
+	_, err := repo.batchHandler.Batch(&BatchOptionNormal, commands)
+	return err
+}
@@ -0,0 +1,158 @@
+package repository
+
+import (
+	"driver/domain"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryOutboxRepository keeps outbox messages in memory. It behaves like OutboxRepository and is meant for
+// tests and short-lived runs.
+type MemoryOutboxRepository struct {
+	mutex    sync.Mutex
+	lastId   int64
+	messages map[int64]*domain.OutboxMessage
+}
+
+func NewMemoryOutboxRepository() *MemoryOutboxRepository {
+	return &MemoryOutboxRepository{messages: make(map[int64]*domain.OutboxMessage)}
+}
+
+func (repo *MemoryOutboxRepository) Enqueue(msg *domain.OutboxMessage) (bool, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	for _, m := range repo.messages {
+		if m.Reference == msg.Reference && isActive(m.State) {
+			return false, nil
+		}
+	}
+
+	repo.lastId++
+	m := *msg
+	m.Id = repo.lastId
+	m.State = domain.OutboxStatePending
+	m.TransferId = nil
+	m.TransferHash = nil
+	m.ValidUntil = nil
+	m.CreatedAt = time.Now()
+	m.SentAt = nil
+	repo.messages[m.Id] = &m
+
+	msg.Id = m.Id
+	msg.State = m.State
+	return true, nil
+}
+
+func (repo *MemoryOutboxRepository) FindActive(reference string) (*domain.OutboxMessage, error) {
+	list := repo.findAll(func(m *domain.OutboxMessage) bool {
+		return m.Reference == reference && isActive(m.State)
+	})
+	if len(list) == 0 {
+		return nil, nil
+	}
+	return list[0], nil
+}
+
+func (repo *MemoryOutboxRepository) FindAllPending(limit int) ([]*domain.OutboxMessage, error) {
+	list := repo.findAll(func(m *domain.OutboxMessage) bool {
+		return m.State == domain.OutboxStatePending
+	})
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	return list, nil
+}
+
+func (repo *MemoryOutboxRepository) FindAllSending() ([]*domain.OutboxMessage, error) {
+	return repo.findAll(func(m *domain.OutboxMessage) bool {
+		return m.State == domain.OutboxStateSending
+	}), nil
+}
+
+func (repo *MemoryOutboxRepository) FindSent(destination string, queryId uint64) (*domain.OutboxMessage, error) {
+	list := repo.findAll(func(m *domain.OutboxMessage) bool {
+		return m.Destination == destination && m.QueryId == queryId && m.State == domain.OutboxStateSent
+	})
+	if len(list) == 0 {
+		return nil, nil
+	}
+	return list[len(list)-1], nil
+}
+
+func (repo *MemoryOutboxRepository) FindByQueryId(queryId uint64) (*domain.OutboxMessage, error) {
+	list := repo.findAll(func(m *domain.OutboxMessage) bool {
+		return m.QueryId == queryId
+	})
+	if len(list) == 0 {
+		return nil, nil
+	}
+	return list[len(list)-1], nil
+}
+
+func (repo *MemoryOutboxRepository) SetSending(ids []int64, transferId uint64, transferHash string, validUntil time.Time) error {
+	return repo.update(ids, func(m *domain.OutboxMessage) bool {
+		return m.State == domain.OutboxStatePending
+	}, func(m *domain.OutboxMessage) {
+		m.State = domain.OutboxStateSending
+		m.TransferId = &transferId
+		m.TransferHash = &transferHash
+		m.ValidUntil = &validUntil
+	})
+}
+
+func (repo *MemoryOutboxRepository) SetSent(ids []int64, timestamp time.Time) error {
+	return repo.update(ids, nil, func(m *domain.OutboxMessage) {
+		m.State = domain.OutboxStateSent
+		m.SentAt = &timestamp
+	})
+}
+
+func (repo *MemoryOutboxRepository) SetState(ids []int64, state string) error {
+	return repo.update(ids, nil, func(m *domain.OutboxMessage) {
+		m.State = state
+		m.TransferId = nil
+		m.TransferHash = nil
+		m.ValidUntil = nil
+	})
+}
+
+func (repo *MemoryOutboxRepository) findAll(match func(m *domain.OutboxMessage) bool) []*domain.OutboxMessage {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	list := make([]*domain.OutboxMessage, 0)
+	for _, m := range repo.messages {
+		if match(m) {
+			result := *m
+			list = append(list, &result)
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Id < list[j].Id
+	})
+	return list
+}
+
+// update changes all the messages or none of them, like a batch of commands in a transaction.
+func (repo *MemoryOutboxRepository) update(ids []int64, check func(m *domain.OutboxMessage) bool, change func(m *domain.OutboxMessage)) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	for _, id := range ids {
+		m, exist := repo.messages[id]
+		if !exist || (check != nil && !check(m)) {
+			return ErrorRecordNotFound
+		}
+	}
+	for _, id := range ids {
+		change(repo.messages[id])
+	}
+	return nil
+}
+
+func isActive(state string) bool {
+	return state == domain.OutboxStatePending || state == domain.OutboxStateSending
+}
@@ -0,0 +1,91 @@
+package repository
+
+const (
+	sqliteOutboxEnqueue = `
+	insert into outbox (
+			reference, kind, destination, query_id, message, mode, state, transfer_id, valid_until, created_at, sent_at
+		)
+		select
+			?1, ?2, ?3, ?4, ?5, ?6, 'pending', null, null, CURRENT_TIMESTAMP, null
+		where not exists (
+			select 1 from outbox where reference = ?1 and state in ('pending', 'sending')
+		)
+	returning id
+`
+
+	sqliteOutboxFindActive = `
+	select
+		id, reference, kind, destination, query_id, message, mode, state, transfer_id, transfer_hash, valid_until, created_at, sent_at
+	from outbox
+	where reference = ?1 and state in ('pending', 'sending')
+`
+
+	sqliteOutboxFindAllPending = `
+	select
+		id, reference, kind, destination, query_id, message, mode, state, transfer_id, transfer_hash, valid_until, created_at, sent_at
+	from outbox
+	where state = 'pending'
+	order by id
+	limit ?1
+`
+
+	sqliteOutboxFindAllSending = `
+	select
+		id, reference, kind, destination, query_id, message, mode, state, transfer_id, transfer_hash, valid_until, created_at, sent_at
+	from outbox
+	where state = 'sending'
+	order by id
+`
+
+	sqliteOutboxFindSent = `
+	select
+		id, reference, kind, destination, query_id, message, mode, state, transfer_id, transfer_hash, valid_until, created_at, sent_at
+	from outbox
+	where destination = ?1 and query_id = ?2 and state = 'sent'
+	order by id desc
+	limit 1
+`
+
+	sqliteOutboxFindByQueryId = `
+	select
+		id, reference, kind, destination, query_id, message, mode, state, transfer_id, transfer_hash, valid_until, created_at, sent_at
+	from outbox
+	where query_id = ?1
+	order by id desc
+	limit 1
+`
+
+	sqliteOutboxSetSending = `
+	update outbox
+		set state = 'sending', transfer_id = ?2, transfer_hash = ?3, valid_until = ?4
+	where id = ?1 and state = 'pending'
+`
+
+	sqliteOutboxSetSent = `
+	update outbox
+		set state = 'sent', sent_at = ?2
+	where id = ?1
+`
+
+	sqliteOutboxSetState = `
+	update outbox
+		set state = ?2, transfer_id = null, transfer_hash = null, valid_until = null
+	where id = ?1
+`
+)
+
+var sqliteOutboxQueries = outboxQueries{
+	enqueue:        sqliteOutboxEnqueue,
+	findActive:     sqliteOutboxFindActive,
+	findAllPending: sqliteOutboxFindAllPending,
+	findAllSending: sqliteOutboxFindAllSending,
+	findSent:       sqliteOutboxFindSent,
+	findByQueryId:  sqliteOutboxFindByQueryId,
+	setSending:     sqliteOutboxSetSending,
+	setSent:        sqliteOutboxSetSent,
+	setState:       sqliteOutboxSetState,
+}
+
+func NewSQLiteOutboxRepository(db BatchHandler) *OutboxRepository {
+	return &OutboxRepository{batchHandler: db, queries: sqliteOutboxQueries}
+}
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"github.com/behrang/sqlbatch"
+)
+
+const (
+	sqlQueryIdNext = `
+	update counters
+		set value = value + 1
+	where name = 'query_id'
+	returning value
+`
+)
+
+// queryIdQueries keeps the SQL commands of a database dialect.
+type queryIdQueries struct {
+	next string
+}
+
+var postgresQueryIdQueries = queryIdQueries{
+	next: sqlQueryIdNext,
+}
+
+// QueryIdRepository allocates the query ids of the driver messages from a counter in the database, so they are
+// unique across restarts and across the stake and unstake messages.
+type QueryIdRepository struct {
+	batchHandler BatchHandler
+	queries      queryIdQueries
+}
+
+func NewQueryIdRepository(db BatchHandler) *QueryIdRepository {
+	return &QueryIdRepository{batchHandler: db, queries: postgresQueryIdQueries}
+}
+
+func (repo *QueryIdRepository) Next() (uint64, error) {
+	results, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
+		{
+			Query:   repo.queries.next,
+			Args:    []interface{}{},
+			ReadOne: readId,
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	id, exist := results[0].(int64)
+	if !exist {
+		return 0, ErrorRecordNotFound
+	}
+	return uint64(id), nil
+}
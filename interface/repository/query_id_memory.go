@@ -0,0 +1,24 @@
+package repository
+
+import (
+	"sync"
+)
+
+// MemoryQueryIdRepository allocates query ids in memory. It behaves like QueryIdRepository and is meant for
+// tests and short-lived runs.
+type MemoryQueryIdRepository struct {
+	mutex sync.Mutex
+	last  uint64
+}
+
+func NewMemoryQueryIdRepository() *MemoryQueryIdRepository {
+	return &MemoryQueryIdRepository{}
+}
+
+func (repo *MemoryQueryIdRepository) Next() (uint64, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	repo.last++
+	return repo.last, nil
+}
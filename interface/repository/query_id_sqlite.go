@@ -0,0 +1,18 @@
+package repository
+
+const (
+	sqliteQueryIdNext = `
+	update counters
+		set value = value + 1
+	where name = 'query_id'
+	returning value
+`
+)
+
+var sqliteQueryIdQueries = queryIdQueries{
+	next: sqliteQueryIdNext,
+}
+
+func NewSQLiteQueryIdRepository(db BatchHandler) *QueryIdRepository {
+	return &QueryIdRepository{batchHandler: db, queries: sqliteQueryIdQueries}
+}
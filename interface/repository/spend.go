@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"driver/domain"
+	"time"
+
+	"github.com/behrang/sqlbatch"
+	"github.com/tonkeeper/tongo/tlb"
+)
+
+const (
+	sqlSpendRecord = `
+	insert into spends (transfer_id, amount, created_at)
+		values ($1, $2, $3)
+`
+
+	sqlSpendSum = `
+	select coalesce(sum(amount), 0)
+	from spends
+	where created_at > $1
+`
+
+	sqlSpendLock = `
+	insert into spend_locks (period, spent, cap, locked_at, lifted_at)
+		select $1, $2, $3, $4, null
+		where not exists (
+			select 1 from spend_locks where lifted_at is null
+		)
+`
+
+	sqlSpendFindLatestLock = `
+	select
+		id, period, spent, cap, locked_at, lifted_at
+	from spend_locks
+	order by id desc
+	limit 1
+`
+
+	sqlSpendLift = `
+	update spend_locks
+		set lifted_at = $1
+	where lifted_at is null
+	returning id, period, spent, cap, locked_at, lifted_at
+`
+)
+
+// spendQueries keeps the SQL commands of a database dialect.
+type spendQueries struct {
+	record         string
+	sum            string
+	lock           string
+	findLatestLock string
+	lift           string
+}
+
+var postgresSpendQueries = spendQueries{
+	record:         sqlSpendRecord,
+	sum:            sqlSpendSum,
+	lock:           sqlSpendLock,
+	findLatestLock: sqlSpendFindLatestLock,
+	lift:           sqlSpendLift,
+}
+
+// SpendRepository keeps the amounts spent by the transfers of the driver wallet, and the locks put on the wallet
+// when a spend cap is hit.
+type SpendRepository struct {
+	batchHandler BatchHandler
+	queries      spendQueries
+}
+
+func NewSpendRepository(db BatchHandler) *SpendRepository {
+	return &SpendRepository{batchHandler: db, queries: postgresSpendQueries}
+}
+
+func readSpendLock(scan func(...interface{}) error) (interface{}, error) {
+	l := domain.SpendLock{}
+	var spent, limit int64
+	err := scan(&l.Id, &l.Period, &spent, &limit, &l.LockedAt, &l.LiftedAt)
+	l.Spent = tlb.Grams(spent)
+	l.Cap = tlb.Grams(limit)
+	return &l, err
+}
+
+func readAllSpendLocks(memo interface{}, scan func(...interface{}) error) (interface{}, error) {
+	l, err := readSpendLock(scan)
+
+	list := memo.([]*domain.SpendLock)
+	list = append(list, l.(*domain.SpendLock))
+	return list, err
+}
+
+func readSum(scan func(...interface{}) error) (interface{}, error) {
+	var sum int64
+	err := scan(&sum)
+	return sum, err
+}
+
+func (repo *SpendRepository) Record(transferId uint64, amount tlb.Grams, timestamp time.Time) error {
+	_, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
+		{
+			Query:  repo.queries.record,
+			Args:   []interface{}{int64(transferId), int64(amount), timestamp},
+			Affect: 1,
+		},
+	})
+	return err
+}
+
+// Sum returns the total amount spent after the given time.
+func (repo *SpendRepository) Sum(since time.Time) (tlb.Grams, error) {
+	results, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
+		{
+			Query:   repo.queries.sum,
+			Args:    []interface{}{since},
+			ReadOne: readSum,
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	sum, _ := results[0].(int64)
+	return tlb.Grams(sum), nil
+}
+
+// Lock records a lock for the period, unless another lock is still active.
+func (repo *SpendRepository) Lock(period string, spent tlb.Grams, limit tlb.Grams, timestamp time.Time) error {
+	_, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
+		{
+			Query: repo.queries.lock,
+			Args:  []interface{}{period, int64(spent), int64(limit), timestamp},
+		},
+	})
+	return err
+}
+
+// FindLatestLock returns the latest lock, lifted or not, or nil if the wallet was never locked.
+func (repo *SpendRepository) FindLatestLock() (*domain.SpendLock, error) {
+	results, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
+		{
+			Query:   repo.queries.findLatestLock,
+			Args:    []interface{}{},
+			ReadOne: readSpendLock,
+		},
+	})
+	result, _ := results[0].(*domain.SpendLock)
+	return result, err
+}
+
+// Lift lifts the active locks, and returns them.
+func (repo *SpendRepository) Lift(timestamp time.Time) ([]*domain.SpendLock, error) {
+	results, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
+		{
+			Query:   repo.queries.lift,
+			Args:    []interface{}{timestamp},
+			Init:    make([]*domain.SpendLock, 0),
+			ReadAll: readAllSpendLocks,
+		},
+	})
+	result, _ := results[0].([]*domain.SpendLock)
+	return result, err
+}
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"driver/domain"
+	"sync"
+	"time"
+
+	"github.com/tonkeeper/tongo/tlb"
+)
+
+type memorySpend struct {
+	transferId uint64
+	amount     tlb.Grams
+	createdAt  time.Time
+}
+
+// MemorySpendRepository keeps spends and spend locks in memory. It behaves like SpendRepository and is meant for
+// tests and short-lived runs.
+type MemorySpendRepository struct {
+	mutex  sync.Mutex
+	spends []memorySpend
+	locks  []*domain.SpendLock
+}
+
+func NewMemorySpendRepository() *MemorySpendRepository {
+	return &MemorySpendRepository{}
+}
+
+func (repo *MemorySpendRepository) Record(transferId uint64, amount tlb.Grams, timestamp time.Time) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	repo.spends = append(repo.spends, memorySpend{transferId: transferId, amount: amount, createdAt: timestamp})
+	return nil
+}
+
+func (repo *MemorySpendRepository) Sum(since time.Time) (tlb.Grams, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	sum := tlb.Grams(0)
+	for _, s := range repo.spends {
+		if s.createdAt.After(since) {
+			sum += s.amount
+		}
+	}
+	return sum, nil
+}
+
+func (repo *MemorySpendRepository) Lock(period string, spent tlb.Grams, limit tlb.Grams, timestamp time.Time) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	for _, l := range repo.locks {
+		if l.LiftedAt == nil {
+			return nil
+		}
+	}
+
+	repo.locks = append(repo.locks, &domain.SpendLock{
+		Id:       int64(len(repo.locks) + 1),
+		Period:   period,
+		Spent:    spent,
+		Cap:      limit,
+		LockedAt: timestamp,
+	})
+	return nil
+}
+
+func (repo *MemorySpendRepository) FindLatestLock() (*domain.SpendLock, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	if len(repo.locks) == 0 {
+		return nil, nil
+	}
+	l := *repo.locks[len(repo.locks)-1]
+	return &l, nil
+}
+
+func (repo *MemorySpendRepository) Lift(timestamp time.Time) ([]*domain.SpendLock, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	lifted := make([]*domain.SpendLock, 0)
+	for _, l := range repo.locks {
+		if l.LiftedAt == nil {
+			liftedAt := timestamp
+			l.LiftedAt = &liftedAt
+			c := *l
+			lifted = append(lifted, &c)
+		}
+	}
+	return lifted, nil
+}
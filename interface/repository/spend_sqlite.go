@@ -0,0 +1,50 @@
+package repository
+
+// Timestamps are compared through julianday, as they are kept as text in SQLite.
+const (
+	sqliteSpendRecord = `
+	insert into spends (transfer_id, amount, created_at)
+		values (?1, ?2, ?3)
+`
+
+	sqliteSpendSum = `
+	select coalesce(sum(amount), 0)
+	from spends
+	where julianday(created_at) > julianday(?1)
+`
+
+	sqliteSpendLock = `
+	insert into spend_locks (period, spent, cap, locked_at, lifted_at)
+		select ?1, ?2, ?3, ?4, null
+		where not exists (
+			select 1 from spend_locks where lifted_at is null
+		)
+`
+
+	sqliteSpendFindLatestLock = `
+	select
+		id, period, spent, cap, locked_at, lifted_at
+	from spend_locks
+	order by id desc
+	limit 1
+`
+
+	sqliteSpendLift = `
+	update spend_locks
+		set lifted_at = ?1
+	where lifted_at is null
+	returning id, period, spent, cap, locked_at, lifted_at
+`
+)
+
+var sqliteSpendQueries = spendQueries{
+	record:         sqliteSpendRecord,
+	sum:            sqliteSpendSum,
+	lock:           sqliteSpendLock,
+	findLatestLock: sqliteSpendFindLatestLock,
+	lift:           sqliteSpendLift,
+}
+
+func NewSQLiteSpendRepository(db BatchHandler) *SpendRepository {
+	return &SpendRepository{batchHandler: db, queries: sqliteSpendQueries}
+}
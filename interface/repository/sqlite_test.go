@@ -0,0 +1,575 @@
+package repository_test
+
+import (
+	"driver/domain"
+	"driver/infrastructure/dbhandler"
+	"driver/interface/repository"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// newSQLite opens a new in-memory SQLite database with the schema of the embedded migrations. The database lives as
+// long as its single connection.
+func newSQLite(t *testing.T) dbhandler.DBHandler {
+	db, err := dbhandler.OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := dbhandler.NewMigrator(db, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = migrator.Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dbhandler.DBHandler{DB: db}
+}
+
+func ptr[T any](value T) *T {
+	return &value
+}
+
+func TestSQLiteStakeRepository(t *testing.T) {
+	repo := repository.NewSQLiteStakeRepository(newSQLite(t))
+	owner := "owner"
+	info := domain.StakeRelatedInfo{Value: 5_000_000_000, Time: time.Unix(1700000000, 0).UTC(), Hash: "deposit"}
+
+	// A request in each state, the index of the message telling them apart.
+	states := []string{
+		domain.RequestStateNew, domain.RequestStateError, domain.RequestStateRetriable, domain.RequestStateOngoing,
+		domain.RequestStateRejected, domain.RequestStateSent, domain.RequestStateVerified, domain.RequestStateBounced,
+		domain.RequestStateSkipped,
+	}
+	for i, state := range states {
+		request, err := repo.InsertIfNotExists("wallet", 100, "hash", i, nil, &owner, info)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if request == nil || request.State != domain.RequestStateNew || request.Owner == nil || *request.Owner != owner {
+			t.Fatalf("inserted %+v, want a new request of the owner", request)
+		}
+		err = repo.SetState("hash", i, state)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Inserting again keeps the state, and fills the seqno in, which takes the same parameter twice.
+	request, err := repo.InsertIfNotExists("wallet", 100, "hash", 4, ptr(uint32(7)), nil, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.State != domain.RequestStateRejected || request.FinalMcSeqno == nil || *request.FinalMcSeqno != 7 || request.Owner == nil {
+		t.Fatalf("inserted again %+v, want the state and owner kept and the seqno filled in", request)
+	}
+
+	triable, err := repo.FindAllTriable(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(triable) != 5 {
+		t.Fatalf("found %v triable stakes, want the new, error, retriable, ongoing and rejected ones", len(triable))
+	}
+	for _, request := range triable {
+		if request.MsgIndex > 4 {
+			t.Fatalf("found stake in state %v triable", request.State)
+		}
+	}
+
+	// Retries count up to the most allowed.
+	for i := 0; i < 2; i++ {
+		err = repo.SetRetrying("hash", 0, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	request, err = repo.Find("hash", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.RetryCount != 2 || request.State != domain.RequestStateOngoing || request.RetriedAt == nil {
+		t.Fatalf("retried stake is %+v, want it ongoing with 2 retries", request)
+	}
+	triable, err = repo.FindAllTriable(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(triable) != 4 {
+		t.Fatalf("found %v triable stakes, want the one out of retries left out", len(triable))
+	}
+
+	err = repo.SetSent("hash", 0, "message", 60_000_000, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifiable, err := repo.FindAllVerifiable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(verifiable) != 2 {
+		t.Fatalf("found %v verifiable stakes, want the two sent", len(verifiable))
+	}
+	err = repo.SetVerified("hash", 0, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An excess is summed once, however many times it's added.
+	for _, excess := range []string{"excess-1", "excess-1", "excess-2"} {
+		err = repo.AddExcess("hash", 0, excess, 10_000_000)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	request, err = repo.Find("hash", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.State != domain.RequestStateVerified || request.MessageHash == nil || request.Cost == nil || *request.Cost != 60_000_000 ||
+		request.Excess == nil || *request.Excess != 20_000_000 {
+		t.Fatalf("stake is %+v, want it verified with its cost and both excesses", request)
+	}
+
+	err = repo.SetRejected("hash", 1, 71)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request, err = repo.Find("hash", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.State != domain.RequestStateRejected || request.ExitCode == nil || *request.ExitCode != 71 {
+		t.Fatalf("stake is %+v, want it rejected by 71", request)
+	}
+
+	// Only a request whose message may be out is bounced, the others are not found to bounce.
+	for i := range states {
+		request, err = repo.Find("hash", i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bounceable := request.State == domain.RequestStateSent || request.State == domain.RequestStateVerified ||
+			request.State == domain.RequestStateRetriable
+		err = repo.SetBounced("hash", i, ptr(int32(70)))
+		if (err == nil) != bounceable {
+			t.Fatalf("bouncing stake in state %v returned %v", request.State, err)
+		}
+		bounced, err := repo.Find("hash", i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bounceable && (bounced.State != domain.RequestStateBounced || bounced.ExitCode == nil || *bounced.ExitCode != 70) {
+			t.Fatalf("stake in state %v is %+v after bouncing, want it bounced by 70", request.State, bounced)
+		}
+	}
+
+	byOwner, err := repo.FindByOwner(owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byOwner) != len(states) {
+		t.Fatalf("found %v stakes of the owner, want %v", len(byOwner), len(states))
+	}
+	request, err = repo.Find("hash", len(states))
+	if err != nil || request != nil {
+		t.Fatalf("found %v for an unknown stake, want none", request)
+	}
+}
+
+func TestSQLiteUnstakeRepository(t *testing.T) {
+	repo := repository.NewSQLiteUnstakeRepository(newSQLite(t))
+	owner := "owner"
+	info := domain.UnstakeRelatedInfo{Value: 100_000_000, Time: time.Unix(1700000000, 0).UTC(), Hash: "unstake"}
+
+	states := []string{
+		domain.RequestStateNew, domain.RequestStateError, domain.RequestStateRetriable, domain.RequestStateOngoing,
+		domain.RequestStateRejected, domain.RequestStateSent, domain.RequestStateVerified,
+	}
+	for i, state := range states {
+		hash := string(rune('a' + i))
+		_, err := repo.InsertIfNotExists("wallet", *big.NewInt(int64(i + 1)), hash, nil, &owner, info)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = repo.SetState(hash, state)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	request, err := repo.InsertIfNotExists("wallet", *big.NewInt(1), "a", ptr(uint32(7)), nil, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.Tokens.Int64() != 1 || request.FinalMcSeqno == nil || *request.FinalMcSeqno != 7 || request.Owner == nil {
+		t.Fatalf("inserted again %+v, want the tokens and owner kept and the seqno filled in", request)
+	}
+
+	triable, err := repo.FindAllTriable(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(triable) != 5 {
+		t.Fatalf("found %v triable unstakes, want the new, error, retriable, ongoing and rejected ones", len(triable))
+	}
+
+	err = repo.SetRetrying("a", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.SetSent("a", "message", 60_000_000, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifiable, err := repo.FindAllVerifiable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(verifiable) != 2 {
+		t.Fatalf("found %v verifiable unstakes, want the two sent", len(verifiable))
+	}
+	err = repo.SetVerified("a", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, excess := range []string{"excess-1", "excess-1", "excess-2"} {
+		err = repo.AddExcess("a", excess, 10_000_000)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	request, err = repo.Find("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.State != domain.RequestStateVerified || request.RetryCount != 1 || request.Cost == nil || request.Excess == nil ||
+		*request.Excess != 20_000_000 {
+		t.Fatalf("unstake is %+v, want it verified with both excesses", request)
+	}
+
+	err = repo.SetRejected("b", 73)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.SetBounced("f", ptr(int32(72)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.SetBounced("a", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.SetBounced("d", nil)
+	if err == nil {
+		t.Fatal("bounced an ongoing unstake")
+	}
+	for hash, state := range map[string]string{
+		"a": domain.RequestStateBounced, "b": domain.RequestStateRejected, "d": domain.RequestStateOngoing, "f": domain.RequestStateBounced,
+	} {
+		request, err = repo.Find(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if request.State != state {
+			t.Fatalf("unstake %v is %v, want it %v", hash, request.State, state)
+		}
+	}
+
+	byOwner, err := repo.FindByOwner(owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byOwner) != len(states) {
+		t.Fatalf("found %v unstakes of the owner, want %v", len(byOwner), len(states))
+	}
+}
+
+func TestSQLiteOutboxRepository(t *testing.T) {
+	repo := repository.NewSQLiteOutboxRepository(newSQLite(t))
+
+	messages := make([]*domain.OutboxMessage, 0)
+	for i, reference := range []string{"a", "b", "c"} {
+		msg := &domain.OutboxMessage{
+			Reference:   reference,
+			Kind:        domain.OutboxKindStake,
+			Destination: "wallet",
+			QueryId:     uint64(i + 1),
+			Message:     "message",
+			Mode:        3,
+		}
+		inserted, err := repo.Enqueue(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !inserted || msg.Id == 0 {
+			t.Fatalf("message %v is not queued", reference)
+		}
+		messages = append(messages, msg)
+	}
+
+	// A reference is queued once while its message is active.
+	inserted, err := repo.Enqueue(&domain.OutboxMessage{Reference: "a", Kind: domain.OutboxKindStake, Destination: "wallet", QueryId: 9})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inserted {
+		t.Fatal("queued an active reference again")
+	}
+
+	pending, err := repo.FindAllPending(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 2 || pending[0].Reference != "a" || pending[1].Reference != "b" {
+		t.Fatalf("found %v pending messages, want the first 2 in order", len(pending))
+	}
+
+	validUntil := time.Now().Add(time.Minute).UTC().Truncate(time.Second)
+	ids := []int64{messages[0].Id, messages[1].Id}
+	err = repo.SetSending(ids, 42, "transfer", validUntil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sending, err := repo.FindAllSending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sending) != 2 || sending[0].TransferId == nil || *sending[0].TransferId != 42 || sending[0].TransferHash == nil ||
+		sending[0].ValidUntil == nil || !sending[0].ValidUntil.Equal(validUntil) {
+		t.Fatalf("found %v sending messages, want both with their transfer", len(sending))
+	}
+	active, err := repo.FindActive("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if active == nil || active.State != domain.OutboxStateSending {
+		t.Fatalf("found active %+v, want the sending message", active)
+	}
+
+	err = repo.SetSent(ids[:1], time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.SetState(ids[1:], domain.OutboxStatePending)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sent, err := repo.FindSent("wallet", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent == nil || sent.Reference != "a" || sent.SentAt == nil {
+		t.Fatalf("found sent %+v, want message a", sent)
+	}
+	sent, err = repo.FindSent("wallet", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent != nil {
+		t.Fatalf("found %+v sent, want the message put back pending left out", sent)
+	}
+	byQueryId, err := repo.FindByQueryId(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if byQueryId == nil || byQueryId.Reference != "b" || byQueryId.State != domain.OutboxStatePending || byQueryId.TransferId != nil {
+		t.Fatalf("found %+v by the query id, want message b pending again", byQueryId)
+	}
+
+	// Once the message is done with, the reference can be queued again.
+	active, err = repo.FindActive("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if active != nil {
+		t.Fatalf("found active %+v, want the sent message left out", active)
+	}
+	inserted, err = repo.Enqueue(&domain.OutboxMessage{Reference: "a", Kind: domain.OutboxKindStake, Destination: "wallet", QueryId: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !inserted {
+		t.Fatal("the reference of a sent message is not queued again")
+	}
+}
+
+func TestSQLiteMemoRepository(t *testing.T) {
+	repo := repository.NewSQLiteMemoRepository(newSQLite(t))
+
+	memo, err := repo.Find("extraction")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if memo != nil {
+		t.Fatalf("found memo %+v, want none", memo)
+	}
+
+	for _, hash := range []string{"first", "second"} {
+		_, err = repo.Upsert("extraction", &domain.ExtractionMemo{LatestProcessedHash: hash, LatestProcessedLt: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	memo, err = repo.Find("extraction")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var extraction domain.ExtractionMemo
+	if memo == nil || extraction.FromJson(memo.Memo) != nil || extraction.LatestProcessedHash != "second" {
+		t.Fatalf("found memo %+v, want the latest one", memo)
+	}
+}
+
+func TestSQLiteQueryIdRepository(t *testing.T) {
+	repo := repository.NewSQLiteQueryIdRepository(newSQLite(t))
+
+	previous := uint64(0)
+	for i := 0; i < 3; i++ {
+		queryId, err := repo.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if queryId <= previous {
+			t.Fatalf("got query id %v after %v, want them increasing", queryId, previous)
+		}
+		previous = queryId
+	}
+}
+
+func TestSQLiteSpendRepository(t *testing.T) {
+	repo := repository.NewSQLiteSpendRepository(newSQLite(t))
+	now := time.Now()
+
+	err := repo.Record(1, 100, now.Add(-2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.Record(2, 200, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, err := repo.Sum(now.Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum != 200 {
+		t.Fatalf("summed %v in the last hour, want 200", sum)
+	}
+
+	lock, err := repo.FindLatestLock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lock != nil {
+		t.Fatalf("found lock %+v, want none", lock)
+	}
+	err = repo.Lock("hourly", 200, 150, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock, err = repo.FindLatestLock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lock == nil || lock.Period != "hourly" || lock.Spent != 200 || lock.Cap != 150 || lock.LiftedAt != nil {
+		t.Fatalf("found lock %+v, want the hourly lock", lock)
+	}
+
+	lifted, err := repo.Lift(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lifted) != 1 {
+		t.Fatalf("lifted %v locks, want 1", len(lifted))
+	}
+	lock, err = repo.FindLatestLock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lock == nil || lock.LiftedAt == nil {
+		t.Fatalf("found lock %+v after lifting, want it lifted", lock)
+	}
+	lifted, err = repo.Lift(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lifted) != 0 {
+		t.Fatalf("lifted %v locks again, want none", len(lifted))
+	}
+}
+
+func TestSQLiteEventRepository(t *testing.T) {
+	repo := repository.NewSQLiteEventRepository(newSQLite(t))
+	source := "sender"
+	event := domain.Event{
+		Hash:       "event",
+		Lt:         10,
+		ExecutedAt: time.Unix(1700000000, 0).UTC(),
+		Opcode:     0x1234,
+		Source:     &source,
+		Value:      5_000_000_000,
+		Success:    true,
+		Fees:       domain.EventFees{Total: 100},
+		OutMessages: []domain.EventMessage{
+			{Opcode: 0x5678, QueryId: ptr(uint64(3)), Destination: "wallet", Value: 50_000_000, FwdFee: 1_000},
+		},
+	}
+
+	for i := 0; i < 2; i++ {
+		err := repo.InsertAll([]domain.Event{event})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	found, err := repo.Find("event")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found == nil || found.Lt != 10 || found.Source == nil || len(found.OutMessages) != 1 || *found.OutMessages[0].QueryId != 3 {
+		t.Fatalf("found event %+v, want it as inserted", found)
+	}
+}
+
+func TestSQLiteFailureRepository(t *testing.T) {
+	repo := repository.NewSQLiteFailureRepository(newSQLite(t))
+	sender := "sender"
+	now := time.Now().UTC().Truncate(time.Second)
+
+	requests := []domain.FailedRequest{
+		{Hash: "old", Lt: 1, ExecutedAt: now.Add(-48 * time.Hour), Kind: domain.FailedRequestKindDeposit, Sender: &sender, Value: 1, ExitCode: 101, Bounced: true},
+		{Hash: "new", Lt: 2, ExecutedAt: now, Kind: domain.FailedRequestKindUnstake, Value: 2, ExitCode: 77, FinalMcSeqno: ptr(uint32(7))},
+	}
+	for i := 0; i < 2; i++ {
+		err := repo.InsertAll(requests)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	found, err := repo.Find("new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found == nil || found.ExitCode != 77 || found.Bounced || found.FinalMcSeqno == nil || *found.FinalMcSeqno != 7 {
+		t.Fatalf("found %+v, want it as inserted", found)
+	}
+	recent, err := repo.FindAll(now.Add(-time.Hour), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recent) != 1 || recent[0].Hash != "new" {
+		t.Fatalf("found %v failures in the last hour, want the new one", len(recent))
+	}
+	bySender, err := repo.FindBySender(sender, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bySender) != 1 || bySender[0].Hash != "old" {
+		t.Fatalf("found %v failures of the sender, want the old one", len(bySender))
+	}
+}
@@ -6,80 +6,151 @@ import (
 	"time"
 
 	"github.com/behrang/sqlbatch"
+	"github.com/tonkeeper/tongo/tlb"
 )
 
 const (
 	sqlStakeInsertIfNotExists = `
 	insert into stakes as c (
-			address, round_since, hash, state, retry_count, info, created_at, retried_at, sent_at, verified_at
+			address, round_since, hash, msg_index, final_mc_seqno, owner, state, retry_count, info, created_at, retried_at, sent_at, verified_at
 		)
 		values (
-			$1, $2, $3, 'new', 0, $4::jsonb, now(), null, null, null
+			$1, $2, $3, $4, $5, $6, 'new', 0, $7::jsonb, now(), null, null, null
 		)
-	on conflict (hash) do
+	on conflict (hash, msg_index) do
 		update set
-			info = $4::jsonb
+			info = $7::jsonb, final_mc_seqno = coalesce(c.final_mc_seqno, $5), owner = coalesce(c.owner, $6)
 `
 
 	sqlStakeFind = `
 	select
-		address, round_since, hash, state, retry_count, info, created_at, retried_at, sent_at, verified_at
+		address, round_since, hash, msg_index, final_mc_seqno, owner, state, retry_count, info, created_at, retried_at, sent_at, verified_at, message_hash, exit_code, cost, excess
 	from stakes
-	where hash = $1
+	where hash = $1 and msg_index = $2
 `
 
 	sqlStakeFindAllTriable = `
 	select
-		address, round_since, hash, state, retry_count, info, created_at, retried_at, sent_at, verified_at
+		address, round_since, hash, msg_index, final_mc_seqno, owner, state, retry_count, info, created_at, retried_at, sent_at, verified_at, message_hash, exit_code, cost, excess
 	from stakes
-	where state in ('new', 'error', 'retriable', 'ongoing') and retry_count < $1
+	where state in ('new', 'error', 'retriable', 'ongoing', 'rejected') and retry_count < $1
 `
 
 	sqlStakeFindAllVerifiable = `
 	select
-		address, round_since, hash, state, retry_count, info, created_at, retried_at, sent_at, verified_at
+		address, round_since, hash, msg_index, final_mc_seqno, owner, state, retry_count, info, created_at, retried_at, sent_at, verified_at, message_hash, exit_code, cost, excess
 	from stakes
 	where state in ('sent')
 `
 
 	sqlStakeSetState = `
 	update stakes
-		set state = $2
-	where hash = $1
+		set state = $3
+	where hash = $1 and msg_index = $2
 `
 
 	sqlStakeSetRetrying = `
 	update stakes
-		set retry_count = retry_count + 1, retried_at = $2, state = 'ongoing'
-	where hash = $1
+		set retry_count = retry_count + 1, retried_at = $3, state = 'ongoing'
+	where hash = $1 and msg_index = $2
 `
 
 	sqlStakeSetSent = `
 	update stakes
-		set sent_at = $2, state = 'sent'
-	where hash = $1
+		set sent_at = $3, state = 'sent', message_hash = $4, cost = $5
+	where hash = $1 and msg_index = $2
 `
 
 	sqlStakeSetVerified = `
 	update stakes
-		set verified_at = $2, state = 'verified'
-	where hash = $1
+		set verified_at = $3, state = 'verified'
+	where hash = $1 and msg_index = $2
+`
+
+	sqlStakeFindByOwner = `
+	select
+		address, round_since, hash, msg_index, final_mc_seqno, owner, state, retry_count, info, created_at, retried_at, sent_at, verified_at, message_hash, exit_code, cost, excess
+	from stakes
+	where owner = $1
+	order by created_at
+`
+
+	sqlStakeInsertExcess = `
+	insert into excesses (
+			hash, reference, value, created_at
+		)
+		values (
+			$2, $1, $3, now()
+		)
+	on conflict (hash) do nothing
+`
+
+	sqlStakeSetExcess = `
+	update stakes
+		set excess = (select sum(value) from excesses where reference = $3)
+	where hash = $1 and msg_index = $2
+`
+
+	sqlStakeSetRejected = `
+	update stakes
+		set state = 'rejected', exit_code = $3
+	where hash = $1 and msg_index = $2
+`
+
+	sqlStakeSetBounced = `
+	update stakes
+		set state = 'bounced', exit_code = $3
+	where hash = $1 and msg_index = $2 and state in ('sent', 'verified', 'retriable')
 `
 )
 
+// stakeQueries keeps the SQL commands of a database dialect.
+type stakeQueries struct {
+	insertIfNotExists string
+	find              string
+	findAllTriable    string
+	findAllVerifiable string
+	setState          string
+	setRetrying       string
+	setSent           string
+	setVerified       string
+	findByOwner       string
+	insertExcess      string
+	setExcess         string
+	setRejected       string
+	setBounced        string
+}
+
+var postgresStakeQueries = stakeQueries{
+	insertIfNotExists: sqlStakeInsertIfNotExists,
+	find:              sqlStakeFind,
+	findAllTriable:    sqlStakeFindAllTriable,
+	findAllVerifiable: sqlStakeFindAllVerifiable,
+	setState:          sqlStakeSetState,
+	setRetrying:       sqlStakeSetRetrying,
+	setSent:           sqlStakeSetSent,
+	setVerified:       sqlStakeSetVerified,
+	findByOwner:       sqlStakeFindByOwner,
+	insertExcess:      sqlStakeInsertExcess,
+	setExcess:         sqlStakeSetExcess,
+	setRejected:       sqlStakeSetRejected,
+	setBounced:        sqlStakeSetBounced,
+}
+
 type StakeRepository struct {
 	batchHandler BatchHandler
+	queries      stakeQueries
 }
 
 func NewStakeRepository(db BatchHandler) *StakeRepository {
-	return &StakeRepository{batchHandler: db}
+	return &StakeRepository{batchHandler: db, queries: postgresStakeQueries}
 }
 
 func readStake(scan func(...interface{}) error) (interface{}, error) {
 	r := domain.StakeRequest{}
 	var infoJson []byte
 	err := scan(
-		&r.Address, &r.RoundSince, &r.Hash, &r.State, &r.RetryCount, &infoJson, &r.CreatedAt, &r.RetriedAt, &r.SentAt, &r.VerifiedAt,
+		&r.Address, &r.RoundSince, &r.Hash, &r.MsgIndex, &r.FinalMcSeqno, &r.Owner, &r.State, &r.RetryCount, &infoJson, &r.CreatedAt, &r.RetriedAt, &r.SentAt, &r.VerifiedAt, &r.MessageHash, &r.ExitCode, &r.Cost, &r.Excess,
 	)
 	if err != nil {
 		return &r, err
@@ -92,7 +163,7 @@ func readAllStakes(memo interface{}, scan func(...interface{}) error) (interface
 	r := domain.StakeRequest{}
 	var infoJson []byte
 	err := scan(
-		&r.Address, &r.RoundSince, &r.Hash, &r.State, &r.RetryCount, &infoJson, &r.CreatedAt, &r.RetriedAt, &r.SentAt, &r.VerifiedAt,
+		&r.Address, &r.RoundSince, &r.Hash, &r.MsgIndex, &r.FinalMcSeqno, &r.Owner, &r.State, &r.RetryCount, &infoJson, &r.CreatedAt, &r.RetriedAt, &r.SentAt, &r.VerifiedAt, &r.MessageHash, &r.ExitCode, &r.Cost, &r.Excess,
 	)
 	if err == nil {
 		err = json.Unmarshal(infoJson, &r.Info)
@@ -103,20 +174,20 @@ func readAllStakes(memo interface{}, scan func(...interface{}) error) (interface
 	return list, err
 }
 
-func (repo *StakeRepository) InsertIfNotExists(address string, roundSince uint32, hash string, info domain.StakeRelatedInfo) (*domain.StakeRequest, error) {
+func (repo *StakeRepository) InsertIfNotExists(address string, roundSince uint32, hash string, msgIndex int, finalMcSeqno *uint32, owner *string, info domain.StakeRelatedInfo) (*domain.StakeRequest, error) {
 
 	infoJson, _ := json.Marshal(info)
 	results, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
 		{
-			Query: sqlStakeInsertIfNotExists,
+			Query: repo.queries.insertIfNotExists,
 			Args: []interface{}{
-				address, roundSince, hash, infoJson,
+				address, roundSince, hash, msgIndex, finalMcSeqno, owner, infoJson,
 			},
 			Affect: 1,
 		},
 		{
-			Query:   sqlStakeFind,
-			Args:    []interface{}{hash},
+			Query:   repo.queries.find,
+			Args:    []interface{}{hash, msgIndex},
 			ReadOne: readStake,
 		},
 	})
@@ -125,11 +196,11 @@ func (repo *StakeRepository) InsertIfNotExists(address string, roundSince uint32
 	return result, err
 }
 
-func (repo *StakeRepository) Find(hash string) (*domain.StakeRequest, error) {
+func (repo *StakeRepository) Find(hash string, msgIndex int) (*domain.StakeRequest, error) {
 	results, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
 		{
-			Query:   sqlStakeFind,
-			Args:    []interface{}{hash},
+			Query:   repo.queries.find,
+			Args:    []interface{}{hash, msgIndex},
 			ReadOne: readStake,
 		},
 	})
@@ -140,7 +211,7 @@ func (repo *StakeRepository) Find(hash string) (*domain.StakeRequest, error) {
 func (repo *StakeRepository) FindAllTriable(maxRetry int) ([]*domain.StakeRequest, error) {
 	results, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
 		{
-			Query:   sqlStakeFindAllTriable,
+			Query:   repo.queries.findAllTriable,
 			Args:    []interface{}{maxRetry},
 			Init:    make([]*domain.StakeRequest, 0),
 			ReadAll: readAllStakes,
@@ -153,7 +224,7 @@ func (repo *StakeRepository) FindAllTriable(maxRetry int) ([]*domain.StakeReques
 func (repo *StakeRepository) FindAllVerifiable() ([]*domain.StakeRequest, error) {
 	results, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
 		{
-			Query:   sqlStakeFindAllVerifiable,
+			Query:   repo.queries.findAllVerifiable,
 			Args:    []interface{}{},
 			Init:    make([]*domain.StakeRequest, 0),
 			ReadAll: readAllStakes,
@@ -163,44 +234,101 @@ func (repo *StakeRepository) FindAllVerifiable() ([]*domain.StakeRequest, error)
 	return result, err
 }
 
-func (repo *StakeRepository) SetState(hash string, state string) error {
+func (repo *StakeRepository) SetState(hash string, msgIndex int, state string) error {
+	_, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
+		{
+			Query:  repo.queries.setState,
+			Args:   []interface{}{hash, msgIndex, state},
+			Affect: 1,
+		},
+	})
+	return err
+}
+
+func (repo *StakeRepository) SetRetrying(hash string, msgIndex int, timestamp time.Time) error {
 	_, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
 		{
-			Query:  sqlStakeSetState,
-			Args:   []interface{}{hash, state},
+			Query:  repo.queries.setRetrying,
+			Args:   []interface{}{hash, msgIndex, timestamp},
 			Affect: 1,
 		},
 	})
 	return err
 }
 
-func (repo *StakeRepository) SetRetrying(hash string, timestamp time.Time) error {
+func (repo *StakeRepository) SetSent(hash string, msgIndex int, messageHash string, cost tlb.Grams, timestamp time.Time) error {
 	_, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
 		{
-			Query:  sqlStakeSetRetrying,
-			Args:   []interface{}{hash, timestamp},
+			Query:  repo.queries.setSent,
+			Args:   []interface{}{hash, msgIndex, timestamp, messageHash, int64(cost)},
+			Affect: 1,
+		},
+	})
+	return err
+}
+
+func (repo *StakeRepository) SetVerified(hash string, msgIndex int, timestamp time.Time) error {
+	_, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
+		{
+			Query:  repo.queries.setVerified,
+			Args:   []interface{}{hash, msgIndex, timestamp},
+			Affect: 1,
+		},
+	})
+	return err
+}
+
+// FindByOwner returns the requests of the owner's wallet, the oldest first.
+func (repo *StakeRepository) FindByOwner(owner string) ([]*domain.StakeRequest, error) {
+	results, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
+		{
+			Query:   repo.queries.findByOwner,
+			Args:    []interface{}{owner},
+			Init:    make([]*domain.StakeRequest, 0),
+			ReadAll: readAllStakes,
+		},
+	})
+	result, _ := results[0].([]*domain.StakeRequest)
+	return result, err
+}
+
+// AddExcess keeps an excess returned for the request, and sums up the excesses of the request. An excess is kept
+// once, so adding it again changes nothing.
+func (repo *StakeRepository) AddExcess(hash string, msgIndex int, excessHash string, value tlb.Grams) error {
+	_, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
+		{
+			Query: repo.queries.insertExcess,
+			Args:  []interface{}{domain.StakeReference(hash, msgIndex), excessHash, int64(value)},
+		},
+		{
+			Query:  repo.queries.setExcess,
+			Args:   []interface{}{hash, msgIndex, domain.StakeReference(hash, msgIndex)},
 			Affect: 1,
 		},
 	})
 	return err
 }
 
-func (repo *StakeRepository) SetSent(hash string, timestamp time.Time) error {
+// SetRejected keeps the exit code of the emulation which rejected the message of the request. The request is
+// tried again, as the emulation reflects the current state of the j-wallet.
+func (repo *StakeRepository) SetRejected(hash string, msgIndex int, exitCode int32) error {
 	_, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
 		{
-			Query:  sqlStakeSetSent,
-			Args:   []interface{}{hash, timestamp},
+			Query:  repo.queries.setRejected,
+			Args:   []interface{}{hash, msgIndex, exitCode},
 			Affect: 1,
 		},
 	})
 	return err
 }
 
-func (repo *StakeRepository) SetVerified(hash string, timestamp time.Time) error {
+// SetBounced moves a sent request to the bounced state, along with the exit code of the j-wallet transaction which
+// bounced the message, or nil if it's unknown. It fails if the request is not sent, e.g. it's being sent again.
+func (repo *StakeRepository) SetBounced(hash string, msgIndex int, exitCode *int32) error {
 	_, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
 		{
-			Query:  sqlStakeSetVerified,
-			Args:   []interface{}{hash, timestamp},
+			Query:  repo.queries.setBounced,
+			Args:   []interface{}{hash, msgIndex, exitCode},
 			Affect: 1,
 		},
 	})
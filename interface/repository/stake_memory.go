@@ -0,0 +1,215 @@
+package repository
+
+import (
+	"driver/domain"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tonkeeper/tongo/tlb"
+)
+
+var (
+	ErrorRecordNotFound = fmt.Errorf("record not found")
+)
+
+// MemoryStakeRepository keeps stake requests in memory. It behaves like StakeRepository and is meant
+// for tests and short-lived runs.
+type MemoryStakeRepository struct {
+	mutex    sync.Mutex
+	requests map[string]*domain.StakeRequest // by reference
+	excesses map[string]map[string]tlb.Grams
+}
+
+func NewMemoryStakeRepository() *MemoryStakeRepository {
+	return &MemoryStakeRepository{
+		requests: make(map[string]*domain.StakeRequest),
+		excesses: make(map[string]map[string]tlb.Grams),
+	}
+}
+
+func (repo *MemoryStakeRepository) InsertIfNotExists(address string, roundSince uint32, hash string, msgIndex int, finalMcSeqno *uint32, owner *string, info domain.StakeRelatedInfo) (*domain.StakeRequest, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	reference := domain.StakeReference(hash, msgIndex)
+	r, exist := repo.requests[reference]
+	if !exist {
+		r = &domain.StakeRequest{
+			Address:    address,
+			RoundSince: roundSince,
+			Hash:       hash,
+			MsgIndex:   msgIndex,
+			State:      domain.RequestStateNew,
+			RetryCount: 0,
+			CreatedAt:  time.Now(),
+		}
+		repo.requests[reference] = r
+	}
+	r.Info = info
+	if r.FinalMcSeqno == nil {
+		r.FinalMcSeqno = finalMcSeqno
+	}
+	if r.Owner == nil {
+		r.Owner = owner
+	}
+
+	result := *r
+	return &result, nil
+}
+
+func (repo *MemoryStakeRepository) Find(hash string, msgIndex int) (*domain.StakeRequest, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	r, exist := repo.requests[domain.StakeReference(hash, msgIndex)]
+	if !exist {
+		return nil, nil
+	}
+
+	result := *r
+	return &result, nil
+}
+
+func (repo *MemoryStakeRepository) FindAllTriable(maxRetry int) ([]*domain.StakeRequest, error) {
+	return repo.findAll(func(r *domain.StakeRequest) bool {
+		return isTriable(r.State) && r.RetryCount < maxRetry
+	}), nil
+}
+
+func (repo *MemoryStakeRepository) FindAllVerifiable() ([]*domain.StakeRequest, error) {
+	return repo.findAll(func(r *domain.StakeRequest) bool {
+		return r.State == domain.RequestStateSent
+	}), nil
+}
+
+func (repo *MemoryStakeRepository) SetState(hash string, msgIndex int, state string) error {
+	return repo.update(hash, msgIndex, func(r *domain.StakeRequest) {
+		r.State = state
+	})
+}
+
+func (repo *MemoryStakeRepository) SetRetrying(hash string, msgIndex int, timestamp time.Time) error {
+	return repo.update(hash, msgIndex, func(r *domain.StakeRequest) {
+		r.RetryCount++
+		r.RetriedAt = &timestamp
+		r.State = domain.RequestStateOngoing
+	})
+}
+
+func (repo *MemoryStakeRepository) SetSent(hash string, msgIndex int, messageHash string, cost tlb.Grams, timestamp time.Time) error {
+	return repo.update(hash, msgIndex, func(r *domain.StakeRequest) {
+		r.SentAt = &timestamp
+		r.MessageHash = &messageHash
+		r.Cost = &cost
+		r.State = domain.RequestStateSent
+	})
+}
+
+func (repo *MemoryStakeRepository) SetVerified(hash string, msgIndex int, timestamp time.Time) error {
+	return repo.update(hash, msgIndex, func(r *domain.StakeRequest) {
+		r.VerifiedAt = &timestamp
+		r.State = domain.RequestStateVerified
+	})
+}
+
+func (repo *MemoryStakeRepository) FindByOwner(owner string) ([]*domain.StakeRequest, error) {
+	return repo.findAll(func(r *domain.StakeRequest) bool {
+		return r.Owner != nil && *r.Owner == owner
+	}), nil
+}
+
+func (repo *MemoryStakeRepository) AddExcess(hash string, msgIndex int, excessHash string, value tlb.Grams) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	reference := domain.StakeReference(hash, msgIndex)
+	r, exist := repo.requests[reference]
+	if !exist {
+		return ErrorRecordNotFound
+	}
+
+	excesses, exist := repo.excesses[reference]
+	if !exist {
+		excesses = make(map[string]tlb.Grams)
+		repo.excesses[reference] = excesses
+	}
+	if _, exist := excesses[excessHash]; !exist {
+		excesses[excessHash] = value
+	}
+
+	total := tlb.Grams(0)
+	for _, v := range excesses {
+		total += v
+	}
+	r.Excess = &total
+	return nil
+}
+
+func (repo *MemoryStakeRepository) SetRejected(hash string, msgIndex int, exitCode int32) error {
+	return repo.update(hash, msgIndex, func(r *domain.StakeRequest) {
+		r.ExitCode = &exitCode
+		r.State = domain.RequestStateRejected
+	})
+}
+
+func (repo *MemoryStakeRepository) SetBounced(hash string, msgIndex int, exitCode *int32) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	r, exist := repo.requests[domain.StakeReference(hash, msgIndex)]
+	if !exist || !isBounceable(r.State) {
+		return ErrorRecordNotFound
+	}
+	r.ExitCode = exitCode
+	r.State = domain.RequestStateBounced
+	return nil
+}
+
+func (repo *MemoryStakeRepository) findAll(match func(r *domain.StakeRequest) bool) []*domain.StakeRequest {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	list := make([]*domain.StakeRequest, 0)
+	for _, r := range repo.requests {
+		if match(r) {
+			result := *r
+			list = append(list, &result)
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return list
+}
+
+func (repo *MemoryStakeRepository) update(hash string, msgIndex int, change func(r *domain.StakeRequest)) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	r, exist := repo.requests[domain.StakeReference(hash, msgIndex)]
+	if !exist {
+		return ErrorRecordNotFound
+	}
+	change(r)
+	return nil
+}
+
+func isTriable(state string) bool {
+	switch state {
+	case domain.RequestStateNew, domain.RequestStateError, domain.RequestStateRetriable, domain.RequestStateOngoing, domain.RequestStateRejected:
+		return true
+	}
+	return false
+}
+
+// isBounceable reports whether a message is sent for a request in the state, so it can be bounced.
+func isBounceable(state string) bool {
+	switch state {
+	case domain.RequestStateSent, domain.RequestStateVerified, domain.RequestStateRetriable:
+		return true
+	}
+	return false
+}
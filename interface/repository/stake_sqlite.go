@@ -0,0 +1,116 @@
+package repository
+
+const (
+	sqliteStakeInsertIfNotExists = `
+	insert into stakes as c (
+			address, round_since, hash, msg_index, final_mc_seqno, owner, state, retry_count, info, created_at, retried_at, sent_at, verified_at
+		)
+		values (
+			?1, ?2, ?3, ?4, ?5, ?6, 'new', 0, ?7, CURRENT_TIMESTAMP, null, null, null
+		)
+	on conflict (hash, msg_index) do
+		update set
+			info = ?7, final_mc_seqno = coalesce(c.final_mc_seqno, ?5), owner = coalesce(c.owner, ?6)
+`
+
+	sqliteStakeFind = `
+	select
+		address, round_since, hash, msg_index, final_mc_seqno, owner, state, retry_count, info, created_at, retried_at, sent_at, verified_at, message_hash, exit_code, cost, excess
+	from stakes
+	where hash = ?1 and msg_index = ?2
+`
+
+	sqliteStakeFindAllTriable = `
+	select
+		address, round_since, hash, msg_index, final_mc_seqno, owner, state, retry_count, info, created_at, retried_at, sent_at, verified_at, message_hash, exit_code, cost, excess
+	from stakes
+	where state in ('new', 'error', 'retriable', 'ongoing', 'rejected') and retry_count < ?1
+`
+
+	sqliteStakeFindAllVerifiable = `
+	select
+		address, round_since, hash, msg_index, final_mc_seqno, owner, state, retry_count, info, created_at, retried_at, sent_at, verified_at, message_hash, exit_code, cost, excess
+	from stakes
+	where state in ('sent')
+`
+
+	sqliteStakeSetState = `
+	update stakes
+		set state = ?3
+	where hash = ?1 and msg_index = ?2
+`
+
+	sqliteStakeSetRetrying = `
+	update stakes
+		set retry_count = retry_count + 1, retried_at = ?3, state = 'ongoing'
+	where hash = ?1 and msg_index = ?2
+`
+
+	sqliteStakeSetSent = `
+	update stakes
+		set sent_at = ?3, state = 'sent', message_hash = ?4, cost = ?5
+	where hash = ?1 and msg_index = ?2
+`
+
+	sqliteStakeSetVerified = `
+	update stakes
+		set verified_at = ?3, state = 'verified'
+	where hash = ?1 and msg_index = ?2
+`
+
+	sqliteStakeFindByOwner = `
+	select
+		address, round_since, hash, msg_index, final_mc_seqno, owner, state, retry_count, info, created_at, retried_at, sent_at, verified_at, message_hash, exit_code, cost, excess
+	from stakes
+	where owner = ?1
+	order by created_at
+`
+
+	sqliteStakeInsertExcess = `
+	insert into excesses (
+			hash, reference, value, created_at
+		)
+		values (
+			?2, ?1, ?3, CURRENT_TIMESTAMP
+		)
+	on conflict (hash) do nothing
+`
+
+	sqliteStakeSetExcess = `
+	update stakes
+		set excess = (select sum(value) from excesses where reference = ?3)
+	where hash = ?1 and msg_index = ?2
+`
+
+	sqliteStakeSetRejected = `
+	update stakes
+		set state = 'rejected', exit_code = ?3
+	where hash = ?1 and msg_index = ?2
+`
+
+	sqliteStakeSetBounced = `
+	update stakes
+		set state = 'bounced', exit_code = ?3
+	where hash = ?1 and msg_index = ?2 and state in ('sent', 'verified', 'retriable')
+`
+)
+
+var sqliteStakeQueries = stakeQueries{
+	insertIfNotExists: sqliteStakeInsertIfNotExists,
+	find:              sqliteStakeFind,
+	findAllTriable:    sqliteStakeFindAllTriable,
+	findAllVerifiable: sqliteStakeFindAllVerifiable,
+	setState:          sqliteStakeSetState,
+	setRetrying:       sqliteStakeSetRetrying,
+	setSent:           sqliteStakeSetSent,
+	setVerified:       sqliteStakeSetVerified,
+	findByOwner:       sqliteStakeFindByOwner,
+	insertExcess:      sqliteStakeInsertExcess,
+	setExcess:         sqliteStakeSetExcess,
+	setRejected:       sqliteStakeSetRejected,
+	setBounced:        sqliteStakeSetBounced,
+}
+
+func NewSQLiteStakeRepository(db BatchHandler) *StakeRepository {
+	return &StakeRepository{batchHandler: db, queries: sqliteStakeQueries}
+}
@@ -7,38 +7,39 @@ import (
 	"time"
 
 	"github.com/behrang/sqlbatch"
+	"github.com/tonkeeper/tongo/tlb"
 )
 
 const (
 	sqlUntakeInsertIfNotExists = `
 	insert into unstakes as c (
-			address, tokens, hash, state, retry_count, info, created_at, retried_at, sent_at, verified_at
+			address, tokens, hash, final_mc_seqno, owner, state, retry_count, info, created_at, retried_at, sent_at, verified_at
 		)
 		values (
-			$1, $2, $3, 'new', 0, $4::jsonb, now(), null, null, null
+			$1, $2, $3, $4, $5, 'new', 0, $6::jsonb, now(), null, null, null
 		)
 	on conflict (hash) do
 		update set
-			info = $4::jsonb
+			info = $6::jsonb, final_mc_seqno = coalesce(c.final_mc_seqno, $4), owner = coalesce(c.owner, $5)
 `
 
 	sqlUnstakeFind = `
 	select
-		address, tokens, hash, state, retry_count, info, created_at, retried_at, sent_at, verified_at
+		address, tokens, hash, final_mc_seqno, owner, state, retry_count, info, created_at, retried_at, sent_at, verified_at, message_hash, exit_code, cost, excess
 	from unstakes
 	where hash = $1
 `
 
 	sqlUnstakeFindAllTriable = `
 	select
-		address, tokens, hash, state, retry_count, info, created_at, retried_at, sent_at, verified_at
+		address, tokens, hash, final_mc_seqno, owner, state, retry_count, info, created_at, retried_at, sent_at, verified_at, message_hash, exit_code, cost, excess
 	from unstakes
-	where state in ('new', 'error', 'retriable', 'ongoing') and retry_count < $1
+	where state in ('new', 'error', 'retriable', 'ongoing', 'rejected') and retry_count < $1
 `
 
 	sqlUnstakeFindAllVerifiable = `
 	select
-		address, tokens, hash, state, retry_count, info, created_at, retried_at, sent_at, verified_at
+		address, tokens, hash, final_mc_seqno, owner, state, retry_count, info, created_at, retried_at, sent_at, verified_at, message_hash, exit_code, cost, excess
 	from unstakes
 	where state in ('sent')
 `
@@ -57,7 +58,7 @@ const (
 
 	sqlUntakeSetSent = `
 	update unstakes
-		set sent_at = $2, state = 'sent'
+		set sent_at = $2, state = 'sent', message_hash = $3, cost = $4
 	where hash = $1
 `
 
@@ -66,14 +67,84 @@ const (
 		set verified_at = $2, state = 'verified'
 	where hash = $1
 `
+
+	sqlUnstakeFindByOwner = `
+	select
+		address, tokens, hash, final_mc_seqno, owner, state, retry_count, info, created_at, retried_at, sent_at, verified_at, message_hash, exit_code, cost, excess
+	from unstakes
+	where owner = $1
+	order by created_at
+`
+
+	sqlUnstakeInsertExcess = `
+	insert into excesses (
+			hash, reference, value, created_at
+		)
+		values (
+			$2, $1, $3, now()
+		)
+	on conflict (hash) do nothing
+`
+
+	sqlUnstakeSetExcess = `
+	update unstakes
+		set excess = (select sum(value) from excesses where reference = $1)
+	where hash = $1
+`
+
+	sqlUnstakeSetRejected = `
+	update unstakes
+		set state = 'rejected', exit_code = $2
+	where hash = $1
+`
+
+	sqlUnstakeSetBounced = `
+	update unstakes
+		set state = 'bounced', exit_code = $2
+	where hash = $1 and state in ('sent', 'verified', 'retriable')
+`
 )
 
+// unstakeQueries keeps the SQL commands of a database dialect.
+type unstakeQueries struct {
+	insertIfNotExists string
+	find              string
+	findAllTriable    string
+	findAllVerifiable string
+	setState          string
+	setRetrying       string
+	setSent           string
+	setVerified       string
+	findByOwner       string
+	insertExcess      string
+	setExcess         string
+	setRejected       string
+	setBounced        string
+}
+
+var postgresUnstakeQueries = unstakeQueries{
+	insertIfNotExists: sqlUntakeInsertIfNotExists,
+	find:              sqlUnstakeFind,
+	findAllTriable:    sqlUnstakeFindAllTriable,
+	findAllVerifiable: sqlUnstakeFindAllVerifiable,
+	setState:          sqlUnstakeSetState,
+	setRetrying:       sqlUntakeSetRetrying,
+	setSent:           sqlUntakeSetSent,
+	setVerified:       sqlUntakeSetVerified,
+	findByOwner:       sqlUnstakeFindByOwner,
+	insertExcess:      sqlUnstakeInsertExcess,
+	setExcess:         sqlUnstakeSetExcess,
+	setRejected:       sqlUnstakeSetRejected,
+	setBounced:        sqlUnstakeSetBounced,
+}
+
 type UnstakeRepository struct {
 	batchHandler BatchHandler
+	queries      unstakeQueries
 }
 
 func NewUnstakeRepository(db BatchHandler) *UnstakeRepository {
-	return &UnstakeRepository{batchHandler: db}
+	return &UnstakeRepository{batchHandler: db, queries: postgresUnstakeQueries}
 }
 
 func readUnstake(scan func(...interface{}) error) (interface{}, error) {
@@ -81,7 +152,7 @@ func readUnstake(scan func(...interface{}) error) (interface{}, error) {
 	var tokenStr string
 	var infoJson []byte
 	err := scan(
-		&r.Address, &tokenStr, &r.Hash, &r.State, &r.RetryCount, &infoJson, &r.CreatedAt, &r.RetriedAt, &r.SentAt, &r.VerifiedAt,
+		&r.Address, &tokenStr, &r.Hash, &r.FinalMcSeqno, &r.Owner, &r.State, &r.RetryCount, &infoJson, &r.CreatedAt, &r.RetriedAt, &r.SentAt, &r.VerifiedAt, &r.MessageHash, &r.ExitCode, &r.Cost, &r.Excess,
 	)
 	if err != nil {
 		return &r, err
@@ -99,7 +170,7 @@ func readAllUnstakes(memo interface{}, scan func(...interface{}) error) (interfa
 	var tokenStr string
 	var infoJson []byte
 	err := scan(
-		&r.Address, &tokenStr, &r.Hash, &r.State, &r.RetryCount, &infoJson, &r.CreatedAt, &r.RetriedAt, &r.SentAt, &r.VerifiedAt,
+		&r.Address, &tokenStr, &r.Hash, &r.FinalMcSeqno, &r.Owner, &r.State, &r.RetryCount, &infoJson, &r.CreatedAt, &r.RetriedAt, &r.SentAt, &r.VerifiedAt, &r.MessageHash, &r.ExitCode, &r.Cost, &r.Excess,
 	)
 
 	if err == nil {
@@ -115,19 +186,19 @@ func readAllUnstakes(memo interface{}, scan func(...interface{}) error) (interfa
 	return list, err
 }
 
-func (repo *UnstakeRepository) InsertIfNotExists(address string, tokens big.Int, hash string, info domain.UnstakeRelatedInfo) (*domain.UnstakeRequest, error) {
+func (repo *UnstakeRepository) InsertIfNotExists(address string, tokens big.Int, hash string, finalMcSeqno *uint32, owner *string, info domain.UnstakeRelatedInfo) (*domain.UnstakeRequest, error) {
 
 	infoJson, _ := json.Marshal(info)
 	results, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
 		{
-			Query: sqlUntakeInsertIfNotExists,
+			Query: repo.queries.insertIfNotExists,
 			Args: []interface{}{
-				address, tokens.String(), hash, infoJson,
+				address, tokens.String(), hash, finalMcSeqno, owner, infoJson,
 			},
 			Affect: 1,
 		},
 		{
-			Query:   sqlUnstakeFind,
+			Query:   repo.queries.find,
 			Args:    []interface{}{hash},
 			ReadOne: readUnstake,
 		},
@@ -140,7 +211,7 @@ func (repo *UnstakeRepository) InsertIfNotExists(address string, tokens big.Int,
 func (repo *UnstakeRepository) Find(hash string) (*domain.UnstakeRequest, error) {
 	results, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
 		{
-			Query:   sqlUnstakeFind,
+			Query:   repo.queries.find,
 			Args:    []interface{}{hash},
 			ReadOne: readUnstake,
 		},
@@ -152,7 +223,7 @@ func (repo *UnstakeRepository) Find(hash string) (*domain.UnstakeRequest, error)
 func (repo *UnstakeRepository) FindAllTriable(maxRetry int) ([]*domain.UnstakeRequest, error) {
 	results, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
 		{
-			Query:   sqlUnstakeFindAllTriable,
+			Query:   repo.queries.findAllTriable,
 			Args:    []interface{}{maxRetry},
 			Init:    make([]*domain.UnstakeRequest, 0),
 			ReadAll: readAllUnstakes,
@@ -165,7 +236,7 @@ func (repo *UnstakeRepository) FindAllTriable(maxRetry int) ([]*domain.UnstakeRe
 func (repo *UnstakeRepository) FindAllVerifiable() ([]*domain.UnstakeRequest, error) {
 	results, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
 		{
-			Query:   sqlUnstakeFindAllVerifiable,
+			Query:   repo.queries.findAllVerifiable,
 			Args:    []interface{}{},
 			Init:    make([]*domain.UnstakeRequest, 0),
 			ReadAll: readAllUnstakes,
@@ -178,7 +249,7 @@ func (repo *UnstakeRepository) FindAllVerifiable() ([]*domain.UnstakeRequest, er
 func (repo *UnstakeRepository) SetState(hash string, state string) error {
 	_, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
 		{
-			Query:  sqlUnstakeSetState,
+			Query:  repo.queries.setState,
 			Args:   []interface{}{hash, state},
 			Affect: 1,
 		},
@@ -189,7 +260,7 @@ func (repo *UnstakeRepository) SetState(hash string, state string) error {
 func (repo *UnstakeRepository) SetRetrying(hash string, timestamp time.Time) error {
 	_, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
 		{
-			Query:  sqlUntakeSetRetrying,
+			Query:  repo.queries.setRetrying,
 			Args:   []interface{}{hash, timestamp},
 			Affect: 1,
 		},
@@ -197,11 +268,11 @@ func (repo *UnstakeRepository) SetRetrying(hash string, timestamp time.Time) err
 	return err
 }
 
-func (repo *UnstakeRepository) SetSent(hash string, timestamp time.Time) error {
+func (repo *UnstakeRepository) SetSent(hash string, messageHash string, cost tlb.Grams, timestamp time.Time) error {
 	_, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
 		{
-			Query:  sqlUntakeSetSent,
-			Args:   []interface{}{hash, timestamp},
+			Query:  repo.queries.setSent,
+			Args:   []interface{}{hash, timestamp, messageHash, int64(cost)},
 			Affect: 1,
 		},
 	})
@@ -211,10 +282,67 @@ func (repo *UnstakeRepository) SetSent(hash string, timestamp time.Time) error {
 func (repo *UnstakeRepository) SetVerified(hash string, timestamp time.Time) error {
 	_, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
 		{
-			Query:  sqlUntakeSetVerified,
+			Query:  repo.queries.setVerified,
 			Args:   []interface{}{hash, timestamp},
 			Affect: 1,
 		},
 	})
 	return err
 }
+
+// FindByOwner returns the requests of the owner's wallet, the oldest first.
+func (repo *UnstakeRepository) FindByOwner(owner string) ([]*domain.UnstakeRequest, error) {
+	results, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
+		{
+			Query:   repo.queries.findByOwner,
+			Args:    []interface{}{owner},
+			Init:    make([]*domain.UnstakeRequest, 0),
+			ReadAll: readAllUnstakes,
+		},
+	})
+	result, _ := results[0].([]*domain.UnstakeRequest)
+	return result, err
+}
+
+// AddExcess keeps an excess returned for the request, and sums up the excesses of the request. An excess is kept
+// once, so adding it again changes nothing.
+func (repo *UnstakeRepository) AddExcess(hash string, excessHash string, value tlb.Grams) error {
+	_, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
+		{
+			Query: repo.queries.insertExcess,
+			Args:  []interface{}{hash, excessHash, int64(value)},
+		},
+		{
+			Query:  repo.queries.setExcess,
+			Args:   []interface{}{hash},
+			Affect: 1,
+		},
+	})
+	return err
+}
+
+// SetRejected keeps the exit code of the emulation which rejected the message of the request. The request is
+// tried again, as the emulation reflects the current state of the j-wallet.
+func (repo *UnstakeRepository) SetRejected(hash string, exitCode int32) error {
+	_, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
+		{
+			Query:  repo.queries.setRejected,
+			Args:   []interface{}{hash, exitCode},
+			Affect: 1,
+		},
+	})
+	return err
+}
+
+// SetBounced moves a sent request to the bounced state, along with the exit code of the j-wallet transaction which
+// bounced the message, or nil if it's unknown. It fails if the request is not sent, e.g. it's being sent again.
+func (repo *UnstakeRepository) SetBounced(hash string, exitCode *int32) error {
+	_, err := repo.batchHandler.Batch(&BatchOptionNormal, []sqlbatch.Command{
+		{
+			Query:  repo.queries.setBounced,
+			Args:   []interface{}{hash, exitCode},
+			Affect: 1,
+		},
+	})
+	return err
+}
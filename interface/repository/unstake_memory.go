@@ -0,0 +1,195 @@
+package repository
+
+import (
+	"driver/domain"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tonkeeper/tongo/tlb"
+)
+
+// MemoryUnstakeRepository keeps unstake requests in memory. It behaves like UnstakeRepository and is
+// meant for tests and short-lived runs.
+type MemoryUnstakeRepository struct {
+	mutex    sync.Mutex
+	requests map[string]*domain.UnstakeRequest
+	excesses map[string]map[string]tlb.Grams
+}
+
+func NewMemoryUnstakeRepository() *MemoryUnstakeRepository {
+	return &MemoryUnstakeRepository{
+		requests: make(map[string]*domain.UnstakeRequest),
+		excesses: make(map[string]map[string]tlb.Grams),
+	}
+}
+
+func (repo *MemoryUnstakeRepository) InsertIfNotExists(address string, tokens big.Int, hash string, finalMcSeqno *uint32, owner *string, info domain.UnstakeRelatedInfo) (*domain.UnstakeRequest, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	r, exist := repo.requests[hash]
+	if !exist {
+		r = &domain.UnstakeRequest{
+			Address:    address,
+			Hash:       hash,
+			State:      domain.RequestStateNew,
+			RetryCount: 0,
+			CreatedAt:  time.Now(),
+		}
+		r.Tokens.Set(&tokens)
+		repo.requests[hash] = r
+	}
+	r.Info = info
+	if r.FinalMcSeqno == nil {
+		r.FinalMcSeqno = finalMcSeqno
+	}
+	if r.Owner == nil {
+		r.Owner = owner
+	}
+
+	return copyUnstake(r), nil
+}
+
+func (repo *MemoryUnstakeRepository) Find(hash string) (*domain.UnstakeRequest, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	r, exist := repo.requests[hash]
+	if !exist {
+		return nil, nil
+	}
+	return copyUnstake(r), nil
+}
+
+func (repo *MemoryUnstakeRepository) FindAllTriable(maxRetry int) ([]*domain.UnstakeRequest, error) {
+	return repo.findAll(func(r *domain.UnstakeRequest) bool {
+		return isTriable(r.State) && r.RetryCount < maxRetry
+	}), nil
+}
+
+func (repo *MemoryUnstakeRepository) FindAllVerifiable() ([]*domain.UnstakeRequest, error) {
+	return repo.findAll(func(r *domain.UnstakeRequest) bool {
+		return r.State == domain.RequestStateSent
+	}), nil
+}
+
+func (repo *MemoryUnstakeRepository) SetState(hash string, state string) error {
+	return repo.update(hash, func(r *domain.UnstakeRequest) {
+		r.State = state
+	})
+}
+
+func (repo *MemoryUnstakeRepository) SetRetrying(hash string, timestamp time.Time) error {
+	return repo.update(hash, func(r *domain.UnstakeRequest) {
+		r.RetryCount++
+		r.RetriedAt = &timestamp
+		r.State = domain.RequestStateOngoing
+	})
+}
+
+func (repo *MemoryUnstakeRepository) SetSent(hash string, messageHash string, cost tlb.Grams, timestamp time.Time) error {
+	return repo.update(hash, func(r *domain.UnstakeRequest) {
+		r.SentAt = &timestamp
+		r.MessageHash = &messageHash
+		r.Cost = &cost
+		r.State = domain.RequestStateSent
+	})
+}
+
+func (repo *MemoryUnstakeRepository) SetVerified(hash string, timestamp time.Time) error {
+	return repo.update(hash, func(r *domain.UnstakeRequest) {
+		r.VerifiedAt = &timestamp
+		r.State = domain.RequestStateVerified
+	})
+}
+
+func (repo *MemoryUnstakeRepository) FindByOwner(owner string) ([]*domain.UnstakeRequest, error) {
+	return repo.findAll(func(r *domain.UnstakeRequest) bool {
+		return r.Owner != nil && *r.Owner == owner
+	}), nil
+}
+
+func (repo *MemoryUnstakeRepository) AddExcess(hash string, excessHash string, value tlb.Grams) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	r, exist := repo.requests[hash]
+	if !exist {
+		return ErrorRecordNotFound
+	}
+
+	excesses, exist := repo.excesses[hash]
+	if !exist {
+		excesses = make(map[string]tlb.Grams)
+		repo.excesses[hash] = excesses
+	}
+	if _, exist := excesses[excessHash]; !exist {
+		excesses[excessHash] = value
+	}
+
+	total := tlb.Grams(0)
+	for _, v := range excesses {
+		total += v
+	}
+	r.Excess = &total
+	return nil
+}
+
+func (repo *MemoryUnstakeRepository) SetRejected(hash string, exitCode int32) error {
+	return repo.update(hash, func(r *domain.UnstakeRequest) {
+		r.ExitCode = &exitCode
+		r.State = domain.RequestStateRejected
+	})
+}
+
+func (repo *MemoryUnstakeRepository) SetBounced(hash string, exitCode *int32) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	r, exist := repo.requests[hash]
+	if !exist || !isBounceable(r.State) {
+		return ErrorRecordNotFound
+	}
+	r.ExitCode = exitCode
+	r.State = domain.RequestStateBounced
+	return nil
+}
+
+func (repo *MemoryUnstakeRepository) findAll(match func(r *domain.UnstakeRequest) bool) []*domain.UnstakeRequest {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	list := make([]*domain.UnstakeRequest, 0)
+	for _, r := range repo.requests {
+		if match(r) {
+			list = append(list, copyUnstake(r))
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return list
+}
+
+func (repo *MemoryUnstakeRepository) update(hash string, change func(r *domain.UnstakeRequest)) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	r, exist := repo.requests[hash]
+	if !exist {
+		return ErrorRecordNotFound
+	}
+	change(r)
+	return nil
+}
+
+// copyUnstake copies a request, including its tokens, so callers can't alter the stored one.
+func copyUnstake(r *domain.UnstakeRequest) *domain.UnstakeRequest {
+	result := *r
+	result.Tokens = big.Int{}
+	result.Tokens.Set(&r.Tokens)
+	return &result
+}
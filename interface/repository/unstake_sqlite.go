@@ -0,0 +1,116 @@
+package repository
+
+const (
+	sqliteUnstakeInsertIfNotExists = `
+	insert into unstakes as c (
+			address, tokens, hash, final_mc_seqno, owner, state, retry_count, info, created_at, retried_at, sent_at, verified_at
+		)
+		values (
+			?1, ?2, ?3, ?4, ?5, 'new', 0, ?6, CURRENT_TIMESTAMP, null, null, null
+		)
+	on conflict (hash) do
+		update set
+			info = ?6, final_mc_seqno = coalesce(c.final_mc_seqno, ?4), owner = coalesce(c.owner, ?5)
+`
+
+	sqliteUnstakeFind = `
+	select
+		address, tokens, hash, final_mc_seqno, owner, state, retry_count, info, created_at, retried_at, sent_at, verified_at, message_hash, exit_code, cost, excess
+	from unstakes
+	where hash = ?1
+`
+
+	sqliteUnstakeFindAllTriable = `
+	select
+		address, tokens, hash, final_mc_seqno, owner, state, retry_count, info, created_at, retried_at, sent_at, verified_at, message_hash, exit_code, cost, excess
+	from unstakes
+	where state in ('new', 'error', 'retriable', 'ongoing', 'rejected') and retry_count < ?1
+`
+
+	sqliteUnstakeFindAllVerifiable = `
+	select
+		address, tokens, hash, final_mc_seqno, owner, state, retry_count, info, created_at, retried_at, sent_at, verified_at, message_hash, exit_code, cost, excess
+	from unstakes
+	where state in ('sent')
+`
+
+	sqliteUnstakeSetState = `
+	update unstakes
+		set state = ?2
+	where hash = ?1
+`
+
+	sqliteUnstakeSetRetrying = `
+	update unstakes
+		set retry_count = retry_count + 1, retried_at = ?2, state = 'ongoing'
+	where hash = ?1
+`
+
+	sqliteUnstakeSetSent = `
+	update unstakes
+		set sent_at = ?2, state = 'sent', message_hash = ?3, cost = ?4
+	where hash = ?1
+`
+
+	sqliteUnstakeSetVerified = `
+	update unstakes
+		set verified_at = ?2, state = 'verified'
+	where hash = ?1
+`
+
+	sqliteUnstakeFindByOwner = `
+	select
+		address, tokens, hash, final_mc_seqno, owner, state, retry_count, info, created_at, retried_at, sent_at, verified_at, message_hash, exit_code, cost, excess
+	from unstakes
+	where owner = ?1
+	order by created_at
+`
+
+	sqliteUnstakeInsertExcess = `
+	insert into excesses (
+			hash, reference, value, created_at
+		)
+		values (
+			?2, ?1, ?3, CURRENT_TIMESTAMP
+		)
+	on conflict (hash) do nothing
+`
+
+	sqliteUnstakeSetExcess = `
+	update unstakes
+		set excess = (select sum(value) from excesses where reference = ?1)
+	where hash = ?1
+`
+
+	sqliteUnstakeSetRejected = `
+	update unstakes
+		set state = 'rejected', exit_code = ?2
+	where hash = ?1
+`
+
+	sqliteUnstakeSetBounced = `
+	update unstakes
+		set state = 'bounced', exit_code = ?2
+	where hash = ?1 and state in ('sent', 'verified', 'retriable')
+`
+)
+
+var sqliteUnstakeQueries = unstakeQueries{
+	insertIfNotExists: sqliteUnstakeInsertIfNotExists,
+	find:              sqliteUnstakeFind,
+	findAllTriable:    sqliteUnstakeFindAllTriable,
+	findAllVerifiable: sqliteUnstakeFindAllVerifiable,
+	setState:          sqliteUnstakeSetState,
+	setRetrying:       sqliteUnstakeSetRetrying,
+	setSent:           sqliteUnstakeSetSent,
+	setVerified:       sqliteUnstakeSetVerified,
+	findByOwner:       sqliteUnstakeFindByOwner,
+	insertExcess:      sqliteUnstakeInsertExcess,
+	setExcess:         sqliteUnstakeSetExcess,
+	setRejected:       sqliteUnstakeSetRejected,
+	setBounced:        sqliteUnstakeSetBounced,
+}
+
+func NewSQLiteUnstakeRepository(db BatchHandler) *UnstakeRepository {
+	return &UnstakeRepository{batchHandler: db, queries: sqliteUnstakeQueries}
+}
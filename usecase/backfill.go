@@ -0,0 +1,251 @@
+package usecase
+
+import (
+	"context"
+	"driver/domain"
+	"driver/domain/model"
+	"driver/interface/exporter"
+	"log"
+
+	"github.com/tonkeeper/tongo"
+)
+
+// BackfillInteractor looks through a range of the treasury history again, and stores the stake and unstake requests,
+// the failed requests and the events missed by the extraction. Old transactions are only kept by archive liteservers,
+// so the client should be connected to one of them.
+type BackfillInteractor struct {
+	client             ChainClient
+	stakeInteractor    *StakeInteractor
+	unstakeInteractor  *UnstakeInteractor
+	eventInteractor    *EventInteractor
+	failureInteractor  *FailureInteractor
+	decoderRegistry    *DecoderRegistry
+	finalityInteractor *FinalityInteractor
+	inboundInteractor  *InboundInteractor
+}
+
+func NewBackfillInteractor(client ChainClient,
+	stakeInteractor *StakeInteractor,
+	unstakeInteractor *UnstakeInteractor,
+	eventInteractor *EventInteractor,
+	failureInteractor *FailureInteractor,
+	decoderRegistry *DecoderRegistry,
+	finalityInteractor *FinalityInteractor,
+	inboundInteractor *InboundInteractor) *BackfillInteractor {
+	interactor := &BackfillInteractor{
+		client:             client,
+		stakeInteractor:    stakeInteractor,
+		unstakeInteractor:  unstakeInteractor,
+		eventInteractor:    eventInteractor,
+		failureInteractor:  failureInteractor,
+		decoderRegistry:    decoderRegistry,
+		finalityInteractor: finalityInteractor,
+		inboundInteractor:  inboundInteractor,
+	}
+	return interactor
+}
+
+// Backfill pages back through the transactions of the treasury in the range, and finds the requests in them which
+// are not stored yet. The missing requests are inserted, unless it's a dry run. Requests already stored are left as
+// they are. Transactions the latest final masterchain block doesn't commit to are left for the extraction.
+func (interactor *BackfillInteractor) Backfill(ctx context.Context, treasuryAccount tongo.AccountID, r domain.BackfillRange, dryRun bool) (*domain.BackfillResult, error) {
+	result := domain.BackfillResult{
+		StakeRequests:   make([]domain.StakeRequest, 0),
+		UnstakeRequests: make([]domain.UnstakeRequest, 0),
+		FailedRequests:  make([]domain.FailedRequest, 0),
+	}
+
+	final, err := interactor.finalityInteractor.FinalBlock(ctx, treasuryAccount)
+	if err != nil {
+		exporter.IncErrorCount()
+		log.Printf("🔴 getting final block - %v\n", err.Error())
+		return nil, err
+	}
+
+	err = interactor.walkRange(ctx, treasuryAccount, r, final.EndLt, func(trans []tongo.Transaction) error {
+		return interactor.store(trans, final.MasterchainSeqno, &result, dryRun)
+	})
+	return &result, err
+}
+
+// BackfillInbound pages back through the transactions of the driver wallet in the range, and processes the bounces and
+// the excesses in them, as the inbound extraction does. Those already processed are left as they are. On a dry run,
+// they are only counted.
+func (interactor *BackfillInteractor) BackfillInbound(ctx context.Context, r domain.BackfillRange, dryRun bool) (*domain.InboundBackfillResult, error) {
+	result := domain.InboundBackfillResult{}
+
+	account := interactor.inboundInteractor.driverWallet.GetAddress()
+	err := interactor.walkRange(ctx, account, r, 0, func(trans []tongo.Transaction) error {
+		result.Transactions += len(trans)
+		if dryRun {
+			for _, t := range trans {
+				if isReturned(t) {
+					result.Returned++
+				}
+			}
+			return nil
+		}
+
+		bounces, excesses, err := interactor.inboundInteractor.process(ctx, trans)
+		result.Bounces += bounces
+		result.Excesses += excesses
+		return err
+	})
+	return &result, err
+}
+
+// walkRange pages back through the transactions of the account, the latest first, and passes the transactions of
+// each page in the range to process. Transactions at or after beforeLt are left out, unless it's zero.
+func (interactor *BackfillInteractor) walkRange(ctx context.Context,
+	account tongo.AccountID,
+	r domain.BackfillRange,
+	beforeLt uint64,
+	process func(trans []tongo.Transaction) error) error {
+
+	var trans []tongo.Transaction
+	var err error
+	if r.StartHash != "" {
+		var hash tongo.Bits256
+		err = hash.FromHex(r.StartHash)
+		if err != nil {
+			return err
+		}
+		trans, err = interactor.client.GetTransactions(ctx, tracePageSize, account, r.ToLt, hash)
+	} else {
+		trans, err = interactor.client.GetLastTransactions(ctx, account, lastTransactionsCount)
+	}
+	if err != nil {
+		exporter.IncErrorCount()
+		log.Printf("🔴 getting transactions - %v\n", err.Error())
+		return err
+	}
+
+	total := 0
+	for len(trans) > 0 {
+		inRange := make([]tongo.Transaction, 0, len(trans))
+		passed := false
+		for _, t := range trans {
+			if isBefore(t, r) {
+				passed = true
+				break
+			}
+			if !isAfter(t, r) && (beforeLt == 0 || t.Lt < beforeLt) {
+				inRange = append(inRange, t)
+			}
+		}
+
+		if len(inRange) > 0 {
+			total += len(inRange)
+			err = process(inRange)
+			if err != nil {
+				return err
+			}
+		}
+
+		last := trans[len(trans)-1]
+		ht := model.NewHTransaction(&last.Transaction)
+		log.Printf("Back-filling transactions... Total: %v / Reached lt: %v, time: %v\n", total, ht.Lt(), ht.UnixTime())
+		if passed || last.PrevTransLt == 0 {
+			break
+		}
+
+		trans, err = interactor.client.GetTransactions(ctx, tracePageSize, account, last.Lt, tongo.Bits256(last.Hash()))
+		if err != nil {
+			exporter.IncErrorCount()
+			log.Printf("🔴 getting transactions - %v\n", err.Error())
+			return err
+		}
+
+		// Remove the first element as it's already looked through in previous loop
+		if len(trans) > 0 {
+			trans = trans[1:]
+		}
+	}
+
+	return nil
+}
+
+// store keeps the requests of the transactions which are not stored yet, and their events, or only collects the
+// requests on a dry run.
+func (interactor *BackfillInteractor) store(trans []tongo.Transaction, finalMcSeqno uint32, result *domain.BackfillResult, dryRun bool) error {
+	result.Transactions += len(trans)
+
+	found := domain.ExtractionResult{FinalMcSeqno: finalMcSeqno}
+	interactor.decoderRegistry.Decode(trans, &found)
+
+	stakes := make([]domain.StakeRequest, 0)
+	for _, request := range found.StakeRequests {
+		exists, err := interactor.stakeInteractor.Exists(request.Hash, request.MsgIndex)
+		if err != nil {
+			exporter.IncErrorCount()
+			log.Printf("🔴 finding stake [hash: %v] - %v\n", request.Hash, err.Error())
+			return err
+		}
+		if !exists {
+			stakes = append(stakes, request)
+		}
+	}
+
+	unstakes := make([]domain.UnstakeRequest, 0)
+	for _, request := range found.UnstakeRequests {
+		exists, err := interactor.unstakeInteractor.Exists(request.Hash)
+		if err != nil {
+			exporter.IncErrorCount()
+			log.Printf("🔴 finding unstake [hash: %v] - %v\n", request.Hash, err.Error())
+			return err
+		}
+		if !exists {
+			unstakes = append(unstakes, request)
+		}
+	}
+
+	failures := make([]domain.FailedRequest, 0)
+	for _, request := range found.FailedRequests {
+		exists, err := interactor.failureInteractor.Exists(request.Hash)
+		if err != nil {
+			exporter.IncErrorCount()
+			log.Printf("🔴 finding failed request [hash: %v] - %v\n", request.Hash, err.Error())
+			return err
+		}
+		if !exists {
+			failures = append(failures, request)
+		}
+	}
+
+	if !dryRun {
+		events := interactor.eventInteractor.MakeEvents(trans)
+		err := interactor.eventInteractor.Store(events)
+		if err != nil {
+			return err
+		}
+		result.Events += len(events)
+
+		err = interactor.stakeInteractor.Store(stakes)
+		if err != nil {
+			return err
+		}
+		err = interactor.unstakeInteractor.Store(unstakes)
+		if err != nil {
+			return err
+		}
+		err = interactor.failureInteractor.Store(failures)
+		if err != nil {
+			return err
+		}
+	}
+
+	result.StakeRequests = append(result.StakeRequests, stakes...)
+	result.UnstakeRequests = append(result.UnstakeRequests, unstakes...)
+	result.FailedRequests = append(result.FailedRequests, failures...)
+	return nil
+}
+
+// isBefore tells whether the transaction is older than the range.
+func isBefore(t tongo.Transaction, r domain.BackfillRange) bool {
+	return t.Lt < r.FromLt || (!r.FromTime.IsZero() && int64(t.Now) < r.FromTime.Unix())
+}
+
+// isAfter tells whether the transaction is newer than the range.
+func isAfter(t tongo.Transaction, r domain.BackfillRange) bool {
+	return (r.ToLt != 0 && t.Lt > r.ToLt) || (!r.ToTime.IsZero() && int64(t.Now) > r.ToTime.Unix())
+}
@@ -0,0 +1,178 @@
+package usecase_test
+
+import (
+	"context"
+	"driver/domain"
+	"testing"
+
+	"github.com/tonkeeper/tongo/liteclient"
+)
+
+func TestBackfillInboundGap(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	env.sim.StartRound(100)
+
+	env.deposit(t, 0, 80)
+	result, err := env.extractInteractor.Extract(ctx, env.treasury)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.extractInteractor.Store(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env.sim.FinishRound(100)
+	env.startMessenger(t)
+	requests, err := env.stakeInteractor.LoadTriable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	send := func(requests []*domain.StakeRequest) {
+		err := env.stakeInteractor.SendStakeMessageToJettonWallets(ctx, requests)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, request := range requests {
+			waitFor(t, "stake "+request.Reference(), func() bool {
+				return env.stakeState(t, request.Hash, request.MsgIndex) == domain.RequestStateSent
+			})
+		}
+	}
+
+	// The excess of the first message moves the inbound cursor, and the excesses of the rest are more than the latest
+	// page, which is all the liteserver returns.
+	send(requests[:1])
+	_, excesses, err := env.inboundInteractor.Extract(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if excesses != 1 {
+		t.Fatalf("processed %v excesses, want the first one", excesses)
+	}
+	send(requests[1:])
+	env.sim.SetFailure("GetTransactions", liteclient.LiteServerErrorC{Code: 651, Message: "lt not in db"})
+	_, excesses, err = env.inboundInteractor.Extract(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if excesses == 0 || excesses >= len(requests)-1 {
+		t.Fatalf("processed %v excesses, want only the latest ones", excesses)
+	}
+	env.sim.SetFailure("GetTransactions", nil)
+
+	gaps, err := env.memoInteractor.GetInboundGaps()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gaps) != 1 {
+		t.Fatalf("got inbound gaps %v, want one", gaps)
+	}
+	missed := len(requests) - 1 - excesses
+
+	// The back-fill processes the excesses in the gap, as 'backfill --gaps' does, and the gap is forgotten.
+	r := domain.BackfillRange{FromLt: gaps[0].FromLt, ToLt: gaps[0].ToLt, StartHash: gaps[0].ToHash}
+	backfilled, err := env.backfillInteractor.BackfillInbound(ctx, r, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backfilled.Bounces != 0 || backfilled.Excesses < missed {
+		t.Fatalf("back-filled %v bounces and %v excesses, want the %v missed excesses", backfilled.Bounces, backfilled.Excesses, missed)
+	}
+	err = env.memoInteractor.RemoveInboundGap(gaps[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	gaps, err = env.memoInteractor.GetInboundGaps()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gaps) != 0 {
+		t.Fatalf("got inbound gaps %v after the back-fill, want none", gaps)
+	}
+
+	for _, request := range requests {
+		stake, err := env.stakeRepository.Find(request.Hash, request.MsgIndex)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stake.Excess == nil {
+			t.Fatalf("stake %v has no excess after the back-fill", request.Reference())
+		}
+	}
+}
+
+func TestBackfillDryRun(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	env.sim.StartRound(100)
+
+	env.deposit(t, 0, 10)
+	_, err := env.extractInteractor.Extract(ctx, env.treasury)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the latest page of the new deposits is extracted, and the rest is left in a gap.
+	env.deposit(t, 10, 80)
+	env.sim.SetFailure("GetTransactions", liteclient.LiteServerErrorC{Code: 651, Message: "lt not in db"})
+	result, err := env.extractInteractor.Extract(ctx, env.treasury)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.extractInteractor.Store(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.sim.SetFailure("GetTransactions", nil)
+
+	gaps, err := env.memoInteractor.GetExtractionGaps()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gaps) != 1 {
+		t.Fatalf("got gaps %v, want one", gaps)
+	}
+	r := domain.BackfillRange{FromLt: gaps[0].FromLt, ToLt: gaps[0].ToLt, StartHash: gaps[0].ToHash}
+
+	// A dry run finds the missed requests, each time, but stores none of them, and the gap is kept.
+	var found []domain.StakeRequest
+	for i := 0; i < 2; i++ {
+		dryRun, err := env.backfillInteractor.Backfill(ctx, env.treasury, r, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(dryRun.StakeRequests) == 0 || dryRun.Events != 0 {
+			t.Fatalf("dry run found %v stakes and stored %v events, want the missed stakes and no events",
+				len(dryRun.StakeRequests), dryRun.Events)
+		}
+		found = dryRun.StakeRequests
+	}
+	for _, request := range found {
+		if state := env.stakeState(t, request.Hash, request.MsgIndex); state != "" {
+			t.Fatalf("stake %v is %v after a dry run, want it not stored", request.Reference(), state)
+		}
+	}
+	gaps, err = env.memoInteractor.GetExtractionGaps()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gaps) != 1 {
+		t.Fatalf("got gaps %v after a dry run, want the gap kept", gaps)
+	}
+
+	// The back-fill then stores what the dry run found.
+	backfilled, err := env.backfillInteractor.Backfill(ctx, env.treasury, r, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backfilled.StakeRequests) != len(found) {
+		t.Fatalf("back-filled %v stakes, want the %v the dry run found", len(backfilled.StakeRequests), len(found))
+	}
+	for _, request := range found {
+		if state := env.stakeState(t, request.Hash, request.MsgIndex); state == "" {
+			t.Fatalf("stake %v is not stored by the back-fill", request.Reference())
+		}
+	}
+}
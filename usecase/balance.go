@@ -0,0 +1,74 @@
+package usecase
+
+import (
+	"context"
+	"driver/domain/config"
+	"driver/interface/exporter"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/tonkeeper/tongo/tlb"
+)
+
+var (
+	ErrorBalanceLow = fmt.Errorf("driver wallet balance is below the reserve")
+)
+
+// BalanceInteractor watches the balance of the driver wallet. When the balance is below the configured reserve,
+// the wallet is considered low on funds, and no more messages should be queued nor sent until it's funded again.
+type BalanceInteractor struct {
+	client       ChainClient
+	driverWallet DriverWallet
+
+	mutex   sync.Mutex
+	balance *tlb.Grams
+}
+
+func NewBalanceInteractor(client ChainClient, driverWallet DriverWallet) *BalanceInteractor {
+	return &BalanceInteractor{
+		client:       client,
+		driverWallet: driverWallet,
+	}
+}
+
+// Check reads the balance of the driver wallet, exports it, and alerts if it's below the reserve. If reading
+// fails, the previous balance is kept.
+func (interactor *BalanceInteractor) Check(ctx context.Context) (tlb.Grams, error) {
+	state, err := interactor.client.GetAccountState(ctx, interactor.driverWallet.GetAddress())
+	if err != nil {
+		exporter.IncErrorCount()
+		log.Printf("🔴 getting driver wallet balance - %v\n", err.Error())
+		return 0, err
+	}
+
+	balance := tlb.Grams(0)
+	if state.Account.SumType == "Account" {
+		balance = state.Account.Account.Storage.Balance.Grams
+	}
+	exporter.SetDriverWalletBalance(float64(balance) / 1e9)
+
+	interactor.mutex.Lock()
+	wasLow := interactor.balance != nil && *interactor.balance < config.GetMinReserve()
+	interactor.balance = &balance
+	interactor.mutex.Unlock()
+
+	isLow := balance < config.GetMinReserve()
+	switch {
+	case isLow:
+		exporter.IncErrorCount()
+		log.Printf("🔴 driver wallet balance is low, stake and unstake are paused [balance: %v, reserve: %v]\n", balance, config.GetMinReserve())
+	case wasLow:
+		log.Printf("🔵 driver wallet is funded, stake and unstake are resumed [balance: %v, reserve: %v]\n", balance, config.GetMinReserve())
+	}
+
+	return balance, nil
+}
+
+// IsLow tells whether the latest known balance of the driver wallet is below the reserve. It's false until the
+// balance is checked.
+func (interactor *BalanceInteractor) IsLow() bool {
+	interactor.mutex.Lock()
+	defer interactor.mutex.Unlock()
+	return interactor.balance != nil && *interactor.balance < config.GetMinReserve()
+}
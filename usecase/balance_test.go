@@ -0,0 +1,67 @@
+package usecase_test
+
+import (
+	"context"
+	"driver/domain"
+	"driver/domain/config"
+	"testing"
+	"time"
+)
+
+func TestLowBalanceHoldsOutbox(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	env.sim.StartRound(100)
+
+	env.deposit(t, 0, 1)
+	result, err := env.extractInteractor.Extract(ctx, env.treasury)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.extractInteractor.Store(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.sim.FinishRound(100)
+
+	// The messages are queued before the balance is found low, so they are in the outbox already.
+	requests, err := env.stakeInteractor.LoadTriable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.stakeInteractor.SendStakeMessageToJettonWallets(ctx, requests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.sim.SetDriverBalance(config.GetMinReserve() - 1)
+	_, err = env.balanceInteractor.Check(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !env.balanceInteractor.IsLow() {
+		t.Fatal("balance is not low below the reserve")
+	}
+
+	env.startMessenger(t)
+	time.Sleep(3 * time.Second)
+	if pending := env.outboxInteractor.LoadPending(10); len(pending) != len(requests) {
+		t.Fatalf("%v messages are pending while the balance is low, want all %v left in the outbox", len(pending), len(requests))
+	}
+	if state := env.sim.WalletState(testAccount(3, 0)); len(state.Staking) == 0 {
+		t.Fatal("stake_coins is sent while the balance is low")
+	}
+
+	// Once the wallet is funded, the messages are sent.
+	env.sim.SetDriverBalance(100_000_000_000)
+	_, err = env.balanceInteractor.Check(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := requests[0]
+	waitFor(t, "stake "+request.Reference(), func() bool {
+		return env.stakeState(t, request.Hash, request.MsgIndex) == domain.RequestStateSent
+	})
+	if state := env.sim.WalletState(testAccount(3, 0)); len(state.Staking) != 0 {
+		t.Fatal("stake_coins is not applied once the balance is recovered")
+	}
+}
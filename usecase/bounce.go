@@ -0,0 +1,142 @@
+package usecase
+
+import (
+	"context"
+	"driver/domain"
+	"driver/domain/config"
+	"driver/domain/model"
+	"driver/interface/exporter"
+	"fmt"
+	"log"
+
+	"github.com/tonkeeper/tongo"
+)
+
+const (
+	// OpcodeBounce is the prefix of the body of a bounced message, followed by the beginning of the original body.
+	OpcodeBounce = uint32(0xffffffff)
+)
+
+var (
+	ErrorBounceNotTraced = fmt.Errorf("transaction which bounced the message is not found")
+)
+
+// processBounce correlates a bounce with the sent message by the j-wallet and the query id, and moves the request of
+// the message to the bounced state. Bounces of unknown messages, or of messages already processed, are ignored. If the
+// j-wallet transaction which bounced the message can't be traced, e.g. its history is pruned, the bounce is kept with
+// an unknown exit code, so it doesn't hold the later inbound messages back.
+func (interactor *InboundInteractor) processBounce(ctx context.Context, trans *model.HTransaction) (bool, error) {
+	bounce := trans.InMessage()
+	src := bounce.Src()
+	if src == nil {
+		return false, nil
+	}
+
+	body := bounce.GetBody()
+	prefix, err := body.ReadUint(32)
+	if err != nil || uint32(prefix) != OpcodeBounce {
+		return false, nil
+	}
+	opcode, err := body.ReadUint(32)
+	if err != nil || (uint32(opcode) != domain.OpcodeStakeCoin && uint32(opcode) != domain.OpcodeWithdraw) {
+		return false, nil
+	}
+	queryId, err := body.ReadUint(64)
+	if err != nil {
+		return false, nil
+	}
+
+	wallet := src.ToHuman(true, config.IsTestNet())
+	msg, err := interactor.outboxInteractor.FindSent(wallet, queryId)
+	if err != nil {
+		return false, err
+	}
+	if msg == nil {
+		log.Printf("🔵 bounce of an unknown message [wallet: %v, query id: %v]\n", wallet, queryId)
+		return false, nil
+	}
+
+	var exitCode *int32
+	code, err := interactor.exitCode(ctx, *src, bounce)
+	if err == nil {
+		exitCode = &code
+	} else if ctx.Err() != nil {
+		return false, ctx.Err()
+	} else {
+		exporter.IncErrorCount()
+		log.Printf("🔴 tracing bounce, exit code is unknown [wallet: %v, query id: %v] - %v\n", wallet, queryId, err.Error())
+	}
+
+	switch msg.Kind {
+	case domain.OutboxKindStake:
+		var hash string
+		var msgIndex int
+		hash, msgIndex, err = domain.ParseStakeReference(msg.Reference)
+		if err == nil {
+			err = interactor.stakeRepository.SetBounced(hash, msgIndex, exitCode)
+		}
+	case domain.OutboxKindUnstake:
+		err = interactor.unstakeRepository.SetBounced(msg.Reference, exitCode)
+	default:
+		err = ErrorUnknownRequest
+	}
+	if err != nil {
+		// The request may be picked again meanwhile, so it's left as it is.
+		exporter.IncErrorCount()
+		log.Printf("🔴 setting %v request bounced [reference: %v] - %v\n", msg.Kind, msg.Reference, err.Error())
+	}
+
+	err = interactor.outboxInteractor.SetBounced(msg)
+	if err != nil {
+		return false, err
+	}
+
+	exporter.IncErrorCount()
+	log.Printf("🔴 %v message bounced [wallet: %v, reference: %v, exit code: %v]\n", msg.Kind, wallet, msg.Reference, formatExitCode(exitCode))
+	return true, nil
+}
+
+// formatExitCode formats an exit code which may be unknown.
+func formatExitCode(exitCode *int32) string {
+	if exitCode == nil {
+		return "unknown"
+	}
+	return fmt.Sprintf("%v", *exitCode)
+}
+
+// exitCode finds the transaction of the j-wallet which bounced the message, and returns its exit code. The
+// transaction is the latest one of the j-wallet before the bounce is created.
+func (interactor *InboundInteractor) exitCode(ctx context.Context, account tongo.AccountID, bounce *model.HMessage) (int32, error) {
+	createdLt := bounce.CreatedLt()
+	bounceHash := bounce.Hash()
+
+	trans, err := interactor.client.GetLastTransactions(ctx, account, tracePageSize)
+	for err == nil && len(trans) > 0 {
+		for i := range trans {
+			if trans[i].Lt >= createdLt {
+				continue
+			}
+
+			ht := model.NewHTransaction(&trans[i].Transaction)
+			for _, outMsg := range ht.OutMessages() {
+				if outMsg.Hash() == bounceHash {
+					return ht.ExitCode(), nil
+				}
+			}
+			return 0, ErrorBounceNotTraced
+		}
+
+		last := trans[len(trans)-1]
+		trans, err = interactor.client.GetTransactions(ctx, tracePageSize, account, last.Lt, tongo.Bits256(last.Hash()))
+
+		// Remove the first element as it's already looked through
+		if len(trans) > 0 {
+			trans = trans[1:]
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return 0, ErrorBounceNotTraced
+}
@@ -0,0 +1,113 @@
+package usecase_test
+
+import (
+	"context"
+	"driver/domain"
+	"driver/infrastructure/simulator"
+	"testing"
+)
+
+func TestBounce(t *testing.T) {
+	exitCode := simulator.ExitCodeRoundOngoing
+	tests := []struct {
+		name     string
+		history  func(env *testEnv)
+		exitCode *int32
+	}{
+		{
+			name:     "traced",
+			history:  func(env *testEnv) {},
+			exitCode: &exitCode,
+		},
+		{
+			name: "pruned history",
+			history: func(env *testEnv) {
+				for i := 0; i < 3; i++ {
+					env.sim.PruneTransactions(testAccount(3, i), 0)
+				}
+			},
+			exitCode: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			ctx := context.Background()
+			env.sim.StartRound(100)
+
+			env.deposit(t, 0, 3)
+			result, err := env.extractInteractor.Extract(ctx, env.treasury)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = env.extractInteractor.Store(result)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The messages are queued once the round is finished, but the round is taken part in again before they
+			// are sent, so the j-wallets reject them.
+			env.sim.FinishRound(100)
+			requests, err := env.stakeInteractor.LoadTriable()
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = env.stakeInteractor.SendStakeMessageToJettonWallets(ctx, requests)
+			if err != nil {
+				t.Fatal(err)
+			}
+			env.sim.StartRound(100)
+			env.startMessenger(t)
+			for _, request := range requests {
+				waitFor(t, "stake "+request.Reference(), func() bool {
+					return env.stakeState(t, request.Hash, request.MsgIndex) == domain.RequestStateSent
+				})
+			}
+
+			test.history(env)
+			bounces, excesses, err := env.inboundInteractor.Extract(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bounces != 3 || excesses != 0 {
+				t.Fatalf("processed %v bounces and %v excesses, want a bounce of each message", bounces, excesses)
+			}
+			for _, request := range requests {
+				stake, err := env.stakeRepository.Find(request.Hash, request.MsgIndex)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if stake.State != domain.RequestStateBounced {
+					t.Fatalf("stake %v is %v, want it bounced", request.Reference(), stake.State)
+				}
+				if (stake.ExitCode == nil) != (test.exitCode == nil) || (stake.ExitCode != nil && *stake.ExitCode != *test.exitCode) {
+					t.Fatalf("stake %v has exit code %v, want %v", request.Reference(), formatExitCode(stake.ExitCode), formatExitCode(test.exitCode))
+				}
+			}
+
+			// The inbound cursor is moved past the bounces, and bounced requests are not tried again.
+			bounces, _, err = env.inboundInteractor.Extract(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bounces != 0 {
+				t.Fatalf("processed %v bounces again", bounces)
+			}
+			requests, err = env.stakeInteractor.LoadTriable()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(requests) != 0 {
+				t.Fatalf("loaded %v triable stakes, want none", len(requests))
+			}
+		})
+	}
+}
+
+func formatExitCode(exitCode *int32) interface{} {
+	if exitCode == nil {
+		return "unknown"
+	}
+	return *exitCode
+}
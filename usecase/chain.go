@@ -0,0 +1,35 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"github.com/tonkeeper/tongo"
+	"github.com/tonkeeper/tongo/liteapi"
+	"github.com/tonkeeper/tongo/liteclient"
+	"github.com/tonkeeper/tongo/tlb"
+)
+
+// ChainClient is the subset of the lite client API the interactors need to talk to the network.
+// It is satisfied by *liteapi.Client, and it covers what the tongo wallet needs from a blockchain, so the
+// same value can be handed over to the driver wallet.
+type ChainClient interface {
+	RunSmcMethod(ctx context.Context, accountID tongo.AccountID, method string, params tlb.VmStack) (uint32, tlb.VmStack, error)
+	GetAccountState(ctx context.Context, accountID tongo.AccountID) (tlb.ShardAccount, error)
+	GetLastTransactions(ctx context.Context, accountID tongo.AccountID, limit int) ([]tongo.Transaction, error)
+	GetTransactions(ctx context.Context, count uint32, accountID tongo.AccountID, lt uint64, hash tongo.Bits256) ([]tongo.Transaction, error)
+	GetSeqno(ctx context.Context, accountID tongo.AccountID) (uint32, error)
+	SendMessage(ctx context.Context, payload []byte) (uint32, error)
+	GetConfigParams(ctx context.Context, mode liteapi.ConfigMode, paramList []uint32) (tlb.ConfigParams, error)
+}
+
+// BlockClient is the subset of the lite client API needed to follow the blocks of the network, and to list the
+// transactions in them. It is satisfied by *liteapi.Client.
+type BlockClient interface {
+	GetMasterchainInfo(ctx context.Context) (liteclient.LiteServerMasterchainInfoC, error)
+	WaitMasterchainSeqno(ctx context.Context, seqno uint32, timeout time.Duration) error
+	LookupBlock(ctx context.Context, blockID tongo.BlockID, mode uint32, lt *uint64, utime *uint32) (tongo.BlockIDExt, tlb.BlockInfo, error)
+	GetAllShardsInfo(ctx context.Context, blockID tongo.BlockIDExt) ([]tongo.BlockIDExt, error)
+	ListBlockTransactions(ctx context.Context, blockID tongo.BlockIDExt, mode, count uint32, after *liteclient.LiteServerTransactionId3C) ([]liteclient.LiteServerTransactionIdC, bool, error)
+	GetOneTransactionFromBlock(ctx context.Context, accountID tongo.AccountID, blockId tongo.BlockIDExt, lt uint64) (tongo.Transaction, error)
+}
@@ -10,7 +10,6 @@ import (
 
 	"github.com/tonkeeper/tongo"
 	"github.com/tonkeeper/tongo/boc"
-	"github.com/tonkeeper/tongo/liteapi"
 	"github.com/tonkeeper/tongo/tlb"
 )
 
@@ -21,17 +20,17 @@ var (
 )
 
 type ContractInteractor struct {
-	client *liteapi.Client
+	client ChainClient
 }
 
-func NewContractInteractor(client *liteapi.Client) *ContractInteractor {
+func NewContractInteractor(client ChainClient) *ContractInteractor {
 	return &ContractInteractor{
 		client: client,
 	}
 }
 
-func (interactor *ContractInteractor) GetTreasuryState() (*model.TreasuryState, error) {
-	code, stack, err := interactor.client.RunSmcMethod(context.Background(), config.GetTreasuryAccountId(), "get_treasury_state", tlb.VmStack{})
+func (interactor *ContractInteractor) GetTreasuryState(ctx context.Context) (*model.TreasuryState, error) {
+	code, stack, err := interactor.client.RunSmcMethod(ctx, config.GetTreasuryAccountId(), "get_treasury_state", tlb.VmStack{})
 
 	if err != nil {
 		log.Printf("🔴 getting treasury state [code = %v] - %v\n", code, err.Error())
@@ -87,8 +86,8 @@ func (interactor *ContractInteractor) GetTreasuryState() (*model.TreasuryState,
 	return result, nil
 }
 
-func (interactor *ContractInteractor) GetMaxBurnableTokens() (*big.Int, error) {
-	code, stack, err := interactor.client.RunSmcMethod(context.Background(), config.GetTreasuryAccountId(), "get_max_burnable_tokens", tlb.VmStack{})
+func (interactor *ContractInteractor) GetMaxBurnableTokens(ctx context.Context) (*big.Int, error) {
+	code, stack, err := interactor.client.RunSmcMethod(ctx, config.GetTreasuryAccountId(), "get_max_burnable_tokens", tlb.VmStack{})
 
 	if err != nil {
 		log.Printf("🔴 getting max burnable tokens [code = %v] - %v\n", code, err.Error())
@@ -105,8 +104,8 @@ func (interactor *ContractInteractor) GetMaxBurnableTokens() (*big.Int, error) {
 	return result, nil
 }
 
-func (interactor *ContractInteractor) GetWalletState(accountId tongo.AccountID) (*model.WalletState, error) {
-	code, stack, err := interactor.client.RunSmcMethod(context.Background(), accountId, "get_wallet_state", tlb.VmStack{})
+func (interactor *ContractInteractor) GetWalletState(ctx context.Context, accountId tongo.AccountID) (*model.WalletState, error) {
+	code, stack, err := interactor.client.RunSmcMethod(ctx, accountId, "get_wallet_state", tlb.VmStack{})
 
 	if err != nil {
 		log.Printf("🔴 getting wallet state [code = %v] - %v\n", code, err.Error())
@@ -139,8 +138,8 @@ func (interactor *ContractInteractor) GetWalletState(accountId tongo.AccountID)
 	return result, nil
 }
 
-func (interactor *ContractInteractor) GetTreasuryBalance() (uint64, error) {
-	state, err := interactor.client.GetAccountState(context.Background(), config.GetTreasuryAccountId())
+func (interactor *ContractInteractor) GetTreasuryBalance(ctx context.Context) (uint64, error) {
+	state, err := interactor.client.GetAccountState(ctx, config.GetTreasuryAccountId())
 	if err != nil {
 		return 0, err
 	}
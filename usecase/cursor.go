@@ -0,0 +1,137 @@
+package usecase
+
+import (
+	"context"
+	"driver/domain"
+	"driver/domain/model"
+	"driver/interface/exporter"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/tonkeeper/tongo"
+	"github.com/tonkeeper/tongo/liteclient"
+)
+
+// lastTransactionsCount is how many of the latest transactions of an account are read at first. Older ones are
+// paged through by tracePageSize.
+const lastTransactionsCount = 50
+
+// walkTransactions pages through the transactions of the account, the latest first, back to the cursor, and passes
+// each page of the transactions after the cursor to process. It returns the cursor of the latest transaction, to be
+// kept once all of them are processed. Transactions at or after beforeLt are left for a later walk, unless it's zero.
+//
+// The walk stops on the logical time of the cursor, so it stops even if the cursor's transaction is not found. If the
+// history ends before the cursor is reached, e.g. as the liteserver doesn't keep that old transactions, the
+// transactions in between are missed, and the gap is returned to be reported. A liteserver answers an older page it
+// doesn't keep with a not-ready error rather than an empty page, so that answer ends the history as well. Other
+// errors, e.g. a lost connection or a liteserver timeout, are returned so the walk is retried.
+func walkTransactions(ctx context.Context,
+	client ChainClient,
+	account tongo.AccountID,
+	cursor domain.Cursor,
+	beforeLt uint64,
+	process func(trans []tongo.Transaction) error) (domain.Cursor, *domain.Gap, error) {
+
+	trans, err := client.GetLastTransactions(ctx, account, lastTransactionsCount)
+	if err != nil {
+		return cursor, nil, err
+	}
+
+	latest := cursor
+	var oldest *tongo.Transaction
+	for len(trans) > 0 {
+		page := trans
+		for beforeLt != 0 && len(page) > 0 && page[0].Lt >= beforeLt {
+			page = page[1:]
+		}
+		if latest == cursor && len(page) > 0 {
+			latest = domain.Cursor{Lt: page[0].Lt, Hash: page[0].Hash().Hex()}
+		}
+
+		index, reached := findLastUnprocessed(page, cursor)
+		if index > 0 {
+			err = process(page[:index])
+			if err != nil {
+				return cursor, nil, err
+			}
+		}
+		if reached {
+			return latest, nil, nil
+		}
+
+		oldest = &trans[len(trans)-1]
+		if oldest.PrevTransLt == 0 {
+			// The first transaction of the account is reached.
+			break
+		}
+
+		trans, err = client.GetTransactions(ctx, tracePageSize, account, oldest.Lt, tongo.Bits256(oldest.Hash()))
+		if isHistoryUnavailable(err) {
+			log.Printf("❗️ older transactions are unavailable, the history ends [lt: %v, hash: %v] - %v\n", oldest.Lt, oldest.Hash().Hex(), err.Error())
+			break
+		}
+		if err != nil {
+			return cursor, nil, err
+		}
+
+		// Remove the first element as it's already processed in previous loop
+		if len(trans) > 0 {
+			trans = trans[1:]
+		}
+	}
+
+	if cursor == (domain.Cursor{}) || latest == cursor {
+		// Nothing was processed before, so the whole history is looked through, or no transaction is found to look
+		// through.
+		return latest, nil, nil
+	}
+
+	gap := &domain.Gap{
+		FromLt:     cursor.Lt,
+		ToLt:       oldest.Lt,
+		ToHash:     oldest.Hash().Hex(),
+		DetectedAt: time.Now(),
+	}
+	return latest, gap, nil
+}
+
+// liteServerNotReady is the code a liteserver answers a request for the transactions it doesn't keep with, e.g. "lt
+// not in db". Other codes, e.g. a timeout, say nothing about the history.
+const liteServerNotReady = 651
+
+// isHistoryUnavailable tells whether the error is the liteserver's answer that it doesn't keep the transactions, rather
+// than any other failure of the request.
+func isHistoryUnavailable(err error) bool {
+	var serverErr liteclient.LiteServerErrorC
+	return errors.As(err, &serverErr) && serverErr.Code == liteServerNotReady
+}
+
+// findLastUnprocessed returns the number of transactions of the page, the latest first, which come after the
+// cursor, and whether the cursor is reached in the page. A cursor kept before the logical time was, is reached by
+// its hash only.
+func findLastUnprocessed(trans []tongo.Transaction, cursor domain.Cursor) (int, bool) {
+	for i, t := range trans {
+		hash := model.NewHTransaction(&t.Transaction).Formatter().Hash()
+		switch {
+		case cursor.Lt == 0:
+			if cursor.Hash != "" && hash == cursor.Hash {
+				return i, true
+			}
+
+		case t.Lt == cursor.Lt:
+			if hash != cursor.Hash {
+				exporter.IncErrorCount()
+				log.Printf("🔴 cursor mismatch, stopping on its logical time [lt: %v, cursor hash: %v, found hash: %v]\n", t.Lt, cursor.Hash, hash)
+			}
+			return i, true
+
+		case t.Lt < cursor.Lt:
+			exporter.IncErrorCount()
+			log.Printf("🔴 cursor transaction not found, stopping on its logical time [lt: %v, hash: %v]\n", cursor.Lt, cursor.Hash)
+			return i, true
+		}
+	}
+
+	return len(trans), false
+}
@@ -0,0 +1,168 @@
+package usecase_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/tonkeeper/tongo/liteclient"
+)
+
+func TestExtractContinuesFromCursor(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	env.sim.StartRound(100)
+
+	// More than a page of transactions, so the history is paged through.
+	env.deposit(t, 0, 120)
+	result, err := env.extractInteractor.Extract(ctx, env.treasury)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.StakeRequests) != 120 {
+		t.Fatalf("extracted %v stakes, want 120", len(result.StakeRequests))
+	}
+
+	env.deposit(t, 120, 30)
+	result, err = env.extractInteractor.Extract(ctx, env.treasury)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.StakeRequests) != 30 {
+		t.Fatalf("extracted %v stakes after the cursor, want 30", len(result.StakeRequests))
+	}
+
+	gaps, err := env.memoInteractor.GetExtractionGaps()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gaps) != 0 {
+		t.Fatalf("got gaps %v, want none", gaps)
+	}
+}
+
+func TestExtractReportsGap(t *testing.T) {
+	tests := []struct {
+		name    string
+		history func(env *testEnv)
+	}{
+		{
+			name: "pruned history",
+			history: func(env *testEnv) {
+				env.sim.PruneTransactions(env.treasury, 60)
+			},
+		},
+		{
+			name: "liteserver not ready",
+			history: func(env *testEnv) {
+				env.sim.SetFailure("GetTransactions", liteclient.LiteServerErrorC{Code: 651, Message: "lt not in db"})
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			ctx := context.Background()
+			env.sim.StartRound(100)
+
+			env.deposit(t, 0, 10)
+			_, err := env.extractInteractor.Extract(ctx, env.treasury)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cursor, err := env.memoInteractor.GetExtractionCursor()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Only the latest page is returned, the rest of the new transactions are not.
+			env.deposit(t, 10, 80)
+			test.history(env)
+			result, err := env.extractInteractor.Extract(ctx, env.treasury)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result.StakeRequests) == 0 || len(result.StakeRequests) >= 80 {
+				t.Fatalf("extracted %v stakes, want only the latest ones", len(result.StakeRequests))
+			}
+
+			gaps, err := env.memoInteractor.GetExtractionGaps()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(gaps) != 1 {
+				t.Fatalf("got gaps %v, want one", gaps)
+			}
+			if gaps[0].FromLt != cursor.Lt || gaps[0].ToLt <= cursor.Lt {
+				t.Fatalf("got gap %v, want one after lt %v", gaps[0], cursor.Lt)
+			}
+			latest, err := env.memoInteractor.GetExtractionCursor()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if latest.Lt <= gaps[0].ToLt {
+				t.Fatalf("cursor at lt %v, want it after the gap at lt %v", latest.Lt, gaps[0].ToLt)
+			}
+		})
+	}
+}
+
+func TestExtractKeepsCursorOnError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{name: "connection lost", err: fmt.Errorf("connection lost")},
+		{name: "liteserver timeout", err: liteclient.LiteServerErrorC{Code: 652, Message: "timeout"}},
+		{name: "liteserver failure", err: liteclient.LiteServerErrorC{Code: 602, Message: "cannot load state"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			ctx := context.Background()
+			env.sim.StartRound(100)
+
+			env.deposit(t, 0, 10)
+			_, err := env.extractInteractor.Extract(ctx, env.treasury)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cursor, err := env.memoInteractor.GetExtractionCursor()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			env.deposit(t, 10, 80)
+			env.sim.SetFailure("GetTransactions", test.err)
+			_, err = env.extractInteractor.Extract(ctx, env.treasury)
+			if err == nil {
+				t.Fatal("extracted through the error")
+			}
+			latest, err := env.memoInteractor.GetExtractionCursor()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if latest != cursor {
+				t.Fatalf("cursor moved to %v, want it kept at %v", latest, cursor)
+			}
+
+			env.sim.SetFailure("GetTransactions", nil)
+			result, err := env.extractInteractor.Extract(ctx, env.treasury)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result.StakeRequests) != 80 {
+				t.Fatalf("extracted %v stakes once the error is gone, want 80", len(result.StakeRequests))
+			}
+			gaps, err := env.memoInteractor.GetExtractionGaps()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(gaps) != 0 {
+				t.Fatalf("got gaps %v, want none", gaps)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package usecase
+
+import (
+	"driver/domain"
+	"driver/domain/model"
+	"fmt"
+
+	"github.com/tonkeeper/tongo"
+)
+
+// MessageDirection tells whether a decoder cares about the in-message or the out-messages of a transaction.
+type MessageDirection int
+
+const (
+	MessageIn MessageDirection = iota
+	MessageOut
+)
+
+var (
+	ErrorDecoderConflict = fmt.Errorf("a decoder with the same name is already registered")
+	ErrorInvalidDecoder  = fmt.Errorf("a decoder must have a name and a decode function")
+)
+
+// DecodeFunc receives a transaction along with its messages matching the opcode and the direction of the decoder,
+// in the order they are in the transaction, and adds what it finds in them to the result. The result tells the
+// masterchain block committing the transaction.
+type DecodeFunc func(trans *model.HTransaction, msgs []*model.HMessage, result *domain.ExtractionResult)
+
+// Decoder is a handler of the extraction, declaring the opcode and the direction of the messages it cares about.
+type Decoder struct {
+	Name      string
+	Opcode    uint32
+	Direction MessageDirection
+	Decode    DecodeFunc
+}
+
+// DecoderRegistry passes the treasury transactions to the decoders registered for the opcodes of their messages, so
+// a new kind of request is added by registering a decoder for it. The messages of a transaction are decoded once,
+// and each decoder receives a transaction at most once, with all of its matching messages.
+type DecoderRegistry struct {
+	decoders []Decoder
+}
+
+func NewDecoderRegistry() *DecoderRegistry {
+	return &DecoderRegistry{
+		decoders: make([]Decoder, 0),
+	}
+}
+
+// Register adds the decoder. Decoders are called in the order they are registered.
+func (registry *DecoderRegistry) Register(decoder Decoder) error {
+	if decoder.Name == "" || decoder.Decode == nil {
+		return ErrorInvalidDecoder
+	}
+	for _, d := range registry.decoders {
+		if d.Name == decoder.Name {
+			return ErrorDecoderConflict
+		}
+	}
+
+	registry.decoders = append(registry.decoders, decoder)
+	return nil
+}
+
+// Decode passes each of the transactions to the decoders which care about its messages.
+func (registry *DecoderRegistry) Decode(trans []tongo.Transaction, result *domain.ExtractionResult) {
+	for _, t := range trans {
+		ht := model.NewHTransaction(&t.Transaction)
+
+		inMsg := ht.InMessage()
+		inOpcode := inMsg.Opcode()
+
+		outMsgs := ht.OutMessages()
+		outOpcodes := make([]uint32, len(outMsgs))
+		for i, msg := range outMsgs {
+			outOpcodes[i] = msg.Opcode()
+		}
+
+		for _, decoder := range registry.decoders {
+			msgs := make([]*model.HMessage, 0, 1)
+			switch decoder.Direction {
+			case MessageIn:
+				if inOpcode == decoder.Opcode {
+					msgs = append(msgs, inMsg)
+				}
+			case MessageOut:
+				for i, msg := range outMsgs {
+					if outOpcodes[i] == decoder.Opcode {
+						msgs = append(msgs, msg)
+					}
+				}
+			}
+
+			if len(msgs) > 0 {
+				decoder.Decode(ht, msgs, result)
+			}
+		}
+	}
+}
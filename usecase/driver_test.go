@@ -0,0 +1,132 @@
+package usecase_test
+
+import (
+	"context"
+	"driver/domain"
+	"math/big"
+	"testing"
+)
+
+// TestStakeAndUnstake runs the turns of the start command one after another: the requests are extracted, their
+// messages are sent by the messenger, and they are verified by the j-wallet states.
+func TestStakeAndUnstake(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	env.startMessenger(t)
+	env.sim.StartRound(100)
+
+	env.deposit(t, 0, 3)
+	result, err := env.extractInteractor.Extract(ctx, env.treasury)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.StakeRequests) != 3 || len(result.UnstakeRequests) != 0 {
+		t.Fatalf("extracted %v stakes and %v unstakes, want 3 stakes", len(result.StakeRequests), len(result.UnstakeRequests))
+	}
+	err = env.extractInteractor.Store(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The round is in progress, so the stakes wait.
+	stakes, err := env.stakeInteractor.LoadTriable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.stakeInteractor.SendStakeMessageToJettonWallets(ctx, stakes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, request := range stakes {
+		if state := env.stakeState(t, request.Hash, request.MsgIndex); state != domain.RequestStateNew {
+			t.Fatalf("stake %v is %v during the round, want it new", request.Reference(), state)
+		}
+	}
+
+	env.sim.FinishRound(100)
+	err = env.stakeInteractor.SendStakeMessageToJettonWallets(ctx, stakes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, request := range stakes {
+		waitFor(t, "stake "+request.Reference(), func() bool {
+			return env.stakeState(t, request.Hash, request.MsgIndex) == domain.RequestStateSent
+		})
+	}
+
+	verifiableStakes, _, err := env.verifyInteractor.LoadVerifiable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.verifyInteractor.VerifyStakeRequests(ctx, verifiableStakes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, request := range stakes {
+		if state := env.stakeState(t, request.Hash, request.MsgIndex); state != domain.RequestStateVerified {
+			t.Fatalf("stake %v is %v, want it verified", request.Reference(), state)
+		}
+		state := env.sim.WalletState(testAccount(3, i))
+		if state == nil || state.Tokens.Uint64() != 5_000_000_000 || len(state.Staking) != 0 {
+			t.Fatalf("wallet %v is %v, want the tokens of the deposit", i, state)
+		}
+	}
+
+	// A user unstakes a part of the tokens.
+	_, err = env.sim.Unstake(testAccount(3, 1), big.NewInt(2_000_000_000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.sim.SealMasterchainBlock()
+	env.sim.SetMaxBurnableTokens(big.NewInt(10_000_000_000))
+
+	result, err = env.extractInteractor.Extract(ctx, env.treasury)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.StakeRequests) != 0 || len(result.UnstakeRequests) != 1 {
+		t.Fatalf("extracted %v stakes and %v unstakes, want an unstake", len(result.StakeRequests), len(result.UnstakeRequests))
+	}
+	err = env.extractInteractor.Store(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unstakes, err := env.unstakeInteractor.LoadTriable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.unstakeInteractor.SendWithdrawMessageToJettonWallets(ctx, unstakes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unstake := unstakes[0]
+	waitFor(t, "unstake "+unstake.Hash, func() bool {
+		return env.unstakeState(t, unstake.Hash) == domain.RequestStateSent
+	})
+
+	_, verifiableUnstakes, err := env.verifyInteractor.LoadVerifiable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.verifyInteractor.VerifyUnstakeRequests(ctx, verifiableUnstakes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state := env.unstakeState(t, unstake.Hash); state != domain.RequestStateVerified {
+		t.Fatalf("unstake is %v, want it verified", state)
+	}
+	state := env.sim.WalletState(testAccount(3, 1))
+	if state.Tokens.Uint64() != 3_000_000_000 || state.Unstaking.Sign() != 0 {
+		t.Fatalf("wallet has %v tokens and %v unstaking, want the rest of the tokens", &state.Tokens, &state.Unstaking)
+	}
+
+	// The unused coins of every message come back to the driver wallet.
+	bounces, excesses, err := env.inboundInteractor.Extract(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bounces != 0 || excesses != 4 {
+		t.Fatalf("processed %v bounces and %v excesses, want an excess of each message", bounces, excesses)
+	}
+}
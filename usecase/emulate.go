@@ -0,0 +1,108 @@
+package usecase
+
+import (
+	"context"
+	"driver/domain"
+	"driver/domain/model"
+	"driver/interface/exporter"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/tonkeeper/tongo/boc"
+	"github.com/tonkeeper/tongo/tlb"
+)
+
+var (
+	ErrorNotAccepted      = fmt.Errorf("message is not accepted by its destination")
+	ErrorTransferRejected = fmt.Errorf("transfer is rejected by the driver wallet")
+	ErrorMessageRejected  = fmt.Errorf("message is rejected by its destination")
+)
+
+// Emulator runs a message against the current state of its destination, without sending it. An external message
+// the destination doesn't accept gives ErrorNotAccepted, as there is no transaction for it.
+type Emulator interface {
+	Emulate(ctx context.Context, msg tlb.Message) (tlb.Transaction, error)
+}
+
+// emulate runs the transfer against the driver wallet, and each of its messages against its destination, as
+// they are now. Messages which their destinations reject are given up, and the rest of the batch is returned.
+// A transfer the driver wallet would fail to process is not sent at all. If the emulation itself fails, the
+// batch is sent as it is.
+func (interactor *MessengerInteractor) emulate(ctx context.Context, batch []*domain.OutboxMessage, transfer *Transfer) ([]*domain.OutboxMessage, error) {
+	cell, err := boc.DeserializeBoc(transfer.Payload)
+	if err != nil {
+		return nil, err
+	}
+	var extMsg tlb.Message
+	err = tlb.Unmarshal(cell[0], &extMsg)
+	if err != nil {
+		return nil, err
+	}
+
+	trans, err := interactor.emulator.Emulate(ctx, extMsg)
+	if err != nil {
+		exporter.IncErrorCount()
+		if errors.Is(err, ErrorNotAccepted) {
+			log.Printf("🔴 emulating transfer %v - %v\n", transfer.Id, err.Error())
+			return nil, err
+		}
+		log.Printf("🔴 emulating transfer %v, sending it anyway - %v\n", transfer.Id, err.Error())
+		return batch, nil
+	}
+
+	htrans := model.NewHTransaction(&trans)
+	if !htrans.IsComputeSucceeded() || !htrans.IsSucceeded() {
+		exporter.IncErrorCount()
+		log.Printf("🔴 emulating transfer %v - driver wallet transaction failed [exit code: %v]\n", transfer.Id, htrans.ExitCode())
+		return nil, ErrorTransferRejected
+	}
+
+	outMsgs := sentMessages(htrans, batch)
+
+	accepted := make([]*domain.OutboxMessage, 0, len(batch))
+	rejected := make([]*domain.OutboxMessage, 0)
+	exitCodes := make([]int32, 0)
+	for i, msg := range batch {
+		if outMsgs[i] == nil {
+			// It's not sent by the emulated transfer, so it's left to be found out after sending.
+			accepted = append(accepted, msg)
+			continue
+		}
+
+		destTrans, err := interactor.emulator.Emulate(ctx, outMsgs[i].Raw())
+		if err != nil {
+			exporter.IncErrorCount()
+			log.Printf("🔴 emulating message, sending it anyway [reference: %v] - %v\n", msg.Reference, err.Error())
+			accepted = append(accepted, msg)
+			continue
+		}
+
+		hdestTrans := model.NewHTransaction(&destTrans)
+		if hdestTrans.IsComputeSucceeded() && hdestTrans.IsSucceeded() {
+			accepted = append(accepted, msg)
+			continue
+		}
+		rejected = append(rejected, msg)
+		exitCodes = append(exitCodes, hdestTrans.ExitCode())
+	}
+
+	if len(rejected) > 0 {
+		interactor.outboxInteractor.SetRejected(rejected)
+		for i, msg := range rejected {
+			interactor.reject(msg, exitCodes[i])
+		}
+	}
+
+	return accepted, nil
+}
+
+// reject sends the exit code of the emulation which rejected an outbox message to its listener.
+func (interactor *MessengerInteractor) reject(msg *domain.OutboxMessage, exitCode int32) {
+	interactor.respondWith(msg, Response{
+		reference: msg.Reference,
+		ok:        false,
+		err:       ErrorMessageRejected,
+		exitCode:  &exitCode,
+	})
+}
@@ -0,0 +1,98 @@
+package usecase
+
+import (
+	"driver/domain"
+	"driver/domain/config"
+	"driver/domain/model"
+	"driver/interface/exporter"
+	"log"
+
+	"github.com/tonkeeper/tongo"
+)
+
+// EventInteractor decodes the treasury transactions into events, and keeps all of them, so deposits, unstakes,
+// loans and failures can be audited without an external indexer.
+type EventInteractor struct {
+	eventRepository EventRepository
+}
+
+func NewEventInteractor(eventRepository EventRepository) *EventInteractor {
+	return &EventInteractor{
+		eventRepository: eventRepository,
+	}
+}
+
+// MakeEvents decodes each of the transactions into an event.
+func (interactor *EventInteractor) MakeEvents(trans []tongo.Transaction) []domain.Event {
+	events := make([]domain.Event, 0, len(trans))
+	for _, t := range trans {
+		ht := model.NewHTransaction(&t.Transaction)
+		inMsg := ht.InMessage()
+
+		var source *string
+		if src := inMsg.Src(); src != nil {
+			addr := src.ToHuman(true, config.IsTestNet())
+			source = &addr
+		}
+
+		totalFee, processFee, storageFee, inMsgFee, outMsgsFee := ht.Fees()
+
+		outMsgs := ht.OutMessages()
+		outMessages := make([]domain.EventMessage, 0, len(outMsgs))
+		for _, msg := range outMsgs {
+			outMessages = append(outMessages, makeEventMessage(msg))
+		}
+
+		events = append(events, domain.Event{
+			Hash:       ht.Formatter().Hash(),
+			Lt:         ht.Lt(),
+			ExecutedAt: ht.UnixTime(),
+			Opcode:     inMsg.Opcode(),
+			Source:     source,
+			Value:      ht.Value(),
+			Success:    ht.IsSucceeded(),
+			Fees: domain.EventFees{
+				Total:   totalFee,
+				Process: processFee,
+				Storage: storageFee,
+				InMsg:   inMsgFee,
+				OutMsgs: outMsgsFee,
+			},
+			OutMessages: outMessages,
+		})
+	}
+	return events
+}
+
+// Store keeps the events, and leaves the ones already kept as they are.
+func (interactor *EventInteractor) Store(events []domain.Event) error {
+	err := interactor.eventRepository.InsertAll(events)
+	if err != nil {
+		exporter.IncErrorCount()
+		log.Printf("🔴 storing events - %v\n", err.Error())
+		return err
+	}
+	return nil
+}
+
+// makeEventMessage decodes an out-message. Most messages of the protocol have a query id after the opcode.
+func makeEventMessage(msg *model.HMessage) domain.EventMessage {
+	result := domain.EventMessage{
+		Opcode: msg.Opcode(),
+		Value:  msg.Value(),
+		FwdFee: msg.FwdFee(),
+	}
+
+	if dest := msg.Dest(); dest != nil {
+		result.Destination = dest.ToHuman(true, config.IsTestNet())
+	}
+
+	body := msg.GetBody()
+	if _, err := body.ReadUint(32); err == nil {
+		if queryId, err := body.ReadUint(64); err == nil {
+			result.QueryId = &queryId
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,66 @@
+package usecase
+
+import (
+	"driver/domain"
+	"driver/domain/model"
+	"log"
+)
+
+const (
+	// OpcodeExcesses is the opcode of the message returning the unused part of the coins attached to a message.
+	OpcodeExcesses = uint32(0xd53276db)
+)
+
+// processExcess finds the sent message by the query id of the excess, and keeps the returned coins on its request, so
+// the net cost of the request is known. Each attempt of a request has its own message, so the excess of an earlier
+// attempt is still kept on its request. What the message spent is observed for the estimate of the next messages.
+// Excesses of unknown messages are ignored.
+func (interactor *InboundInteractor) processExcess(trans *model.HTransaction) (bool, error) {
+	excess := trans.InMessage()
+	body := excess.GetBody()
+	_, err := body.ReadUint(32)
+	if err != nil {
+		return false, nil
+	}
+	queryId, err := body.ReadUint(64)
+	if err != nil {
+		return false, nil
+	}
+
+	msg, err := interactor.outboxInteractor.FindByQueryId(queryId)
+	if err != nil {
+		return false, err
+	}
+	if msg == nil {
+		log.Printf("🔵 excess of an unknown message [query id: %v, value: %v]\n", queryId, excess.Value())
+		return false, nil
+	}
+
+	var opcode uint32
+	switch msg.Kind {
+	case domain.OutboxKindStake:
+		opcode = domain.OpcodeStakeCoin
+		var hash string
+		var msgIndex int
+		hash, msgIndex, err = domain.ParseStakeReference(msg.Reference)
+		if err == nil {
+			err = interactor.stakeRepository.AddExcess(hash, msgIndex, excess.Hash().Hex(), excess.Value())
+		}
+	case domain.OutboxKindUnstake:
+		opcode = domain.OpcodeWithdraw
+		err = interactor.unstakeRepository.AddExcess(msg.Reference, excess.Hash().Hex(), excess.Value())
+	default:
+		err = ErrorUnknownRequest
+	}
+	if err != nil {
+		return false, err
+	}
+
+	value, err := interactor.outboxInteractor.Value(msg)
+	if err != nil {
+		log.Printf("❗️ reading the attached value of message %v - %v\n", msg.Reference, err.Error())
+	} else if value > excess.Value() {
+		interactor.feeInteractor.Observe(opcode, value-excess.Value())
+	}
+	return true, nil
+}
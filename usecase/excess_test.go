@@ -0,0 +1,136 @@
+package usecase_test
+
+import (
+	"context"
+	"driver/domain"
+	"driver/domain/config"
+	"testing"
+)
+
+func TestExcess(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	env.sim.StartRound(100)
+
+	env.deposit(t, 0, 3)
+	result, err := env.extractInteractor.Extract(ctx, env.treasury)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.extractInteractor.Store(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env.sim.FinishRound(100)
+	env.startMessenger(t)
+	requests, err := env.stakeInteractor.LoadTriable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.stakeInteractor.SendStakeMessageToJettonWallets(ctx, requests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, request := range requests {
+		waitFor(t, "stake "+request.Reference(), func() bool {
+			return env.stakeState(t, request.Hash, request.MsgIndex) == domain.RequestStateSent
+		})
+	}
+
+	// The excesses are looked through twice, but each is kept once.
+	for i := 0; i < 2; i++ {
+		err = env.memoInteractor.SetInboundCursor(domain.Cursor{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		bounces, excesses, err := env.inboundInteractor.Extract(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bounces != 0 || excesses != 3 {
+			t.Fatalf("processed %v bounces and %v excesses, want an excess of each message", bounces, excesses)
+		}
+	}
+
+	for _, request := range requests {
+		stake, err := env.stakeRepository.Find(request.Hash, request.MsgIndex)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stake.Cost == nil || stake.Excess == nil || *stake.Excess >= *stake.Cost {
+			t.Fatalf("stake %v cost %v with an excess of %v, want a part of the cost returned once", request.Reference(), stake.Cost, stake.Excess)
+		}
+	}
+}
+
+func TestExcessOfEarlierAttempt(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	env.sim.StartRound(100)
+
+	env.deposit(t, 0, 2)
+	result, err := env.extractInteractor.Extract(ctx, env.treasury)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.extractInteractor.Store(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env.sim.FinishRound(100)
+	env.startMessenger(t)
+	send := func(count int) []*domain.StakeRequest {
+		requests, err := env.stakeInteractor.LoadTriable()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(requests) != count {
+			t.Fatalf("loaded %v triable stakes, want %v", len(requests), count)
+		}
+		err = env.stakeInteractor.SendStakeMessageToJettonWallets(ctx, requests)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, request := range requests {
+			waitFor(t, "stake "+request.Reference(), func() bool {
+				return env.stakeState(t, request.Hash, request.MsgIndex) == domain.RequestStateSent
+			})
+		}
+		return requests
+	}
+
+	// The first request is tried again before the excess of its first message is processed, and the j-wallet has
+	// coins staking again, so it accepts the second message too. The other request is sent once.
+	requests := send(2)
+	retried, once := requests[0], requests[1]
+	if retried.Address != testAccount(3, 0).ToHuman(true, config.IsTestNet()) {
+		retried, once = once, retried
+	}
+	env.deposit(t, 0, 1)
+	err = env.stakeRepository.SetState(retried.Hash, retried.MsgIndex, domain.RequestStateRetriable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	send(1)
+
+	bounces, excesses, err := env.inboundInteractor.Extract(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bounces != 0 || excesses != 3 {
+		t.Fatalf("processed %v bounces and %v excesses, want the excesses of all messages", bounces, excesses)
+	}
+	retriedStake, err := env.stakeRepository.Find(retried.Hash, retried.MsgIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	onceStake, err := env.stakeRepository.Find(once.Hash, once.MsgIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retriedStake.Excess == nil || onceStake.Excess == nil || *retriedStake.Excess != 2**onceStake.Excess {
+		t.Fatalf("kept excess %v, want both excesses, twice the excess %v of one message", retriedStake.Excess, onceStake.Excess)
+	}
+}
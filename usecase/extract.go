@@ -3,35 +3,42 @@ package usecase
 import (
 	"context"
 	"driver/domain"
-	"driver/domain/model"
 	"driver/interface/exporter"
 	"fmt"
 	"log"
 
 	"github.com/tonkeeper/tongo"
-	"github.com/tonkeeper/tongo/liteapi"
 	tgwallet "github.com/tonkeeper/tongo/wallet"
 )
 
 const (
+	OpcodeDeposit      = uint32(0) // a comment, which is 'd' for a deposit
 	OpcodeSaveCoin     = uint32(0x7f30ee55)
 	OpcodeReserveToken = uint32(0x24a319a7)
 )
 
 type ExtractInteractor struct {
-	client             *liteapi.Client
+	client             ChainClient
 	memoInteractor     *MemoInteractor
 	contractInteractor *ContractInteractor
 	stakeInteractor    *StakeInteractor
 	unstakeInteractor  *UnstakeInteractor
+	eventInteractor    *EventInteractor
+	failureInteractor  *FailureInteractor
+	decoderRegistry    *DecoderRegistry
+	finalityInteractor *FinalityInteractor
 	driverWallet       *tgwallet.Wallet
 }
 
-func NewExtractInteractor(client *liteapi.Client,
+func NewExtractInteractor(client ChainClient,
 	memoInteractor *MemoInteractor,
 	contractInteractor *ContractInteractor,
 	stakeInteractor *StakeInteractor,
 	unstakeInteractor *UnstakeInteractor,
+	eventInteractor *EventInteractor,
+	failureInteractor *FailureInteractor,
+	decoderRegistry *DecoderRegistry,
+	finalityInteractor *FinalityInteractor,
 	driverWallet *tgwallet.Wallet) *ExtractInteractor {
 	interactor := &ExtractInteractor{
 		client:             client,
@@ -39,98 +46,102 @@ func NewExtractInteractor(client *liteapi.Client,
 		contractInteractor: contractInteractor,
 		stakeInteractor:    stakeInteractor,
 		unstakeInteractor:  unstakeInteractor,
+		eventInteractor:    eventInteractor,
+		failureInteractor:  failureInteractor,
+		decoderRegistry:    decoderRegistry,
+		finalityInteractor: finalityInteractor,
 		driverWallet:       driverWallet,
 	}
 	return interactor
 }
 
-func (interactor *ExtractInteractor) Extract(treasuryAccount tongo.AccountID) (*domain.ExtractionResult, error) {
+// Extract looks through the treasury transactions after the extraction cursor for stake and unstake requests, decodes
+// all of them into events, and moves the cursor to the latest transaction. Only the transactions committed by the latest
+// final masterchain block are looked through. A gap found between the cursor and the transactions the liteserver
+// returns is reported and kept, so it can be back-filled.
+func (interactor *ExtractInteractor) Extract(ctx context.Context, treasuryAccount tongo.AccountID) (*domain.ExtractionResult, error) {
+	final, err := interactor.finalityInteractor.FinalBlock(ctx, treasuryAccount)
+	if err != nil {
+		exporter.IncErrorCount()
+		log.Printf("🔴 getting final block - %v\n", err.Error())
+		return nil, err
+	}
+
+	return interactor.extract(ctx, treasuryAccount, final)
+}
+
+// extract looks through the treasury transactions after the extraction cursor which the final block commits to.
+func (interactor *ExtractInteractor) extract(ctx context.Context, treasuryAccount tongo.AccountID, final domain.FinalBlock) (*domain.ExtractionResult, error) {
 
 	result := domain.ExtractionResult{
+		FinalMcSeqno:    final.MasterchainSeqno,
 		StakeRequests:   make([]domain.StakeRequest, 0, 50),
 		UnstakeRequests: make([]domain.UnstakeRequest, 0, 50),
+		FailedRequests:  make([]domain.FailedRequest, 0),
+		Events:          make([]domain.Event, 0, 50),
 	}
 
 	// Read the latest processed transaction info
-	latestProcessedHash, err := interactor.memoInteractor.GetLatestProcessedHash()
+	cursor, err := interactor.memoInteractor.GetExtractionCursor()
 	if err != nil {
 		exporter.IncErrorCount()
-		fmt.Printf("🔴 getting last processed hash - %v\n", err.Error())
+		fmt.Printf("🔴 getting extraction cursor - %v\n", err.Error())
 		return nil, err
 	}
 
-	// Get last transactions of the treasury account, sorted decently by time.
-	trans, err := interactor.client.GetLastTransactions(context.Background(), treasuryAccount, 50)
+	latest, gap, err := walkTransactions(ctx, interactor.client, treasuryAccount, cursor, final.EndLt, func(trans []tongo.Transaction) error {
+		stakes, unstakes := interactor.collect(trans, &result)
+		log.Printf("Processing transactions... Total: %v / Found: %v stake(s) and %v unstake(s)\n", len(trans), stakes, unstakes)
+		return nil
+	})
 	if err != nil {
 		exporter.IncErrorCount()
-		fmt.Printf("🔴 getting last transactions - %v\n", err.Error())
+		log.Printf("🔴 getting transactions - %v\n", err.Error())
+		fmt.Printf("❌ No wallet will be kept due to above error.\n")
 		return nil, err
 	}
 
-	// Keep the first processing transaction's hash, so that in next call, stop searching through the processed transactions.
-	var firstTrans *model.HTransaction
-	firstTransHash := ""
-	if len(trans) > 0 {
-		firstTrans = model.NewHTransaction(&trans[0].Transaction)
-		firstTransHash = firstTrans.Formatter().Hash()
-	}
-
-	// Start processing transactions
-	var hash tongo.Bits256
-	reachEnd := firstTransHash == latestProcessedHash
-	if reachEnd {
+	if latest == cursor {
 		log.Printf("No new transaction for process.\n")
+		return &result, nil
 	}
 
-	for err == nil && len(trans) > 0 && !reachEnd {
-		index := findLastUnprocessed(trans, latestProcessedHash)
-		reachEnd = index < len(trans)
-		if reachEnd {
-			trans = trans[0:index]
-		}
-
-		stkReqs := interactor.stakeInteractor.MakeStakeRequests(trans)
-		unstkReqs := interactor.unstakeInteractor.MakeUnstakeRequests(trans)
-		result.StakeRequests = append(result.StakeRequests, stkReqs...)
-		result.UnstakeRequests = append(result.UnstakeRequests, unstkReqs...)
-		log.Printf("Processing transactions... Total: %v / Found: %v stake(s) and %v unstake(s)\n", len(trans), len(stkReqs), len(unstkReqs))
-
-		// If the latest processed transaction is not reached,
-		if !reachEnd {
-			// Extract the Lt and the Hash of last transaction
-			lt := trans[len(trans)-1].Lt
-			hash.FromHex(trans[len(trans)-1].Hash().Hex())
-
-			// Extract previous transactions. GetTransactions function returns 16 items by max, this is why 16 is passed for the count parameter.
-			trans, err = interactor.client.GetTransactions(context.Background(), 16, treasuryAccount, lt, hash)
-			if err != nil {
-				exporter.IncErrorCount()
-				log.Printf("🔴 getting transactions - %v\n", err.Error())
-				fmt.Printf("❌ No wallet will be kept due to above error.\n")
-				return nil, err
-			}
-
-			// Remove the first element as it's already processed in previous loop
-			if len(trans) > 0 {
-				trans = trans[1:]
-			}
-		}
-	}
-
-	// Keep the first hash as the latest processed hash.
-	if firstTransHash != "" && firstTransHash != latestProcessedHash {
-		err = interactor.memoInteractor.SetLatestProcessedHash(firstTransHash)
+	if gap != nil {
+		exporter.IncErrorCount()
+		log.Printf("🔴 treasury transactions are missed, back-fill them [after lt: %v, before lt: %v, before hash: %v]\n", gap.FromLt, gap.ToLt, gap.ToHash)
+		err = interactor.memoInteractor.AddExtractionGap(*gap)
 		if err != nil {
 			exporter.IncErrorCount()
-			log.Printf("🔴 updating latest hash - %v\n", err.Error())
+			log.Printf("🔴 keeping extraction gap - %v\n", err.Error())
 		}
 	}
 
+	// Keep the latest transaction as the cursor.
+	err = interactor.memoInteractor.SetExtractionCursor(latest)
+	if err != nil {
+		exporter.IncErrorCount()
+		log.Printf("🔴 updating extraction cursor - %v\n", err.Error())
+	}
+
 	return &result, nil
 }
 
+// collect adds the requests the decoders find in the transactions, and their events, to the result, and returns how
+// many stakes and unstakes are found.
+func (interactor *ExtractInteractor) collect(trans []tongo.Transaction, result *domain.ExtractionResult) (int, int) {
+	stakes, unstakes := len(result.StakeRequests), len(result.UnstakeRequests)
+	interactor.decoderRegistry.Decode(trans, result)
+	result.Events = append(result.Events, interactor.eventInteractor.MakeEvents(trans)...)
+	return len(result.StakeRequests) - stakes, len(result.UnstakeRequests) - unstakes
+}
+
 func (interactor *ExtractInteractor) Store(extractResult *domain.ExtractionResult) error {
-	err := interactor.stakeInteractor.Store(extractResult.StakeRequests)
+	err := interactor.eventInteractor.Store(extractResult.Events)
+	if err != nil {
+		return err
+	}
+
+	err = interactor.stakeInteractor.Store(extractResult.StakeRequests)
 	if err != nil {
 		exporter.IncErrorCount()
 		log.Printf("🔴 storing stake - %v\n", err.Error())
@@ -144,5 +155,10 @@ func (interactor *ExtractInteractor) Store(extractResult *domain.ExtractionResul
 		return err
 	}
 
+	err = interactor.failureInteractor.Store(extractResult.FailedRequests)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
@@ -0,0 +1,117 @@
+package usecase
+
+import (
+	"driver/domain"
+	"driver/domain/config"
+	"driver/domain/model"
+	"driver/interface/exporter"
+	"log"
+	"time"
+)
+
+// FailureInteractor keeps the deposits and unstakes the treasury failed to process, along with the exit code and
+// whether the coins were bounced, so a user whose coins seem lost can be answered.
+type FailureInteractor struct {
+	failureRepository FailureRepository
+}
+
+func NewFailureInteractor(failureRepository FailureRepository) *FailureInteractor {
+	return &FailureInteractor{
+		failureRepository: failureRepository,
+	}
+}
+
+// Decoders returns the decoders of the failed requests, i.e. the failed transactions of the deposits and the
+// reserve_token messages the treasury receives.
+func (interactor *FailureInteractor) Decoders() []Decoder {
+	return []Decoder{
+		{
+			Name:      "failed_deposit",
+			Opcode:    OpcodeDeposit,
+			Direction: MessageIn,
+			Decode:    interactor.decoder(domain.FailedRequestKindDeposit, isDeposit),
+		},
+		{
+			Name:      "failed_unstake",
+			Opcode:    OpcodeReserveToken,
+			Direction: MessageIn,
+			Decode:    interactor.decoder(domain.FailedRequestKindUnstake, nil),
+		},
+	}
+}
+
+// decoder returns the decode function of a kind of failed requests. If match is given, only the in-messages it
+// matches are of that kind.
+func (interactor *FailureInteractor) decoder(kind string, match func(msg *model.HMessage) bool) DecodeFunc {
+	return func(ht *model.HTransaction, msgs []*model.HMessage, result *domain.ExtractionResult) {
+		// Leave transaction if it's succeeded, it's a request of its own.
+		if ht.IsSucceeded() {
+			return
+		}
+		if match != nil && !match(msgs[0]) {
+			return
+		}
+
+		var sender *string
+		if src := msgs[0].Src(); src != nil {
+			addr := src.ToHuman(true, config.IsTestNet())
+			sender = &addr
+		}
+
+		// The bounce phase sends the coins back along with the out-messages.
+		bounced := false
+		for _, msg := range ht.OutMessages() {
+			if msg.IsBounced() {
+				bounced = true
+			}
+		}
+
+		finalMcSeqno := result.FinalMcSeqno
+		result.FailedRequests = append(result.FailedRequests, domain.FailedRequest{
+			Hash:         ht.Formatter().Hash(),
+			Lt:           ht.Lt(),
+			ExecutedAt:   ht.UnixTime(),
+			Kind:         kind,
+			Sender:       sender,
+			Value:        ht.Value(),
+			ExitCode:     ht.ExitCode(),
+			Bounced:      bounced,
+			FinalMcSeqno: &finalMcSeqno,
+		})
+	}
+}
+
+// isDeposit tells whether the message is a deposit, i.e. the comment 'd'. Any other message of the opcode 0, e.g. an
+// empty body or another comment, is a plain transfer.
+func isDeposit(msg *model.HMessage) bool {
+	comment, ok := msg.Comment()
+	return ok && comment == "d"
+}
+
+// Store keeps the failed requests, and leaves the ones already kept as they are.
+func (interactor *FailureInteractor) Store(requests []domain.FailedRequest) error {
+	err := interactor.failureRepository.InsertAll(requests)
+	if err != nil {
+		exporter.IncErrorCount()
+		log.Printf("🔴 storing failed requests - %v\n", err.Error())
+		return err
+	}
+	return nil
+}
+
+// Exists tells whether the failed request of the transaction is already kept.
+func (interactor *FailureInteractor) Exists(hash string) (bool, error) {
+	request, err := interactor.failureRepository.Find(hash)
+	if err != nil {
+		return false, err
+	}
+	return request != nil, nil
+}
+
+// List returns the requests failed since the time, or the ones sent by the address if it's given, the latest first.
+func (interactor *FailureInteractor) List(since time.Time, sender string, limit int) ([]*domain.FailedRequest, error) {
+	if sender != "" {
+		return interactor.failureRepository.FindBySender(sender, limit)
+	}
+	return interactor.failureRepository.FindAll(since, limit)
+}
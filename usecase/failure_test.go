@@ -0,0 +1,82 @@
+package usecase_test
+
+import (
+	"context"
+	"driver/domain"
+	"driver/domain/config"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestFailedRequests(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	env.sim.StartRound(100)
+
+	owner, walletId := testAccount(2, 0), testAccount(3, 0)
+	env.deposit(t, 0, 1)
+	deposit, err := env.sim.FailedDeposit(owner, 7_000_000_000, 101)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A failed transfer with another comment is not a deposit.
+	_, err = env.sim.FailedTransfer(owner, 3_000_000_000, "hello", 101)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.sim.FinishRound(100)
+	unstake, err := env.sim.FailedUnstake(walletId, big.NewInt(2_000_000_000), 77)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.sim.SealMasterchainBlock()
+
+	result, err := env.extractInteractor.Extract(ctx, env.treasury)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.StakeRequests) != 1 || len(result.UnstakeRequests) != 0 || len(result.FailedRequests) != 2 {
+		t.Fatalf("extracted %v stakes, %v unstakes and %v failed requests, want a stake and the failed deposit and unstake",
+			len(result.StakeRequests), len(result.UnstakeRequests), len(result.FailedRequests))
+	}
+	// Storing the same requests again keeps them once.
+	for i := 0; i < 2; i++ {
+		err = env.extractInteractor.Store(result)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	failed, err := env.failureInteractor.List(time.Now().Add(-time.Hour), "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 2 {
+		t.Fatalf("listed %v failed requests, want 2", len(failed))
+	}
+	want := []struct {
+		hash     string
+		kind     string
+		sender   string
+		value    uint64
+		exitCode int32
+	}{
+		{unstake.Hash().Hex(), domain.FailedRequestKindUnstake, walletId.ToHuman(true, config.IsTestNet()), 100_000_000, 77},
+		{deposit.Hash().Hex(), domain.FailedRequestKindDeposit, owner.ToHuman(true, config.IsTestNet()), 7_000_000_000, 101},
+	}
+	for i, request := range failed {
+		if request.Hash != want[i].hash || request.Kind != want[i].kind || request.Sender == nil || *request.Sender != want[i].sender ||
+			uint64(request.Value) != want[i].value || request.ExitCode != want[i].exitCode || !request.Bounced || request.FinalMcSeqno == nil {
+			t.Fatalf("failed request %v is %+v, want %+v bounced", i, request, want[i])
+		}
+	}
+
+	bySender, err := env.failureInteractor.List(time.Time{}, want[1].sender, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bySender) != 1 || bySender[0].Hash != want[1].hash {
+		t.Fatalf("listed %v failed requests of the owner, want the deposit", len(bySender))
+	}
+}
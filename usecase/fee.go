@@ -0,0 +1,230 @@
+package usecase
+
+import (
+	"context"
+	"driver/domain"
+	"driver/domain/config"
+	"driver/interface/exporter"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/tonkeeper/tongo"
+	"github.com/tonkeeper/tongo/liteapi"
+	"github.com/tonkeeper/tongo/tlb"
+	"github.com/tonkeeper/tongo/ton"
+)
+
+var (
+	ErrorNoFeeConfig = fmt.Errorf("gas or forwarding prices are missing from the blockchain config")
+)
+
+// feeConfigTTL is how long the prices read from the blockchain config are used before reading them again.
+const feeConfigTTL = 10 * time.Minute
+
+// feeHop is a step of the chain of transactions a driver message starts: the gas used by the contract
+// receiving the message, and the size of the message it sends on, if any.
+type feeHop struct {
+	gas   uint64
+	bits  uint64
+	cells uint64
+}
+
+// feeProfile describes what a driver message costs along its way, until its excess is returned. It is the first
+// estimate of a message, until the spends of the sent messages are observed from their excesses. The fallback is
+// attached if neither the prices nor any spends are known.
+type feeProfile struct {
+	hops     []feeHop
+	fallback tlb.Grams
+}
+
+// The gas and message sizes are rough upper guesses of what the treasury and j-wallet contracts use, so the first
+// messages may overpay. Once their excesses are back, the estimate follows what the messages really spent.
+var feeProfiles = map[uint32]feeProfile{
+	// stake_coins: j-wallet -> treasury -> j-wallet -> excess to the driver wallet
+	domain.OpcodeStakeCoin: {
+		hops: []feeHop{
+			{gas: 30_000, bits: 1_023, cells: 2},
+			{gas: 50_000, bits: 1_023, cells: 2},
+			{gas: 30_000, bits: 700, cells: 1},
+			{gas: 5_000},
+		},
+		fallback: domain.DefaultStakeCoinAmount,
+	},
+
+	// withdraw_tokens: j-wallet -> treasury -> j-wallet -> coins to the owner, excess to the driver wallet
+	domain.OpcodeWithdraw: {
+		hops: []feeHop{
+			{gas: 30_000, bits: 1_023, cells: 2},
+			{gas: 80_000, bits: 1_023, cells: 2},
+			{gas: 30_000, bits: 1_400, cells: 2},
+			{gas: 5_000},
+		},
+		fallback: domain.DefaultWithdrawAmount,
+	},
+}
+
+// feeSamples is how many of the latest spends of each opcode are kept to estimate the next messages.
+const feeSamples = 20
+
+// feePrices are the gas and forwarding prices of a workchain.
+type feePrices struct {
+	gas     tlb.GasLimitsPrices
+	forward tlb.MsgForwardPrices
+}
+
+// FeeInteractor estimates the coins to attach to the driver messages, from what the latest messages spent, or
+// from the gas and forwarding prices of the blockchain config (parameters 20, 21, 24 and 25) before any is spent.
+type FeeInteractor struct {
+	client ChainClient
+
+	mutex       sync.Mutex
+	masterchain *feePrices
+	basechain   *feePrices
+	loadedAt    time.Time
+	spends      map[uint32][]tlb.Grams
+}
+
+func NewFeeInteractor(client ChainClient) *FeeInteractor {
+	return &FeeInteractor{
+		client: client,
+		spends: map[uint32][]tlb.Grams{},
+	}
+}
+
+// Observe keeps what a sent message with the opcode spent, i.e. its attached value less its excess, so the next
+// messages are estimated by it. Only the latest spends of each opcode are kept.
+func (interactor *FeeInteractor) Observe(opcode uint32, spent tlb.Grams) {
+	interactor.mutex.Lock()
+	defer interactor.mutex.Unlock()
+
+	spends := append(interactor.spends[opcode], spent)
+	if len(spends) > feeSamples {
+		spends = spends[len(spends)-feeSamples:]
+	}
+	interactor.spends[opcode] = spends
+}
+
+// observed returns the most any of the latest messages with the opcode spent, and false if none is observed yet.
+func (interactor *FeeInteractor) observed(opcode uint32) (tlb.Grams, bool) {
+	interactor.mutex.Lock()
+	defer interactor.mutex.Unlock()
+
+	spends := interactor.spends[opcode]
+	if len(spends) == 0 {
+		return 0, false
+	}
+	most := spends[0]
+	for _, spent := range spends[1:] {
+		if spent > most {
+			most = spent
+		}
+	}
+	return most, true
+}
+
+// Estimate returns the value to attach to a message with the opcode sent to the account. It is the most the latest
+// messages with the opcode spent, or the fees estimated by the prices if none is observed yet, plus the configured
+// margin, and it is kept between the configured least and most attached values. If neither is known, the fallback
+// of the message is used.
+func (interactor *FeeInteractor) Estimate(ctx context.Context, opcode uint32, accid tongo.AccountID) tlb.Grams {
+	profile := feeProfiles[opcode]
+
+	value := profile.fallback
+	if spent, exist := interactor.observed(opcode); exist {
+		value = tlb.Grams(uint64(spent) * uint64(100+config.GetFeeMargin()) / 100)
+	} else if prices, err := interactor.getPrices(ctx, accid.Workchain); err != nil {
+		exporter.IncErrorCount()
+		log.Printf("🔴 loading fee prices - %v\n", err.Error())
+	} else {
+		fees := uint64(0)
+		for _, hop := range profile.hops {
+			fees += gasFee(prices.gas, hop.gas)
+			if hop.bits > 0 || hop.cells > 0 {
+				fees += forwardFee(prices.forward, hop.bits, hop.cells)
+			}
+		}
+		value = tlb.Grams(fees * uint64(100+config.GetFeeMargin()) / 100)
+	}
+
+	if value < config.GetMinAttachedValue() {
+		value = config.GetMinAttachedValue()
+	}
+	if value > config.GetMaxAttachedValue() {
+		log.Printf("🔵 attached value %v is capped to %v\n", value, config.GetMaxAttachedValue())
+		value = config.GetMaxAttachedValue()
+	}
+	return value
+}
+
+// getPrices returns the prices of the workchain, and reads them again if they are loaded too long ago. The
+// previous prices are used if reading them fails.
+func (interactor *FeeInteractor) getPrices(ctx context.Context, workchain int32) (*feePrices, error) {
+	interactor.mutex.Lock()
+	defer interactor.mutex.Unlock()
+
+	if interactor.basechain == nil || time.Since(interactor.loadedAt) > feeConfigTTL {
+		err := interactor.loadPrices(ctx)
+		if err != nil && interactor.basechain == nil {
+			return nil, err
+		}
+		if err != nil {
+			exporter.IncErrorCount()
+			log.Printf("🔴 reloading fee prices, using the previous ones - %v\n", err.Error())
+		}
+	}
+
+	if workchain == -1 {
+		return interactor.masterchain, nil
+	}
+	return interactor.basechain, nil
+}
+
+func (interactor *FeeInteractor) loadPrices(ctx context.Context) error {
+	params, err := interactor.client.GetConfigParams(ctx, liteapi.ConfigMode(0), []uint32{20, 21, 24, 25})
+	if err != nil {
+		return err
+	}
+
+	conf, err := ton.ConvertBlockchainConfig(params)
+	if err != nil {
+		return err
+	}
+
+	if conf.ConfigParam20 == nil || conf.ConfigParam21 == nil || conf.ConfigParam24 == nil || conf.ConfigParam25 == nil {
+		return ErrorNoFeeConfig
+	}
+
+	interactor.masterchain = &feePrices{gas: conf.ConfigParam20.GasLimitsPrices, forward: conf.ConfigParam24.MsgForwardPrices}
+	interactor.basechain = &feePrices{gas: conf.ConfigParam21.GasLimitsPrices, forward: conf.ConfigParam25.MsgForwardPrices}
+	interactor.loadedAt = time.Now()
+	return nil
+}
+
+// gasFee returns the fee of the gas in nanotons. The prices are kept in 1/65536 of a nanoton.
+func gasFee(prices tlb.GasLimitsPrices, gas uint64) uint64 {
+	switch prices.SumType {
+	case "GasFlatPfx":
+		if prices.GasFlatPfx.Other == nil {
+			return prices.GasFlatPfx.FlatGasPrice
+		}
+		if gas <= prices.GasFlatPfx.FlatGasLimit {
+			return prices.GasFlatPfx.FlatGasPrice
+		}
+		return prices.GasFlatPfx.FlatGasPrice + gasFee(*prices.GasFlatPfx.Other, gas-prices.GasFlatPfx.FlatGasLimit)
+	case "GasPricesExt":
+		return ceilDiv(prices.GasPricesExt.GasPrice*gas, 1<<16)
+	default:
+		return ceilDiv(prices.GasPrices.GasPrice*gas, 1<<16)
+	}
+}
+
+// forwardFee returns the fee of forwarding a message of the size in nanotons.
+func forwardFee(prices tlb.MsgForwardPrices, bits uint64, cells uint64) uint64 {
+	return prices.LumpPrice + ceilDiv(prices.BitPrice*bits+prices.CellPrice*cells, 1<<16)
+}
+
+func ceilDiv(a uint64, b uint64) uint64 {
+	return (a + b - 1) / b
+}
@@ -0,0 +1,154 @@
+package usecase_test
+
+import (
+	"context"
+	"driver/domain"
+	"driver/domain/config"
+	"driver/infrastructure/simulator"
+	"driver/usecase"
+	"fmt"
+	"testing"
+
+	"github.com/tonkeeper/tongo/tlb"
+)
+
+func TestFeeEstimate(t *testing.T) {
+	ctx := context.Background()
+	wallet := testAccount(3, 0)
+	margin := func(spent tlb.Grams) tlb.Grams {
+		return tlb.Grams(uint64(spent) * uint64(100+config.GetFeeMargin()) / 100)
+	}
+
+	tests := []struct {
+		name     string
+		prepare  func(sim *simulator.Simulator, feeInteractor *usecase.FeeInteractor)
+		check    func(stake tlb.Grams, withdraw tlb.Grams) bool
+		expected string
+	}{
+		{
+			name:    "cheap config",
+			prepare: func(sim *simulator.Simulator, feeInteractor *usecase.FeeInteractor) {},
+			check: func(stake tlb.Grams, withdraw tlb.Grams) bool {
+				return stake < domain.DefaultStakeCoinAmount && withdraw < domain.DefaultWithdrawAmount &&
+					stake >= config.GetMinAttachedValue() && withdraw > stake
+			},
+			expected: "below the previous constants",
+		},
+		{
+			name: "least attached value",
+			prepare: func(sim *simulator.Simulator, feeInteractor *usecase.FeeInteractor) {
+				sim.SetGasPrice(1)
+			},
+			check: func(stake tlb.Grams, withdraw tlb.Grams) bool {
+				return stake == config.GetMinAttachedValue()
+			},
+			expected: "the configured least value for the stake",
+		},
+		{
+			name: "high gas price",
+			prepare: func(sim *simulator.Simulator, feeInteractor *usecase.FeeInteractor) {
+				sim.SetGasPrice(100_000 << 16)
+			},
+			check: func(stake tlb.Grams, withdraw tlb.Grams) bool {
+				return stake == config.GetMaxAttachedValue() && withdraw == config.GetMaxAttachedValue()
+			},
+			expected: "the configured most value",
+		},
+		{
+			name: "observed spends",
+			prepare: func(sim *simulator.Simulator, feeInteractor *usecase.FeeInteractor) {
+				sim.SetGasPrice(2_000 << 16)
+				feeInteractor.Observe(domain.OpcodeStakeCoin, 70_000_000)
+				feeInteractor.Observe(domain.OpcodeStakeCoin, 80_000_000)
+				feeInteractor.Observe(domain.OpcodeWithdraw, 90_000_000)
+			},
+			check: func(stake tlb.Grams, withdraw tlb.Grams) bool {
+				return stake == margin(80_000_000) && withdraw == margin(90_000_000)
+			},
+			expected: "the most observed spends with the margin",
+		},
+		{
+			name: "prices unavailable",
+			prepare: func(sim *simulator.Simulator, feeInteractor *usecase.FeeInteractor) {
+				sim.SetFailure("GetConfigParams", fmt.Errorf("connection lost"))
+			},
+			check: func(stake tlb.Grams, withdraw tlb.Grams) bool {
+				return stake == domain.DefaultStakeCoinAmount && withdraw == domain.DefaultWithdrawAmount
+			},
+			expected: "the fallbacks",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			feeInteractor := usecase.NewFeeInteractor(env.sim)
+			test.prepare(env.sim, feeInteractor)
+
+			stake := feeInteractor.Estimate(ctx, domain.OpcodeStakeCoin, wallet)
+			withdraw := feeInteractor.Estimate(ctx, domain.OpcodeWithdraw, wallet)
+			if !test.check(stake, withdraw) {
+				t.Fatalf("estimated %v and %v, want %v", stake, withdraw, test.expected)
+			}
+		})
+	}
+}
+
+// TestFeeEstimateFollowsExcesses checks that once the excesses of the sent messages are back, the next messages are
+// estimated by what they spent.
+func TestFeeEstimateFollowsExcesses(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	env.sim.StartRound(100)
+
+	env.deposit(t, 0, 1)
+	result, err := env.extractInteractor.Extract(ctx, env.treasury)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.extractInteractor.Store(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests, err := env.stakeInteractor.LoadTriable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := requests[0]
+	walletId := testAccount(3, 0)
+	value := env.feeInteractor.Estimate(ctx, domain.OpcodeStakeCoin, walletId)
+
+	env.sim.FinishRound(100)
+	env.startMessenger(t)
+	err = env.stakeInteractor.SendStakeMessageToJettonWallets(ctx, requests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "stake "+request.Reference(), func() bool {
+		return env.stakeState(t, request.Hash, request.MsgIndex) == domain.RequestStateSent
+	})
+
+	_, excesses, err := env.inboundInteractor.Extract(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if excesses != 1 {
+		t.Fatalf("processed %v excesses, want the excess of the message", excesses)
+	}
+	stake, err := env.stakeRepository.Find(request.Hash, request.MsgIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stake.Excess == nil || *stake.Excess >= value {
+		t.Fatalf("kept excess %v, want a part of the attached %v", stake.Excess, value)
+	}
+
+	spent := value - *stake.Excess
+	want := tlb.Grams(uint64(spent) * uint64(100+config.GetFeeMargin()) / 100)
+	if want < config.GetMinAttachedValue() {
+		want = config.GetMinAttachedValue()
+	}
+	if estimate := env.feeInteractor.Estimate(ctx, domain.OpcodeStakeCoin, walletId); estimate != want {
+		t.Fatalf("estimated %v after spending %v, want %v", estimate, spent, want)
+	}
+}
@@ -0,0 +1,71 @@
+package usecase
+
+import (
+	"context"
+	"driver/domain"
+	"driver/domain/config"
+	"fmt"
+
+	"github.com/tonkeeper/tongo"
+)
+
+var (
+	ErrorNoFinalBlock = fmt.Errorf("no masterchain block is deep enough to be final")
+)
+
+// FinalityInteractor finds the masterchain blocks which are deep enough to be final, i.e. finality_depth blocks
+// behind the latest one. Only the transactions they commit to are extracted, so a lagging or forked liteserver can't
+// feed transactions which never make it to the chain.
+type FinalityInteractor struct {
+	client BlockClient
+}
+
+func NewFinalityInteractor(client BlockClient) *FinalityInteractor {
+	interactor := &FinalityInteractor{
+		client: client,
+	}
+	return interactor
+}
+
+// Depth returns how many masterchain blocks a block must be behind the latest one to be final.
+func (interactor *FinalityInteractor) Depth() uint32 {
+	return config.GetFinalityDepth()
+}
+
+// FinalBlock returns the latest final masterchain block, along with the block of the account's shard it commits to.
+func (interactor *FinalityInteractor) FinalBlock(ctx context.Context, account tongo.AccountID) (domain.FinalBlock, error) {
+	info, err := interactor.client.GetMasterchainInfo(ctx)
+	if err != nil {
+		return domain.FinalBlock{}, err
+	}
+
+	last := info.Last.ToBlockIdExt()
+	depth := interactor.Depth()
+	if last.Seqno <= depth {
+		return domain.FinalBlock{}, ErrorNoFinalBlock
+	}
+
+	masterBlock := last
+	if depth > 0 {
+		masterBlock, _, err = interactor.client.LookupBlock(ctx, tongo.BlockID{Workchain: -1, Shard: masterchainShard, Seqno: last.Seqno - depth}, lookupBlockBySeqno, nil, nil)
+		if err != nil {
+			return domain.FinalBlock{}, err
+		}
+	}
+
+	top, err := shardTop(ctx, interactor.client, masterBlock, account)
+	if err != nil {
+		return domain.FinalBlock{}, err
+	}
+
+	_, topInfo, err := interactor.client.LookupBlock(ctx, top.BlockID, lookupBlockBySeqno, nil, nil)
+	if err != nil {
+		return domain.FinalBlock{}, err
+	}
+
+	return domain.FinalBlock{
+		MasterchainSeqno: masterBlock.Seqno,
+		ShardBlock:       top,
+		EndLt:            topInfo.EndLt,
+	}, nil
+}
@@ -0,0 +1,131 @@
+package usecase
+
+import (
+	"context"
+	"driver/domain/model"
+	"driver/interface/exporter"
+	"log"
+
+	"github.com/tonkeeper/tongo"
+)
+
+// InboundInteractor looks through the driver wallet's transactions for the messages returned to it by the
+// j-wallets, i.e. the bounces of the rejected messages and the excesses of the accepted ones.
+type InboundInteractor struct {
+	client            ChainClient
+	memoInteractor    *MemoInteractor
+	outboxInteractor  *OutboxInteractor
+	feeInteractor     *FeeInteractor
+	stakeRepository   StakeRepository
+	unstakeRepository UnstakeRepository
+	driverWallet      DriverWallet
+}
+
+func NewInboundInteractor(client ChainClient,
+	memoInteractor *MemoInteractor,
+	outboxInteractor *OutboxInteractor,
+	feeInteractor *FeeInteractor,
+	stakeRepository StakeRepository,
+	unstakeRepository UnstakeRepository,
+	driverWallet DriverWallet) *InboundInteractor {
+	interactor := &InboundInteractor{
+		client:            client,
+		memoInteractor:    memoInteractor,
+		outboxInteractor:  outboxInteractor,
+		feeInteractor:     feeInteractor,
+		stakeRepository:   stakeRepository,
+		unstakeRepository: unstakeRepository,
+		driverWallet:      driverWallet,
+	}
+	return interactor
+}
+
+// Extract processes the messages which arrived at the driver wallet since the last call. If a message can't be
+// processed, the inbound cursor is not moved, so all of them are looked through again in the next call.
+// It returns the number of requests moved to the bounced state, and the number of excesses kept.
+func (interactor *InboundInteractor) Extract(ctx context.Context) (int, int, error) {
+	account := interactor.driverWallet.GetAddress()
+
+	cursor, err := interactor.memoInteractor.GetInboundCursor()
+	if err != nil {
+		exporter.IncErrorCount()
+		log.Printf("🔴 getting inbound cursor - %v\n", err.Error())
+		return 0, 0, err
+	}
+
+	bounces, excesses := 0, 0
+	latest, gap, err := walkTransactions(ctx, interactor.client, account, cursor, 0, func(trans []tongo.Transaction) error {
+		b, e, err := interactor.process(ctx, trans)
+		bounces += b
+		excesses += e
+		return err
+	})
+	if err != nil {
+		exporter.IncErrorCount()
+		log.Printf("🔴 looking through driver wallet transactions - %v\n", err.Error())
+		return bounces, excesses, err
+	}
+
+	if gap != nil {
+		exporter.IncErrorCount()
+		log.Printf("🔴 driver wallet transactions are missed, back-fill them [after lt: %v, before lt: %v, before hash: %v]\n", gap.FromLt, gap.ToLt, gap.ToHash)
+		err = interactor.memoInteractor.AddInboundGap(*gap)
+		if err != nil {
+			exporter.IncErrorCount()
+			log.Printf("🔴 keeping inbound gap - %v\n", err.Error())
+		}
+	}
+
+	if latest != cursor {
+		err = interactor.memoInteractor.SetInboundCursor(latest)
+		if err != nil {
+			exporter.IncErrorCount()
+			log.Printf("🔴 updating inbound cursor - %v\n", err.Error())
+		}
+	}
+
+	return bounces, excesses, nil
+}
+
+// process processes the bounces and the excesses which arrived by the transactions. It returns the number of requests
+// moved to the bounced state, and the number of excesses kept, before any message which can't be processed.
+func (interactor *InboundInteractor) process(ctx context.Context, trans []tongo.Transaction) (int, int, error) {
+	bounces, excesses := 0, 0
+	for i := range trans {
+		ht := model.NewHTransaction(&trans[i].Transaction)
+		if !trans[i].Msgs.InMsg.Exists {
+			continue
+		}
+
+		inMsg := ht.InMessage()
+		var processed bool
+		var err error
+		switch {
+		case inMsg.IsBounced():
+			processed, err = interactor.processBounce(ctx, ht)
+			if processed {
+				bounces++
+			}
+		case inMsg.Opcode() == OpcodeExcesses:
+			processed, err = interactor.processExcess(ht)
+			if processed {
+				excesses++
+			}
+		}
+		if err != nil {
+			log.Printf("🔴 processing inbound message [transaction: %v] - %v\n", ht.Formatter().Hash(), err.Error())
+			return bounces, excesses, err
+		}
+	}
+	return bounces, excesses, nil
+}
+
+// isReturned tells whether the message arrived at the driver wallet is a bounce or an excess, i.e. what process looks
+// for.
+func isReturned(trans tongo.Transaction) bool {
+	if !trans.Msgs.InMsg.Exists {
+		return false
+	}
+	inMsg := model.NewHTransaction(&trans.Transaction).InMessage()
+	return inMsg.IsBounced() || inMsg.Opcode() == OpcodeExcesses
+}
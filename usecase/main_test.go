@@ -0,0 +1,176 @@
+package usecase_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"driver/domain/config"
+	"driver/infrastructure/simulator"
+	"driver/interface/exporter"
+	"driver/interface/repository"
+	"driver/usecase"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/tonkeeper/tongo"
+	"github.com/tonkeeper/tongo/wallet"
+)
+
+func TestMain(m *testing.M) {
+	config.ReadConfig("testdata/config.json")
+	exporter.Init()
+	os.Exit(m.Run())
+}
+
+// testEnv is the driver wired the way the start command wires it, on top of the simulator and the memory
+// repositories.
+type testEnv struct {
+	sim      *simulator.Simulator
+	treasury tongo.AccountID
+
+	driverWallet    wallet.Wallet
+	messengerWallet usecase.DriverWallet
+
+	memoRepository    usecase.MemoRepository
+	stakeRepository   usecase.StakeRepository
+	unstakeRepository usecase.UnstakeRepository
+	outboxRepository  usecase.OutboxRepository
+	failureRepository usecase.FailureRepository
+
+	memoInteractor      *usecase.MemoInteractor
+	stakeInteractor     *usecase.StakeInteractor
+	unstakeInteractor   *usecase.UnstakeInteractor
+	failureInteractor   *usecase.FailureInteractor
+	requestInteractor   *usecase.RequestInteractor
+	extractInteractor   *usecase.ExtractInteractor
+	verifyInteractor    *usecase.VerifyInteractor
+	outboxInteractor    *usecase.OutboxInteractor
+	messengerInteractor *usecase.MessengerInteractor
+	balanceInteractor   *usecase.BalanceInteractor
+	inboundInteractor   *usecase.InboundInteractor
+	feeInteractor       *usecase.FeeInteractor
+	backfillInteractor  *usecase.BackfillInteractor
+	decoderRegistry     *usecase.DecoderRegistry
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	_, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := &testEnv{treasury: config.GetTreasuryAccountId()}
+
+	env.driverWallet, err = wallet.New(key, wallet.V4R2, 0, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.sim = simulator.NewSimulator(env.treasury, env.driverWallet.GetAddress())
+	env.messengerWallet, err = usecase.NewSeqnoWallet(env.sim, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env.memoRepository = repository.NewMemoryMemoRepository()
+	env.stakeRepository = repository.NewMemoryStakeRepository()
+	env.unstakeRepository = repository.NewMemoryUnstakeRepository()
+	env.outboxRepository = repository.NewMemoryOutboxRepository()
+	env.failureRepository = repository.NewMemoryFailureRepository()
+	queryIdRepository := repository.NewMemoryQueryIdRepository()
+
+	env.memoInteractor = usecase.NewMemoInteractor(env.memoRepository)
+	contractInteractor := usecase.NewContractInteractor(env.sim)
+	env.feeInteractor = usecase.NewFeeInteractor(env.sim)
+	env.stakeInteractor = usecase.NewStakeInteractor(env.sim, env.memoInteractor, contractInteractor, env.feeInteractor, env.stakeRepository, queryIdRepository, &env.driverWallet)
+	env.unstakeInteractor = usecase.NewUnstakeInteractor(env.sim, env.memoInteractor, contractInteractor, env.feeInteractor, env.unstakeRepository, queryIdRepository, &env.driverWallet)
+	eventInteractor := usecase.NewEventInteractor(repository.NewMemoryEventRepository())
+	env.failureInteractor = usecase.NewFailureInteractor(env.failureRepository)
+	env.requestInteractor = usecase.NewRequestInteractor(env.stakeRepository, env.unstakeRepository)
+
+	env.decoderRegistry = usecase.NewDecoderRegistry()
+	decoders := append([]usecase.Decoder{env.stakeInteractor.Decoder(), env.unstakeInteractor.Decoder()}, env.failureInteractor.Decoders()...)
+	for _, decoder := range decoders {
+		err = env.decoderRegistry.Register(decoder)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	finalityInteractor := usecase.NewFinalityInteractor(env.sim)
+	env.extractInteractor = usecase.NewExtractInteractor(env.sim, env.memoInteractor, contractInteractor, env.stakeInteractor, env.unstakeInteractor, eventInteractor, env.failureInteractor, env.decoderRegistry, finalityInteractor, &env.driverWallet)
+	env.verifyInteractor = usecase.NewVerifyInteractor(env.sim, contractInteractor, env.stakeRepository, env.unstakeRepository)
+
+	env.outboxInteractor = usecase.NewOutboxInteractor(env.outboxRepository)
+	stakeCh := env.stakeInteractor.InitializeChannel(env.outboxInteractor)
+	unstakeCh := env.unstakeInteractor.InitializeChannel(env.outboxInteractor)
+	spendInteractor := usecase.NewSpendInteractor(repository.NewMemorySpendRepository())
+	env.balanceInteractor = usecase.NewBalanceInteractor(env.sim, env.messengerWallet)
+	env.messengerInteractor = usecase.NewMessengerInteractor(env.sim, env.messengerWallet, env.outboxInteractor, nil, spendInteractor, env.balanceInteractor, stakeCh, unstakeCh)
+	env.inboundInteractor = usecase.NewInboundInteractor(env.sim, env.memoInteractor, env.outboxInteractor, env.feeInteractor, env.stakeRepository, env.unstakeRepository, env.messengerWallet)
+	env.backfillInteractor = usecase.NewBackfillInteractor(env.sim, env.stakeInteractor, env.unstakeInteractor, eventInteractor, env.failureInteractor, env.decoderRegistry, finalityInteractor, env.inboundInteractor)
+
+	return env
+}
+
+// testAccount returns a distinct basechain account for each index and kind, e.g. the owner and the jetton wallet
+// of a user.
+func testAccount(kind int, index int) tongo.AccountID {
+	return tongo.MustParseAccountID(fmt.Sprintf("0:%x%063x", kind, index))
+}
+
+// deposit makes a deposit of each user in a round, and commits them by a masterchain block.
+func (env *testEnv) deposit(t *testing.T, from int, count int) []tongo.Transaction {
+	trans := make([]tongo.Transaction, 0, count)
+	for i := from; i < from+count; i++ {
+		tx, err := env.sim.Deposit(testAccount(2, i), testAccount(3, i), 5_000_000_000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		trans = append(trans, tx)
+	}
+	env.sim.SealMasterchainBlock()
+	return trans
+}
+
+// startMessenger sends the outbox messages until the test ends.
+func (env *testEnv) startMessenger(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go env.messengerInteractor.ListenOnOutbox(ctx)
+	t.Cleanup(cancel)
+}
+
+// waitFor waits until the condition holds, and fails the test if it doesn't in a few seconds.
+func waitFor(t *testing.T, what string, condition func() bool) {
+	deadline := time.Now().Add(10 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %v", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// stakeState returns the state of the stake request, or an empty string if it's not found.
+func (env *testEnv) stakeState(t *testing.T, hash string, msgIndex int) string {
+	request, err := env.stakeRepository.Find(hash, msgIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request == nil {
+		return ""
+	}
+	return request.State
+}
+
+// unstakeState returns the state of the unstake request, or an empty string if it's not found.
+func (env *testEnv) unstakeState(t *testing.T, hash string) string {
+	request, err := env.unstakeRepository.Find(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request == nil {
+		return ""
+	}
+	return request.State
+}
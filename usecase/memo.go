@@ -2,46 +2,197 @@ package usecase
 
 import (
 	"driver/domain"
-	"driver/interface/repository"
+
+	"github.com/tonkeeper/tongo"
 )
 
 const (
 	ExtractionMemoKey = "extraction"
+	InboundMemoKey    = "inbound"
+
+	// maxGaps is how many of the latest gaps are kept in a memo.
+	maxGaps = 100
 )
 
 type MemoInteractor struct {
-	memoRepository *repository.MemoRepository
+	memoRepository MemoRepository
 }
 
-func NewMemoInteractor(memoRepository *repository.MemoRepository) *MemoInteractor {
+func NewMemoInteractor(memoRepository MemoRepository) *MemoInteractor {
 	interactor := &MemoInteractor{
 		memoRepository: memoRepository,
 	}
 	return interactor
 }
 
-func (interactor *MemoInteractor) GetLatestProcessedHash() (string, error) {
-	memo, err := interactor.memoRepository.Find(ExtractionMemoKey)
-	if err != nil || memo == nil {
-		return "", err
+// GetExtractionCursor returns the latest treasury transaction processed by the extraction.
+func (interactor *MemoInteractor) GetExtractionCursor() (domain.Cursor, error) {
+	return interactor.getCursor(ExtractionMemoKey)
+}
+
+func (interactor *MemoInteractor) SetExtractionCursor(cursor domain.Cursor) error {
+	return interactor.setCursor(ExtractionMemoKey, cursor)
+}
+
+// GetBlockCursor returns the latest blocks processed by the extraction, when it follows the blocks.
+func (interactor *MemoInteractor) GetBlockCursor() (domain.BlockCursor, error) {
+	memo, err := interactor.getMemo(ExtractionMemoKey)
+	if err != nil {
+		return domain.BlockCursor{}, err
 	}
 
-	var extractionMemo domain.ExtractionMemo
-	extractionMemo.FromJson(memo.Memo)
-	return extractionMemo.LatestProcessedHash, nil
+	cursor := domain.BlockCursor{MasterchainSeqno: memo.LatestMasterchainSeqno}
+	if memo.LatestShardBlock != nil {
+		rootHash, err := tongo.ParseHash(memo.LatestShardBlock.RootHash)
+		if err != nil {
+			return domain.BlockCursor{}, err
+		}
+		fileHash, err := tongo.ParseHash(memo.LatestShardBlock.FileHash)
+		if err != nil {
+			return domain.BlockCursor{}, err
+		}
+		cursor.ShardBlock = tongo.BlockIDExt{
+			BlockID: tongo.BlockID{
+				Workchain: memo.LatestShardBlock.Workchain,
+				Shard:     memo.LatestShardBlock.Shard,
+				Seqno:     memo.LatestShardBlock.Seqno,
+			},
+			RootHash: rootHash,
+			FileHash: fileHash,
+		}
+	}
+	return cursor, nil
+}
+
+// SetBlockCursor keeps the latest blocks processed by the extraction along with its transaction cursor, so both
+// are moved together.
+func (interactor *MemoInteractor) SetBlockCursor(block domain.BlockCursor, cursor domain.Cursor) error {
+	memo, err := interactor.getMemo(ExtractionMemoKey)
+	if err != nil {
+		return err
+	}
+
+	memo.LatestMasterchainSeqno = block.MasterchainSeqno
+	memo.LatestShardBlock = &domain.ShardBlock{
+		Workchain: block.ShardBlock.Workchain,
+		Shard:     block.ShardBlock.Shard,
+		Seqno:     block.ShardBlock.Seqno,
+		RootHash:  block.ShardBlock.RootHash.Hex(),
+		FileHash:  block.ShardBlock.FileHash.Hex(),
+	}
+	memo.LatestProcessedLt = cursor.Lt
+	memo.LatestProcessedHash = cursor.Hash
+	_, err = interactor.memoRepository.Upsert(ExtractionMemoKey, memo)
+	return err
+}
+
+// AddExtractionGap keeps a gap found in the treasury transactions, so it can be back-filled later.
+func (interactor *MemoInteractor) AddExtractionGap(gap domain.Gap) error {
+	return interactor.addGap(ExtractionMemoKey, gap)
+}
+
+func (interactor *MemoInteractor) GetExtractionGaps() ([]domain.Gap, error) {
+	memo, err := interactor.getMemo(ExtractionMemoKey)
+	if err != nil {
+		return nil, err
+	}
+	return memo.Gaps, nil
+}
+
+// RemoveExtractionGap forgets a gap found in the treasury transactions, once it's back-filled.
+func (interactor *MemoInteractor) RemoveExtractionGap(gap domain.Gap) error {
+	return interactor.removeGap(ExtractionMemoKey, gap)
+}
+
+// GetInboundCursor returns the latest driver wallet transaction looked through for the messages returned to the
+// driver wallet.
+func (interactor *MemoInteractor) GetInboundCursor() (domain.Cursor, error) {
+	return interactor.getCursor(InboundMemoKey)
+}
+
+func (interactor *MemoInteractor) SetInboundCursor(cursor domain.Cursor) error {
+	return interactor.setCursor(InboundMemoKey, cursor)
+}
+
+// AddInboundGap keeps a gap found in the driver wallet transactions, so the bounces and excesses in it can be
+// back-filled later.
+func (interactor *MemoInteractor) AddInboundGap(gap domain.Gap) error {
+	return interactor.addGap(InboundMemoKey, gap)
+}
+
+func (interactor *MemoInteractor) GetInboundGaps() ([]domain.Gap, error) {
+	memo, err := interactor.getMemo(InboundMemoKey)
+	if err != nil {
+		return nil, err
+	}
+	return memo.Gaps, nil
+}
+
+// RemoveInboundGap forgets a gap found in the driver wallet transactions, once it's back-filled.
+func (interactor *MemoInteractor) RemoveInboundGap(gap domain.Gap) error {
+	return interactor.removeGap(InboundMemoKey, gap)
+}
+
+func (interactor *MemoInteractor) getCursor(key string) (domain.Cursor, error) {
+	memo, err := interactor.getMemo(key)
+	if err != nil {
+		return domain.Cursor{}, err
+	}
+	return domain.Cursor{Lt: memo.LatestProcessedLt, Hash: memo.LatestProcessedHash}, nil
+}
+
+func (interactor *MemoInteractor) setCursor(key string, cursor domain.Cursor) error {
+	memo, err := interactor.getMemo(key)
+	if err != nil {
+		return err
+	}
+
+	memo.LatestProcessedLt = cursor.Lt
+	memo.LatestProcessedHash = cursor.Hash
+	_, err = interactor.memoRepository.Upsert(key, memo)
+	return err
 }
 
-func (interactor *MemoInteractor) SetLatestProcessedHash(hash string) error {
-	memo, err := interactor.memoRepository.Find(ExtractionMemoKey)
+func (interactor *MemoInteractor) addGap(key string, gap domain.Gap) error {
+	memo, err := interactor.getMemo(key)
 	if err != nil {
 		return err
 	}
 
+	memo.Gaps = append(memo.Gaps, gap)
+	if len(memo.Gaps) > maxGaps {
+		memo.Gaps = memo.Gaps[len(memo.Gaps)-maxGaps:]
+	}
+	_, err = interactor.memoRepository.Upsert(key, memo)
+	return err
+}
+
+func (interactor *MemoInteractor) removeGap(key string, gap domain.Gap) error {
+	memo, err := interactor.getMemo(key)
+	if err != nil {
+		return err
+	}
+
+	gaps := make([]domain.Gap, 0, len(memo.Gaps))
+	for _, g := range memo.Gaps {
+		if g.FromLt != gap.FromLt || g.ToLt != gap.ToLt {
+			gaps = append(gaps, g)
+		}
+	}
+	memo.Gaps = gaps
+	_, err = interactor.memoRepository.Upsert(key, memo)
+	return err
+}
+
+func (interactor *MemoInteractor) getMemo(key string) (*domain.ExtractionMemo, error) {
+	memo, err := interactor.memoRepository.Find(key)
+	if err != nil {
+		return nil, err
+	}
+
 	var extractionMemo domain.ExtractionMemo
 	if memo != nil {
 		extractionMemo.FromJson(memo.Memo)
 	}
-	extractionMemo.LatestProcessedHash = hash
-	_, err = interactor.memoRepository.Upsert(ExtractionMemoKey, &extractionMemo)
-	return err
+	return &extractionMemo, nil
 }
@@ -3,123 +3,427 @@ package usecase
 import (
 	"context"
 	"driver/domain"
+	"driver/domain/model"
+	"driver/interface/exporter"
+	"errors"
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
-	"github.com/tonkeeper/tongo/liteapi"
+	"github.com/tonkeeper/tongo/tlb"
 	tgwallet "github.com/tonkeeper/tongo/wallet"
 )
 
-var ErrorTimeOut = fmt.Errorf("timeout for new seqno")
+const (
+	// batchWindow is how long the messenger waits for more messages to fill a transfer.
+	batchWindow = 1 * time.Second
+
+	// outboxPollInterval is how often the outbox is checked when no new message is notified, and how long the
+	// messenger backs off after failing to send.
+	outboxPollInterval = 5 * time.Second
+
+	// lowBalancePollInterval is how long the messenger backs off while the driver wallet balance is below the reserve.
+	lowBalancePollInterval = outboxPollInterval
+
+	// spendLockPollInterval is how long the messenger backs off while the driver wallet is locked for hitting a
+	// spend cap.
+	spendLockPollInterval = 1 * time.Minute
+)
+
+var (
+	ErrorTimeOut = fmt.Errorf("timeout for confirming the transfer")
+)
 
 type Response struct {
-	reference string
-	ok        bool
-	err       error
+	reference   string
+	messageHash string
+	cost        tlb.Grams
+	ok          bool
+	err         error
+	exitCode    *int32
 
 	StakeRequest   *domain.StakeRequest
 	UnstakeRequest *domain.UnstakeRequest
 }
 
 type MessengerInteractor struct {
-	client       *liteapi.Client
-	driverWallet *tgwallet.Wallet
-	listenerCh   chan domain.MessagePack
-	stakeCh      chan Response
-	unstakeCh    chan Response
+	client            ChainClient
+	driverWallet      DriverWallet
+	outboxInteractor  *OutboxInteractor
+	emulator          Emulator
+	spendInteractor   *SpendInteractor
+	balanceInteractor *BalanceInteractor
+	stakeCh           chan Response
+	unstakeCh         chan Response
 }
 
-func NewMessengerInteractor(client *liteapi.Client,
-	driverWallet *tgwallet.Wallet,
-	listenerCh chan domain.MessagePack,
+func NewMessengerInteractor(client ChainClient,
+	driverWallet DriverWallet,
+	outboxInteractor *OutboxInteractor,
+	emulator Emulator,
+	spendInteractor *SpendInteractor,
+	balanceInteractor *BalanceInteractor,
 	stakeCh chan Response,
 	unstakeCh chan Response) *MessengerInteractor {
 	interactor := &MessengerInteractor{
-		client:       client,
-		driverWallet: driverWallet,
-		listenerCh:   listenerCh,
-		stakeCh:      stakeCh,
-		unstakeCh:    unstakeCh,
+		client:            client,
+		driverWallet:      driverWallet,
+		outboxInteractor:  outboxInteractor,
+		emulator:          emulator,
+		spendInteractor:   spendInteractor,
+		balanceInteractor: balanceInteractor,
+		stakeCh:           stakeCh,
+		unstakeCh:         unstakeCh,
 	}
 	return interactor
 }
 
-func (interactor *MessengerInteractor) ListenOnChannel() error {
+// ListenOnOutbox sends the pending messages of the outbox, until the outbox is closed. Pending messages are
+// grouped, so up to the wallet's maximum of them are sent by a single transfer, and the transfer is recorded
+// before being sent. Transfers are traced in the background, so the next one can be sent if the wallet allows.
+// Transfers left unconfirmed by a previous run are traced first. Once the outbox is closed, the remaining
+// pending messages are left for the next run. The response channels are closed at the end, so the listeners
+// know no more response is coming.
+func (interactor *MessengerInteractor) ListenOnOutbox(ctx context.Context) error {
+	var transfers sync.WaitGroup
+	defer close(interactor.stakeCh)
+	defer close(interactor.unstakeCh)
+	defer transfers.Wait()
 
-	var err error = nil
-	var seqno uint32 = 0
+	slots := make(chan struct{}, interactor.driverWallet.MaxInFlight())
 
-	// @TODO: implement a way to end the loop and close the channel
-	for {
-		msg := <-interactor.listenerCh
-		if msg.Reference == "-close-" {
+	for _, batch := range groupByTransfer(interactor.outboxInteractor.LoadSending()) {
+		if !interactor.acquire(ctx, slots) {
+			return nil
+		}
+
+		transfer := &Transfer{
+			Id:         *batch[0].TransferId,
+			Hash:       *batch[0].TransferHash,
+			ValidUntil: *batch[0].ValidUntil,
+		}
+		transfers.Add(1)
+		go interactor.wait(ctx, slots, &transfers, transfer, batch)
+	}
+
+	for interactor.acquire(ctx, slots) {
+		batch := interactor.nextBatch(ctx)
+		if len(batch) == 0 {
 			break
 		}
 
-		// Get the current sequence number
-		driverAccountId := interactor.driverWallet.GetAddress()
-		seqno, err = interactor.client.GetSeqno(context.Background(), driverAccountId)
+		transfer, batch, err := interactor.send(ctx, batch)
+		if errors.Is(err, ErrorSpendLocked) {
+			<-slots
+			interactor.backOff(ctx, spendLockPollInterval)
+			continue
+		}
+		if errors.Is(err, ErrorBalanceLow) {
+			<-slots
+			interactor.backOff(ctx, lowBalancePollInterval)
+			continue
+		}
 		if err != nil {
-			log.Printf("🔴 getting current driver's seqno - %v\n", err.Error())
+			<-slots
+			interactor.backOff(ctx, outboxPollInterval)
+			continue
+		}
+		if transfer == nil {
+			// All messages of the batch are rejected by the emulation, so nothing is sent.
+			<-slots
+			continue
+		}
+
+		transfers.Add(1)
+		go interactor.wait(ctx, slots, &transfers, transfer, batch)
+	}
+
+	return nil
+}
+
+// acquire takes a slot for a transfer. It returns false if the outbox is closed.
+func (interactor *MessengerInteractor) acquire(ctx context.Context, slots chan struct{}) bool {
+	select {
+	case slots <- struct{}{}:
+		return true
+	case <-interactor.outboxInteractor.Closed():
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (interactor *MessengerInteractor) backOff(ctx context.Context, duration time.Duration) {
+	select {
+	case <-time.After(duration):
+	case <-interactor.outboxInteractor.Closed():
+	case <-ctx.Done():
+	}
+}
+
+// nextBatch waits for pending messages, then gives more messages a short window to be queued, up to the
+// wallet's maximum in total. An empty batch means the outbox is closed.
+func (interactor *MessengerInteractor) nextBatch(ctx context.Context) []*domain.OutboxMessage {
+	max := interactor.driverWallet.MaxMessages()
+	waited := false
+
+	for {
+		batch := interactor.outboxInteractor.LoadPending(max)
+		if len(batch) == max || (len(batch) > 0 && waited) {
+			return batch
+		}
+
+		wait := time.After(outboxPollInterval)
+		notify := interactor.outboxInteractor.Notify()
+		if len(batch) > 0 {
+			waited = true
+			wait = time.After(batchWindow)
+			notify = nil
 		}
 
-		// Send a message and wait for the sequence number to increase
-		err = interactor.driverWallet.Send(context.Background(), msg.Message.MakeMessage())
+		select {
+		case <-wait:
+		case <-notify:
+		case <-interactor.outboxInteractor.Closed():
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// send records the batch as being sent by a new transfer, then sends the transfer. Once the transfer is
+// recorded, a failure in sending is left to be found out by waiting on it. If an emulator is given, the transfer
+// is emulated first, and the messages which would be rejected are left out of it. The messages actually carried
+// by the transfer are returned along with it, and no transfer is returned if all of them are left out. Nothing is
+// sent while the driver wallet is locked for hitting a spend cap, or if the transfer would make it hit one. Nor is
+// anything sent while the balance of the driver wallet is below the reserve, so the messages stay pending until it's
+// funded again.
+func (interactor *MessengerInteractor) send(ctx context.Context, batch []*domain.OutboxMessage) (*Transfer, []*domain.OutboxMessage, error) {
+	err := interactor.spendInteractor.Check()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if interactor.balanceInteractor.IsLow() {
+		log.Printf("❗️ driver wallet balance is below the reserve, %v messages are left in the outbox\n", len(batch))
+		return nil, nil, ErrorBalanceLow
+	}
+
+	transfer, err := interactor.prepare(ctx, batch)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if interactor.emulator != nil {
+		accepted, err := interactor.emulate(ctx, batch, transfer)
 		if err != nil {
-			log.Printf("🔴 sending message [reference: %v] - %v\n", msg.Reference, err.Error())
-		} else {
-			_, err = interactor.waitForNextSeqno(seqno)
+			return nil, nil, err
+		}
+		if len(accepted) == 0 {
+			return nil, nil, nil
+		}
+		if len(accepted) < len(batch) {
+			batch = accepted
+			transfer, err = interactor.prepare(ctx, batch)
 			if err != nil {
-				log.Printf("🔴 timed out for getting next seqno [seqno: %v] - %v\n", seqno, err.Error())
-				continue
+				return nil, nil, err
 			}
 		}
+	}
 
-		response := Response{
-			reference: msg.Reference,
-			ok:        err == nil,
-			err:       err,
+	err = interactor.spend(batch, transfer)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	references := outboxReferences(batch)
+	err = interactor.outboxInteractor.SetSending(batch, transfer)
+	if err != nil {
+		exporter.IncErrorCount()
+		log.Printf("🔴 recording transfer [references: %v] - %v\n", references, err.Error())
+		return nil, nil, err
+	}
+
+	err = interactor.driverWallet.Send(ctx, transfer)
+	if err != nil {
+		exporter.IncErrorCount()
+		log.Printf("🔴 sending transfer [references: %v] - %v\n", references, err.Error())
+	}
+
+	return transfer, batch, nil
+}
 
-			StakeRequest:   msg.StakeRequest,
-			UnstakeRequest: msg.UnstakeRequest,
+// prepare builds and signs a transfer of the batch, without sending it.
+func (interactor *MessengerInteractor) prepare(ctx context.Context, batch []*domain.OutboxMessage) (*Transfer, error) {
+	references := make([]string, 0, len(batch))
+	messages := make([]tgwallet.RawMessage, 0, len(batch))
+	for _, msg := range batch {
+		raw, err := interactor.outboxInteractor.RawMessage(msg)
+		if err != nil {
+			// The message can never be sent, so give it up and let the request be tried again.
+			exporter.IncErrorCount()
+			log.Printf("🔴 decoding outbox message [reference: %v] - %v\n", msg.Reference, err.Error())
+			interactor.outboxInteractor.SetFailed([]*domain.OutboxMessage{msg})
+			interactor.respond(msg, nil, err)
+			return nil, err
 		}
+		references = append(references, msg.Reference)
+		messages = append(messages, raw)
+	}
 
-		if msg.StakeRequest != nil {
-			// The message is a stake request, so send the response to stake response channel
-			interactor.stakeCh <- response
-		} else if msg.UnstakeRequest != nil {
-			// The message is an unstake request, so send the response to unstake response channel
-			interactor.unstakeCh <- response
-		} else {
-			// Oops! neither of request objects is provided
-			log.Printf("🔴 sending response - unknown request source! [reference: %v]\n", msg.Reference)
+	transfer, err := interactor.driverWallet.Prepare(ctx, messages)
+	if err != nil {
+		exporter.IncErrorCount()
+		log.Printf("🔴 preparing transfer [references: %v] - %v\n", references, err.Error())
+		return nil, err
+	}
+
+	return transfer, nil
+}
+
+// spend records the coins attached to the messages of the transfer against the spend caps. A transfer put back in
+// the queue after expiring is counted again when sent, which only errs on the safe side.
+func (interactor *MessengerInteractor) spend(batch []*domain.OutboxMessage, transfer *Transfer) error {
+	amount := tlb.Grams(0)
+	for _, msg := range batch {
+		value, err := interactor.outboxInteractor.Value(msg)
+		if err != nil {
+			exporter.IncErrorCount()
+			log.Printf("🔴 reading value of outbox message [reference: %v] - %v\n", msg.Reference, err.Error())
+			return err
 		}
+		amount += value
 	}
 
-	return nil
+	return interactor.spendInteractor.Spend(transfer.Id, amount)
 }
 
-func (interactor *MessengerInteractor) waitForNextSeqno(seqno uint32) (uint32, error) {
-	driverAccountId := interactor.driverWallet.GetAddress()
+// wait traces the transfer and records its result. Messages of an expired transfer are put back in the queue.
+// If the result is not known, the messages are left as being sent, to be traced again by the next run.
+func (interactor *MessengerInteractor) wait(ctx context.Context, slots chan struct{}, transfers *sync.WaitGroup, transfer *Transfer, batch []*domain.OutboxMessage) {
+	defer transfers.Done()
+	defer func() { <-slots }()
+
+	trans, err := interactor.trace(ctx, transfer)
+	switch {
+	case err == nil:
+		interactor.record(trans, batch)
 
-	err := ErrorTimeOut
-	currSeqno := seqno
+	case errors.Is(err, ErrorTransferExpired):
+		log.Printf("🔵 transfer %v expired, queueing its %v messages again\n", transfer.Id, len(batch))
+		interactor.outboxInteractor.SetPending(batch)
 
-	timeout := time.Now().Add(30 * time.Second)
-	for time.Now().Before(timeout) {
-		var inErr error
-		currSeqno, inErr = interactor.client.GetSeqno(context.Background(), driverAccountId)
-		if inErr != nil {
-			log.Printf("🔴 getting current driver's seqno - %v\n", inErr.Error())
+	default:
+		log.Printf("🔴 confirming transfer %v - %v\n", transfer.Id, err.Error())
+	}
+}
+
+// record checks the phases of the transaction which processed a transfer, and finds out which messages of the
+// transfer are actually sent by it.
+func (interactor *MessengerInteractor) record(trans *model.HTransaction, batch []*domain.OutboxMessage) {
+	if !trans.IsComputeSucceeded() || !trans.IsSucceeded() {
+		exporter.IncErrorCount()
+		log.Printf("🔴 driver wallet transaction %v - compute or action phase failed\n", trans.Formatter().Hash())
+		interactor.outboxInteractor.SetFailed(batch)
+		for _, msg := range batch {
+			interactor.respond(msg, nil, ErrorTransferFailed)
 		}
+		return
+	}
 
-		if currSeqno > seqno {
-			err = nil
-			break
+	outMsgs := sentMessages(trans, batch)
+
+	sent := make([]*domain.OutboxMessage, 0, len(batch))
+	failed := make([]*domain.OutboxMessage, 0)
+	for i, msg := range batch {
+		if outMsgs[i] == nil {
+			failed = append(failed, msg)
+		} else {
+			sent = append(sent, msg)
+		}
+	}
+	if len(sent) > 0 {
+		interactor.outboxInteractor.SetSent(sent)
+	}
+	if len(failed) > 0 {
+		interactor.outboxInteractor.SetFailed(failed)
+	}
+
+	for i, msg := range batch {
+		if outMsgs[i] == nil {
+			exporter.IncErrorCount()
+			interactor.respond(msg, nil, ErrorMessageNotSent)
+		} else {
+			interactor.respond(msg, outMsgs[i], nil)
 		}
-		time.Sleep(500 * time.Millisecond)
 	}
+}
+
+// respond sends the result of an outbox message to its listener. The out-message sent for it tells the hash of the
+// message and what it cost the driver wallet, i.e. its value and the fees paid for forwarding it.
+func (interactor *MessengerInteractor) respond(msg *domain.OutboxMessage, outMsg *model.HMessage, err error) {
+	response := Response{
+		reference: msg.Reference,
+		ok:        err == nil,
+		err:       err,
+	}
+	if outMsg != nil {
+		response.messageHash = outMsg.Hash().Hex()
+		response.cost = outMsg.Value() + outMsg.FwdFee() + outMsg.IhrFee()
+	}
+	interactor.respondWith(msg, response)
+}
 
-	return currSeqno, err
+// respondWith sends the response to the listener of the outbox message's kind.
+func (interactor *MessengerInteractor) respondWith(msg *domain.OutboxMessage, response Response) {
+	switch msg.Kind {
+	case domain.OutboxKindStake:
+		// The message is a stake request, so send the response to stake response channel
+		hash, msgIndex, err := domain.ParseStakeReference(msg.Reference)
+		if err != nil {
+			exporter.IncErrorCount()
+			log.Printf("🔴 sending response [reference: %v] - %v\n", msg.Reference, err.Error())
+			return
+		}
+		response.StakeRequest = &domain.StakeRequest{Address: msg.Destination, Hash: hash, MsgIndex: msgIndex}
+		interactor.stakeCh <- response
+	case domain.OutboxKindUnstake:
+		// The message is an unstake request, so send the response to unstake response channel
+		response.UnstakeRequest = &domain.UnstakeRequest{Address: msg.Destination, Hash: msg.Reference}
+		interactor.unstakeCh <- response
+	default:
+		// Oops! neither of request kinds is provided
+		log.Printf("🔴 sending response - unknown request source! [reference: %v]\n", msg.Reference)
+	}
+}
+
+func outboxReferences(messages []*domain.OutboxMessage) []string {
+	references := make([]string, 0, len(messages))
+	for _, msg := range messages {
+		references = append(references, msg.Reference)
+	}
+	return references
+}
+
+// groupByTransfer splits the messages being sent by the transfers carrying them, in the order of the transfers.
+func groupByTransfer(messages []*domain.OutboxMessage) [][]*domain.OutboxMessage {
+	groups := make([][]*domain.OutboxMessage, 0)
+	index := make(map[uint64]int)
+	for _, msg := range messages {
+		if msg.TransferId == nil || msg.TransferHash == nil || msg.ValidUntil == nil {
+			// The transfer can't be traced, so leave it to be checked by hand.
+			log.Printf("🔴 resuming transfer - untraceable message [reference: %v]\n", msg.Reference)
+			continue
+		}
+		i, exist := index[*msg.TransferId]
+		if !exist {
+			i = len(groups)
+			index[*msg.TransferId] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], msg)
+	}
+	return groups
 }
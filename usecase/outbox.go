@@ -0,0 +1,227 @@
+package usecase
+
+import (
+	"driver/domain"
+	"driver/domain/config"
+	"driver/domain/model"
+	"driver/interface/exporter"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/tonkeeper/tongo/boc"
+	"github.com/tonkeeper/tongo/tlb"
+	tgwallet "github.com/tonkeeper/tongo/wallet"
+)
+
+var (
+	ErrorUnknownRequest = fmt.Errorf("neither stake nor unstake request is provided")
+)
+
+// OutboxInteractor keeps the messages of the driver wallet in the outbox, so a message that is queued is sent
+// even if the driver stops before sending it, and a message that is sent is never sent again.
+type OutboxInteractor struct {
+	outboxRepository OutboxRepository
+
+	notifyCh  chan struct{}
+	closeCh   chan struct{}
+	closeOnce sync.Once
+}
+
+func NewOutboxInteractor(outboxRepository OutboxRepository) *OutboxInteractor {
+	interactor := &OutboxInteractor{
+		outboxRepository: outboxRepository,
+		notifyCh:         make(chan struct{}, 1),
+		closeCh:          make(chan struct{}),
+	}
+	return interactor
+}
+
+// Enqueue serializes the message and stores it as pending. It returns false if a message for the same
+// reference is already pending or being sent.
+func (interactor *OutboxInteractor) Enqueue(mp domain.MessagePack) (bool, error) {
+	kind := domain.OutboxKindStake
+	if mp.StakeRequest == nil {
+		if mp.UnstakeRequest == nil {
+			return false, ErrorUnknownRequest
+		}
+		kind = domain.OutboxKindUnstake
+	}
+
+	wmsg := mp.Message.MakeMessage()
+	intMsg, mode, err := wmsg.ToInternal()
+	if err != nil {
+		return false, err
+	}
+	cell := boc.NewCell()
+	err = tlb.Marshal(cell, intMsg)
+	if err != nil {
+		return false, err
+	}
+	message, err := cell.ToBocBase64()
+	if err != nil {
+		return false, err
+	}
+
+	inserted, err := interactor.outboxRepository.Enqueue(&domain.OutboxMessage{
+		Reference:   mp.Reference,
+		Kind:        kind,
+		Destination: wmsg.Address.ToHuman(true, config.IsTestNet()),
+		QueryId:     mp.Message.QueryId(),
+		Message:     message,
+		Mode:        mode,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if inserted {
+		select {
+		case interactor.notifyCh <- struct{}{}:
+		default:
+		}
+	}
+	return inserted, nil
+}
+
+// IsQueued reports whether a message for the reference is pending or being sent. If it cannot be known, the
+// message is assumed to be queued, so it's not queued twice.
+func (interactor *OutboxInteractor) IsQueued(reference string) bool {
+	msg, err := interactor.outboxRepository.FindActive(reference)
+	if err != nil {
+		exporter.IncErrorCount()
+		log.Printf("🔴 finding outbox message [reference: %v] - %v\n", reference, err.Error())
+		return true
+	}
+	return msg != nil
+}
+
+func (interactor *OutboxInteractor) LoadPending(limit int) []*domain.OutboxMessage {
+	messages, err := interactor.outboxRepository.FindAllPending(limit)
+	if err != nil {
+		exporter.IncErrorCount()
+		log.Printf("🔴 loading pending outbox messages - %v\n", err.Error())
+		return nil
+	}
+	return messages
+}
+
+func (interactor *OutboxInteractor) LoadSending() []*domain.OutboxMessage {
+	messages, err := interactor.outboxRepository.FindAllSending()
+	if err != nil {
+		exporter.IncErrorCount()
+		log.Printf("🔴 loading sending outbox messages - %v\n", err.Error())
+		return nil
+	}
+	return messages
+}
+
+// FindSent returns the latest message sent to the destination with the query id, or nil if there is none.
+func (interactor *OutboxInteractor) FindSent(destination string, queryId uint64) (*domain.OutboxMessage, error) {
+	return interactor.outboxRepository.FindSent(destination, queryId)
+}
+
+// FindByQueryId returns the message carrying the query id, or nil if there is none. Each message gets its own query
+// id, so the messages of every attempt of a request can be found by it.
+func (interactor *OutboxInteractor) FindByQueryId(queryId uint64) (*domain.OutboxMessage, error) {
+	return interactor.outboxRepository.FindByQueryId(queryId)
+}
+
+// RawMessage decodes the internal message kept for an outbox message.
+func (interactor *OutboxInteractor) RawMessage(msg *domain.OutboxMessage) (tgwallet.RawMessage, error) {
+	cell, err := boc.DeserializeSinglRootBase64(msg.Message)
+	if err != nil {
+		return tgwallet.RawMessage{}, err
+	}
+	return tgwallet.RawMessage{Message: cell, Mode: msg.Mode}, nil
+}
+
+// Value returns the coins attached to the internal message kept for an outbox message.
+func (interactor *OutboxInteractor) Value(msg *domain.OutboxMessage) (tlb.Grams, error) {
+	cell, err := boc.DeserializeSinglRootBase64(msg.Message)
+	if err != nil {
+		return 0, err
+	}
+
+	var message tlb.Message
+	err = tlb.Unmarshal(cell, &message)
+	if err != nil {
+		return 0, err
+	}
+	return model.NewHMessage(&message).Value(), nil
+}
+
+// SetSending records the transfer carrying the messages. It must be done before the transfer is sent.
+func (interactor *OutboxInteractor) SetSending(messages []*domain.OutboxMessage, transfer *Transfer) error {
+	return interactor.outboxRepository.SetSending(outboxIds(messages), transfer.Id, transfer.Hash, transfer.ValidUntil)
+}
+
+func (interactor *OutboxInteractor) SetSent(messages []*domain.OutboxMessage) {
+	err := interactor.outboxRepository.SetSent(outboxIds(messages), time.Now())
+	if err != nil {
+		exporter.IncErrorCount()
+		log.Printf("🔴 setting outbox messages sent - %v\n", err.Error())
+	}
+}
+
+// SetPending puts the messages back in the queue, as their transfer is never going to be processed.
+func (interactor *OutboxInteractor) SetPending(messages []*domain.OutboxMessage) {
+	err := interactor.outboxRepository.SetState(outboxIds(messages), domain.OutboxStatePending)
+	if err != nil {
+		exporter.IncErrorCount()
+		log.Printf("🔴 setting outbox messages pending - %v\n", err.Error())
+		return
+	}
+
+	select {
+	case interactor.notifyCh <- struct{}{}:
+	default:
+	}
+}
+
+func (interactor *OutboxInteractor) SetFailed(messages []*domain.OutboxMessage) {
+	err := interactor.outboxRepository.SetState(outboxIds(messages), domain.OutboxStateFailed)
+	if err != nil {
+		exporter.IncErrorCount()
+		log.Printf("🔴 setting outbox messages failed - %v\n", err.Error())
+	}
+}
+
+// SetRejected gives up the messages, as their emulation shows their destinations reject them.
+func (interactor *OutboxInteractor) SetRejected(messages []*domain.OutboxMessage) {
+	err := interactor.outboxRepository.SetState(outboxIds(messages), domain.OutboxStateRejected)
+	if err != nil {
+		exporter.IncErrorCount()
+		log.Printf("🔴 setting outbox messages rejected - %v\n", err.Error())
+	}
+}
+
+func (interactor *OutboxInteractor) SetBounced(msg *domain.OutboxMessage) error {
+	return interactor.outboxRepository.SetState([]int64{msg.Id}, domain.OutboxStateBounced)
+}
+
+// Notify receives a value when new messages are pending.
+func (interactor *OutboxInteractor) Notify() <-chan struct{} {
+	return interactor.notifyCh
+}
+
+// Close tells the messenger to stop picking pending messages. They are kept for the next run.
+func (interactor *OutboxInteractor) Close() {
+	interactor.closeOnce.Do(func() {
+		close(interactor.closeCh)
+	})
+}
+
+// Closed is closed when the outbox is closed.
+func (interactor *OutboxInteractor) Closed() <-chan struct{} {
+	return interactor.closeCh
+}
+
+func outboxIds(messages []*domain.OutboxMessage) []int64 {
+	ids := make([]int64, 0, len(messages))
+	for _, msg := range messages {
+		ids = append(ids, msg.Id)
+	}
+	return ids
+}
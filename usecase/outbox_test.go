@@ -0,0 +1,99 @@
+package usecase_test
+
+import (
+	"context"
+	"driver/domain"
+	"driver/interface/repository"
+	"driver/usecase"
+	"testing"
+	"time"
+)
+
+// restart wires new stake, unstake, outbox and messenger interactors on the repositories of the test environment,
+// the way the start command does on a new run, and sends the outbox messages until the returned function is called.
+func (env *testEnv) restart(t *testing.T) (stop func()) {
+	contractInteractor := usecase.NewContractInteractor(env.sim)
+	queryIdRepository := repository.NewMemoryQueryIdRepository()
+	stakeInteractor := usecase.NewStakeInteractor(env.sim, env.memoInteractor, contractInteractor, env.feeInteractor, env.stakeRepository, queryIdRepository, &env.driverWallet)
+	unstakeInteractor := usecase.NewUnstakeInteractor(env.sim, env.memoInteractor, contractInteractor, env.feeInteractor, env.unstakeRepository, queryIdRepository, &env.driverWallet)
+
+	outboxInteractor := usecase.NewOutboxInteractor(env.outboxRepository)
+	stakeCh := stakeInteractor.InitializeChannel(outboxInteractor)
+	unstakeCh := unstakeInteractor.InitializeChannel(outboxInteractor)
+	spendInteractor := usecase.NewSpendInteractor(repository.NewMemorySpendRepository())
+	messengerInteractor := usecase.NewMessengerInteractor(env.sim, env.messengerWallet, outboxInteractor, nil, spendInteractor, env.balanceInteractor, stakeCh, unstakeCh)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		messengerInteractor.ListenOnOutbox(ctx)
+	}()
+	stop = func() {
+		outboxInteractor.Close()
+		cancel()
+		<-done
+	}
+	t.Cleanup(stop)
+	return stop
+}
+
+// TestOutboxSurvivesRestart checks that a message queued by a run which stops before sending it is sent by the
+// next run, and by none after.
+func TestOutboxSurvivesRestart(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	env.sim.StartRound(100)
+
+	env.deposit(t, 0, 1)
+	result, err := env.extractInteractor.Extract(ctx, env.treasury)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.extractInteractor.Store(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.sim.FinishRound(100)
+
+	// The first run queues the message and is dropped before its messenger picks it up.
+	requests, err := env.stakeInteractor.LoadTriable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.stakeInteractor.SendStakeMessageToJettonWallets(ctx, requests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.outboxInteractor.Close()
+	if pending := env.outboxInteractor.LoadPending(10); len(pending) != 1 {
+		t.Fatalf("%v messages are pending after the run is dropped, want the queued one", len(pending))
+	}
+
+	// The next run sends it.
+	stop := env.restart(t)
+	request := requests[0]
+	waitFor(t, "stake "+request.Reference(), func() bool {
+		return env.stakeState(t, request.Hash, request.MsgIndex) == domain.RequestStateSent
+	})
+	stop()
+
+	// The run after finds nothing left to send.
+	env.restart(t)
+	time.Sleep(3 * time.Second)
+
+	walletId := testAccount(3, 0)
+	trans, err := env.sim.GetLastTransactions(ctx, walletId, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trans) != 1 {
+		t.Fatalf("j-wallet has %v transactions, want the message received once", len(trans))
+	}
+	if pending := env.outboxInteractor.LoadPending(10); len(pending) != 0 {
+		t.Fatalf("%v messages are pending after they are sent, want none", len(pending))
+	}
+	if state := env.sim.WalletState(walletId); len(state.Staking) != 0 {
+		t.Fatal("stake_coins is not applied")
+	}
+}
@@ -0,0 +1,88 @@
+package usecase
+
+import (
+	"driver/domain"
+	"math/big"
+	"time"
+
+	"github.com/tonkeeper/tongo/tlb"
+)
+
+// StakeRepository keeps the stake requests found by the extraction process.
+type StakeRepository interface {
+	InsertIfNotExists(address string, roundSince uint32, hash string, msgIndex int, finalMcSeqno *uint32, owner *string, info domain.StakeRelatedInfo) (*domain.StakeRequest, error)
+	Find(hash string, msgIndex int) (*domain.StakeRequest, error)
+	FindAllTriable(maxRetry int) ([]*domain.StakeRequest, error)
+	FindAllVerifiable() ([]*domain.StakeRequest, error)
+	FindByOwner(owner string) ([]*domain.StakeRequest, error)
+	SetState(hash string, msgIndex int, state string) error
+	SetRetrying(hash string, msgIndex int, timestamp time.Time) error
+	SetSent(hash string, msgIndex int, messageHash string, cost tlb.Grams, timestamp time.Time) error
+	SetVerified(hash string, msgIndex int, timestamp time.Time) error
+	AddExcess(hash string, msgIndex int, excessHash string, value tlb.Grams) error
+	SetRejected(hash string, msgIndex int, exitCode int32) error
+	SetBounced(hash string, msgIndex int, exitCode *int32) error
+}
+
+// UnstakeRepository keeps the unstake requests found by the extraction process.
+type UnstakeRepository interface {
+	InsertIfNotExists(address string, tokens big.Int, hash string, finalMcSeqno *uint32, owner *string, info domain.UnstakeRelatedInfo) (*domain.UnstakeRequest, error)
+	Find(hash string) (*domain.UnstakeRequest, error)
+	FindAllTriable(maxRetry int) ([]*domain.UnstakeRequest, error)
+	FindAllVerifiable() ([]*domain.UnstakeRequest, error)
+	FindByOwner(owner string) ([]*domain.UnstakeRequest, error)
+	SetState(hash string, state string) error
+	SetRetrying(hash string, timestamp time.Time) error
+	SetSent(hash string, messageHash string, cost tlb.Grams, timestamp time.Time) error
+	SetVerified(hash string, timestamp time.Time) error
+	AddExcess(hash string, excessHash string, value tlb.Grams) error
+	SetRejected(hash string, exitCode int32) error
+	SetBounced(hash string, exitCode *int32) error
+}
+
+// MemoRepository keeps the notes the driver processes leave for their next turn.
+type MemoRepository interface {
+	Upsert(key string, memo domain.Memorable) (*domain.Memo, error)
+	Find(key string) (*domain.Memo, error)
+}
+
+// OutboxRepository keeps the messages of the driver wallet from being queued until they are sent.
+type OutboxRepository interface {
+	Enqueue(msg *domain.OutboxMessage) (bool, error)
+	FindActive(reference string) (*domain.OutboxMessage, error)
+	FindAllPending(limit int) ([]*domain.OutboxMessage, error)
+	FindAllSending() ([]*domain.OutboxMessage, error)
+	FindSent(destination string, queryId uint64) (*domain.OutboxMessage, error)
+	FindByQueryId(queryId uint64) (*domain.OutboxMessage, error)
+	SetSending(ids []int64, transferId uint64, transferHash string, validUntil time.Time) error
+	SetSent(ids []int64, timestamp time.Time) error
+	SetState(ids []int64, state string) error
+}
+
+// QueryIdRepository allocates the query ids of the messages sent by the driver.
+type QueryIdRepository interface {
+	Next() (uint64, error)
+}
+
+// SpendRepository keeps what the driver wallet spends, and the locks put on it once a spend cap is hit.
+type SpendRepository interface {
+	Record(transferId uint64, amount tlb.Grams, timestamp time.Time) error
+	Sum(since time.Time) (tlb.Grams, error)
+	Lock(period string, spent tlb.Grams, limit tlb.Grams, timestamp time.Time) error
+	FindLatestLock() (*domain.SpendLock, error)
+	Lift(timestamp time.Time) ([]*domain.SpendLock, error)
+}
+
+// EventRepository keeps every treasury transaction, decoded, for auditing.
+type EventRepository interface {
+	InsertAll(events []domain.Event) error
+	Find(hash string) (*domain.Event, error)
+}
+
+// FailureRepository keeps the deposits and unstakes the treasury failed to process.
+type FailureRepository interface {
+	InsertAll(requests []domain.FailedRequest) error
+	Find(hash string) (*domain.FailedRequest, error)
+	FindAll(since time.Time, limit int) ([]*domain.FailedRequest, error)
+	FindBySender(sender string, limit int) ([]*domain.FailedRequest, error)
+}
@@ -0,0 +1,31 @@
+package usecase
+
+import (
+	"driver/domain"
+)
+
+// RequestInteractor looks up the stored stake and unstake requests, e.g. to answer a user asking after their coins.
+type RequestInteractor struct {
+	stakeRepository   StakeRepository
+	unstakeRepository UnstakeRepository
+}
+
+func NewRequestInteractor(stakeRepository StakeRepository, unstakeRepository UnstakeRepository) *RequestInteractor {
+	return &RequestInteractor{
+		stakeRepository:   stakeRepository,
+		unstakeRepository: unstakeRepository,
+	}
+}
+
+// FindByOwner returns the stake and unstake requests of the user's wallet, the oldest first.
+func (interactor *RequestInteractor) FindByOwner(owner string) ([]*domain.StakeRequest, []*domain.UnstakeRequest, error) {
+	stakes, err := interactor.stakeRepository.FindByOwner(owner)
+	if err != nil {
+		return nil, nil, err
+	}
+	unstakes, err := interactor.unstakeRepository.FindByOwner(owner)
+	if err != nil {
+		return nil, nil, err
+	}
+	return stakes, unstakes, nil
+}
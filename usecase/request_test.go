@@ -0,0 +1,53 @@
+package usecase_test
+
+import (
+	"context"
+	"driver/domain/config"
+	"math/big"
+	"testing"
+)
+
+func TestFindByOwner(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	env.sim.StartRound(100)
+
+	env.deposit(t, 0, 2)
+	env.sim.FinishRound(100)
+	_, err := env.sim.Unstake(testAccount(3, 0), big.NewInt(1_000_000_000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.sim.SealMasterchainBlock()
+
+	result, err := env.extractInteractor.Extract(ctx, env.treasury)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.extractInteractor.Store(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	owner := testAccount(2, 0).ToHuman(true, config.IsTestNet())
+	wallet := testAccount(3, 0).ToHuman(true, config.IsTestNet())
+	stakes, unstakes, err := env.requestInteractor.FindByOwner(owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stakes) != 1 || stakes[0].Address != wallet || stakes[0].Owner == nil || *stakes[0].Owner != owner {
+		t.Fatalf("found %v stakes of the owner, want the deposit to %v", len(stakes), wallet)
+	}
+	if len(unstakes) != 1 || unstakes[0].Address != wallet || unstakes[0].Owner == nil || *unstakes[0].Owner != owner {
+		t.Fatalf("found %v unstakes of the owner, want the unstake of %v", len(unstakes), wallet)
+	}
+
+	// The j-wallet is not the owner.
+	stakes, unstakes, err = env.requestInteractor.FindByOwner(wallet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stakes) != 0 || len(unstakes) != 0 {
+		t.Fatalf("found %v stakes and %v unstakes by the j-wallet, want none", len(stakes), len(unstakes))
+	}
+}
@@ -0,0 +1,144 @@
+package usecase
+
+import (
+	"driver/domain"
+	"driver/domain/config"
+	"driver/interface/exporter"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/tonkeeper/tongo/tlb"
+)
+
+var (
+	ErrorSpendLocked = fmt.Errorf("driver wallet is locked for hitting a spend cap")
+)
+
+// spendCap is a ceiling on what the driver wallet sends out over a rolling period.
+type spendCap struct {
+	period   string
+	duration time.Duration
+	limit    tlb.Grams
+}
+
+// SpendInteractor keeps what the driver wallet sends out within the configured caps. Once a transfer would pass a
+// cap, the wallet is locked, and no more transfers are sent until an operator lifts the lock. After a lift, only
+// what is spent since then counts against the caps.
+type SpendInteractor struct {
+	mutex           sync.Mutex
+	spendRepository SpendRepository
+}
+
+func NewSpendInteractor(spendRepository SpendRepository) *SpendInteractor {
+	return &SpendInteractor{
+		spendRepository: spendRepository,
+	}
+}
+
+// Check returns ErrorSpendLocked, and alerts, if the driver wallet is locked.
+func (interactor *SpendInteractor) Check() error {
+	lock, err := interactor.spendRepository.FindLatestLock()
+	if err != nil {
+		exporter.IncErrorCount()
+		log.Printf("🔴 loading spend lock - %v\n", err.Error())
+		return err
+	}
+
+	if lock != nil && lock.LiftedAt == nil {
+		exporter.SetSpendLocked(true)
+		exporter.IncErrorCount()
+		log.Printf("🔴 driver wallet is locked for hitting the %v spend cap, run 'driver spend lift' to resume [spent: %v, cap: %v]\n",
+			lock.Period, lock.Spent, lock.Cap)
+		return ErrorSpendLocked
+	}
+
+	exporter.SetSpendLocked(false)
+	return nil
+}
+
+// Spend records the amount sent out by the transfer, if it's within the caps. Otherwise, the driver wallet is
+// locked, and ErrorSpendLocked is returned. Spends are checked one at a time, so two transfers can't both pass a
+// cap that only one fits in.
+func (interactor *SpendInteractor) Spend(transferId uint64, amount tlb.Grams) error {
+	interactor.mutex.Lock()
+	defer interactor.mutex.Unlock()
+
+	err := interactor.Check()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, c := range spendCaps() {
+		if c.limit == 0 {
+			continue
+		}
+
+		spent, err := interactor.Spent(c.period)
+		if err != nil {
+			exporter.IncErrorCount()
+			log.Printf("🔴 loading %v spend - %v\n", c.period, err.Error())
+			return err
+		}
+
+		if spent+amount > c.limit {
+			err = interactor.spendRepository.Lock(c.period, spent+amount, c.limit, now)
+			if err != nil {
+				exporter.IncErrorCount()
+				log.Printf("🔴 locking driver wallet for hitting the %v spend cap - %v\n", c.period, err.Error())
+				return err
+			}
+			exporter.SetSpendLocked(true)
+			exporter.IncErrorCount()
+			log.Printf("🔴 driver wallet hit the %v spend cap and is locked, run 'driver spend lift' to resume [spent: %v, transfer: %v, cap: %v]\n",
+				c.period, spent, amount, c.limit)
+			return ErrorSpendLocked
+		}
+	}
+
+	err = interactor.spendRepository.Record(transferId, amount, now)
+	if err != nil {
+		exporter.IncErrorCount()
+		log.Printf("🔴 recording spend of transfer %v - %v\n", transferId, err.Error())
+	}
+	return err
+}
+
+// Spent returns what is counted against the cap of the period, i.e. what is spent within the period, and after
+// the latest lift.
+func (interactor *SpendInteractor) Spent(period string) (tlb.Grams, error) {
+	since := time.Now()
+	for _, c := range spendCaps() {
+		if c.period == period {
+			since = since.Add(-c.duration)
+		}
+	}
+
+	lock, err := interactor.spendRepository.FindLatestLock()
+	if err != nil {
+		return 0, err
+	}
+	if lock != nil && lock.LiftedAt != nil && lock.LiftedAt.After(since) {
+		since = *lock.LiftedAt
+	}
+
+	return interactor.spendRepository.Sum(since)
+}
+
+func (interactor *SpendInteractor) FindLatestLock() (*domain.SpendLock, error) {
+	return interactor.spendRepository.FindLatestLock()
+}
+
+// Lift lifts the active lock of the driver wallet. The lifted locks are returned, none if the wallet is not locked.
+func (interactor *SpendInteractor) Lift() ([]*domain.SpendLock, error) {
+	return interactor.spendRepository.Lift(time.Now())
+}
+
+func spendCaps() []spendCap {
+	return []spendCap{
+		{period: domain.SpendPeriodHour, duration: time.Hour, limit: config.GetMaxSpendPerHour()},
+		{period: domain.SpendPeriodDay, duration: 24 * time.Hour, limit: config.GetMaxSpendPerDay()},
+	}
+}
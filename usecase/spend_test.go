@@ -0,0 +1,150 @@
+package usecase_test
+
+import (
+	"driver/domain"
+	"driver/domain/config"
+	"driver/interface/repository"
+	"driver/usecase"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tonkeeper/tongo/tlb"
+)
+
+const ton = tlb.Grams(1_000_000_000)
+
+func TestSpendCap(t *testing.T) {
+	if config.GetMaxSpendPerHour() != 1000*ton || config.GetMaxSpendPerDay() != 3000*ton {
+		t.Fatalf("caps are %v an hour and %v a day, want the test config", config.GetMaxSpendPerHour(), config.GetMaxSpendPerDay())
+	}
+	spendInteractor := usecase.NewSpendInteractor(repository.NewMemorySpendRepository())
+
+	err := spendInteractor.Spend(1, 600*ton)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = spendInteractor.Spend(2, 500*ton)
+	if !errors.Is(err, usecase.ErrorSpendLocked) {
+		t.Fatalf("spending past the hourly cap returned %v, want ErrorSpendLocked", err)
+	}
+	// Once locked, even a transfer within the cap is held.
+	err = spendInteractor.Spend(3, ton)
+	if !errors.Is(err, usecase.ErrorSpendLocked) {
+		t.Fatalf("spending on a locked wallet returned %v, want ErrorSpendLocked", err)
+	}
+
+	lock, err := spendInteractor.FindLatestLock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lock == nil || lock.Period != domain.SpendPeriodHour || lock.Spent != 1100*ton || lock.Cap != 1000*ton || lock.LiftedAt != nil {
+		t.Fatalf("locked %+v, want the hourly cap hit by 1100 TON", lock)
+	}
+	spent, err := spendInteractor.Spent(domain.SpendPeriodHour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spent != 600*ton {
+		t.Fatalf("spent %v within the hour, want only the first transfer", spent)
+	}
+
+	lifted, err := spendInteractor.Lift()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lifted) != 1 {
+		t.Fatalf("lifted %v locks, want 1", len(lifted))
+	}
+	// After the lift, only what is spent since then counts.
+	err = spendInteractor.Spend(2, 500*ton)
+	if err != nil {
+		t.Fatalf("spending after the lift returned %v", err)
+	}
+	if err = spendInteractor.Check(); err != nil {
+		t.Fatalf("checking after the lift returned %v", err)
+	}
+}
+
+func TestSpendCapWindow(t *testing.T) {
+	spendRepository := repository.NewMemorySpendRepository()
+	spendInteractor := usecase.NewSpendInteractor(spendRepository)
+	now := time.Now()
+
+	// Spends out of a window no longer count against its cap.
+	err := spendRepository.Record(1, 900*ton, now.Add(-2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = spendRepository.Record(2, 2500*ton, now.Add(-25*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = spendInteractor.Spend(3, 500*ton)
+	if err != nil {
+		t.Fatalf("spending after the hour rolled over returned %v", err)
+	}
+
+	hour, err := spendInteractor.Spent(domain.SpendPeriodHour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	day, err := spendInteractor.Spent(domain.SpendPeriodDay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hour != 500*ton || day != 1400*ton {
+		t.Fatalf("spent %v within the hour and %v within the day, want 500 and 1400 TON", hour, day)
+	}
+
+	// The hour still has room, but the day doesn't.
+	err = spendRepository.Record(4, 1500*ton, now.Add(-3*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = spendInteractor.Spend(5, 200*ton)
+	if !errors.Is(err, usecase.ErrorSpendLocked) {
+		t.Fatalf("spending past the daily cap returned %v, want ErrorSpendLocked", err)
+	}
+	lock, err := spendInteractor.FindLatestLock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lock == nil || lock.Period != domain.SpendPeriodDay || lock.Spent != 3100*ton {
+		t.Fatalf("locked %+v, want the daily cap hit by 3100 TON", lock)
+	}
+}
+
+func TestSpendCapConcurrent(t *testing.T) {
+	spendRepository := repository.NewMemorySpendRepository()
+	spendInteractor := usecase.NewSpendInteractor(spendRepository)
+
+	// Each transfer fits in the hourly cap, but not both.
+	errs := make([]error, 2)
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = spendInteractor.Spend(uint64(i+1), 600*ton)
+		}(i)
+	}
+	wg.Wait()
+
+	if (errs[0] == nil) == (errs[1] == nil) {
+		t.Fatalf("spending concurrently returned %v and %v, want one transfer through and the other locked", errs[0], errs[1])
+	}
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, usecase.ErrorSpendLocked) {
+			t.Fatalf("spending concurrently returned %v, want ErrorSpendLocked", err)
+		}
+	}
+	spent, err := spendRepository.Sum(time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spent != 600*ton {
+		t.Fatalf("recorded %v, want only one transfer", spent)
+	}
+}
@@ -1,51 +1,58 @@
 package usecase
 
 import (
+	"context"
 	"driver/domain"
 	"driver/domain/config"
 	"driver/domain/model"
 	"driver/interface/exporter"
-	"driver/interface/repository"
 	"log"
 	"time"
 
 	"github.com/tonkeeper/tongo"
-	"github.com/tonkeeper/tongo/liteapi"
 	"github.com/tonkeeper/tongo/tlb"
 	"github.com/tonkeeper/tongo/ton"
 	tgwallet "github.com/tonkeeper/tongo/wallet"
 )
 
 type StakeInteractor struct {
-	client             *liteapi.Client
+	client             ChainClient
 	memoInteractor     *MemoInteractor
 	contractInteractor *ContractInteractor
-	stakeRepository    *repository.StakeRepository
+	feeInteractor      *FeeInteractor
+	stakeRepository    StakeRepository
+	queryIdRepository  QueryIdRepository
 	driverWallet       *tgwallet.Wallet
 
-	messengerCh chan domain.MessagePack
-	responseCh  chan Response
+	outboxInteractor *OutboxInteractor
+	responseCh       chan Response
+	done             chan struct{}
 }
 
-func NewStakeInteractor(client *liteapi.Client,
+func NewStakeInteractor(client ChainClient,
 	memoInteractor *MemoInteractor,
 	contractInteractor *ContractInteractor,
-	stakeRepository *repository.StakeRepository,
+	feeInteractor *FeeInteractor,
+	stakeRepository StakeRepository,
+	queryIdRepository QueryIdRepository,
 	driverWallet *tgwallet.Wallet) *StakeInteractor {
 	interactor := &StakeInteractor{
 		client:             client,
 		memoInteractor:     memoInteractor,
 		contractInteractor: contractInteractor,
+		feeInteractor:      feeInteractor,
 		stakeRepository:    stakeRepository,
+		queryIdRepository:  queryIdRepository,
 		driverWallet:       driverWallet,
 	}
 
 	return interactor
 }
 
-func (interactor *StakeInteractor) InitializeChannel(messengerCh chan domain.MessagePack) chan Response {
+func (interactor *StakeInteractor) InitializeChannel(outboxInteractor *OutboxInteractor) chan Response {
 
-	interactor.messengerCh = messengerCh
+	interactor.outboxInteractor = outboxInteractor
+	interactor.done = make(chan struct{})
 
 	interactor.responseCh = make(chan Response, 5)
 	go interactor.ListenOnResponse(interactor.responseCh)
@@ -54,7 +61,7 @@ func (interactor *StakeInteractor) InitializeChannel(messengerCh chan domain.Mes
 
 func (interactor *StakeInteractor) Store(requests []domain.StakeRequest) error {
 	for _, request := range requests {
-		_, err := interactor.stakeRepository.InsertIfNotExists(request.Address, request.RoundSince, request.Hash, request.Info)
+		_, err := interactor.stakeRepository.InsertIfNotExists(request.Address, request.RoundSince, request.Hash, request.MsgIndex, request.FinalMcSeqno, request.Owner, request.Info)
 		if err != nil {
 			exporter.IncErrorCount()
 			log.Printf("🔴 inserting stake - %v\n", err.Error())
@@ -64,6 +71,15 @@ func (interactor *StakeInteractor) Store(requests []domain.StakeRequest) error {
 	return nil
 }
 
+// Exists tells whether the stake request of the out-message of the transaction is already stored.
+func (interactor *StakeInteractor) Exists(hash string, msgIndex int) (bool, error) {
+	request, err := interactor.stakeRepository.Find(hash, msgIndex)
+	if err != nil {
+		return false, err
+	}
+	return request != nil, nil
+}
+
 func (interactor *StakeInteractor) LoadTriable() ([]*domain.StakeRequest, error) {
 
 	requests, err := interactor.stakeRepository.FindAllTriable(config.GetMaxRetry())
@@ -76,7 +92,7 @@ func (interactor *StakeInteractor) LoadTriable() ([]*domain.StakeRequest, error)
 	return requests, nil
 }
 
-func (interactor *StakeInteractor) SendStakeMessageToJettonWallets(requests []*domain.StakeRequest) error {
+func (interactor *StakeInteractor) SendStakeMessageToJettonWallets(ctx context.Context, requests []*domain.StakeRequest) error {
 	// The round-since value must be considered as a condition whether to call stakeCoin or not.
 	//
 	//	start from sooner roundSince
@@ -98,7 +114,7 @@ func (interactor *StakeInteractor) SendStakeMessageToJettonWallets(requests []*d
 		}
 	}
 
-	treasuryState, err := interactor.contractInteractor.GetTreasuryState()
+	treasuryState, err := interactor.contractInteractor.GetTreasuryState(ctx)
 	if err != nil {
 		exporter.IncErrorCount()
 		log.Printf("🔴 getting treasury state - %v\n", err.Error())
@@ -111,6 +127,15 @@ func (interactor *StakeInteractor) SendStakeMessageToJettonWallets(requests []*d
 		}
 
 		for _, request := range subList {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			// A message of the request is still in the outbox, so wait for its result.
+			if interactor.outboxInteractor.IsQueued(request.Reference()) {
+				continue
+			}
+
 			accid, err := ton.AccountIDFromBase64Url(request.Address)
 			if err != nil {
 				exporter.IncErrorCount()
@@ -118,103 +143,128 @@ func (interactor *StakeInteractor) SendStakeMessageToJettonWallets(requests []*d
 				continue
 			}
 
-			interactor.stakeRepository.SetRetrying(request.Hash, time.Now())
+			interactor.stakeRepository.SetRetrying(request.Hash, request.MsgIndex, time.Now())
 
 			// check the wallet to know if it is wating for a stake-coin messages, using get_wallet_state
-			walletState, err := interactor.contractInteractor.GetWalletState(accid)
+			walletState, err := interactor.contractInteractor.GetWalletState(ctx, accid)
 			if err != nil {
 				exporter.IncErrorCount()
 				log.Printf("🔴 getting wallet state - %v\n", err.Error())
-				interactor.stakeRepository.SetState(request.Hash, domain.RequestStateError)
+				interactor.stakeRepository.SetState(request.Hash, request.MsgIndex, domain.RequestStateError)
 				continue
 			}
 
 			if _, exist := walletState.Staking[roundSince]; !exist {
 				log.Printf("🔵 wallet has no stake request.")
-				interactor.stakeRepository.SetState(request.Hash, domain.RequestStateSkipped)
+				interactor.stakeRepository.SetState(request.Hash, request.MsgIndex, domain.RequestStateSkipped)
 				continue
 			}
 
-			reference := request.Hash
+			// Each message gets its own query id, kept on its outbox message, so its effects on chain can be matched back
+			// to the request, whichever attempt they come from.
+			queryId, err := interactor.queryIdRepository.Next()
+			if err != nil {
+				exporter.IncErrorCount()
+				log.Printf("🔴 allocating query id [wallet: %v] - %v\n", request.Address, err.Error())
+				interactor.stakeRepository.SetState(request.Hash, request.MsgIndex, domain.RequestStateError)
+				continue
+			}
+
+			reference := request.Reference()
 			mp := domain.MessagePack{
 				Reference: reference,
-				Message:   interactor.makeMessage(accid, request),
+				Message:   interactor.makeMessage(ctx, accid, request, queryId),
 
 				StakeRequest:   request,
 				UnstakeRequest: nil,
 			}
 
-			interactor.messengerCh <- mp
+			_, err = interactor.outboxInteractor.Enqueue(mp)
+			if err != nil {
+				exporter.IncErrorCount()
+				log.Printf("🔴 queueing message [wallet: %v] - %v\n", request.Address, err.Error())
+				interactor.stakeRepository.SetState(request.Hash, request.MsgIndex, domain.RequestStateError)
+			}
 		}
 	}
 
 	return nil
 }
 
-func (interactor *StakeInteractor) makeMessage(accid tongo.AccountID, request *domain.StakeRequest) domain.Messagable {
+func (interactor *StakeInteractor) makeMessage(ctx context.Context, accid tongo.AccountID, request *domain.StakeRequest, queryId uint64) domain.Messagable {
 
+	// The excess of the coins attached to the message is returned to the driver wallet.
+	driverAddress := interactor.driverWallet.GetAddress()
 	return domain.StakeCoinMessage{
 		AccountId: accid,
+		Amount:    interactor.feeInteractor.Estimate(ctx, domain.OpcodeStakeCoin, accid),
 		TlbMsg: domain.TlbStakeCoinMessage{
 			Opcode:       tlb.Uint32(domain.OpcodeStakeCoin),
-			QuieryId:     tlb.Uint64(time.Now().Unix()),
+			QuieryId:     tlb.Uint64(queryId),
 			RoundSince:   tlb.Uint32(request.RoundSince),
-			ReturnExcess: tlb.MsgAddress{SumType: "AddrNone"},
+			ReturnExcess: driverAddress.ToMsgAddress(),
 		},
 	}
 }
 
-func (interactor *StakeInteractor) MakeStakeRequests(trans []tongo.Transaction) []domain.StakeRequest {
-	requests := make([]domain.StakeRequest, 0, 1)
-	for _, t := range trans {
-		ht := model.NewHTransaction(&t.Transaction)
-
-		// leave transaction if it's failed
-		if !ht.IsSucceeded() {
-			continue
-		}
-
-		msgs := ht.GetOutMessagesByOpcode(OpcodeSaveCoin)
-		if len(msgs) > 1 {
-			log.Printf("❗️ something's wrong, more than one msg found.")
-			continue
-		}
+// Decoder returns the decoder of the stake requests, i.e. the save_coin messages the treasury sends to the jetton
+// wallets.
+func (interactor *StakeInteractor) Decoder() Decoder {
+	return Decoder{
+		Name:      "stake",
+		Opcode:    OpcodeSaveCoin,
+		Direction: MessageOut,
+		Decode:    interactor.decodeStake,
+	}
+}
 
-		var msg *model.HMessage = nil
-		if len(msgs) == 1 {
-			msg = msgs[0]
-		}
+func (interactor *StakeInteractor) decodeStake(ht *model.HTransaction, msgs []*model.HMessage, result *domain.ExtractionResult) {
+	// leave transaction if it's failed
+	if !ht.IsSucceeded() {
+		return
+	}
 
-		info := domain.StakeRelatedInfo{
-			Value: ht.Value(),
-			Time:  ht.UnixTime(),
-			Hash:  ht.Formatter().Hash(),
-		}
+	info := domain.StakeRelatedInfo{
+		Value: ht.Value(),
+		Time:  ht.UnixTime(),
+		Hash:  ht.Formatter().Hash(),
+	}
 
-		if msg != nil {
-			accid := msg.Dest()
-			cell := msg.GetBody()
-			tlbm := domain.TlbSaveCoinMessage{}
-			tlb.Unmarshal(cell, &tlbm)
-
-			addr := accid.ToHuman(true, config.IsTestNet())
-			requests = append(requests, domain.StakeRequest{
-				Address:    addr,
-				RoundSince: uint32(tlbm.RoundSince),
-				Hash:       ht.Formatter().Hash(),
-				Info:       info,
-				CreatedAt:  time.Now()})
-		}
+	// The owner is the wallet which sent the deposit.
+	var owner *string
+	if src := ht.InMessage().Src(); src != nil {
+		ownerAddr := src.ToHuman(true, config.IsTestNet())
+		owner = &ownerAddr
 	}
 
-	return requests
+	// A transaction may send several save_coin messages, e.g. for deposits of several wallets, each of which is a
+	// request of its own. A request is indexed by the order of its message among the save_coin messages, rather than
+	// among all the out-messages, so the only one of a transaction is always the first.
+	for i, msg := range msgs {
+		accid := msg.Dest()
+		cell := msg.GetBody()
+		tlbm := domain.TlbSaveCoinMessage{}
+		tlb.Unmarshal(cell, &tlbm)
+
+		addr := accid.ToHuman(true, config.IsTestNet())
+		finalMcSeqno := result.FinalMcSeqno
+		result.StakeRequests = append(result.StakeRequests, domain.StakeRequest{
+			Address:      addr,
+			RoundSince:   uint32(tlbm.RoundSince),
+			Hash:         ht.Formatter().Hash(),
+			MsgIndex:     i,
+			FinalMcSeqno: &finalMcSeqno,
+			Owner:        owner,
+			Info:         info,
+			CreatedAt:    time.Now()})
+	}
 }
 
+// ListenOnResponse persists the results of the sent messages, until the response channel is closed.
 func (interactor *StakeInteractor) ListenOnResponse(respCh chan Response) {
-	// @TODO: implement a way to end the loop and close the channel
-	for {
-		resp := <-respCh
+	defer close(interactor.done)
 
+	for resp := range respCh {
 		request := resp.StakeRequest
 		if request == nil {
 			exporter.IncErrorCount()
@@ -222,24 +272,21 @@ func (interactor *StakeInteractor) ListenOnResponse(respCh chan Response) {
 			continue
 		}
 
-		if !resp.ok {
+		if resp.exitCode != nil {
+			log.Printf("🔵 staking rejected by emulation [wallet: %v, exit code: %v]\n", request.Address, *resp.exitCode)
+			interactor.stakeRepository.SetRejected(request.Hash, request.MsgIndex, *resp.exitCode)
+		} else if !resp.ok {
 			exporter.IncErrorCount()
 			log.Printf("🔴 staking [wallet: %v] - %v\n", request.Address, resp.err.Error())
-			interactor.stakeRepository.SetState(request.Hash, domain.RequestStateError)
+			interactor.stakeRepository.SetState(request.Hash, request.MsgIndex, domain.RequestStateError)
 		} else {
-			interactor.stakeRepository.SetSent(request.Hash, time.Now())
-			log.Printf("staking sent [wallet: %v]\n", request.Address)
+			interactor.stakeRepository.SetSent(request.Hash, request.MsgIndex, resp.messageHash, resp.cost, time.Now())
+			log.Printf("staking sent [wallet: %v, message: %v]\n", request.Address, resp.messageHash)
 		}
 	}
 }
 
-func findLastUnprocessed(trans []tongo.Transaction, lastHash string) int {
-	for i, t := range trans {
-		ht := model.NewHTransaction(&t.Transaction)
-		if ht.Formatter().Hash() == lastHash {
-			return i
-		}
-	}
-
-	return len(trans)
+// Done is closed when all responses are processed, after the response channel is closed.
+func (interactor *StakeInteractor) Done() <-chan struct{} {
+	return interactor.done
 }
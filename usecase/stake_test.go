@@ -0,0 +1,106 @@
+package usecase_test
+
+import (
+	"context"
+	"driver/domain"
+	"driver/infrastructure/simulator"
+	"testing"
+)
+
+func TestMultipleSaveCoins(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	env.sim.StartRound(100)
+
+	// The treasury sends another message first, so the save_coins messages are not at the first out-message keys.
+	env.sim.SendDepositNotices(true)
+	deposits := make([]simulator.WalletDeposit, 0, 3)
+	for i := 0; i < 3; i++ {
+		deposits = append(deposits, simulator.WalletDeposit{Owner: testAccount(2, i), WalletId: testAccount(3, i), Amount: 5_000_000_000})
+	}
+	multi, err := env.sim.MultiDeposit(testAccount(2, 0), deposits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	single := env.deposit(t, 3, 1)[0]
+	multiHash := multi.Hash().Hex()
+	singleHash := single.Hash().Hex()
+
+	// The stake of the single deposit was kept before the index was, i.e. at index 0.
+	legacy, err := env.stakeRepository.InsertIfNotExists(testAccount(3, 3).ToHuman(true, true), 100, singleHash, 0, nil, nil, domain.StakeRelatedInfo{})
+	if err != nil || legacy == nil {
+		t.Fatal(legacy, err)
+	}
+
+	result, err := env.extractInteractor.Extract(ctx, env.treasury)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.StakeRequests) != 4 {
+		t.Fatalf("extracted %v stakes, want 4", len(result.StakeRequests))
+	}
+	indexes := map[string][]int{}
+	for _, request := range result.StakeRequests {
+		indexes[request.Hash] = append(indexes[request.Hash], request.MsgIndex)
+	}
+	if len(indexes[multiHash]) != 3 || indexes[multiHash][0] != 0 || indexes[multiHash][1] != 1 || indexes[multiHash][2] != 2 {
+		t.Fatalf("multiple save_coins at indexes %v, want 0, 1 and 2", indexes[multiHash])
+	}
+	if len(indexes[singleHash]) != 1 || indexes[singleHash][0] != 0 {
+		t.Fatalf("single save_coins at indexes %v, want 0", indexes[singleHash])
+	}
+	if reference := domain.StakeReference(multiHash, 2); reference != multiHash+":2" {
+		t.Fatalf("got reference %v", reference)
+	}
+	err = env.extractInteractor.Store(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env.sim.FinishRound(100)
+	env.startMessenger(t)
+	requests, err := env.stakeInteractor.LoadTriable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 4 {
+		t.Fatalf("loaded %v triable stakes, want 4", len(requests))
+	}
+	err = env.stakeInteractor.SendStakeMessageToJettonWallets(ctx, requests)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, request := range requests {
+		waitFor(t, "stake "+request.Reference(), func() bool {
+			return env.stakeState(t, request.Hash, request.MsgIndex) == domain.RequestStateSent
+		})
+	}
+	for i := 0; i < 4; i++ {
+		state := env.sim.WalletState(testAccount(3, i))
+		if state == nil || state.Tokens.Uint64() != 5_000_000_000 {
+			t.Fatalf("wallet %v has %v, want the tokens of one deposit", i, state)
+		}
+	}
+
+	// Extracting the transactions again finds the same requests.
+	err = env.memoInteractor.SetExtractionCursor(domain.Cursor{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err = env.extractInteractor.Extract(ctx, env.treasury)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.extractInteractor.Store(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests, err = env.stakeInteractor.LoadTriable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 0 {
+		t.Fatalf("loaded %v triable stakes after extracting again, want none", len(requests))
+	}
+}
@@ -0,0 +1,312 @@
+package usecase
+
+import (
+	"context"
+	"driver/domain"
+	"driver/interface/exporter"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/tonkeeper/tongo"
+	"github.com/tonkeeper/tongo/liteclient"
+)
+
+const (
+	// masterchainShard is the shard of the masterchain, which is never split.
+	masterchainShard = uint64(0x8000000000000000)
+
+	// lookupBlockBySeqno is the mode of LookupBlock to find a block by its seqno.
+	lookupBlockBySeqno = uint32(1)
+
+	// listBlockTransactionsMode asks for the account, logical time and hash of the transactions in a block, and
+	// listBlockTransactionsAfter for the ones after a given transaction.
+	listBlockTransactionsMode  = uint32(1 | 2 | 4)
+	listBlockTransactionsAfter = uint32(128)
+	blockTransactionsPageSize  = uint32(256)
+
+	// blockWaitTimeout is how long the next masterchain block is waited for, a few times the block interval.
+	blockWaitTimeout = 30 * time.Second
+
+	// maxMasterchainLag is how many masterchain blocks the stream may fall behind, before it catches up by the
+	// transactions of the treasury instead, as liteservers don't keep that old blocks for long.
+	maxMasterchainLag = uint32(1000)
+)
+
+var (
+	ErrorShardNotFound      = fmt.Errorf("no shard of the masterchain block contains the account")
+	ErrorShardBlockNotFound = fmt.Errorf("the block cursor is not found before the shard block")
+)
+
+// StreamInteractor follows the masterchain blocks, and extracts the stake and unstake requests from the treasury
+// transactions in the shard blocks each masterchain block commits to. A masterchain block is processed once it's
+// final, i.e. finality_depth blocks are made after it, so the requests are extracted as soon as they are final, and
+// none is missed for a burst of transactions.
+type StreamInteractor struct {
+	client             BlockClient
+	memoInteractor     *MemoInteractor
+	extractInteractor  *ExtractInteractor
+	finalityInteractor *FinalityInteractor
+}
+
+func NewStreamInteractor(client BlockClient,
+	memoInteractor *MemoInteractor,
+	extractInteractor *ExtractInteractor,
+	finalityInteractor *FinalityInteractor) *StreamInteractor {
+	interactor := &StreamInteractor{
+		client:             client,
+		memoInteractor:     memoInteractor,
+		extractInteractor:  extractInteractor,
+		finalityInteractor: finalityInteractor,
+	}
+	return interactor
+}
+
+// Next waits for the masterchain block after the block cursor to be final, and extracts the requests from the
+// treasury transactions of the shard blocks it commits to, then moves the cursors to it.
+//
+// If no block is processed yet, the shard block of the cursor is not known or not found, or the stream has fallen
+// too far behind, the requests are extracted from the latest final transactions of the treasury, the way the polling
+// extraction does, and the stream goes on from the latest final masterchain block.
+func (interactor *StreamInteractor) Next(ctx context.Context, treasuryAccount tongo.AccountID) (*domain.ExtractionResult, error) {
+	block, err := interactor.memoInteractor.GetBlockCursor()
+	if err != nil {
+		exporter.IncErrorCount()
+		log.Printf("🔴 getting block cursor - %v\n", err.Error())
+		return nil, err
+	}
+
+	info, err := interactor.client.GetMasterchainInfo(ctx)
+	if err != nil {
+		exporter.IncErrorCount()
+		log.Printf("🔴 getting masterchain info - %v\n", err.Error())
+		return nil, err
+	}
+
+	last := info.Last.ToBlockIdExt()
+	if block.MasterchainSeqno == 0 || block.ShardBlock.Seqno == 0 || last.Seqno > block.MasterchainSeqno+maxMasterchainLag {
+		return interactor.catchUp(ctx, treasuryAccount)
+	}
+
+	next := block.MasterchainSeqno + 1
+	final := next + interactor.finalityInteractor.Depth()
+	if last.Seqno < final {
+		err = interactor.client.WaitMasterchainSeqno(ctx, final, blockWaitTimeout)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	masterBlock, _, err := interactor.client.LookupBlock(ctx, tongo.BlockID{Workchain: -1, Shard: masterchainShard, Seqno: next}, lookupBlockBySeqno, nil, nil)
+	if err != nil {
+		exporter.IncErrorCount()
+		log.Printf("🔴 looking up masterchain block [seqno: %v] - %v\n", next, err.Error())
+		return nil, err
+	}
+
+	top, err := shardTop(ctx, interactor.client, masterBlock, treasuryAccount)
+	if err != nil {
+		exporter.IncErrorCount()
+		log.Printf("🔴 getting shard of masterchain block [seqno: %v] - %v\n", next, err.Error())
+		return nil, err
+	}
+
+	shardBlocks, err := interactor.shardBlocksAfter(ctx, top, block.ShardBlock, treasuryAccount)
+	if err == ErrorShardBlockNotFound {
+		exporter.IncErrorCount()
+		log.Printf("🔴 shard block of the cursor not found [shard block: %v, masterchain block: %v]\n", block.ShardBlock.BlockID, next)
+		return interactor.catchUp(ctx, treasuryAccount)
+	}
+	if err != nil {
+		exporter.IncErrorCount()
+		log.Printf("🔴 walking back shard blocks [seqno: %v] - %v\n", top.Seqno, err.Error())
+		return nil, err
+	}
+
+	cursor, err := interactor.memoInteractor.GetExtractionCursor()
+	if err != nil {
+		exporter.IncErrorCount()
+		log.Printf("🔴 getting extraction cursor - %v\n", err.Error())
+		return nil, err
+	}
+
+	result := domain.ExtractionResult{
+		FinalMcSeqno:    next,
+		StakeRequests:   make([]domain.StakeRequest, 0),
+		UnstakeRequests: make([]domain.UnstakeRequest, 0),
+		FailedRequests:  make([]domain.FailedRequest, 0),
+		Events:          make([]domain.Event, 0),
+	}
+
+	for _, shardBlock := range shardBlocks {
+		trans, err := interactor.blockTransactions(ctx, shardBlock, treasuryAccount, cursor.Lt)
+		if err != nil {
+			exporter.IncErrorCount()
+			log.Printf("🔴 getting transactions of shard block [block: %v] - %v\n", shardBlock.BlockID, err.Error())
+			return nil, err
+		}
+		if len(trans) == 0 {
+			continue
+		}
+
+		stakes, unstakes := interactor.extractInteractor.collect(trans, &result)
+		log.Printf("Processing block transactions... Shard block: %v / Total: %v / Found: %v stake(s) and %v unstake(s)\n", shardBlock.BlockID, len(trans), stakes, unstakes)
+
+		for _, t := range trans {
+			if t.Lt > cursor.Lt {
+				cursor = domain.Cursor{Lt: t.Lt, Hash: t.Hash().Hex()}
+			}
+		}
+	}
+
+	err = interactor.memoInteractor.SetBlockCursor(domain.BlockCursor{MasterchainSeqno: next, ShardBlock: top}, cursor)
+	if err != nil {
+		exporter.IncErrorCount()
+		log.Printf("🔴 updating block cursor - %v\n", err.Error())
+	}
+
+	return &result, nil
+}
+
+// catchUp extracts the requests from the latest final transactions of the treasury, and moves the block cursor to
+// the final masterchain block.
+func (interactor *StreamInteractor) catchUp(ctx context.Context, treasuryAccount tongo.AccountID) (*domain.ExtractionResult, error) {
+	final, err := interactor.finalityInteractor.FinalBlock(ctx, treasuryAccount)
+	if err != nil {
+		exporter.IncErrorCount()
+		log.Printf("🔴 getting final block - %v\n", err.Error())
+		return nil, err
+	}
+
+	log.Printf("🔵 catching up by the treasury transactions, streaming from masterchain block %v\n", final.MasterchainSeqno)
+	result, err := interactor.extractInteractor.extract(ctx, treasuryAccount, final)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := interactor.memoInteractor.GetExtractionCursor()
+	if err != nil {
+		exporter.IncErrorCount()
+		log.Printf("🔴 getting extraction cursor - %v\n", err.Error())
+		return nil, err
+	}
+
+	err = interactor.memoInteractor.SetBlockCursor(domain.BlockCursor{MasterchainSeqno: final.MasterchainSeqno, ShardBlock: final.ShardBlock}, cursor)
+	if err != nil {
+		exporter.IncErrorCount()
+		log.Printf("🔴 updating block cursor - %v\n", err.Error())
+	}
+
+	return result, nil
+}
+
+// shardTop returns the latest block of the shard containing the account, which the masterchain block commits to.
+func shardTop(ctx context.Context, client BlockClient, masterBlock tongo.BlockIDExt, account tongo.AccountID) (tongo.BlockIDExt, error) {
+	shards, err := client.GetAllShardsInfo(ctx, masterBlock)
+	if err != nil {
+		return tongo.BlockIDExt{}, err
+	}
+
+	for _, shard := range shards {
+		if shard.Workchain != account.Workchain {
+			continue
+		}
+		id, err := tongo.ParseShardID(int64(shard.Shard))
+		if err != nil {
+			return tongo.BlockIDExt{}, err
+		}
+		if id.MatchAccountID(account) {
+			return shard, nil
+		}
+	}
+
+	return tongo.BlockIDExt{}, ErrorShardNotFound
+}
+
+// shardBlocksAfter returns the blocks of the account's shard after the cursor block up to the top one, the oldest
+// first. They are found by walking back from the top through the blocks each one is made after, so the walk follows
+// the shard over splits and merges. After a merge, the half the account is in is walked, as the other half has none
+// of its transactions. A block's seqno is above the ones it's made after, so the cursor block is not on the way if a
+// block at or below its seqno is reached instead.
+func (interactor *StreamInteractor) shardBlocksAfter(ctx context.Context, top tongo.BlockIDExt, cursor tongo.BlockIDExt, account tongo.AccountID) ([]tongo.BlockIDExt, error) {
+	blocks := make([]tongo.BlockIDExt, 0)
+	for block := top; block.BlockID != cursor.BlockID; {
+		if block.Seqno <= cursor.Seqno {
+			return nil, ErrorShardBlockNotFound
+		}
+		blocks = append(blocks, block)
+
+		_, info, err := interactor.client.LookupBlock(ctx, block.BlockID, lookupBlockBySeqno, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		parents, err := tongo.GetParents(info)
+		if err != nil {
+			return nil, err
+		}
+
+		found := false
+		for _, parent := range parents {
+			id, err := tongo.ParseShardID(int64(parent.Shard))
+			if err != nil {
+				return nil, err
+			}
+			if id.MatchAccountID(account) {
+				block, found = parent, true
+				break
+			}
+		}
+		if !found {
+			return nil, ErrorShardNotFound
+		}
+	}
+
+	for i, j := 0, len(blocks)-1; i < j; i, j = i+1, j-1 {
+		blocks[i], blocks[j] = blocks[j], blocks[i]
+	}
+	return blocks, nil
+}
+
+// blockTransactions returns the transactions of the account in the shard block which come after the logical time.
+func (interactor *StreamInteractor) blockTransactions(ctx context.Context, block tongo.BlockIDExt, account tongo.AccountID, afterLt uint64) ([]tongo.Transaction, error) {
+	trans := make([]tongo.Transaction, 0)
+
+	var after *liteclient.LiteServerTransactionId3C
+	for {
+		mode := listBlockTransactionsMode
+		if after != nil {
+			mode |= listBlockTransactionsAfter
+		}
+
+		ids, incomplete, err := interactor.client.ListBlockTransactions(ctx, block, mode, blockTransactionsPageSize, after)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, id := range ids {
+			if id.Account == nil || id.Lt == nil {
+				continue
+			}
+			if tongo.Bits256(*id.Account) != account.Address || *id.Lt <= afterLt {
+				continue
+			}
+
+			t, err := interactor.client.GetOneTransactionFromBlock(ctx, account, block, *id.Lt)
+			if err != nil {
+				return nil, err
+			}
+			trans = append(trans, t)
+		}
+
+		if !incomplete || len(ids) == 0 {
+			break
+		}
+		last := ids[len(ids)-1]
+		if last.Account == nil || last.Lt == nil {
+			break
+		}
+		after = &liteclient.LiteServerTransactionId3C{Account: *last.Account, Lt: *last.Lt}
+	}
+
+	return trans, nil
+}
@@ -0,0 +1,162 @@
+package usecase_test
+
+import (
+	"context"
+	"driver/domain"
+	"driver/infrastructure/fakechain"
+	"driver/usecase"
+	"testing"
+
+	"github.com/tonkeeper/tongo"
+)
+
+func TestStreamFollowsSplitAndMerge(t *testing.T) {
+	env := newTestEnv(t)
+	finalityInteractor := usecase.NewFinalityInteractor(env.sim)
+	streamInteractor := usecase.NewStreamInteractor(env.sim, env.memoInteractor, env.extractInteractor, finalityInteractor)
+	ctx := context.Background()
+	env.sim.StartRound(100)
+
+	// No block is processed yet, so the stream catches up by the treasury transactions.
+	env.deposit(t, 0, 5)
+	result, err := streamInteractor.Next(ctx, env.treasury)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.StakeRequests) != 5 {
+		t.Fatalf("caught up with %v stakes, want 5", len(result.StakeRequests))
+	}
+
+	steps := []struct {
+		name  string
+		build func(from int)
+		count int
+	}{
+		{
+			name: "split",
+			build: func(from int) {
+				env.deposit(t, from, 3)
+				env.sim.SplitShard()
+				env.deposit(t, from+3, 4)
+			},
+			count: 7,
+		},
+		{
+			name: "merge",
+			build: func(from int) {
+				env.deposit(t, from, 2)
+				env.sim.MergeShards()
+				env.deposit(t, from+2, 3)
+			},
+			count: 5,
+		},
+	}
+
+	from := 5
+	for _, step := range steps {
+		before, err := env.memoInteractor.GetBlockCursor()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Each deposit seals a masterchain block, so the stream runs one block at a time.
+		step.build(from)
+		from += step.count
+
+		total := 0
+		for {
+			block, err := env.memoInteractor.GetBlockCursor()
+			if err != nil {
+				t.Fatal(err)
+			}
+			info, err := env.sim.GetMasterchainInfo(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if block.MasterchainSeqno == info.Last.Seqno {
+				break
+			}
+
+			result, err := streamInteractor.Next(ctx, env.treasury)
+			if err != nil {
+				t.Fatalf("%v: %v", step.name, err)
+			}
+			for _, stake := range result.StakeRequests {
+				if stake.FinalMcSeqno == nil || *stake.FinalMcSeqno != block.MasterchainSeqno+1 {
+					t.Fatalf("%v: stake committed by masterchain block %v, want %v", step.name, stake.FinalMcSeqno, block.MasterchainSeqno+1)
+				}
+			}
+			total += len(result.StakeRequests)
+		}
+		if total != step.count {
+			t.Fatalf("%v: streamed %v stakes, want %v", step.name, total, step.count)
+		}
+
+		after, err := env.memoInteractor.GetBlockCursor()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if after.ShardBlock.Seqno <= before.ShardBlock.Seqno || after.ShardBlock.RootHash == (tongo.Bits256{}) {
+			t.Fatalf("%v: block cursor at %v, want a shard block after %v", step.name, after.ShardBlock, before.ShardBlock)
+		}
+	}
+
+	gaps, err := env.memoInteractor.GetExtractionGaps()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gaps) != 0 {
+		t.Fatalf("got gaps %v, want none", gaps)
+	}
+}
+
+func TestStreamCatchesUpWithoutCursorBlock(t *testing.T) {
+	env := newTestEnv(t)
+	finalityInteractor := usecase.NewFinalityInteractor(env.sim)
+	streamInteractor := usecase.NewStreamInteractor(env.sim, env.memoInteractor, env.extractInteractor, finalityInteractor)
+	ctx := context.Background()
+	env.sim.StartRound(100)
+
+	env.deposit(t, 0, 5)
+	env.sim.SplitShard()
+	env.deposit(t, 5, 1)
+	_, err := streamInteractor.Next(ctx, env.treasury)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The cursor is moved to the other half of the split shard, which the treasury's blocks are not made after.
+	block, err := env.memoInteractor.GetBlockCursor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cursor, err := env.memoInteractor.GetExtractionCursor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := block.ShardBlock
+	other.Shard = fakechain.RightShard
+	if other.Shard == block.ShardBlock.Shard {
+		other.Shard = fakechain.LeftShard
+	}
+	err = env.memoInteractor.SetBlockCursor(domain.BlockCursor{MasterchainSeqno: block.MasterchainSeqno, ShardBlock: other}, cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env.deposit(t, 6, 3)
+	result, err := streamInteractor.Next(ctx, env.treasury)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.StakeRequests) != 3 {
+		t.Fatalf("caught up with %v stakes, want 3", len(result.StakeRequests))
+	}
+	block, err = env.memoInteractor.GetBlockCursor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.ShardBlock.Shard == other.Shard {
+		t.Fatalf("block cursor kept at %v", block.ShardBlock)
+	}
+}
@@ -0,0 +1,146 @@
+package usecase
+
+import (
+	"context"
+	"driver/domain"
+	"driver/domain/model"
+	"driver/interface/exporter"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/tonkeeper/tongo"
+	"github.com/tonkeeper/tongo/boc"
+	"github.com/tonkeeper/tongo/tlb"
+)
+
+var (
+	ErrorTransferExpired = fmt.Errorf("transfer expired before being processed")
+	ErrorTransferFailed  = fmt.Errorf("driver wallet transaction failed")
+	ErrorMessageNotSent  = fmt.Errorf("message is not sent by the driver wallet transaction")
+)
+
+const (
+	// expiryMargin gives the last blocks before a transfer's expiry a chance to be seen before giving up on it.
+	expiryMargin = 30 * time.Second
+
+	// traceInterval is how often the driver wallet's transactions are looked through for a transfer.
+	traceInterval = 1 * time.Second
+
+	// tracePageSize is the number of transactions fetched at once. GetTransactions returns 16 items by max.
+	tracePageSize = 16
+)
+
+// trace waits for the transaction of the driver wallet which processes the transfer. Once the transfer is expired
+// and no transaction is found for it, it's never going to be processed. ErrorTimeOut means it is not known
+// whether it's processed.
+func (interactor *MessengerInteractor) trace(ctx context.Context, transfer *Transfer) (*model.HTransaction, error) {
+	for {
+		trans, err := interactor.findTransaction(ctx, transfer)
+		if err != nil {
+			exporter.IncErrorCount()
+			log.Printf("🔴 tracing transfer %v - %v\n", transfer.Id, err.Error())
+		}
+		if trans != nil {
+			return trans, nil
+		}
+
+		if time.Now().After(transfer.ValidUntil.Add(expiryMargin)) {
+			if err != nil {
+				return nil, ErrorTimeOut
+			}
+			return nil, ErrorTransferExpired
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(traceInterval):
+		}
+	}
+}
+
+// findTransaction looks through the driver wallet's transactions, from the latest one, for the transaction whose
+// inbound external message is the transfer. Transactions before the transfer is made can't be it, so the search
+// stops there. No transaction and no error means the transfer is not processed yet.
+func (interactor *MessengerInteractor) findTransaction(ctx context.Context, transfer *Transfer) (*model.HTransaction, error) {
+	account := interactor.driverWallet.GetAddress()
+	since := transfer.ValidUntil.Add(-transferLifetime - expiryMargin)
+
+	trans, err := interactor.client.GetLastTransactions(ctx, account, tracePageSize)
+	for err == nil && len(trans) > 0 {
+		for i := range trans {
+			ht := model.NewHTransaction(&trans[i].Transaction)
+			if ht.UnixTime().Before(since) {
+				return nil, nil
+			}
+
+			inMsg := ht.InMessage()
+			if trans[i].Msgs.InMsg.Exists && inMsg.IsExternalIn() && inMsg.Hash().Hex() == transfer.Hash {
+				return ht, nil
+			}
+		}
+
+		last := trans[len(trans)-1]
+		trans, err = interactor.client.GetTransactions(ctx, tracePageSize, account, last.Lt, tongo.Bits256(last.Hash()))
+
+		// Remove the first element as it's already looked through
+		if len(trans) > 0 {
+			trans = trans[1:]
+		}
+	}
+
+	return nil, err
+}
+
+// sentMessages matches the messages of a transfer with the out-messages of the transaction which processed it, by
+// their destinations and bodies. A nil out-message means the message is not sent, e.g. it's skipped in the action
+// phase.
+func sentMessages(trans *model.HTransaction, batch []*domain.OutboxMessage) []*model.HMessage {
+	outMsgs := trans.OutMessages()
+	used := make([]bool, len(outMsgs))
+
+	result := make([]*model.HMessage, len(batch))
+	for i, msg := range batch {
+		dest, bodyHash, err := outboxMessageKey(msg)
+		if err != nil {
+			continue
+		}
+
+		for j, outMsg := range outMsgs {
+			if used[j] || outMsg.Dest() == nil || *outMsg.Dest() != dest {
+				continue
+			}
+			outBodyHash, err := outMsg.GetBody().Hash256()
+			if err != nil || outBodyHash != bodyHash {
+				continue
+			}
+
+			used[j] = true
+			result[i] = outMsg
+			break
+		}
+	}
+
+	return result
+}
+
+// outboxMessageKey returns the destination and the body hash of an outbox message.
+func outboxMessageKey(msg *domain.OutboxMessage) (tongo.AccountID, [32]byte, error) {
+	cell, err := boc.DeserializeSinglRootBase64(msg.Message)
+	if err != nil {
+		return tongo.AccountID{}, [32]byte{}, err
+	}
+	var intMsg tlb.Message
+	err = tlb.Unmarshal(cell, &intMsg)
+	if err != nil {
+		return tongo.AccountID{}, [32]byte{}, err
+	}
+
+	hmsg := model.NewHMessage(&intMsg)
+	if hmsg.Dest() == nil {
+		return tongo.AccountID{}, [32]byte{}, ErrorMessageNotSent
+	}
+	bodyHash, err := hmsg.GetBody().Hash256()
+	return *hmsg.Dest(), bodyHash, err
+}
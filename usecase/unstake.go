@@ -1,53 +1,60 @@
 package usecase
 
 import (
+	"context"
 	"driver/domain"
 	"driver/domain/config"
 	"driver/domain/model"
 	"driver/interface/exporter"
-	"driver/interface/repository"
 	"log"
 	"math/big"
 	"sort"
 	"time"
 
 	"github.com/tonkeeper/tongo"
-	"github.com/tonkeeper/tongo/liteapi"
 	"github.com/tonkeeper/tongo/tlb"
 	"github.com/tonkeeper/tongo/ton"
 	tgwallet "github.com/tonkeeper/tongo/wallet"
 )
 
 type UnstakeInteractor struct {
-	client             *liteapi.Client
+	client             ChainClient
 	memoInteractor     *MemoInteractor
 	contractInteractor *ContractInteractor
-	unstakeRepository  *repository.UnstakeRepository
+	feeInteractor      *FeeInteractor
+	unstakeRepository  UnstakeRepository
+	queryIdRepository  QueryIdRepository
 	driverWallet       *tgwallet.Wallet
 
-	messengerCh chan domain.MessagePack
-	resposeCh   chan Response
+	outboxInteractor *OutboxInteractor
+	resposeCh        chan Response
+	done             chan struct{}
 }
 
-func NewUnstakeInteractor(client *liteapi.Client,
+func NewUnstakeInteractor(client ChainClient,
 	memoInteractor *MemoInteractor,
 	contractInteractor *ContractInteractor,
-	unstakeRepository *repository.UnstakeRepository,
+	feeInteractor *FeeInteractor,
+	unstakeRepository UnstakeRepository,
+	queryIdRepository QueryIdRepository,
 	driverWallet *tgwallet.Wallet) *UnstakeInteractor {
 	interactor := &UnstakeInteractor{
 		client:             client,
 		memoInteractor:     memoInteractor,
 		contractInteractor: contractInteractor,
+		feeInteractor:      feeInteractor,
 		unstakeRepository:  unstakeRepository,
+		queryIdRepository:  queryIdRepository,
 		driverWallet:       driverWallet,
 	}
 
 	return interactor
 }
 
-func (interactor *UnstakeInteractor) InitializeChannel(messengerCh chan domain.MessagePack) chan Response {
+func (interactor *UnstakeInteractor) InitializeChannel(outboxInteractor *OutboxInteractor) chan Response {
 
-	interactor.messengerCh = messengerCh
+	interactor.outboxInteractor = outboxInteractor
+	interactor.done = make(chan struct{})
 
 	interactor.resposeCh = make(chan Response, 5)
 	go interactor.ListenOnResponse(interactor.resposeCh)
@@ -56,7 +63,7 @@ func (interactor *UnstakeInteractor) InitializeChannel(messengerCh chan domain.M
 
 func (interactor *UnstakeInteractor) Store(requests []domain.UnstakeRequest) error {
 	for _, request := range requests {
-		_, err := interactor.unstakeRepository.InsertIfNotExists(request.Address, request.Tokens, request.Hash, request.Info)
+		_, err := interactor.unstakeRepository.InsertIfNotExists(request.Address, request.Tokens, request.Hash, request.FinalMcSeqno, request.Owner, request.Info)
 		if err != nil {
 			exporter.IncErrorCount()
 			log.Printf("🔴 inserting unstake - %v\n", err.Error())
@@ -66,6 +73,15 @@ func (interactor *UnstakeInteractor) Store(requests []domain.UnstakeRequest) err
 	return nil
 }
 
+// Exists tells whether the unstake request of the transaction is already stored.
+func (interactor *UnstakeInteractor) Exists(hash string) (bool, error) {
+	request, err := interactor.unstakeRepository.Find(hash)
+	if err != nil {
+		return false, err
+	}
+	return request != nil, nil
+}
+
 func (interactor *UnstakeInteractor) LoadTriable() ([]*domain.UnstakeRequest, error) {
 
 	requests, err := interactor.unstakeRepository.FindAllTriable(config.GetMaxRetry())
@@ -78,7 +94,7 @@ func (interactor *UnstakeInteractor) LoadTriable() ([]*domain.UnstakeRequest, er
 	return requests, nil
 }
 
-func (interactor *UnstakeInteractor) SendWithdrawMessageToJettonWallets(requests []*domain.UnstakeRequest) error {
+func (interactor *UnstakeInteractor) SendWithdrawMessageToJettonWallets(ctx context.Context, requests []*domain.UnstakeRequest) error {
 
 	// Sorts the requests based on Tokens value accending, so that most requests will be done with a specified budget.
 	sort.Slice(requests, func(i, j int) bool {
@@ -86,6 +102,14 @@ func (interactor *UnstakeInteractor) SendWithdrawMessageToJettonWallets(requests
 	})
 
 	for _, request := range requests {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		// A message of the request is still in the outbox, so wait for its result.
+		if interactor.outboxInteractor.IsQueued(request.Hash) {
+			continue
+		}
 
 		accid, err := ton.AccountIDFromBase64Url(request.Address)
 		if err != nil {
@@ -95,7 +119,7 @@ func (interactor *UnstakeInteractor) SendWithdrawMessageToJettonWallets(requests
 		}
 
 		// Get maximum burnable tokens as the total budget for unstaking.
-		totalBudget, err := interactor.contractInteractor.GetMaxBurnableTokens()
+		totalBudget, err := interactor.contractInteractor.GetMaxBurnableTokens(ctx)
 		if err != nil {
 			exporter.IncErrorCount()
 			log.Printf("🔴 getting max burnable tokens - %v\n", err.Error())
@@ -109,7 +133,7 @@ func (interactor *UnstakeInteractor) SendWithdrawMessageToJettonWallets(requests
 		}
 
 		// Check the wallet to know if it is wating for a withdraw messages.
-		walletState, err := interactor.contractInteractor.GetWalletState(accid)
+		walletState, err := interactor.contractInteractor.GetWalletState(ctx, accid)
 		if err != nil {
 			exporter.IncErrorCount()
 			log.Printf("🔴 getting wallet state - %v\n", err.Error())
@@ -134,90 +158,118 @@ func (interactor *UnstakeInteractor) SendWithdrawMessageToJettonWallets(requests
 
 		interactor.unstakeRepository.SetRetrying(request.Hash, time.Now())
 
+		// Each message gets its own query id, kept on its outbox message, so its effects on chain can be matched back to
+		// the request, whichever attempt they come from.
+		queryId, err := interactor.queryIdRepository.Next()
+		if err != nil {
+			exporter.IncErrorCount()
+			log.Printf("🔴 allocating query id [wallet: %v] - %v\n", request.Address, err.Error())
+			interactor.unstakeRepository.SetState(request.Hash, domain.RequestStateError)
+			continue
+		}
+
 		reference := request.Hash
 		mp := domain.MessagePack{
 			Reference: reference,
-			Message:   interactor.makeMessage(accid, request),
+			Message:   interactor.makeMessage(ctx, accid, request, queryId),
 
 			StakeRequest:   nil,
 			UnstakeRequest: request,
 		}
 
-		interactor.messengerCh <- mp
+		_, err = interactor.outboxInteractor.Enqueue(mp)
+		if err != nil {
+			exporter.IncErrorCount()
+			log.Printf("🔴 queueing message [wallet: %v] - %v\n", request.Address, err.Error())
+			interactor.unstakeRepository.SetState(request.Hash, domain.RequestStateError)
+		}
 	}
 
 	return nil
 }
 
-func (interactor *UnstakeInteractor) makeMessage(accid tongo.AccountID, request *domain.UnstakeRequest) domain.Messagable {
+func (interactor *UnstakeInteractor) makeMessage(ctx context.Context, accid tongo.AccountID, request *domain.UnstakeRequest, queryId uint64) domain.Messagable {
 
+	// The excess of the coins attached to the message is returned to the driver wallet.
+	driverAddress := interactor.driverWallet.GetAddress()
 	return domain.WithdrawMessage{
 		AccountId: accid,
+		Amount:    interactor.feeInteractor.Estimate(ctx, domain.OpcodeWithdraw, accid),
 		TlbMsg: domain.TlbWithdrawMessage{
 			Opcode:       tlb.Uint32(domain.OpcodeWithdraw),
-			QuieryId:     tlb.Uint64(time.Now().Unix()),
-			ReturnExcess: tlb.MsgAddress{SumType: "AddrNone"},
+			QuieryId:     tlb.Uint64(queryId),
+			ReturnExcess: driverAddress.ToMsgAddress(),
 		},
 	}
 }
 
-func (interactor *UnstakeInteractor) MakeUnstakeRequests(trans []tongo.Transaction) []domain.UnstakeRequest {
-	requests := make([]domain.UnstakeRequest, 0, 1)
-	for _, t := range trans {
-		ht := model.NewHTransaction(&t.Transaction)
+// Decoder returns the decoder of the unstake requests, i.e. the reserve_token messages the jetton wallets send to
+// the treasury.
+func (interactor *UnstakeInteractor) Decoder() Decoder {
+	return Decoder{
+		Name:      "unstake",
+		Opcode:    OpcodeReserveToken,
+		Direction: MessageIn,
+		Decode:    interactor.decodeUnstake,
+	}
+}
 
-		// Leave transaction if it's failed.
-		if !ht.IsSucceeded() {
-			continue
-		}
+func (interactor *UnstakeInteractor) decodeUnstake(ht *model.HTransaction, msgs []*model.HMessage, result *domain.ExtractionResult) {
+	// Leave transaction if it's failed.
+	if !ht.IsSucceeded() {
+		return
+	}
 
-		msg := ht.GetInMessagesByOpcode(OpcodeReserveToken)
+	msg := msgs[0]
 
-		info := domain.UnstakeRelatedInfo{
-			Value: ht.Value(),
-			Time:  ht.UnixTime(),
-			Hash:  ht.Formatter().Hash(),
-		}
+	info := domain.UnstakeRelatedInfo{
+		Value: ht.Value(),
+		Time:  ht.UnixTime(),
+		Hash:  ht.Formatter().Hash(),
+	}
 
-		if msg != nil {
-			accid := msg.Src()
-			cell := msg.GetBody()
-			tlbm := domain.TlbReserveTokenMessage{}
-			err := tlb.Unmarshal(cell, &tlbm)
-			if err != nil {
-				exporter.IncErrorCount()
-				log.Printf("🔴 unmarshaling message body [trans hash: %v] - %v\n", ht.Formatter().Hash(), err.Error())
-				continue
-			}
-
-			// @TODO: Use a better conversion method
-			buff, err := tlbm.Tokens.MarshalJSON()
-			if err != nil {
-				exporter.IncErrorCount()
-				log.Printf("🔴 parsing tokens [value: %v] - %v\n", tlbm.Tokens, err.Error())
-				continue
-			}
-			buff = buff[1 : len(buff)-1] // remove " marks from begining and end of json value
-			var tokens big.Int
-			tokens.UnmarshalText(buff)
-			addr := accid.ToHuman(true, config.IsTestNet())
-			requests = append(requests, domain.UnstakeRequest{
-				Address:   addr,
-				Tokens:    tokens,
-				Hash:      ht.Formatter().Hash(),
-				Info:      info,
-				CreatedAt: time.Now()})
-		}
+	accid := msg.Src()
+	cell := msg.GetBody()
+	tlbm := domain.TlbReserveTokenMessage{}
+	err := tlb.Unmarshal(cell, &tlbm)
+	if err != nil {
+		exporter.IncErrorCount()
+		log.Printf("🔴 unmarshaling message body [trans hash: %v] - %v\n", ht.Formatter().Hash(), err.Error())
+		return
 	}
 
-	return requests
+	// @TODO: Use a better conversion method
+	buff, err := tlbm.Tokens.MarshalJSON()
+	if err != nil {
+		exporter.IncErrorCount()
+		log.Printf("🔴 parsing tokens [value: %v] - %v\n", tlbm.Tokens, err.Error())
+		return
+	}
+	buff = buff[1 : len(buff)-1] // remove " marks from begining and end of json value
+	var tokens big.Int
+	tokens.UnmarshalText(buff)
+	addr := accid.ToHuman(true, config.IsTestNet())
+	var owner *string
+	if ownerId, err := tongo.AccountIDFromTlb(tlbm.Owner); err == nil && ownerId != nil {
+		ownerAddr := ownerId.ToHuman(true, config.IsTestNet())
+		owner = &ownerAddr
+	}
+	finalMcSeqno := result.FinalMcSeqno
+	result.UnstakeRequests = append(result.UnstakeRequests, domain.UnstakeRequest{
+		Address:      addr,
+		Tokens:       tokens,
+		Hash:         ht.Formatter().Hash(),
+		FinalMcSeqno: &finalMcSeqno,
+		Owner:        owner,
+		Info:         info,
+		CreatedAt:    time.Now()})
 }
 
+// ListenOnResponse persists the results of the sent messages, until the response channel is closed.
 func (interactor *UnstakeInteractor) ListenOnResponse(respCh chan Response) {
-	// @TODO: implement a way to end the loop and close the channel
-	for {
-		resp := <-respCh
+	defer close(interactor.done)
 
+	for resp := range respCh {
 		request := resp.UnstakeRequest
 		if request == nil {
 			exporter.IncErrorCount()
@@ -225,13 +277,21 @@ func (interactor *UnstakeInteractor) ListenOnResponse(respCh chan Response) {
 			continue
 		}
 
-		if !resp.ok {
+		if resp.exitCode != nil {
+			log.Printf("🔵 unstaking rejected by emulation [wallet: %v, exit code: %v]\n", request.Address, *resp.exitCode)
+			interactor.unstakeRepository.SetRejected(request.Hash, *resp.exitCode)
+		} else if !resp.ok {
 			exporter.IncErrorCount()
 			log.Printf("🔴 unstaking [wallet: %v] - %v\n", request.Address, resp.err.Error())
 			interactor.unstakeRepository.SetState(request.Hash, domain.RequestStateError)
 		} else {
-			interactor.unstakeRepository.SetSent(request.Hash, time.Now())
-			log.Printf("unstaking done [wallet: %v]\n", request.Address)
+			interactor.unstakeRepository.SetSent(request.Hash, resp.messageHash, resp.cost, time.Now())
+			log.Printf("unstaking done [wallet: %v, message: %v]\n", request.Address, resp.messageHash)
 		}
 	}
 }
+
+// Done is closed when all responses are processed, after the response channel is closed.
+func (interactor *UnstakeInteractor) Done() <-chan struct{} {
+	return interactor.done
+}
@@ -1,28 +1,27 @@
 package usecase
 
 import (
+	"context"
 	"driver/domain"
 	"driver/interface/exporter"
-	"driver/interface/repository"
 	"log"
 	"math/big"
 	"time"
 
-	"github.com/tonkeeper/tongo/liteapi"
 	"github.com/tonkeeper/tongo/ton"
 )
 
 type VerifyInteractor struct {
-	client             *liteapi.Client
+	client             ChainClient
 	contractInteractor *ContractInteractor
-	stakeRepository    *repository.StakeRepository
-	unstakeRepository  *repository.UnstakeRepository
+	stakeRepository    StakeRepository
+	unstakeRepository  UnstakeRepository
 }
 
-func NewVerifyInteractor(client *liteapi.Client,
+func NewVerifyInteractor(client ChainClient,
 	contractInteractor *ContractInteractor,
-	stakeRepository *repository.StakeRepository,
-	unstakeRepository *repository.UnstakeRepository) *VerifyInteractor {
+	stakeRepository StakeRepository,
+	unstakeRepository UnstakeRepository) *VerifyInteractor {
 	interactor := &VerifyInteractor{
 		client:             client,
 		contractInteractor: contractInteractor,
@@ -52,9 +51,14 @@ func (interactor *VerifyInteractor) LoadVerifiable() ([]*domain.StakeRequest, []
 	return stakeRequests, unstakeRequests, nil
 }
 
-func (interactor *VerifyInteractor) VerifyStakeRequests(requests []*domain.StakeRequest) error {
+func (interactor *VerifyInteractor) VerifyStakeRequests(ctx context.Context, requests []*domain.StakeRequest) error {
 
 	for _, request := range requests {
+		// Leave the rest of requests for the next turn if the driver is stopping.
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
 		log.Printf("verifying stake [wallet = %v]\n", request.Address)
 		accid, err := ton.AccountIDFromBase64Url(request.Address)
 		if err != nil {
@@ -64,7 +68,7 @@ func (interactor *VerifyInteractor) VerifyStakeRequests(requests []*domain.Stake
 		}
 
 		// Check the wallet to know if it is wating for a stake-coin messages.
-		walletState, err := interactor.contractInteractor.GetWalletState(accid)
+		walletState, err := interactor.contractInteractor.GetWalletState(ctx, accid)
 		if err != nil {
 			exporter.IncErrorCount()
 			log.Printf("🔴 verifying stake - getting wallet state - %v\n", err.Error())
@@ -74,20 +78,25 @@ func (interactor *VerifyInteractor) VerifyStakeRequests(requests []*domain.Stake
 		if _, exist := walletState.Staking[request.RoundSince]; !exist {
 			// If it's not waiting for such this request, then we can assume the stake is done. So set
 			// the state to 'verified'
-			interactor.stakeRepository.SetVerified(request.Hash, time.Now())
+			interactor.stakeRepository.SetVerified(request.Hash, request.MsgIndex, time.Now())
 		} else {
 			// If the wallet is still waiting for such this request, it must filed to be done. So set
 			// the state to 'retriable'.
-			interactor.stakeRepository.SetState(request.Hash, domain.RequestStateRetriable)
+			interactor.stakeRepository.SetState(request.Hash, request.MsgIndex, domain.RequestStateRetriable)
 		}
 	}
 
 	return nil
 }
 
-func (interactor *VerifyInteractor) VerifyUnstakeRequests(requests []*domain.UnstakeRequest) error {
+func (interactor *VerifyInteractor) VerifyUnstakeRequests(ctx context.Context, requests []*domain.UnstakeRequest) error {
 
 	for _, request := range requests {
+		// Leave the rest of requests for the next turn if the driver is stopping.
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
 		log.Printf("verifying unstake [wallet = %v]\n", request.Address)
 		accid, err := ton.AccountIDFromBase64Url(request.Address)
 		if err != nil {
@@ -97,7 +106,7 @@ func (interactor *VerifyInteractor) VerifyUnstakeRequests(requests []*domain.Uns
 		}
 
 		// Check the wallet to know if it is wating for a withdraw messages.
-		walletState, err := interactor.contractInteractor.GetWalletState(accid)
+		walletState, err := interactor.contractInteractor.GetWalletState(ctx, accid)
 		if err != nil {
 			exporter.IncErrorCount()
 			log.Printf("🔴 verifying unstake - getting wallet state - %v\n", err.Error())
@@ -0,0 +1,295 @@
+package usecase
+
+import (
+	"context"
+	"crypto/ed25519"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/tonkeeper/tongo"
+	"github.com/tonkeeper/tongo/boc"
+	"github.com/tonkeeper/tongo/tlb"
+	"github.com/tonkeeper/tongo/ton"
+	tgwallet "github.com/tonkeeper/tongo/wallet"
+)
+
+const (
+	// MaxMessagesPerTransfer is the number of internal messages a V4R2 wallet can send by a single external message.
+	MaxMessagesPerTransfer = 4
+
+	// MaxMessagesPerHighloadTransfer is the number of internal messages a highload wallet can send by a single
+	// external message.
+	MaxMessagesPerHighloadTransfer = 254
+
+	// MaxHighloadTransfersInFlight is the number of highload transfers waiting to be processed at the same time.
+	MaxHighloadTransfersInFlight = 16
+)
+
+// transferLifetime is how long a transfer is accepted by the wallet contract. It is kept short, so a transfer
+// which is lost can be told apart from a slow one soon, and its messages can be sent again.
+const transferLifetime = 1 * time.Minute
+
+// DriverWallet sends internal messages on behalf of the driver. A transfer is prepared first, so it can be
+// recorded before being sent, and traced later, even by another run of the driver.
+type DriverWallet interface {
+	GetAddress() tongo.AccountID
+
+	// MaxMessages is the number of internal messages that can be sent by a single transfer.
+	MaxMessages() int
+
+	// MaxInFlight is the number of transfers that can be sent before the previous ones are processed.
+	MaxInFlight() int
+
+	// Prepare builds and signs a transfer of the messages, without sending it.
+	Prepare(ctx context.Context, messages []tgwallet.RawMessage) (*Transfer, error)
+
+	// Send broadcasts a prepared transfer. Sending the same transfer again is harmless.
+	Send(ctx context.Context, transfer *Transfer) error
+}
+
+// Transfer is an external message of the driver wallet. Id is the seqno or the query id which the wallet
+// contract accepts only once, and Hash is the hash of the external message, by which the wallet transaction
+// processing it is found.
+type Transfer struct {
+	Id         uint64
+	Hash       string
+	ValidUntil time.Time
+	Payload    []byte
+}
+
+// signTransfer signs the body of a wallet message and wraps it in an external message to the wallet. It returns
+// the serialized external message along with its hash.
+func signTransfer(key ed25519.PrivateKey, address tongo.AccountID, body *boc.Cell, init *tlb.StateInit) ([]byte, string, error) {
+	signature, err := body.Sign(key)
+	if err != nil {
+		return nil, "", err
+	}
+	signedBody := tgwallet.SignedMsgBody{Message: tlb.Any(*body)}
+	copy(signedBody.Sign[:], signature)
+	signedBodyCell := boc.NewCell()
+	err = tlb.Marshal(signedBodyCell, signedBody)
+	if err != nil {
+		return nil, "", err
+	}
+
+	extMsg, err := ton.CreateExternalMessage(address, signedBodyCell, init, 0)
+	if err != nil {
+		return nil, "", err
+	}
+	extMsgCell := boc.NewCell()
+	err = tlb.Marshal(extMsgCell, extMsg)
+	if err != nil {
+		return nil, "", err
+	}
+
+	hash, err := extMsgCell.Hash256()
+	if err != nil {
+		return nil, "", err
+	}
+	payload, err := extMsgCell.ToBocCustom(false, false, false, 0)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return payload, tongo.Bits256(hash).Hex(), nil
+}
+
+// stateInit returns the state init of the wallet if it's not deployed yet, as the first transfer deploys it.
+func stateInit(ctx context.Context, client ChainClient, key ed25519.PrivateKey, address tongo.AccountID, version tgwallet.Version) (*tlb.StateInit, error) {
+	state, err := client.GetAccountState(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	if state.Account.Status() != tlb.AccountUninit && state.Account.Status() != tlb.AccountNone {
+		return nil, nil
+	}
+
+	init, err := tgwallet.GenerateStateInit(key.Public().(ed25519.PublicKey), version, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &init, nil
+}
+
+//-------------------------------------------------------------------
+// Seqno based wallet
+
+// SeqnoWallet sends through a seqno based wallet like V4R2. Transfers must be processed one by one, as each
+// one carries the seqno the wallet expects next.
+type SeqnoWallet struct {
+	client      ChainClient
+	key         ed25519.PrivateKey
+	address     tongo.AccountID
+	subWalletId uint32
+}
+
+func NewSeqnoWallet(client ChainClient, key ed25519.PrivateKey) (*SeqnoWallet, error) {
+	// Only the address is taken, the messages are built here, so the seqno of each transfer is known.
+	wallet, err := tgwallet.New(key, tgwallet.V4R2, 0, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SeqnoWallet{
+		client:      client,
+		key:         key,
+		address:     wallet.GetAddress(),
+		subWalletId: uint32(tgwallet.DefaultSubWallet),
+	}, nil
+}
+
+func (w *SeqnoWallet) GetAddress() tongo.AccountID {
+	return w.address
+}
+
+func (w *SeqnoWallet) MaxMessages() int {
+	return MaxMessagesPerTransfer
+}
+
+func (w *SeqnoWallet) MaxInFlight() int {
+	return 1
+}
+
+func (w *SeqnoWallet) Prepare(ctx context.Context, messages []tgwallet.RawMessage) (*Transfer, error) {
+	init, err := stateInit(ctx, w.client, w.key, w.address, tgwallet.V4R2)
+	if err != nil {
+		return nil, err
+	}
+
+	var seqno uint32
+	if init == nil {
+		seqno, err = w.client.GetSeqno(ctx, w.address)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	validUntil := time.Now().Add(transferLifetime)
+
+	bodyCell := boc.NewCell()
+	err = tlb.Marshal(bodyCell, tgwallet.MessageV4{
+		SubWalletId: w.subWalletId,
+		ValidUntil:  uint32(validUntil.Unix()),
+		Seqno:       seqno,
+		Op:          0,
+		RawMessages: tgwallet.PayloadV1toV4(messages),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	payload, hash, err := signTransfer(w.key, w.address, bodyCell, init)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Transfer{
+		Id:         uint64(seqno),
+		Hash:       hash,
+		ValidUntil: validUntil,
+		Payload:    payload,
+	}, nil
+}
+
+func (w *SeqnoWallet) Send(ctx context.Context, transfer *Transfer) error {
+	_, err := w.client.SendMessage(ctx, transfer.Payload)
+	return err
+}
+
+//-------------------------------------------------------------------
+// Highload wallet
+
+// HighloadWallet sends through a highload-wallet v2 contract. Transfers are identified by query ids instead of
+// a seqno, so they don't need to wait for each other, and each one carries up to 254 messages.
+type HighloadWallet struct {
+	client      ChainClient
+	key         ed25519.PrivateKey
+	address     tongo.AccountID
+	subWalletId uint32
+
+	mutex          sync.Mutex
+	lastValidUntil uint32
+	lastQueryId    uint32
+}
+
+func NewHighloadWallet(client ChainClient, key ed25519.PrivateKey) (*HighloadWallet, error) {
+	// Only the address is taken, the messages are built here, so the query ids are under control.
+	wallet, err := tgwallet.New(key, tgwallet.HighLoadV2R2, 0, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &HighloadWallet{
+		client:      client,
+		key:         key,
+		address:     wallet.GetAddress(),
+		subWalletId: uint32(tgwallet.DefaultSubWallet),
+	}, nil
+}
+
+func (w *HighloadWallet) GetAddress() tongo.AccountID {
+	return w.address
+}
+
+func (w *HighloadWallet) MaxMessages() int {
+	return MaxMessagesPerHighloadTransfer
+}
+
+func (w *HighloadWallet) MaxInFlight() int {
+	return MaxHighloadTransfersInFlight
+}
+
+func (w *HighloadWallet) Prepare(ctx context.Context, messages []tgwallet.RawMessage) (*Transfer, error) {
+	init, err := stateInit(ctx, w.client, w.key, w.address, tgwallet.HighLoadV2R2)
+	if err != nil {
+		return nil, err
+	}
+
+	validUntil := time.Now().Add(transferLifetime)
+	queryId := w.nextQueryId(validUntil)
+
+	bodyCell := boc.NewCell()
+	err = tlb.Marshal(bodyCell, tgwallet.HighloadV2Message{
+		SubWalletId:    w.subWalletId,
+		BoundedQueryID: queryId,
+		RawMessages:    tgwallet.PayloadHighload(messages),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	payload, hash, err := signTransfer(w.key, w.address, bodyCell, init)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Transfer{
+		Id:         queryId,
+		Hash:       hash,
+		ValidUntil: validUntil,
+		Payload:    payload,
+	}, nil
+}
+
+func (w *HighloadWallet) Send(ctx context.Context, transfer *Transfer) error {
+	_, err := w.client.SendMessage(ctx, transfer.Payload)
+	return err
+}
+
+// nextQueryId allocates a query id. The higher 32 bits of a query id are the time until which the contract
+// accepts it, and the lower 32 bits make it unique among the ones with the same time.
+func (w *HighloadWallet) nextQueryId(validUntil time.Time) uint64 {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	until := uint32(validUntil.Unix())
+	if until != w.lastValidUntil {
+		// Start from a random point, so ids of a previous run in the same second are not reused.
+		w.lastValidUntil = until
+		w.lastQueryId = rand.Uint32() >> 1
+	}
+	w.lastQueryId++
+
+	return uint64(until)<<32 + uint64(w.lastQueryId)
+}
@@ -0,0 +1,111 @@
+package usecase_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"driver/domain/config"
+	"driver/infrastructure/simulator"
+	"driver/usecase"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tonkeeper/tongo/boc"
+	"github.com/tonkeeper/tongo/tlb"
+	tgwallet "github.com/tonkeeper/tongo/wallet"
+)
+
+// TestHighloadQueryIds checks that the query ids of highload transfers are unique, also across a restart, and that
+// each one carries the time it's valid until, so it can't be allocated again before it expires.
+func TestHighloadQueryIds(t *testing.T) {
+	ctx := context.Background()
+	_, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallet, err := usecase.NewHighloadWallet(nil, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim := simulator.NewSimulator(config.GetTreasuryAccountId(), wallet.GetAddress())
+	sim.UseHighloadDriver()
+
+	// Cells are read with cursors, so each transfer gets messages of its own.
+	messages := func() []tgwallet.RawMessage {
+		msg, mode, err := tgwallet.Message{Amount: 1_000_000, Address: testAccount(2, 0)}.ToInternal()
+		if err != nil {
+			t.Error(err)
+			return nil
+		}
+		cell := boc.NewCell()
+		err = tlb.Marshal(cell, msg)
+		if err != nil {
+			t.Error(err)
+			return nil
+		}
+		return []tgwallet.RawMessage{{Message: cell, Mode: mode}}
+	}
+
+	// The second wallet is the same one after a restart, preparing transfers in the same seconds.
+	wallets := make([]*usecase.HighloadWallet, 2)
+	for i := range wallets {
+		wallets[i], err = usecase.NewHighloadWallet(sim, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	start := time.Now()
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	transfers := make([]*usecase.Transfer, 0, 400)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(w *usecase.HighloadWallet) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				transfer, err := w.Prepare(ctx, messages())
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				mutex.Lock()
+				transfers = append(transfers, transfer)
+				mutex.Unlock()
+			}
+		}(wallets[i%2])
+	}
+	wg.Wait()
+	if t.Failed() {
+		return
+	}
+
+	seen := make(map[uint64]bool, len(transfers))
+	for _, transfer := range transfers {
+		if seen[transfer.Id] {
+			t.Fatalf("query id %v is allocated twice", transfer.Id)
+		}
+		seen[transfer.Id] = true
+
+		until := transfer.Id >> 32
+		if until != uint64(transfer.ValidUntil.Unix()) || !transfer.ValidUntil.After(start) {
+			t.Fatalf("query id %v is valid until %v, want it to carry the future valid until of its transfer %v",
+				transfer.Id, until, transfer.ValidUntil.Unix())
+		}
+	}
+
+	// The contract accepts a query once while it's valid.
+	err = wallets[0].Send(ctx, transfers[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wallets[1].Send(ctx, transfers[0])
+	if !errors.Is(err, simulator.ErrorQueryProcessed) {
+		t.Fatalf("sending a processed query again returned %v, want ErrorQueryProcessed", err)
+	}
+	err = wallets[1].Send(ctx, transfers[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+}